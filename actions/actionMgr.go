@@ -36,6 +36,8 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync"
+	"time"
 	"utils/logging"
 )
 
@@ -56,7 +58,8 @@ type ActionMgr struct {
 	logger           *logging.Writer
 	paramsDir        string
 	dbHdl            *objects.DbHandler
-	ObjHdlMap        map[string]ActionObjInfo
+	hdlMutex         sync.RWMutex
+	objHdlMap        map[string]ActionObjInfo
 	clientMgr        *clients.ClientMgr
 	objectMgr        *objects.ObjectMgr
 	applyConfigOrder []string
@@ -142,7 +145,7 @@ func InitializeActionMgr(paramsDir string, infoFiles []string, logger *logging.W
 func (mgr *ActionMgr) InitializeActionObjectHandles(infoFiles []string) bool {
 	var actionMap map[string]ActionObjJson
 
-	mgr.ObjHdlMap = make(map[string]ActionObjInfo)
+	objHdlMap := make(map[string]ActionObjInfo)
 	for _, objFile := range infoFiles {
 		bytes, err := ioutil.ReadFile(objFile)
 		if err != nil {
@@ -160,14 +163,34 @@ func (mgr *ActionMgr) InitializeActionObjectHandles(infoFiles []string) bool {
 			key := strings.ToLower(k)
 			entry := new(ActionObjInfo)
 			if mgr.clientMgr != nil {
-				entry.Owner = mgr.clientMgr.Clients[v.Owner]
+				entry.Owner, _ = mgr.clientMgr.GetClient(v.Owner)
 			}
-			mgr.ObjHdlMap[key] = *entry
+			objHdlMap[key] = *entry
 		}
 	}
+	mgr.hdlMutex.Lock()
+	mgr.objHdlMap = objHdlMap
+	mgr.hdlMutex.Unlock()
 	return true
 }
 
+//
+// The map and the config order are replaced, never modified, on reload, so
+// they can be read without locking once returned. Callers must not modify
+// them.
+//
+func (mgr *ActionMgr) GetActionObjHdlMap() map[string]ActionObjInfo {
+	mgr.hdlMutex.RLock()
+	defer mgr.hdlMutex.RUnlock()
+	return mgr.objHdlMap
+}
+
+func (mgr *ActionMgr) getApplyConfigOrder() []string {
+	mgr.hdlMutex.RLock()
+	defer mgr.hdlMutex.RUnlock()
+	return mgr.applyConfigOrder
+}
+
 func (mgr *ActionMgr) ReadConfigOrder() error {
 	var configOrder ConfigOrder
 	bytes, err := ioutil.ReadFile(mgr.paramsDir + "/configOrder.json")
@@ -180,9 +203,13 @@ func (mgr *ActionMgr) ReadConfigOrder() error {
 		mgr.logger.Err("Error in unmarshaling data from configOrder.json")
 		return err
 	}
+	applyConfigOrder := make([]string, 0, len(configOrder.Order))
 	for _, objName := range configOrder.Order {
-		mgr.applyConfigOrder = append(mgr.applyConfigOrder, objName)
+		applyConfigOrder = append(applyConfigOrder, objName)
 	}
+	mgr.hdlMutex.Lock()
+	mgr.applyConfigOrder = applyConfigOrder
+	mgr.hdlMutex.Unlock()
 	return nil
 }
 
@@ -248,16 +275,12 @@ func CreateConfig(resource string, body json.RawMessage) {
 				gActionMgr.logger.Debug("errcode not success, return")
 				return
 			}
-			if gActionMgr.objectMgr.ObjHdlMap == nil {
-				gActionMgr.logger.Debug("objHdlMap nil")
-				return
-			}
-			_, ok = gActionMgr.objectMgr.ObjHdlMap[strings.ToLower(resource)]
+			objInfo, ok := gActionMgr.objectMgr.GetConfigObjHdlMap()[strings.ToLower(resource)]
 			if !ok {
 				gActionMgr.logger.Debug("objhdlmap for resource:", resource, " nil")
 				return
 			}
-			resourceOwner := gActionMgr.objectMgr.ObjHdlMap[strings.ToLower(resource)].Owner
+			resourceOwner := objInfo.Owner
 			if resourceOwner.IsConnectedToServer() == false {
 				gActionMgr.logger.Debug("Not connected to resourceOwner:", resourceOwner)
 				return
@@ -265,6 +288,7 @@ func CreateConfig(resource string, body json.RawMessage) {
 			gActionMgr.logger.Debug("Create:", resource, " resourceOwner:", resourceOwner, " obj:", obj)
 			err, success = resourceOwner.CreateObject(obj, gActionMgr.dbHdl.DBUtil)
 			if err == nil && success == true {
+				gActionMgr.objectMgr.ObjectChanged(strings.ToLower(resource), clients.OBJECT_CHANGE_CREATE, nil, obj)
 				_, dbErr := gActionMgr.dbHdl.StoreUUIDToObjKeyMap(objKey)
 				if dbErr == nil {
 					errCode = SRSuccess
@@ -318,13 +342,14 @@ func UpdateConfig(resource string, body json.RawMessage) {
 			mergedObj, _ := obj.MergeDbAndConfigObj(dbObj, diff)
 			mergedObjKey := mergedObj.GetKey()
 			if objKey == mergedObjKey {
-				resourceOwner := gActionMgr.objectMgr.ObjHdlMap[strings.ToLower(resource)].Owner
+				resourceOwner := gActionMgr.objectMgr.GetConfigObjHdlMap()[strings.ToLower(resource)].Owner
 				if resourceOwner.IsConnectedToServer() == false {
 					return
 				}
 
 				err, success = resourceOwner.UpdateObject(dbObj, mergedObj, diff, nil, objKey, gActionMgr.dbHdl.DBUtil)
 				if err == nil && success == true {
+					gActionMgr.objectMgr.ObjectChanged(strings.ToLower(resource), clients.OBJECT_CHANGE_UPDATE, dbObj, mergedObj)
 					_, dbErr := gActionMgr.dbHdl.StoreUUIDToObjKeyMap(objKey)
 					if dbErr == nil {
 					} else {
@@ -344,7 +369,7 @@ func UpdateConfig(resource string, body json.RawMessage) {
 }
 
 func DeleteConfig(resource string) {
-	objMap, ok := gActionMgr.objectMgr.ObjHdlMap[strings.ToLower(resource)]
+	objMap, ok := gActionMgr.objectMgr.GetConfigObjHdlMap()[strings.ToLower(resource)]
 	if !ok {
 		gActionMgr.logger.Debug("Object ", resource, " doesnt exist in ObjHdlMap")
 		return
@@ -375,6 +400,7 @@ func DeleteConfig(resource string) {
 					err, success := objMap.Owner.DeleteObject(obj, objKey, gActionMgr.dbHdl.DBUtil)
 					if err == nil && success == true {
 						gActionMgr.logger.Debug("Delete UUID to objectKeyMap")
+						gActionMgr.objectMgr.ObjectChanged(strings.ToLower(resource), clients.OBJECT_CHANGE_DELETE, obj, nil)
 						uuid, er := gActionMgr.dbHdl.GetUUIDFromObjKey(objKey)
 						if er == nil {
 							err = gActionMgr.dbHdl.DeleteUUIDToObjKeyMap(uuid, objKey)
@@ -400,6 +426,8 @@ func DeleteConfig(resource string) {
 							err, success := objMap.Owner.UpdateObject(obj, defaultObj, diff, nil, objKey, gActionMgr.dbHdl.DBUtil)
 							if success == false {
 								gActionMgr.logger.Err("DeleteConfig: failed to update to default " + objKey + " Error: " + err.Error())
+							} else {
+								gActionMgr.objectMgr.ObjectChanged(strings.ToLower(resource), clients.OBJECT_CHANGE_UPDATE, obj, defaultObj)
 							}
 						}
 					}
@@ -409,8 +437,12 @@ func DeleteConfig(resource string) {
 	}
 }
 
-func ApplyConfigObject(data modelActions.ApplyConfig) {
-	for _, applyResource := range gActionMgr.applyConfigOrder {
+func ApplyConfigObject(data modelActions.ApplyConfig) error {
+	if err := objects.MigrateConfigData(data.ConfigData, int(data.ModelVersion)); err != nil {
+		gActionMgr.logger.Err("ApplyConfig:", err)
+		return err
+	}
+	for _, applyResource := range gActionMgr.getApplyConfigOrder() {
 		for key, value := range data.ConfigData {
 			if applyResource != key {
 				continue
@@ -423,11 +455,17 @@ func ApplyConfigObject(data modelActions.ApplyConfig) {
 			}
 		}
 	}
+	return nil
 }
 
-func ForceApplyConfigObject(data modelActions.ForceApplyConfig) {
+func ForceApplyConfigObject(data modelActions.ForceApplyConfig) error {
+	if err := objects.MigrateConfigData(data.ConfigData, int(data.ModelVersion)); err != nil {
+		gActionMgr.logger.Err("ForceApplyConfig:", err)
+		return err
+	}
 	appliedConfigs := make(map[string]bool)
-	for _, applyResource := range gActionMgr.applyConfigOrder {
+	applyConfigOrder := gActionMgr.getApplyConfigOrder()
+	for _, applyResource := range applyConfigOrder {
 		for key, value := range data.ConfigData {
 			if applyResource != key {
 				continue
@@ -441,13 +479,14 @@ func ForceApplyConfigObject(data modelActions.ForceApplyConfig) {
 			}
 		}
 	}
-	for index := len(gActionMgr.applyConfigOrder) - 1; index >= 0; index-- {
-		objName := gActionMgr.applyConfigOrder[index]
+	for index := len(applyConfigOrder) - 1; index >= 0; index-- {
+		objName := applyConfigOrder[index]
 		if appliedConfigs[objName] != true {
 			gActionMgr.logger.Debug("Reset configs for:", objName)
 			DeleteConfig(objName)
 		}
 	}
+	return nil
 }
 
 func SaveConfigObject(data modelActions.SaveConfigObj, resource string) error {
@@ -486,8 +525,9 @@ func SaveConfigObject(data modelActions.SaveConfigObj, resource string) error {
 
 func ResetConfigObject(data modelActions.ResetConfig) (err error) {
 	gActionMgr.logger.Debug("Start config reset")
-	for index := len(gActionMgr.applyConfigOrder) - 1; index >= 0; index-- {
-		objName := gActionMgr.applyConfigOrder[index]
+	applyConfigOrder := gActionMgr.getApplyConfigOrder()
+	for index := len(applyConfigOrder) - 1; index >= 0; index-- {
+		objName := applyConfigOrder[index]
 		gActionMgr.logger.Debug("Reset configs for:", objName)
 		DeleteConfig(objName)
 	}
@@ -519,6 +559,24 @@ func OpenConfigFile(cfgFileName string) (fo *os.File, err error) {
 	return fo, err
 }
 
+//
+// Full path of a file named in an action. Relative names are taken from the
+// directory above params and a .json suffix is added if missing.
+//
+func GetConfigFileName(fileName, defaultName string) string {
+	if fileName == "" {
+		gActionMgr.logger.Debug("FileName not set, setting it to default", defaultName)
+		fileName = defaultName
+	}
+	if !strings.HasPrefix(fileName, "/") {
+		fileName = gActionMgr.paramsDir + "../" + fileName
+	}
+	if !strings.HasSuffix(fileName, ".json") {
+		fileName = fileName + ".json"
+	}
+	return fileName
+}
+
 func ExecuteConfigurationAction(obj modelActions.ActionObj) (err error) {
 	gActionMgr.logger.Debug("local client Execute action obj: ", obj)
 	if gActionMgr == nil {
@@ -529,29 +587,18 @@ func ExecuteConfigurationAction(obj modelActions.ActionObj) (err error) {
 	case modelActions.ApplyConfig:
 		gActionMgr.logger.Debug("ApplyConfig")
 		data := obj.(modelActions.ApplyConfig)
-		ApplyConfigObject(data)
+		err = ApplyConfigObject(data)
 	case modelActions.ForceApplyConfig:
 		gActionMgr.logger.Debug("ForceApplyConfig")
 		data := obj.(modelActions.ForceApplyConfig)
-		ForceApplyConfigObject(data)
+		err = ForceApplyConfigObject(data)
 	case modelActions.SaveConfig:
 		gActionMgr.logger.Debug("SaveConfig")
 		var fo *os.File
 		var err error
 		data := obj.(modelActions.SaveConfig)
-		fileName := data.FileName
+		fileName := GetConfigFileName(data.FileName, "startup-config.json")
 		gActionMgr.logger.Debug("FileName:", fileName)
-		if fileName == "" {
-			gActionMgr.logger.Debug("FileName not set, setting it to default startup-config")
-			fileName = gActionMgr.paramsDir + "../" + "startup-config.json"
-		} else {
-			if !strings.HasPrefix(fileName, "/") {
-				fileName = gActionMgr.paramsDir + "../" + fileName
-			}
-		}
-		if !strings.HasSuffix(fileName, ".json") {
-			fileName = fileName + ".json"
-		}
 		// open config file
 		fo, err = OpenConfigFile(fileName)
 		if err != nil {
@@ -566,7 +613,8 @@ func ExecuteConfigurationAction(obj modelActions.ActionObj) (err error) {
 		}()
 		var wdata modelActions.SaveConfigObj
 		wdata.ConfigData = make(map[string][]interface{})
-		for _, applyResource := range gActionMgr.applyConfigOrder {
+		wdata.ModelVersion = int32(objects.MODEL_VERSION)
+		for _, applyResource := range gActionMgr.getApplyConfigOrder() {
 			SaveConfigObject(wdata, applyResource)
 		}
 		js, err := json.MarshalIndent(wdata, "", "    ")
@@ -585,6 +633,64 @@ func ExecuteConfigurationAction(obj modelActions.ActionObj) (err error) {
 		gActionMgr.logger.Debug("Action resolved as ResetConfig")
 		data := obj.(modelActions.ResetConfig)
 		ResetConfigObject(data)
+	case modelActions.CheckDbIntegrity:
+		data := obj.(modelActions.CheckDbIntegrity)
+		err = CheckDbIntegrityObject(data)
+	case modelActions.BackupDatabase:
+		data := obj.(modelActions.BackupDatabase)
+		err = BackupDatabaseObject(data)
+	case modelActions.RestoreDatabase:
+		data := obj.(modelActions.RestoreDatabase)
+		err = RestoreDatabaseObject(data)
+	case modelActions.PurgeEvents:
+		data := obj.(modelActions.PurgeEvents)
+		err = PurgeEventsObject(data)
+	case modelActions.VerifyConfigLog:
+		data := obj.(modelActions.VerifyConfigLog)
+		err = VerifyConfigLogObject(data)
+	}
+	return err
+}
+
+//
+// Run the UUID map integrity check and store the result as the
+// DbIntegrityState object. At most MAX_INTEGRITY_ISSUES issues are listed.
+//
+const (
+	DB_INTEGRITY_STATE_NAME = "UUIDMap"
+	MAX_INTEGRITY_ISSUES    = 100
+)
+
+func CheckDbIntegrityObject(data modelActions.CheckDbIntegrity) error {
+	report, err := gActionMgr.objectMgr.CheckUUIDMaps(data.Repair)
+	if err != nil {
+		gActionMgr.logger.Err("UUID map integrity check failed:", err)
+		return err
+	}
+	state := modelObjs.DbIntegrityState{
+		Name:               DB_INTEGRITY_STATE_NAME,
+		LastRun:            time.Now().Format(time.RFC3339),
+		Repair:             data.Repair,
+		ObjectsChecked:     int32(report.ObjectsChecked),
+		UUIDsChecked:       int32(report.UUIDsChecked),
+		ObjectsWithoutUUID: int32(report.Count(objects.INTEGRITY_OBJ_WITHOUT_UUID)),
+		UUIDsWithoutObject: int32(report.Count(objects.INTEGRITY_UUID_WITHOUT_OBJ)),
+		Mismatched:         int32(report.Count(objects.INTEGRITY_MISMATCHED_ENTRY)),
+		Repaired:           int32(report.Repaired()),
+		RepairFailed:       int32(report.RepairFailed),
+	}
+	for idx, issue := range report.Issues {
+		if idx == MAX_INTEGRITY_ISSUES {
+			break
+		}
+		state.Issues = append(state.Issues, issue.String())
+	}
+	gActionMgr.dbHdl.DeleteObjectFromDb(state)
+	if err = gActionMgr.dbHdl.StoreObjectInDb(state); err != nil {
+		gActionMgr.logger.Err("Failed to store integrity check result:", err)
+	}
+	if report.RepairFailed > 0 {
+		return errors.New(fmt.Sprintln("Failed to repair", report.RepairFailed, "UUID map issues"))
 	}
 	return err
 }
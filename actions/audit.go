@@ -0,0 +1,75 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package actions
+
+import (
+	"config/audit"
+	"errors"
+	"fmt"
+	modelActions "models/actions"
+	modelObjs "models/objects"
+	"time"
+)
+
+const CONFIG_LOG_INTEGRITY_STATE_NAME = "ConfigLog"
+
+//
+// VerifyConfigLog checks the hash chain of the stored ConfigLog against its
+// signed checkpoints and stores the result as the ConfigLogIntegrityState
+// object. The action fails with the first broken link.
+//
+func VerifyConfigLogObject(data modelActions.VerifyConfigLog) error {
+	auditMgr := audit.GetAuditMgr()
+	if auditMgr == nil {
+		return errors.New("No audit log")
+	}
+	report, err := auditMgr.Verify()
+	if err != nil {
+		gActionMgr.logger.Err("ConfigLog verification failed:", err)
+		return err
+	}
+	state := modelObjs.ConfigLogIntegrityState{
+		Name:           CONFIG_LOG_INTEGRITY_STATE_NAME,
+		LastRun:        time.Now().Format(time.RFC3339),
+		Verified:       report.Verified(),
+		EntriesChecked: int32(report.EntriesChecked),
+		Unchained:      int32(report.Unchained),
+		FirstSeqNum:    report.FirstSeqNum,
+		LastSeqNum:     report.LastSeqNum,
+		HeadSeqNum:     report.HeadSeqNum,
+		HeadTime:       report.HeadTime,
+		BrokenSeqNum:   report.BrokenSeqNum,
+		Issue:          report.Issue,
+	}
+	gActionMgr.dbHdl.DeleteObjectFromDb(state)
+	if err = gActionMgr.dbHdl.StoreObjectInDb(state); err != nil {
+		gActionMgr.logger.Err("Failed to store ConfigLog verification result:", err)
+	}
+	if !report.Verified() {
+		gActionMgr.logger.Err("ConfigLog chain broken at", report.BrokenSeqNum, report.Issue)
+		return errors.New(fmt.Sprintln("ConfigLog chain broken at SeqNum", report.BrokenSeqNum, ":", report.Issue))
+	}
+	gActionMgr.logger.Info("Verified", report.EntriesChecked, "ConfigLog entries")
+	return err
+}
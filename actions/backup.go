@@ -0,0 +1,237 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package actions
+
+import (
+	"config/audit"
+	"config/objects"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	modelActions "models/actions"
+	modelObjs "models/objects"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+//
+// A database archive holds every config object with its ObjectId and
+// default object, and the ConfigLog with its anchor and signed head
+// checkpoints. BackupDatabase writes it and RestoreDatabase replays it to
+// the daemons through the same path as ApplyConfig, then puts back the
+// ObjectIds and the ConfigLog.
+//
+const (
+	DB_ARCHIVE_VERSION      = 1
+	DB_ARCHIVE_DEFAULT_FILE = "confd-backup.json"
+)
+
+type DbArchiveObject struct {
+	ObjectType string          `json:"ObjectType"`
+	ObjectId   string          `json:"ObjectId"`
+	Object     json.RawMessage `json:"Object"`
+	Default    json.RawMessage `json:"Default,omitempty"`
+}
+
+type DbArchive struct {
+	Version         int                        `json:"Version"`
+	ModelVersion    int                        `json:"ModelVersion"`
+	Created         string                     `json:"Created"`
+	Objects         []DbArchiveObject          `json:"Objects"`
+	ConfigLog       []modelObjs.ConfigLogState `json:"ConfigLog"`
+	ConfigLogAnchor *audit.Checkpoint          `json:"ConfigLogAnchor,omitempty"`
+	ConfigLogHead   *audit.Checkpoint          `json:"ConfigLogHead,omitempty"`
+}
+
+type configLogBySeqNum []modelObjs.ConfigLogState
+
+func (l configLogBySeqNum) Len() int           { return len(l) }
+func (l configLogBySeqNum) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l configLogBySeqNum) Less(i, j int) bool { return l[i].SeqNum < l[j].SeqNum }
+
+// Writable object types, in config order followed by the rest by name
+func getArchiveObjectTypes() []string {
+	objHdlMap := gActionMgr.objectMgr.GetConfigObjHdlMap()
+	objTypes := make([]string, 0, len(objHdlMap))
+	ordered := make(map[string]bool)
+	for _, objType := range gActionMgr.getApplyConfigOrder() {
+		objTypes = append(objTypes, objType)
+		ordered[strings.ToLower(objType)] = true
+	}
+	var others []string
+	for objType, objInfo := range objHdlMap {
+		if !ordered[objType] && strings.Contains(objInfo.Access, "w") {
+			others = append(others, objType)
+		}
+	}
+	sort.Strings(others)
+	return append(objTypes, others...)
+}
+
+func BackupDatabaseObject(data modelActions.BackupDatabase) error {
+	dbHdl := gActionMgr.dbHdl
+	archive := DbArchive{
+		Version:      DB_ARCHIVE_VERSION,
+		ModelVersion: objects.MODEL_VERSION,
+		Created:      time.Now().Format(time.RFC3339),
+	}
+	for _, objType := range getArchiveObjectTypes() {
+		objHdl, ok := modelObjs.ConfigObjectMap[strings.ToLower(objType)]
+		if !ok {
+			continue
+		}
+		_, obj, err := objects.GetConfigObjFromJsonData(nil, objHdl)
+		if err != nil {
+			continue
+		}
+		dbObjs, err := dbHdl.GetAllObjFromDb(obj)
+		if err != nil {
+			gActionMgr.logger.Err("Backup failed to read", objType, err)
+			return err
+		}
+		for _, dbObj := range dbObjs {
+			objKey := dbObj.GetKey()
+			entry := DbArchiveObject{ObjectType: objType}
+			if entry.Object, err = json.Marshal(dbObj); err != nil {
+				return err
+			}
+			entry.ObjectId, _ = dbHdl.GetUUIDFromObjKey(objKey)
+			if defaultObj, err := dbHdl.GetObjectFromDb(dbObj, objKey+"Default"); err == nil {
+				entry.Default, _ = json.Marshal(defaultObj)
+			}
+			archive.Objects = append(archive.Objects, entry)
+		}
+	}
+	if auditMgr := audit.GetAuditMgr(); auditMgr != nil {
+		var err error
+		archive.ConfigLog, archive.ConfigLogAnchor, archive.ConfigLogHead, err = auditMgr.Backup()
+		if err != nil {
+			gActionMgr.logger.Err("Backup failed to read the ConfigLog", err)
+			return err
+		}
+	} else if logObjs, err := dbHdl.GetAllObjFromDb(modelObjs.ConfigLogState{}); err == nil {
+		for _, logObj := range logObjs {
+			archive.ConfigLog = append(archive.ConfigLog, logObj.(modelObjs.ConfigLogState))
+		}
+		sort.Sort(configLogBySeqNum(archive.ConfigLog))
+	}
+	js, err := json.MarshalIndent(archive, "", "    ")
+	if err != nil {
+		gActionMgr.logger.Err("json marshal returned error: " + err.Error())
+		return err
+	}
+	fileName := GetConfigFileName(data.FileName, DB_ARCHIVE_DEFAULT_FILE)
+	tmpName := fileName + ".tmp"
+	if err = ioutil.WriteFile(tmpName, js, 0644); err == nil {
+		err = os.Rename(tmpName, fileName)
+	}
+	if err != nil {
+		gActionMgr.logger.Err("Failed to write backup", fileName, err)
+		return err
+	}
+	gActionMgr.logger.Info("Backed up", len(archive.Objects), "objects and", len(archive.ConfigLog),
+		"ConfigLog entries to", fileName)
+	return nil
+}
+
+func ReadDbArchive(fileName string) (*DbArchive, error) {
+	bytes, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var archive DbArchive
+	if err = json.Unmarshal(bytes, &archive); err != nil {
+		return nil, err
+	}
+	if archive.Version < 1 || archive.Version > DB_ARCHIVE_VERSION {
+		return nil, errors.New(fmt.Sprintln("Unsupported backup version", archive.Version))
+	}
+	return &archive, nil
+}
+
+func RestoreDatabaseObject(data modelActions.RestoreDatabase) error {
+	dbHdl := gActionMgr.dbHdl
+	fileName := GetConfigFileName(data.FileName, DB_ARCHIVE_DEFAULT_FILE)
+	archive, err := ReadDbArchive(fileName)
+	if err != nil {
+		gActionMgr.logger.Err("Failed to read backup", fileName, err)
+		return err
+	}
+	gActionMgr.logger.Info("Restoring", len(archive.Objects), "objects from", fileName)
+	ResetConfigObject(modelActions.ResetConfig{})
+	failed := 0
+	for _, entry := range archive.Objects {
+		objHdl, ok := modelObjs.ConfigObjectMap[strings.ToLower(entry.ObjectType)]
+		if !ok {
+			gActionMgr.logger.Err("Restore skipped unknown object", entry.ObjectType)
+			failed++
+			continue
+		}
+		entry.Object, err = objects.MigrateJsonObject(entry.ObjectType, entry.Object, archive.ModelVersion)
+		if err == nil && len(entry.Default) > 0 {
+			entry.Default, err = objects.MigrateJsonObject(entry.ObjectType, entry.Default, archive.ModelVersion)
+		}
+		if err != nil {
+			gActionMgr.logger.Err("Restore failed to migrate", entry.ObjectType, err)
+			failed++
+			continue
+		}
+		obj, err := objHdl.UnmarshalObject(entry.Object)
+		if err != nil {
+			gActionMgr.logger.Err("Restore failed to unmarshal", entry.ObjectType, err)
+			failed++
+			continue
+		}
+		objKey := obj.GetKey()
+		CreateConfig(entry.ObjectType, entry.Object)
+		if _, err = dbHdl.GetObjectFromDb(obj, objKey); err != nil {
+			gActionMgr.logger.Err("Restore failed to apply", objKey)
+			failed++
+			continue
+		}
+		if entry.ObjectId != "" {
+			if err = dbHdl.SetObjectId(objKey, entry.ObjectId); err != nil {
+				gActionMgr.logger.Err("Restore failed to set ObjectId of", objKey, err)
+				failed++
+			}
+		}
+		if len(entry.Default) > 0 {
+			if defaultObj, err := objHdl.UnmarshalObject(entry.Default); err == nil {
+				dbHdl.StoreObjectDefaultInDb(defaultObj)
+			}
+		}
+	}
+	if auditMgr := audit.GetAuditMgr(); auditMgr != nil {
+		if err = auditMgr.Restore(archive.ConfigLog, archive.ConfigLogAnchor, archive.ConfigLogHead); err != nil {
+			gActionMgr.logger.Err("Restore failed to store the ConfigLog", err)
+		}
+	}
+	if failed > 0 {
+		return errors.New(fmt.Sprintln("Failed to restore", failed, "of", len(archive.Objects), "objects"))
+	}
+	return nil
+}
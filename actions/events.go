@@ -0,0 +1,65 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package actions
+
+import (
+	"config/objects"
+	"errors"
+	modelActions "models/actions"
+	"time"
+)
+
+//
+// PurgeEvents deletes the events logged before OlderThan, a duration such as
+// 168h or an RFC3339 time, and the oldest events beyond MaxEvents. Without
+// either it purges by the retention policy of systemProfile.json.
+//
+func PurgeEventsObject(data modelActions.PurgeEvents) error {
+	var before time.Time
+	if data.OlderThan != "" {
+		if age, err := time.ParseDuration(data.OlderThan); err == nil && age > 0 {
+			before = time.Now().Add(-age)
+		} else if before, err = time.Parse(time.RFC3339, data.OlderThan); err != nil {
+			return errors.New("Invalid OlderThan " + data.OlderThan)
+		}
+	}
+	if data.MaxEvents < 0 {
+		return errors.New("Invalid MaxEvents")
+	}
+	if before.IsZero() && data.MaxEvents == 0 {
+		retentionMgr := objects.GetEventRetentionMgr()
+		if retentionMgr == nil {
+			return errors.New("No event retention policy")
+		}
+		_, err := retentionMgr.Purge()
+		return err
+	}
+	purged, err := gActionMgr.dbHdl.PurgeEvents(before, int(data.MaxEvents))
+	if err != nil {
+		gActionMgr.logger.Err("Failed to purge events", err)
+		return err
+	}
+	gActionMgr.logger.Info("Purged", purged, "events")
+	return nil
+}
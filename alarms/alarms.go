@@ -0,0 +1,481 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package alarms
+
+import (
+	"config/clients"
+	"config/metrics"
+	"config/objects"
+	"encoding/json"
+	"errors"
+	"github.com/garyburd/redigo/redis"
+	modelObjs "models/objects"
+	"sort"
+	"sync"
+	"time"
+	"utils/logging"
+)
+
+//
+// The alarm engine evaluates the enabled AlarmRule objects against the
+// state objects of their daemons every ALARM_EVAL_INTERVAL. An alarm is
+// raised for each object for which the condition of a rule has held for
+// the duration of the rule, and cleared once it does not hold or the object
+// is gone. Raised and cleared alarms are AlarmState objects, and each
+// change is an Alarm event in the event store. Raised alarms are also kept
+// in the ALARM_RAISED_KEY hash, so that they stay raised over a restart and
+// are cleared with an event once their condition no longer holds.
+//
+const (
+	ALARM_EVAL_INTERVAL = 10 * time.Second
+	CLEARED_ALARMS_SIZE = 1024
+	ALARM_EVENT_TYPE    = "Alarm"
+	ALARM_RAISED_KEY    = "AlarmsRaised"
+
+	ALARM_STATE_RAISED  = "Raised"
+	ALARM_STATE_CLEARED = "Cleared"
+)
+
+var ErrReadOnly = errors.New("AlarmState is read only")
+
+type Alarm struct {
+	Rule        string
+	ObjectKey   string
+	Severity    string
+	Description string
+	Value       string
+	State       string
+	RaisedTime  time.Time
+	ClearedTime time.Time
+}
+
+type AlarmEvent struct {
+	Time        string `json:"Time"`
+	Rule        string `json:"Rule"`
+	ObjectKey   string `json:"ObjectKey"`
+	Severity    string `json:"Severity"`
+	State       string `json:"State"`
+	Value       string `json:"Value"`
+	Description string `json:"Description"`
+}
+
+// Evaluation state of a rule for one object
+type alarmInstance struct {
+	pendingSince time.Time
+	prev         *attrSample
+	alarm        *Alarm
+}
+
+type AlarmMgr struct {
+	logger    *logging.Writer
+	objectMgr *objects.ObjectMgr
+	dbHdl     *objects.DbHandler
+	mutex     sync.Mutex
+	rules     map[string]*alarmRule
+	instances map[string]map[string]*alarmInstance
+	cleared   []Alarm
+	stopCh    chan struct{}
+	wg        sync.WaitGroup
+}
+
+var activeAlarms = metrics.NewGaugeVec("confd_alarms_active", "Raised alarms by severity", "severity")
+
+//
+// Load the stored alarm rules, register the engine as handler of AlarmRule
+// and AlarmState objects and start evaluating. Stored rules which are no
+// longer valid are skipped.
+//
+func init() {
+	objects.RegisterConfdEventType(ALARM_EVENT_TYPE)
+}
+
+func InitializeAlarmMgr(logger *logging.Writer, objectMgr *objects.ObjectMgr, dbHdl *objects.DbHandler) *AlarmMgr {
+	mgr := new(AlarmMgr)
+	mgr.logger = logger
+	mgr.objectMgr = objectMgr
+	mgr.dbHdl = dbHdl
+	mgr.rules = make(map[string]*alarmRule)
+	mgr.instances = make(map[string]map[string]*alarmInstance)
+	mgr.stopCh = make(chan struct{})
+	cfgs, err := dbHdl.GetAllObjFromDb(modelObjs.AlarmRule{})
+	if err != nil {
+		logger.Err("Failed to read alarm rules", err)
+	}
+	for _, obj := range cfgs {
+		rule, err := newAlarmRule(obj.(modelObjs.AlarmRule))
+		if err != nil {
+			logger.Err("Skipping stored alarm rule", err)
+			continue
+		}
+		mgr.rules[rule.name] = rule
+	}
+	mgr.restoreRaised(time.Now())
+	clients.RegisterLocalObjectHandler("AlarmRule", mgr)
+	clients.RegisterLocalObjectHandler("AlarmState", mgr)
+	mgr.updateMetrics()
+	mgr.wg.Add(1)
+	go mgr.run()
+	return mgr
+}
+
+func (mgr *AlarmMgr) Stop() {
+	if mgr == nil {
+		return
+	}
+	close(mgr.stopCh)
+	mgr.wg.Wait()
+}
+
+func (mgr *AlarmMgr) run() {
+	defer mgr.wg.Done()
+	ticker := time.NewTicker(ALARM_EVAL_INTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-mgr.stopCh:
+			return
+		case <-ticker.C:
+			mgr.evaluate(time.Now())
+		}
+	}
+}
+
+func (mgr *AlarmMgr) getRuleResources() map[string]bool {
+	mgr.mutex.Lock()
+	defer mgr.mutex.Unlock()
+	resources := make(map[string]bool)
+	for _, rule := range mgr.rules {
+		if rule.enabled {
+			resources[rule.resource] = true
+		}
+	}
+	return resources
+}
+
+//
+// Poll each state type used by a rule once and evaluate its rules. Alarms
+// of a type whose poll fails are left as they are.
+//
+func (mgr *AlarmMgr) evaluate(now time.Time) {
+	for resource, _ := range mgr.getRuleResources() {
+		stateObjs, err := mgr.objectMgr.GetAllStateObjects(resource)
+		if err != nil {
+			mgr.logger.Debug("Alarm evaluation of", resource, "skipped", err)
+			continue
+		}
+		objMap := make(map[string]modelObjs.ConfigObj, len(stateObjs))
+		for _, obj := range stateObjs {
+			objMap[obj.GetKey()] = obj
+		}
+		mgr.mutex.Lock()
+		for _, rule := range mgr.rules {
+			if rule.enabled && rule.resource == resource {
+				mgr.evaluateRule(rule, objMap, now)
+			}
+		}
+		mgr.mutex.Unlock()
+	}
+	mgr.updateMetrics()
+}
+
+// Must be called with mutex held
+func (mgr *AlarmMgr) evaluateRule(rule *alarmRule, objMap map[string]modelObjs.ConfigObj, now time.Time) {
+	instances, exist := mgr.instances[rule.name]
+	if !exist {
+		instances = make(map[string]*alarmInstance)
+		mgr.instances[rule.name] = instances
+	}
+	for key, obj := range objMap {
+		instance, exist := instances[key]
+		if !exist {
+			instance = new(alarmInstance)
+			instances[key] = instance
+		}
+		matched, known, value, sample := rule.check(obj, instance.prev, now)
+		if rule.rate {
+			instance.prev = &sample
+		}
+		if !known {
+			continue
+		}
+		if !matched {
+			instance.pendingSince = time.Time{}
+			if instance.alarm != nil {
+				mgr.clearAlarm(instance, value, now)
+			}
+			continue
+		}
+		if instance.alarm != nil {
+			instance.alarm.Value = value
+			continue
+		}
+		if instance.pendingSince.IsZero() {
+			instance.pendingSince = now
+		}
+		if now.Sub(instance.pendingSince) >= rule.forDuration {
+			mgr.raiseAlarm(rule, key, instance, value, now)
+		}
+	}
+	for key, instance := range instances {
+		if _, exist := objMap[key]; !exist {
+			if instance.alarm != nil {
+				mgr.clearAlarm(instance, "", now)
+			}
+			delete(instances, key)
+		}
+	}
+}
+
+func (mgr *AlarmMgr) raiseAlarm(rule *alarmRule, key string, instance *alarmInstance, value string, now time.Time) {
+	instance.alarm = &Alarm{
+		Rule:        rule.name,
+		ObjectKey:   key,
+		Severity:    rule.severity,
+		Description: rule.description,
+		Value:       value,
+		State:       ALARM_STATE_RAISED,
+		RaisedTime:  now,
+	}
+	mgr.logger.Info("Alarm", rule.name, "raised for", key, "value", value)
+	mgr.storeRaised(*instance.alarm)
+	mgr.addEvent(*instance.alarm, now)
+}
+
+func (mgr *AlarmMgr) clearAlarm(instance *alarmInstance, value string, now time.Time) {
+	alarm := *instance.alarm
+	alarm.State = ALARM_STATE_CLEARED
+	alarm.ClearedTime = now
+	if value != "" {
+		alarm.Value = value
+	}
+	instance.alarm = nil
+	instance.pendingSince = time.Time{}
+	if len(mgr.cleared) >= CLEARED_ALARMS_SIZE {
+		mgr.cleared = mgr.cleared[1:]
+	}
+	mgr.cleared = append(mgr.cleared, alarm)
+	mgr.logger.Info("Alarm", alarm.Rule, "cleared for", alarm.ObjectKey)
+	mgr.removeRaised(alarm)
+	mgr.addEvent(alarm, now)
+}
+
+func raisedField(alarm Alarm) string {
+	return alarm.Rule + "#" + alarm.ObjectKey
+}
+
+func (mgr *AlarmMgr) storeRaised(alarm Alarm) {
+	data, err := json.Marshal(alarm)
+	if err == nil {
+		_, err = mgr.dbHdl.DoLocked("HSET", ALARM_RAISED_KEY, raisedField(alarm), data)
+	}
+	if err != nil {
+		mgr.logger.Err("Failed to store raised alarm", alarm.Rule, "for", alarm.ObjectKey, err)
+	}
+}
+
+func (mgr *AlarmMgr) removeRaised(alarm Alarm) {
+	if _, err := mgr.dbHdl.DoLocked("HDEL", ALARM_RAISED_KEY, raisedField(alarm)); err != nil {
+		mgr.logger.Err("Failed to remove raised alarm", alarm.Rule, "for", alarm.ObjectKey, err)
+	}
+}
+
+//
+// Raise the alarms stored before a restart again. Alarms of rules which are
+// gone or disabled are cleared right away, the others by the evaluation
+// once their condition no longer holds.
+//
+func (mgr *AlarmMgr) restoreRaised(now time.Time) {
+	values, err := redis.StringMap(mgr.dbHdl.DoLocked("HGETALL", ALARM_RAISED_KEY))
+	if err != nil {
+		mgr.logger.Err("Failed to read raised alarms", err)
+		return
+	}
+	mgr.mutex.Lock()
+	defer mgr.mutex.Unlock()
+	for field, data := range values {
+		var alarm Alarm
+		if err := json.Unmarshal([]byte(data), &alarm); err != nil {
+			mgr.logger.Err("Dropping unreadable raised alarm", field, err)
+			mgr.dbHdl.DoLocked("HDEL", ALARM_RAISED_KEY, field)
+			continue
+		}
+		instance := &alarmInstance{pendingSince: alarm.RaisedTime, alarm: &alarm}
+		if rule, exist := mgr.rules[alarm.Rule]; !exist || !rule.enabled {
+			mgr.clearAlarm(instance, "", now)
+			continue
+		}
+		if mgr.instances[alarm.Rule] == nil {
+			mgr.instances[alarm.Rule] = make(map[string]*alarmInstance)
+		}
+		mgr.instances[alarm.Rule][alarm.ObjectKey] = instance
+	}
+}
+
+func (mgr *AlarmMgr) addEvent(alarm Alarm, now time.Time) {
+	err := mgr.dbHdl.LogEvent(ALARM_EVENT_TYPE, AlarmEvent{
+		Time:        now.Format(time.RFC3339),
+		Rule:        alarm.Rule,
+		ObjectKey:   alarm.ObjectKey,
+		Severity:    alarm.Severity,
+		State:       alarm.State,
+		Value:       alarm.Value,
+		Description: alarm.Description,
+	})
+	if err != nil {
+		mgr.logger.Err("Failed to store alarm event of", alarm.Rule, "for", alarm.ObjectKey, err)
+	}
+}
+
+// Clear the alarms of a rule which is changed or deleted. Must be called
+// with mutex held.
+func (mgr *AlarmMgr) resetRule(name string, now time.Time) {
+	for _, instance := range mgr.instances[name] {
+		if instance.alarm != nil {
+			mgr.clearAlarm(instance, "", now)
+		}
+	}
+	delete(mgr.instances, name)
+}
+
+func (mgr *AlarmMgr) updateMetrics() {
+	counts := make(map[string]int)
+	mgr.mutex.Lock()
+	for _, instances := range mgr.instances {
+		for _, instance := range instances {
+			if instance.alarm != nil {
+				counts[instance.alarm.Severity]++
+			}
+		}
+	}
+	mgr.mutex.Unlock()
+	for _, severity := range Severities {
+		activeAlarms.Set(float64(counts[severity]), severity)
+	}
+}
+
+//
+// LocalObjectHandler of AlarmRule and AlarmState objects
+//
+func (mgr *AlarmMgr) ApplyObject(op string, oldObj, newObj modelObjs.ConfigObj) error {
+	var rule *alarmRule
+	var err error
+	if _, ok := oldObj.(modelObjs.AlarmState); ok {
+		return ErrReadOnly
+	}
+	if _, ok := newObj.(modelObjs.AlarmState); ok {
+		return ErrReadOnly
+	}
+	if op != clients.OBJECT_CHANGE_DELETE {
+		if rule, err = newAlarmRule(newObj.(modelObjs.AlarmRule)); err != nil {
+			return err
+		}
+	}
+	mgr.mutex.Lock()
+	if oldObj != nil {
+		mgr.resetRule(oldObj.(modelObjs.AlarmRule).Name, time.Now())
+		delete(mgr.rules, oldObj.(modelObjs.AlarmRule).Name)
+	}
+	if rule != nil {
+		mgr.rules[rule.name] = rule
+	}
+	mgr.mutex.Unlock()
+	mgr.updateMetrics()
+	return nil
+}
+
+func alarmToState(alarm Alarm) modelObjs.AlarmState {
+	state := modelObjs.AlarmState{
+		Name:        alarm.Rule,
+		ObjectKey:   alarm.ObjectKey,
+		Severity:    alarm.Severity,
+		Description: alarm.Description,
+		Value:       alarm.Value,
+		State:       alarm.State,
+		RaisedTime:  alarm.RaisedTime.Format(time.RFC3339),
+	}
+	if !alarm.ClearedTime.IsZero() {
+		state.ClearedTime = alarm.ClearedTime.Format(time.RFC3339)
+	}
+	return state
+}
+
+type alarmStates []modelObjs.AlarmState
+
+func (states alarmStates) Len() int {
+	return len(states)
+}
+
+func (states alarmStates) Less(i, j int) bool {
+	return states[i].RaisedTime < states[j].RaisedTime
+}
+
+func (states alarmStates) Swap(i, j int) {
+	states[i], states[j] = states[j], states[i]
+}
+
+// Raised alarms and the last cleared ones, oldest first
+func (mgr *AlarmMgr) GetAlarms() []modelObjs.AlarmState {
+	mgr.mutex.Lock()
+	states := make(alarmStates, 0, len(mgr.cleared))
+	for _, alarm := range mgr.cleared {
+		states = append(states, alarmToState(alarm))
+	}
+	for _, instances := range mgr.instances {
+		for _, instance := range instances {
+			if instance.alarm != nil {
+				states = append(states, alarmToState(*instance.alarm))
+			}
+		}
+	}
+	mgr.mutex.Unlock()
+	sort.Stable(states)
+	return states
+}
+
+func (mgr *AlarmMgr) GetObject(obj modelObjs.ConfigObj) (modelObjs.ConfigObj, error) {
+	query, ok := obj.(modelObjs.AlarmState)
+	if !ok {
+		return nil, errors.New("Only AlarmState can be read from the alarm engine")
+	}
+	alarms := mgr.GetAlarms()
+	// The latest alarm of the rule and object
+	for idx := len(alarms) - 1; idx >= 0; idx-- {
+		if alarms[idx].Name == query.Name && alarms[idx].ObjectKey == query.ObjectKey {
+			return alarms[idx], nil
+		}
+	}
+	return nil, errors.New("No alarm " + query.Name + " for " + query.ObjectKey)
+}
+
+func (mgr *AlarmMgr) GetAllObjects(obj modelObjs.ConfigObj) ([]modelObjs.ConfigObj, error) {
+	if _, ok := obj.(modelObjs.AlarmState); !ok {
+		return nil, errors.New("Only AlarmState can be read from the alarm engine")
+	}
+	alarms := mgr.GetAlarms()
+	objs := make([]modelObjs.ConfigObj, len(alarms))
+	for idx, alarm := range alarms {
+		objs[idx] = alarm
+	}
+	return objs, nil
+}
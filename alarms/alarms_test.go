@@ -0,0 +1,243 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package alarms
+
+import (
+	"config/objects"
+	"encoding/json"
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	modelObjs "models/objects"
+	"os"
+	"testing"
+	"time"
+	"utils/logging"
+)
+
+var logger *logging.Writer
+
+func TestMain(m *testing.M) {
+	var err error
+	logger, err = logging.NewLogger("confd", "Alarms", true)
+	if err != nil {
+		fmt.Println("Failed to start logger", err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+func registerStateObjects() {
+	if _, exist := modelObjs.ConfigObjectMap["confdclientstate"]; !exist {
+		modelObjs.ConfigObjectMap["confdclientstate"] = &modelObjs.ConfdClientState{}
+	}
+}
+
+func newTestAlarmMgr() *AlarmMgr {
+	return &AlarmMgr{
+		logger:    logger,
+		dbHdl:     objects.NewMemoryDbHandler(logger),
+		rules:     make(map[string]*alarmRule),
+		instances: make(map[string]map[string]*alarmInstance),
+	}
+}
+
+func TestParseExpression(t *testing.T) {
+	registerStateObjects()
+	valid := []string{
+		"ConfdClientState.NotifyFailed > 10",
+		"ConfdClientState NotifyFailed >= 10",
+		"ConfdClientState.NotifyFailed rate > 0.5/s for 1m",
+		"ConfdClientState.CircuitBreaker == open for 30s",
+		"ConfdClientState.Connected == false",
+		"ConfdClient.Enable == false",
+	}
+	for _, expr := range valid {
+		if _, err := parseExpression(expr); err != nil {
+			t.Error("Failed to parse", expr, err)
+		}
+	}
+	invalid := []string{
+		"ConfdClientState.NotifyFailed >",
+		"NoSuchState.Attr > 1",
+		"ConfdClientState.NoSuchAttr > 1",
+		"ConfdClientState.NotifyFailed =~ 1",
+		"ConfdClientState.CircuitBreaker > open",
+		"ConfdClientState.CircuitBreaker rate > 1",
+		"ConfdClientState.NotifyFailed > 1 during 5m",
+		"ConfdClientState.NotifyFailed > 1 for soon",
+	}
+	for _, expr := range invalid {
+		if _, err := parseExpression(expr); err == nil {
+			t.Error("Parsed invalid expression", expr)
+		}
+	}
+}
+
+func TestNewAlarmRule(t *testing.T) {
+	registerStateObjects()
+	rule, err := newAlarmRule(modelObjs.AlarmRule{Name: "r", Expression: "ConfdClientState.NotifyFailed > 1"})
+	if err != nil || rule.severity != SEVERITY_MAJOR {
+		t.Error("Expected default severity major", rule, err)
+	}
+	if _, err := newAlarmRule(modelObjs.AlarmRule{Name: "r", Severity: "Fatal",
+		Expression: "ConfdClientState.NotifyFailed > 1"}); err == nil {
+		t.Error("Accepted unknown severity")
+	}
+}
+
+func TestEvaluateRule(t *testing.T) {
+	registerStateObjects()
+	mgr := newTestAlarmMgr()
+	rule, err := newAlarmRule(modelObjs.AlarmRule{Name: "failing", Severity: SEVERITY_CRITICAL, Enable: true,
+		Expression: "ConfdClientState.NotifyFailed > 10 for 20s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr.rules[rule.name] = rule
+	start := time.Now()
+	objs := map[string]modelObjs.ConfigObj{
+		"a": modelObjs.ConfdClientState{Name: "a", NotifyFailed: 20},
+		"b": modelObjs.ConfdClientState{Name: "b", NotifyFailed: 1},
+	}
+	mgr.evaluateRule(rule, objs, start)
+	if len(mgr.GetAlarms()) != 0 {
+		t.Error("Alarm raised before the duration of the rule")
+	}
+	mgr.evaluateRule(rule, objs, start.Add(20*time.Second))
+	alarms := mgr.GetAlarms()
+	if len(alarms) != 1 || alarms[0].ObjectKey != "a" || alarms[0].State != ALARM_STATE_RAISED ||
+		alarms[0].Severity != SEVERITY_CRITICAL || alarms[0].Value != "20" {
+		t.Fatal("Expected raised alarm for a, got", alarms)
+	}
+	objs["a"] = modelObjs.ConfdClientState{Name: "a", NotifyFailed: 5}
+	mgr.evaluateRule(rule, objs, start.Add(30*time.Second))
+	alarms = mgr.GetAlarms()
+	if len(alarms) != 1 || alarms[0].State != ALARM_STATE_CLEARED || alarms[0].ClearedTime == "" {
+		t.Error("Expected cleared alarm for a, got", alarms)
+	}
+	stored, err := mgr.dbHdl.GetConfdEvents(ALARM_EVENT_TYPE)
+	if err != nil || len(stored) != 2 {
+		t.Fatal("Expected raise and clear events stored, got", stored, err)
+	}
+	events := make([]AlarmEvent, len(stored))
+	for idx, data := range stored {
+		json.Unmarshal(data.(json.RawMessage), &events[idx])
+	}
+	if events[0].State != ALARM_STATE_RAISED || events[1].State != ALARM_STATE_CLEARED || events[0].Rule != "failing" {
+		t.Error("Expected raise and clear events, got", events)
+	}
+	if info := objects.ParseEventInfo(stored[0].(json.RawMessage)); info.Time.IsZero() || info.Key != "a" {
+		t.Error("Alarm event not readable as an event", info)
+	}
+}
+
+func TestEvaluateRuleObjectGone(t *testing.T) {
+	registerStateObjects()
+	mgr := newTestAlarmMgr()
+	rule, _ := newAlarmRule(modelObjs.AlarmRule{Name: "down", Enable: true,
+		Expression: "ConfdClientState.Connected == false"})
+	now := time.Now()
+	mgr.evaluateRule(rule, map[string]modelObjs.ConfigObj{
+		"a": modelObjs.ConfdClientState{Name: "a"},
+	}, now)
+	if alarms := mgr.GetAlarms(); len(alarms) != 1 || alarms[0].State != ALARM_STATE_RAISED {
+		t.Fatal("Expected raised alarm, got", alarms)
+	}
+	mgr.evaluateRule(rule, map[string]modelObjs.ConfigObj{}, now.Add(time.Second))
+	if alarms := mgr.GetAlarms(); len(alarms) != 1 || alarms[0].State != ALARM_STATE_CLEARED {
+		t.Error("Expected alarm cleared with its object, got", alarms)
+	}
+}
+
+func TestRestoreRaisedAlarms(t *testing.T) {
+	registerStateObjects()
+	mgr := newTestAlarmMgr()
+	down, _ := newAlarmRule(modelObjs.AlarmRule{Name: "down", Enable: true,
+		Expression: "ConfdClientState.Connected == false"})
+	gone, _ := newAlarmRule(modelObjs.AlarmRule{Name: "gone", Enable: true,
+		Expression: "ConfdClientState.Enable == false"})
+	now := time.Now()
+	objs := map[string]modelObjs.ConfigObj{"a": modelObjs.ConfdClientState{Name: "a"}}
+	mgr.evaluateRule(down, objs, now)
+	mgr.evaluateRule(gone, objs, now)
+
+	// Restart with the same DB, the rule gone was deleted meanwhile
+	restarted := newTestAlarmMgr()
+	restarted.dbHdl = mgr.dbHdl
+	restarted.rules[down.name] = down
+	restarted.restoreRaised(now.Add(time.Minute))
+	alarms := restarted.GetAlarms()
+	if len(alarms) != 2 {
+		t.Fatal("Expected a raised and a cleared alarm after restart, got", alarms)
+	}
+	for _, alarm := range alarms {
+		if (alarm.Name == "down") != (alarm.State == ALARM_STATE_RAISED) {
+			t.Error("Unexpected alarm after restart", alarm)
+		}
+	}
+	objs["a"] = modelObjs.ConfdClientState{Name: "a", Connected: true}
+	restarted.evaluateRule(down, objs, now.Add(2*time.Minute))
+	for _, alarm := range restarted.GetAlarms() {
+		if alarm.State != ALARM_STATE_CLEARED {
+			t.Error("Expected restored alarm cleared, got", alarm)
+		}
+	}
+	if stored, _ := restarted.dbHdl.GetConfdEvents(ALARM_EVENT_TYPE); len(stored) != 4 {
+		t.Error("Expected 2 raise and 2 clear events, got", len(stored))
+	}
+	if raised, _ := redis.StringMap(restarted.dbHdl.DoLocked("HGETALL", ALARM_RAISED_KEY)); len(raised) != 0 {
+		t.Error("Cleared alarms still stored as raised", raised)
+	}
+}
+
+func TestEvaluateRate(t *testing.T) {
+	registerStateObjects()
+	mgr := newTestAlarmMgr()
+	rule, _ := newAlarmRule(modelObjs.AlarmRule{Name: "rate", Enable: true,
+		Expression: "ConfdClientState.NotifyFailed rate > 1/s"})
+	now := time.Now()
+	objs := map[string]modelObjs.ConfigObj{"a": modelObjs.ConfdClientState{Name: "a", NotifyFailed: 100}}
+	mgr.evaluateRule(rule, objs, now)
+	if len(mgr.GetAlarms()) != 0 {
+		t.Error("Rate alarm raised without a previous sample")
+	}
+	objs["a"] = modelObjs.ConfdClientState{Name: "a", NotifyFailed: 130}
+	mgr.evaluateRule(rule, objs, now.Add(10*time.Second))
+	if alarms := mgr.GetAlarms(); len(alarms) != 1 || alarms[0].State != ALARM_STATE_RAISED {
+		t.Error("Expected raised rate alarm, got", alarms)
+	}
+	// Counter reset is not a negative rate
+	objs["a"] = modelObjs.ConfdClientState{Name: "a", NotifyFailed: 50}
+	mgr.evaluateRule(rule, objs, now.Add(20*time.Second))
+	if alarms := mgr.GetAlarms(); len(alarms) != 1 || alarms[0].State != ALARM_STATE_RAISED {
+		t.Error("Counter reset changed the alarm, got", alarms)
+	}
+}
+
+func TestAlarmStateReadOnly(t *testing.T) {
+	mgr := newTestAlarmMgr()
+	if err := mgr.ApplyObject("create", nil, modelObjs.AlarmState{Name: "x"}); err != ErrReadOnly {
+		t.Error("AlarmState accepted a create")
+	}
+}
@@ -0,0 +1,262 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package alarms
+
+import (
+	"errors"
+	"fmt"
+	modelObjs "models/objects"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//
+// An alarm rule expression names a state object attribute, an optional
+// rate, a comparison and a value, and optionally how long the condition
+// must hold before the alarm is raised:
+//
+//   PortState.IfInErrors rate > 100/s for 60s
+//   Psu.OperStatus != OK
+//
+// The object may be given with or without the State suffix. Rates are per
+// second and only apply to numeric attributes; <, <=, > and >= need a
+// numeric attribute and value.
+//
+const (
+	SEVERITY_CRITICAL = "critical"
+	SEVERITY_MAJOR    = "major"
+	SEVERITY_MINOR    = "minor"
+	SEVERITY_WARNING  = "warning"
+)
+
+var Severities = []string{SEVERITY_CRITICAL, SEVERITY_MAJOR, SEVERITY_MINOR, SEVERITY_WARNING}
+
+var ruleOps = map[string]bool{"==": true, "!=": true, ">": true, ">=": true, "<": true, "<=": true}
+
+type alarmRule struct {
+	name        string
+	description string
+	severity    string
+	enabled     bool
+	resource    string
+	attr        string
+	rate        bool
+	op          string
+	numeric     bool
+	numValue    float64
+	strValue    string
+	forDuration time.Duration
+}
+
+func getStateResource(objName string) (string, error) {
+	resource := strings.ToLower(objName)
+	if !strings.HasSuffix(resource, "state") {
+		resource += "state"
+	}
+	if _, exist := modelObjs.ConfigObjectMap[resource]; !exist {
+		return "", errors.New("Unknown state object " + objName)
+	}
+	return resource, nil
+}
+
+func isNumericKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func getAttrType(resource, attr string) (reflect.Type, bool) {
+	objType := reflect.TypeOf(modelObjs.ConfigObjectMap[resource])
+	if objType != nil && objType.Kind() == reflect.Ptr {
+		objType = objType.Elem()
+	}
+	if objType == nil || objType.Kind() != reflect.Struct {
+		return nil, false
+	}
+	field, exist := objType.FieldByName(attr)
+	if !exist {
+		return nil, false
+	}
+	return field.Type, true
+}
+
+func parseExpression(expr string) (*alarmRule, error) {
+	rule := new(alarmRule)
+	tokens := strings.Fields(expr)
+	if len(tokens) > 0 && strings.Contains(tokens[0], ".") {
+		objAttr := strings.SplitN(tokens[0], ".", 2)
+		tokens = append([]string{objAttr[0], objAttr[1]}, tokens[1:]...)
+	}
+	if len(tokens) < 4 {
+		return nil, errors.New("Expression is not <Object>.<Attribute> [rate] <op> <value> [for <duration>]")
+	}
+	var err error
+	if rule.resource, err = getStateResource(tokens[0]); err != nil {
+		return nil, err
+	}
+	rule.attr = tokens[1]
+	tokens = tokens[2:]
+	if tokens[0] == "rate" {
+		rule.rate = true
+		tokens = tokens[1:]
+	}
+	if len(tokens) != 2 && len(tokens) != 4 {
+		return nil, errors.New("Invalid expression " + expr)
+	}
+	if rule.op = tokens[0]; !ruleOps[rule.op] {
+		return nil, errors.New("Unknown comparison " + rule.op)
+	}
+	value := strings.Trim(tokens[1], "\"'")
+	if rule.rate {
+		value = strings.TrimSuffix(value, "/s")
+	}
+	if len(tokens) == 4 {
+		if tokens[2] != "for" {
+			return nil, errors.New("Expected for instead of " + tokens[2])
+		}
+		if rule.forDuration, err = time.ParseDuration(tokens[3]); err != nil || rule.forDuration < 0 {
+			return nil, errors.New("Invalid duration " + tokens[3])
+		}
+	}
+	attrType, exist := getAttrType(rule.resource, rule.attr)
+	if !exist {
+		return nil, errors.New("Unknown attribute " + rule.attr)
+	}
+	numericAttr := isNumericKind(attrType.Kind())
+	rule.strValue = value
+	if numValue, err := strconv.ParseFloat(value, 64); err == nil && numericAttr {
+		rule.numeric = true
+		rule.numValue = numValue
+	}
+	if rule.rate && !rule.numeric {
+		return nil, errors.New("Rate needs a numeric attribute and value")
+	}
+	if !rule.numeric && rule.op != "==" && rule.op != "!=" {
+		return nil, errors.New("Comparison " + rule.op + " needs a numeric attribute and value")
+	}
+	return rule, nil
+}
+
+func newAlarmRule(cfg modelObjs.AlarmRule) (*alarmRule, error) {
+	rule, err := parseExpression(cfg.Expression)
+	if err != nil {
+		return nil, errors.New("AlarmRule " + cfg.Name + ": " + err.Error())
+	}
+	rule.name = cfg.Name
+	rule.description = cfg.Description
+	rule.enabled = cfg.Enable
+	rule.severity = strings.ToLower(cfg.Severity)
+	if rule.severity == "" {
+		rule.severity = SEVERITY_MAJOR
+	}
+	for _, severity := range Severities {
+		if rule.severity == severity {
+			return rule, nil
+		}
+	}
+	return nil, errors.New("AlarmRule " + cfg.Name + ": unknown severity " + cfg.Severity)
+}
+
+func compare(op string, value, threshold float64) bool {
+	switch op {
+	case "==":
+		return value == threshold
+	case "!=":
+		return value != threshold
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "<":
+		return value < threshold
+	}
+	return value <= threshold
+}
+
+func numericValue(value reflect.Value) float64 {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint())
+	}
+	return value.Float()
+}
+
+func getAttrValue(obj modelObjs.ConfigObj, attr string) (reflect.Value, bool) {
+	value := reflect.ValueOf(obj)
+	if value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return reflect.Value{}, false
+	}
+	field := value.FieldByName(attr)
+	return field, field.IsValid()
+}
+
+type attrSample struct {
+	value float64
+	time  time.Time
+}
+
+//
+// Check the condition of the rule on obj. prev is the previous sample of a
+// rate rule, which has no result until it has two samples. Returns the
+// value compared, as shown in the alarm.
+//
+func (rule *alarmRule) check(obj modelObjs.ConfigObj, prev *attrSample, now time.Time) (matched, known bool, value string, sample attrSample) {
+	field, exist := getAttrValue(obj, rule.attr)
+	if !exist {
+		return false, false, "", sample
+	}
+	if !rule.numeric {
+		value = fmt.Sprint(field.Interface())
+		return (value == rule.strValue) == (rule.op == "=="), true, value, sample
+	}
+	sample = attrSample{numericValue(field), now}
+	if !rule.rate {
+		return compare(rule.op, sample.value, rule.numValue), true, formatFloat(sample.value), sample
+	}
+	if prev == nil || !now.After(prev.time) {
+		return false, false, "", sample
+	}
+	increase := sample.value - prev.value
+	if increase < 0 {
+		// Counter was reset
+		increase = sample.value
+	}
+	rate := increase / now.Sub(prev.time).Seconds()
+	return compare(rule.op, rate, rule.numValue), true, formatFloat(rate) + "/s", sample
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
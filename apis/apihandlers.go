@@ -25,6 +25,8 @@ package apis
 
 import (
 	"config/actions"
+	"config/auth"
+	"config/clients"
 	"config/objects"
 	"encoding/json"
 	"fmt"
@@ -36,6 +38,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"utils/eventUtils"
 	//"utils/dbutils"
 	//"net/url"
@@ -73,7 +76,11 @@ type GetBulkResponse struct {
 }
 
 type GetEventResponse struct {
-	Objects []modelEvents.EventObj
+	MoreExist     bool  `json:"MoreExist"`
+	ObjCount      int64 `json:"ObjCount"`
+	CurrentMarker int64 `json:"CurrentMarker"`
+	NextMarker    int64 `json:"NextMarker"`
+	Objects       []interface{}
 }
 
 type ActionResponse struct {
@@ -104,6 +111,8 @@ const (
 	SRUpdateNoChange    = 15
 	SRValidationFailed  = 16
 	SRUnmarshalError    = 17
+	SRForbidden         = 18
+	SRInvalidQuery      = 19
 )
 
 // SR error strings
@@ -126,6 +135,8 @@ var ErrString = map[int]string{
 	SRUpdateNoChange:    "Nothing to be updated.",
 	SRValidationFailed:  "Config validation failed.",
 	SRUnmarshalError:    "Unmarshal of json data failed.",
+	SRForbidden:         "Operation not permitted.",
+	SRInvalidQuery:      "Invalid query parameter.",
 }
 
 //Given a code reurn error string
@@ -150,11 +161,19 @@ func (resp *ConfigResponse) FillBaseConfigResponse() {
 
 func RespondErrorForApiCall(w http.ResponseWriter, errCode int, errString string) error {
 	var errResp ErrorResponse
+	setResultCode(w, nil, errCode)
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	if errCode == SRBulkGetTooLarge {
 		w.WriteHeader(http.StatusRequestEntityTooLarge)
 	} else if errCode == SRSystemNotReady {
 		w.WriteHeader(http.StatusServiceUnavailable)
+	} else if errCode == SRAuthFailed {
+		w.Header().Set("WWW-Authenticate", "Basic realm=\""+auth.AUTH_REALM+"\"")
+		w.WriteHeader(http.StatusUnauthorized)
+	} else if errCode == SRForbidden {
+		w.WriteHeader(http.StatusForbidden)
+	} else if errCode == SRInvalidQuery {
+		w.WriteHeader(http.StatusBadRequest)
 	} else {
 		w.WriteHeader(http.StatusNotFound)
 	}
@@ -182,7 +201,7 @@ func GetOneConfigObjectForId(w http.ResponseWriter, r *http.Request) {
 	var retObj ReturnObject
 	var err error
 
-	gApiMgr.ApiCallStats.NumGetCalls++
+	atomic.AddInt32(&gApiMgr.ApiCallStats.NumGetCalls, 1)
 	urlStr := ReplaceMultipleSeperatorInUrl(r.URL.String())
 	resource := strings.Split(strings.TrimPrefix(urlStr, gApiMgr.apiBaseConfig), "/")[0]
 	resource = strings.ToLower(resource)
@@ -213,7 +232,7 @@ func GetOneConfigObjectForId(w http.ResponseWriter, r *http.Request) {
 	retObj.ObjectId = uuid
 	js, err := json.Marshal(retObj)
 	if err == nil {
-		gApiMgr.ApiCallStats.NumGetCallsSuccess++
+		atomic.AddInt32(&gApiMgr.ApiCallStats.NumGetCallsSuccess, 1)
 		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 		w.WriteHeader(http.StatusOK)
 		w.Write(js)
@@ -230,7 +249,7 @@ func GetOneConfigObject(w http.ResponseWriter, r *http.Request) {
 
 	resource := ""
 	queryData := ""
-	gApiMgr.ApiCallStats.NumGetCalls++
+	atomic.AddInt32(&gApiMgr.ApiCallStats.NumGetCalls, 1)
 	urlStr := ReplaceMultipleSeperatorInUrl(r.URL.String())
 	resource = strings.Split(strings.TrimPrefix(urlStr, gApiMgr.apiBaseConfig), "/")[0]
 	resource = strings.Split(resource, "?")[0]
@@ -263,7 +282,7 @@ func GetOneConfigObject(w http.ResponseWriter, r *http.Request) {
 	retObj.ObjectId = uuid
 	js, err := json.Marshal(retObj)
 	if err == nil {
-		gApiMgr.ApiCallStats.NumGetCallsSuccess++
+		atomic.AddInt32(&gApiMgr.ApiCallStats.NumGetCallsSuccess, 1)
 		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 		w.WriteHeader(http.StatusOK)
 		w.Write(js)
@@ -277,7 +296,7 @@ func GetOneStateObjectForId(w http.ResponseWriter, r *http.Request) {
 	var retObj ReturnObject
 	var err error
 
-	gApiMgr.ApiCallStats.NumGetCalls++
+	atomic.AddInt32(&gApiMgr.ApiCallStats.NumGetCalls, 1)
 	urlStr := ReplaceMultipleSeperatorInUrl(r.URL.String())
 	resource := strings.Split(strings.TrimPrefix(urlStr, gApiMgr.apiBaseState), "/")[0]
 	resource = strings.Split(resource, "?")[0]
@@ -311,7 +330,7 @@ func GetOneStateObjectForId(w http.ResponseWriter, r *http.Request) {
 		RespondErrorForApiCall(w, SRNotFound, err.Error())
 		return
 	}
-	resourceOwner := gApiMgr.objectMgr.ObjHdlMap[resource].Owner
+	resourceOwner := gApiMgr.objectMgr.GetConfigObjHdlMap()[resource].Owner
 	if resourceOwner.IsConnectedToServer() == false {
 		errString := "Confd not connected to " + resourceOwner.GetServerName()
 		RespondErrorForApiCall(w, SRSystemNotReady, errString)
@@ -331,7 +350,7 @@ func GetOneStateObjectForId(w http.ResponseWriter, r *http.Request) {
 	retObj.ObjectId = uuid
 	js, err := json.Marshal(retObj)
 	if err == nil {
-		gApiMgr.ApiCallStats.NumGetCallsSuccess++
+		atomic.AddInt32(&gApiMgr.ApiCallStats.NumGetCallsSuccess, 1)
 		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 		w.WriteHeader(http.StatusOK)
 		w.Write(js)
@@ -346,7 +365,7 @@ func GetOneStateObject(w http.ResponseWriter, r *http.Request) {
 	var err error
 	var uuid string
 
-	gApiMgr.ApiCallStats.NumGetCalls++
+	atomic.AddInt32(&gApiMgr.ApiCallStats.NumGetCalls, 1)
 	resource := ""
 	queryData := ""
 	urlStr := ReplaceMultipleSeperatorInUrl(r.URL.String())
@@ -372,7 +391,7 @@ func GetOneStateObject(w http.ResponseWriter, r *http.Request) {
 	}
 	//Get key fields provided in the request.
 	objKey = gApiMgr.dbHdl.GetKey(obj)
-	resourceOwner := gApiMgr.objectMgr.ObjHdlMap[resource].Owner
+	resourceOwner := gApiMgr.objectMgr.GetConfigObjHdlMap()[resource].Owner
 	if resourceOwner.IsConnectedToServer() == false {
 		errString := "Confd not connected to " + resourceOwner.GetServerName()
 		RespondErrorForApiCall(w, SRSystemNotReady, errString)
@@ -388,7 +407,7 @@ func GetOneStateObject(w http.ResponseWriter, r *http.Request) {
 	retObj.ObjectId = uuid
 	js, err := json.Marshal(retObj)
 	if err == nil {
-		gApiMgr.ApiCallStats.NumGetCallsSuccess++
+		atomic.AddInt32(&gApiMgr.ApiCallStats.NumGetCallsSuccess, 1)
 		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 		w.WriteHeader(http.StatusOK)
 		w.Write(js)
@@ -402,7 +421,7 @@ func BulkGetConfigObjects(w http.ResponseWriter, r *http.Request) {
 	var configObjects []modelObjs.ConfigObj
 	var resp GetBulkResponse
 	var err error
-	gApiMgr.ApiCallStats.NumGetCalls++
+	atomic.AddInt32(&gApiMgr.ApiCallStats.NumGetCalls, 1)
 	urlStr := ReplaceMultipleSeperatorInUrl(r.URL.String())
 	resource := strings.TrimPrefix(urlStr, gApiMgr.apiBaseConfig)
 	resource = strings.ToLower(resource)
@@ -425,8 +444,20 @@ func BulkGetConfigObjects(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	resp.CurrentMarker = currentIndex
-	err, resp.ObjCount, resp.NextMarker, resp.MoreExist,
-		configObjects = gApiMgr.dbHdl.GetBulkObjFromDb(obj, currentIndex, objCount)
+	if filters := ExtractAttrFilters(r); len(filters) > 0 {
+		if _, _, err = gApiMgr.objectMgr.ResolveAttrFilters(resource, obj, filters); err != nil {
+			RespondErrorForApiCall(w, SRInvalidQuery, err.Error())
+			return
+		}
+		err, resp.ObjCount, resp.NextMarker, resp.MoreExist,
+			configObjects = GetFilteredConfigObjects(resource, obj, filters, currentIndex, objCount)
+		if err != nil {
+			errCode = SRNotFound
+		}
+	} else {
+		err, resp.ObjCount, resp.NextMarker, resp.MoreExist,
+			configObjects = gApiMgr.dbHdl.GetBulkObjFromDb(obj, currentIndex, objCount)
+	}
 	if err == nil {
 		sortedObjects := obj.SortObjList(configObjects)
 		resp.Objects = make([]ReturnObject, resp.ObjCount)
@@ -440,7 +471,7 @@ func BulkGetConfigObjects(w http.ResponseWriter, r *http.Request) {
 			errCode = SRRespMarshalErr
 			gApiMgr.logger.Err(fmt.Sprintln("### Error in marshalling JSON in getBulk for object ", resource, err))
 		} else {
-			gApiMgr.ApiCallStats.NumGetCallsSuccess++
+			atomic.AddInt32(&gApiMgr.ApiCallStats.NumGetCallsSuccess, 1)
 			w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 			w.WriteHeader(http.StatusOK)
 			w.Write(js)
@@ -459,7 +490,7 @@ func BulkGetStateObjects(w http.ResponseWriter, r *http.Request) {
 	var stateObjects []modelObjs.ConfigObj
 	var resp GetBulkResponse
 	var err error
-	gApiMgr.ApiCallStats.NumGetCalls++
+	atomic.AddInt32(&gApiMgr.ApiCallStats.NumGetCalls, 1)
 	urlStr := ReplaceMultipleSeperatorInUrl(r.URL.String())
 	resource := strings.TrimPrefix(urlStr, gApiMgr.apiBaseState)
 	resource = strings.Split(resource, "?")[0]
@@ -480,7 +511,7 @@ func BulkGetStateObjects(w http.ResponseWriter, r *http.Request) {
 		gApiMgr.logger.Err(fmt.Sprintln("Too many objects requested in bulkget ", objCount))
 		return
 	}
-	resourceOwner := gApiMgr.objectMgr.ObjHdlMap[resource].Owner
+	resourceOwner := gApiMgr.objectMgr.GetConfigObjHdlMap()[resource].Owner
 	if resourceOwner.IsConnectedToServer() == false {
 		errString := "Confd not connected to " + resourceOwner.GetServerName()
 		RespondErrorForApiCall(w, SRSystemNotReady, errString)
@@ -502,7 +533,7 @@ func BulkGetStateObjects(w http.ResponseWriter, r *http.Request) {
 			errCode = SRRespMarshalErr
 			gApiMgr.logger.Err(fmt.Sprintln("### Error in marshalling JSON in getBulk for object ", resource, err))
 		} else {
-			gApiMgr.ApiCallStats.NumGetCallsSuccess++
+			atomic.AddInt32(&gApiMgr.ApiCallStats.NumGetCallsSuccess, 1)
 			w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 			w.WriteHeader(http.StatusOK)
 			w.Write(js)
@@ -530,6 +561,43 @@ func ExtractGetBulkParams(r *http.Request) (currentIndex int64, objectCount int6
 	return currentIndex, objectCount
 }
 
+//
+// Attribute filters of a bulk get: every query parameter other than
+// CurrentMarker and Count, e.g. ?IntfRef=fpPort1&CurrentMarker=0
+//
+func ExtractAttrFilters(r *http.Request) map[string]string {
+	filters := make(map[string]string)
+	for param, values := range r.URL.Query() {
+		if param == "CurrentMarker" || param == "Count" || len(values) == 0 {
+			continue
+		}
+		filters[param] = values[0]
+	}
+	return filters
+}
+
+func GetFilteredConfigObjects(resource string, obj modelObjs.ConfigObj, filters map[string]string,
+	currentIndex, objCount int64) (err error, count int64, nextMarker int64, more bool, objs []modelObjs.ConfigObj) {
+	matched, err := gApiMgr.objectMgr.GetFilteredObjs(resource, obj, filters)
+	if err != nil {
+		return err, 0, 0, false, nil
+	}
+	matched = obj.SortObjList(matched)
+	if currentIndex < 0 || currentIndex > int64(len(matched)) {
+		currentIndex = int64(len(matched))
+	}
+	endIndex := currentIndex + objCount
+	if endIndex > int64(len(matched)) {
+		endIndex = int64(len(matched))
+	}
+	objs = matched[currentIndex:endIndex]
+	more = endIndex < int64(len(matched))
+	if more {
+		nextMarker = endIndex
+	}
+	return nil, int64(len(objs)), nextMarker, more, objs
+}
+
 func ExecuteActionObject(w http.ResponseWriter, r *http.Request) {
 	var resp ActionResponse
 	var errCode int
@@ -537,7 +605,7 @@ func ExecuteActionObject(w http.ResponseWriter, r *http.Request) {
 	var actionobj modelActions.ActionObj
 	var body []byte
 
-	gApiMgr.ApiCallStats.NumActionCalls++
+	atomic.AddInt32(&gApiMgr.ApiCallStats.NumActionCalls, 1)
 	urlStr := ReplaceMultipleSeperatorInUrl(r.URL.String())
 	errCode = SRSuccess
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
@@ -553,7 +621,12 @@ func ExecuteActionObject(w http.ResponseWriter, r *http.Request) {
 	if actionobjHdl, ok := modelActions.ActionObjectMap[resource]; ok {
 		fmt.Println("actionObjhdl:", actionobjHdl)
 		if body, actionobj, err = actions.GetActionObj(r, actionobjHdl); err == nil {
-			resourceOwner := gApiMgr.actionMgr.ObjHdlMap[resource].Owner
+			if err = authorizeActionData(r, actionobj); err != nil {
+				RespondErrorForApiCall(w, SRForbidden, err.Error())
+				gApiMgr.StoreApiCallInfo(r, resource, "POST", body, SRForbidden, err.Error())
+				return
+			}
+			resourceOwner := gApiMgr.actionMgr.GetActionObjHdlMap()[resource].Owner
 			if resourceOwner.IsConnectedToServer() == false {
 				errString := "Confd not connected to " + resourceOwner.GetServerName()
 				errCode = SRSystemNotReady
@@ -563,7 +636,7 @@ func ExecuteActionObject(w http.ResponseWriter, r *http.Request) {
 			}
 			err = resourceOwner.ExecuteAction(actionobj)
 			if err == nil {
-				gApiMgr.ApiCallStats.NumActionCallsSuccess++
+				atomic.AddInt32(&gApiMgr.ApiCallStats.NumActionCallsSuccess, 1)
 				w.WriteHeader(http.StatusOK)
 				errCode = SRSuccess
 				resp.Result = "Success"
@@ -605,7 +678,7 @@ func ConfigObjectCreate(w http.ResponseWriter, r *http.Request) {
 	var obj modelObjs.ConfigObj
 	var body []byte
 
-	gApiMgr.ApiCallStats.NumCreateCalls++
+	atomic.AddInt32(&gApiMgr.ApiCallStats.NumCreateCalls, 1)
 	urlStr := ReplaceMultipleSeperatorInUrl(r.URL.String())
 	errCode = SRSuccess
 	resp := &ConfigResponse{}
@@ -628,6 +701,7 @@ func ConfigObjectCreate(w http.ResponseWriter, r *http.Request) {
 			} else {
 				objKey = gApiMgr.dbHdl.GetKey(obj)
 				uuid, err = gApiMgr.dbHdl.GetUUIDFromObjKey(objKey)
+				setAuditObject(r, objKey, uuid)
 				if err == nil {
 					errCode = SRAlreadyConfigured
 					gApiMgr.logger.Debug("Config object is present")
@@ -642,7 +716,7 @@ func ConfigObjectCreate(w http.ResponseWriter, r *http.Request) {
 				gApiMgr.StoreApiCallInfo(r, resource, "POST", body, errCode, SRErrString(errCode))
 				return
 			}
-			resourceOwner := gApiMgr.objectMgr.ObjHdlMap[resource].Owner
+			resourceOwner := gApiMgr.objectMgr.GetConfigObjHdlMap()[resource].Owner
 			if resourceOwner.IsConnectedToServer() == false {
 				errCode = SRSystemNotReady
 				errString := "Confd not connected to " + resourceOwner.GetServerName()
@@ -650,11 +724,18 @@ func ConfigObjectCreate(w http.ResponseWriter, r *http.Request) {
 				gApiMgr.StoreApiCallInfo(r, resource, "POST", body, errCode, errString)
 				return
 			}
+			if err := authorizeTokenOwner(r, obj); err != nil {
+				RespondErrorForApiCall(w, SRForbidden, err.Error())
+				gApiMgr.StoreApiCallInfo(r, resource, "POST", body, SRForbidden, err.Error())
+				return
+			}
 			err, success = resourceOwner.CreateObject(obj, gApiMgr.dbHdl.DBUtil)
 			if success == true {
 				uuid, dbErr := gApiMgr.dbHdl.StoreUUIDToObjKeyMap(objKey)
+				setAuditObject(r, objKey, uuid)
 				if dbErr == nil {
-					gApiMgr.ApiCallStats.NumCreateCallsSuccess++
+					atomic.AddInt32(&gApiMgr.ApiCallStats.NumCreateCallsSuccess, 1)
+					gApiMgr.objectMgr.ObjectChanged(resource, clients.OBJECT_CHANGE_CREATE, nil, obj)
 					w.WriteHeader(http.StatusCreated)
 					resp.UUId = uuid
 					errCode = SRSuccess
@@ -702,7 +783,7 @@ func ConfigObjectDeleteForId(w http.ResponseWriter, r *http.Request) {
 	var obj modelObjs.ConfigObj
 	var body []byte
 
-	gApiMgr.ApiCallStats.NumDeleteCalls++
+	atomic.AddInt32(&gApiMgr.ApiCallStats.NumDeleteCalls, 1)
 	urlStr := ReplaceMultipleSeperatorInUrl(r.URL.String())
 	resp := &ConfigResponse{}
 	resp.FillBaseConfigResponse()
@@ -718,6 +799,7 @@ func ConfigObjectDeleteForId(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	resp.UUId = vars["objId"]
 	objKey, err = gApiMgr.dbHdl.GetObjKeyFromUUID(vars["objId"])
+	setAuditObject(r, objKey, vars["objId"])
 	if err != nil {
 		errCode = SRNotFound
 		w.WriteHeader(http.StatusNotFound)
@@ -730,7 +812,7 @@ func ConfigObjectDeleteForId(w http.ResponseWriter, r *http.Request) {
 	if objHdl, ok := modelObjs.ConfigObjectMap[resource]; ok {
 		if body, obj, err = objects.GetConfigObjFromJsonData(nil, objHdl); err == nil {
 			dbObj, _ := gApiMgr.dbHdl.GetObjectFromDb(obj, objKey)
-			resourceOwner := gApiMgr.objectMgr.ObjHdlMap[resource].Owner
+			resourceOwner := gApiMgr.objectMgr.GetConfigObjHdlMap()[resource].Owner
 			if resourceOwner.IsConnectedToServer() == false {
 				errString := "Confd not connected to " + resourceOwner.GetServerName()
 				errCode = SRSystemNotReady
@@ -738,6 +820,11 @@ func ConfigObjectDeleteForId(w http.ResponseWriter, r *http.Request) {
 				gApiMgr.StoreApiCallInfo(r, resource, "DELETE", body, errCode, errString)
 				return
 			}
+			if err := authorizeTokenOwner(r, dbObj); err != nil {
+				RespondErrorForApiCall(w, SRForbidden, err.Error())
+				gApiMgr.StoreApiCallInfo(r, resource, "DELETE", body, SRForbidden, err.Error())
+				return
+			}
 			err, success = resourceOwner.DeleteObject(dbObj, objKey, gApiMgr.dbHdl.DBUtil)
 			if success == true {
 				err = gApiMgr.dbHdl.DeleteUUIDToObjKeyMap(vars["objId"], objKey)
@@ -745,7 +832,8 @@ func ConfigObjectDeleteForId(w http.ResponseWriter, r *http.Request) {
 					errCode = SRIdDeleteFail
 					gApiMgr.logger.Debug(fmt.Sprintln("Failure in deleting Uuid map entry for ", vars["objId"], err))
 				} else {
-					gApiMgr.ApiCallStats.NumDeleteCallsSuccess++
+					atomic.AddInt32(&gApiMgr.ApiCallStats.NumDeleteCallsSuccess, 1)
+					gApiMgr.objectMgr.ObjectChanged(resource, clients.OBJECT_CHANGE_DELETE, dbObj, nil)
 					w.WriteHeader(http.StatusGone)
 					errCode = SRSuccess
 					resp.Result = "Success"
@@ -790,7 +878,7 @@ func ConfigObjectDelete(w http.ResponseWriter, r *http.Request) {
 	var obj modelObjs.ConfigObj
 	var body []byte
 
-	gApiMgr.ApiCallStats.NumDeleteCalls++
+	atomic.AddInt32(&gApiMgr.ApiCallStats.NumDeleteCalls, 1)
 	urlStr := ReplaceMultipleSeperatorInUrl(r.URL.String())
 	resp := &ConfigResponse{}
 	resp.FillBaseConfigResponse()
@@ -817,8 +905,9 @@ func ConfigObjectDelete(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 			uuid, err = gApiMgr.dbHdl.GetUUIDFromObjKey(objKey)
+			setAuditObject(r, objKey, uuid)
 			resp.UUId = uuid
-			resourceOwner := gApiMgr.objectMgr.ObjHdlMap[resource].Owner
+			resourceOwner := gApiMgr.objectMgr.GetConfigObjHdlMap()[resource].Owner
 			if resourceOwner.IsConnectedToServer() == false {
 				errString := "Confd not connected to " + resourceOwner.GetServerName()
 				errCode = SRSystemNotReady
@@ -826,6 +915,11 @@ func ConfigObjectDelete(w http.ResponseWriter, r *http.Request) {
 				gApiMgr.StoreApiCallInfo(r, resource, "DELETE", body, errCode, errString)
 				return
 			}
+			if err := authorizeTokenOwner(r, dbObj); err != nil {
+				RespondErrorForApiCall(w, SRForbidden, err.Error())
+				gApiMgr.StoreApiCallInfo(r, resource, "DELETE", body, SRForbidden, err.Error())
+				return
+			}
 			err, success = resourceOwner.DeleteObject(dbObj, objKey, gApiMgr.dbHdl.DBUtil)
 			if success == true {
 				err = gApiMgr.dbHdl.DeleteUUIDToObjKeyMap(uuid, objKey)
@@ -833,7 +927,8 @@ func ConfigObjectDelete(w http.ResponseWriter, r *http.Request) {
 					errCode = SRIdDeleteFail
 					gApiMgr.logger.Debug(fmt.Sprintln("Failure in deleting Uuid map entry for ", uuid, err))
 				} else {
-					gApiMgr.ApiCallStats.NumDeleteCallsSuccess++
+					atomic.AddInt32(&gApiMgr.ApiCallStats.NumDeleteCallsSuccess, 1)
+					gApiMgr.objectMgr.ObjectChanged(resource, clients.OBJECT_CHANGE_DELETE, dbObj, nil)
 					w.WriteHeader(http.StatusGone)
 					errCode = SRSuccess
 					resp.Result = "Success"
@@ -877,7 +972,7 @@ func ConfigObjectUpdateForId(w http.ResponseWriter, r *http.Request) {
 	var obj modelObjs.ConfigObj
 	var body []byte
 
-	gApiMgr.ApiCallStats.NumUpdateCalls++
+	atomic.AddInt32(&gApiMgr.ApiCallStats.NumUpdateCalls, 1)
 	urlStr := ReplaceMultipleSeperatorInUrl(r.URL.String())
 	resp := &ConfigResponse{}
 	resp.FillBaseConfigResponse()
@@ -893,6 +988,7 @@ func ConfigObjectUpdateForId(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	resp.UUId = vars["objId"]
 	objKey, err = gApiMgr.dbHdl.GetObjKeyFromUUID(vars["objId"])
+	setAuditObject(r, objKey, vars["objId"])
 	if err != nil {
 		w.WriteHeader(http.StatusNotFound)
 		errCode = SRNotFound
@@ -939,7 +1035,7 @@ func ConfigObjectUpdateForId(w http.ResponseWriter, r *http.Request) {
 					patchOpInfo := modelObjs.PatchOpInfo{opStr, pathStr, string(*value)}
 					patchOpInfoSlice = append(patchOpInfoSlice, patchOpInfo)
 				}
-				resourceOwner := gApiMgr.objectMgr.ObjHdlMap[resource].Owner
+				resourceOwner := gApiMgr.objectMgr.GetConfigObjHdlMap()[resource].Owner
 				if resourceOwner.IsConnectedToServer() == false {
 					errString := "Confd not connected to " + resourceOwner.GetServerName()
 					errCode = SRSystemNotReady
@@ -953,9 +1049,15 @@ func ConfigObjectUpdateForId(w http.ResponseWriter, r *http.Request) {
 					gApiMgr.StoreApiCallInfo(r, resource, "UPDATE", body, errCode, SRErrString(errCode))
 					return
 				}
+				if err := authorizeTokenOwner(r, dbObj, mergedObj); err != nil {
+					RespondErrorForApiCall(w, SRForbidden, err.Error())
+					gApiMgr.StoreApiCallInfo(r, resource, "UPDATE", body, SRForbidden, err.Error())
+					return
+				}
 				err, success = resourceOwner.UpdateObject(dbObj, mergedObj, diff, patchOpInfoSlice, objKey, gApiMgr.dbHdl.DBUtil)
 				if success == true {
-					gApiMgr.ApiCallStats.NumUpdateCallsSuccess++
+					atomic.AddInt32(&gApiMgr.ApiCallStats.NumUpdateCallsSuccess, 1)
+					gApiMgr.objectMgr.ObjectChanged(resource, clients.OBJECT_CHANGE_UPDATE, dbObj, mergedObj)
 					w.WriteHeader(http.StatusOK)
 					errCode = SRSuccess
 					resp.Result = "Success"
@@ -989,7 +1091,7 @@ func ConfigObjectUpdateForId(w http.ResponseWriter, r *http.Request) {
 			mergedObj, _ := gApiMgr.dbHdl.MergeDbAndConfigObj(obj, dbObj, diff)
 			mergedObjKey := gApiMgr.dbHdl.GetKey(mergedObj)
 			if objKey == mergedObjKey {
-				resourceOwner := gApiMgr.objectMgr.ObjHdlMap[resource].Owner
+				resourceOwner := gApiMgr.objectMgr.GetConfigObjHdlMap()[resource].Owner
 				if resourceOwner.IsConnectedToServer() == false {
 					errString := "Confd not connected to " + resourceOwner.GetServerName()
 					errCode = SRSystemNotReady
@@ -1005,11 +1107,17 @@ func ConfigObjectUpdateForId(w http.ResponseWriter, r *http.Request) {
 					gApiMgr.StoreApiCallInfo(r, resource, "UPDATE", body, errCode, SRErrString(errCode)+err.Error())
 					return
 				}
+				if err := authorizeTokenOwner(r, dbObj, mergedObj); err != nil {
+					RespondErrorForApiCall(w, SRForbidden, err.Error())
+					gApiMgr.StoreApiCallInfo(r, resource, "UPDATE", body, SRForbidden, err.Error())
+					return
+				}
 				err, success = resourceOwner.UpdateObject(dbObj, mergedObj, diff, patchOpInfoSlice, objKey, gApiMgr.dbHdl.DBUtil)
 				if success == true {
 					//Perform post update processing
 					_ = resourceOwner.PostUpdateProcessing(dbObj, mergedObj, diff, gApiMgr.dbHdl.DBUtil)
-					gApiMgr.ApiCallStats.NumUpdateCallsSuccess++
+					atomic.AddInt32(&gApiMgr.ApiCallStats.NumUpdateCallsSuccess, 1)
+					gApiMgr.objectMgr.ObjectChanged(resource, clients.OBJECT_CHANGE_UPDATE, dbObj, mergedObj)
 					w.WriteHeader(http.StatusOK)
 					errCode = SRSuccess
 					resp.Result = "Success"
@@ -1057,7 +1165,7 @@ func ConfigObjectUpdate(w http.ResponseWriter, r *http.Request) {
 	var obj modelObjs.ConfigObj
 	var body []byte
 
-	gApiMgr.ApiCallStats.NumUpdateCalls++
+	atomic.AddInt32(&gApiMgr.ApiCallStats.NumUpdateCalls, 1)
 	urlStr := ReplaceMultipleSeperatorInUrl(r.URL.String())
 	resp := &ConfigResponse{}
 	resp.FillBaseConfigResponse()
@@ -1094,6 +1202,7 @@ func ConfigObjectUpdate(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		uuid, err = gApiMgr.dbHdl.GetUUIDFromObjKey(objKey)
+		setAuditObject(r, objKey, uuid)
 		resp.UUId = uuid
 		patchOpInfoSlice := make([]modelObjs.PatchOpInfo, 0)
 		if strings.Contains(string(body), "\"patch\":") {
@@ -1128,7 +1237,7 @@ func ConfigObjectUpdate(w http.ResponseWriter, r *http.Request) {
 				patchOpInfo := modelObjs.PatchOpInfo{opStr, pathStr, string(*value)}
 				patchOpInfoSlice = append(patchOpInfoSlice, patchOpInfo)
 			}
-			resourceOwner := gApiMgr.objectMgr.ObjHdlMap[resource].Owner
+			resourceOwner := gApiMgr.objectMgr.GetConfigObjHdlMap()[resource].Owner
 			if resourceOwner.IsConnectedToServer() == false {
 				errString := "Confd not connected to " + resourceOwner.GetServerName()
 				errCode = SRSystemNotReady
@@ -1142,9 +1251,15 @@ func ConfigObjectUpdate(w http.ResponseWriter, r *http.Request) {
 				gApiMgr.StoreApiCallInfo(r, resource, "UPDATE", body, errCode, SRErrString(errCode))
 				return
 			}
+			if err := authorizeTokenOwner(r, dbObj, mergedObj); err != nil {
+				RespondErrorForApiCall(w, SRForbidden, err.Error())
+				gApiMgr.StoreApiCallInfo(r, resource, "UPDATE", body, SRForbidden, err.Error())
+				return
+			}
 			err, success = resourceOwner.UpdateObject(dbObj, mergedObj, diff, patchOpInfoSlice, objKey, gApiMgr.dbHdl.DBUtil)
 			if success == true {
-				gApiMgr.ApiCallStats.NumUpdateCallsSuccess++
+				atomic.AddInt32(&gApiMgr.ApiCallStats.NumUpdateCallsSuccess, 1)
+				gApiMgr.objectMgr.ObjectChanged(resource, clients.OBJECT_CHANGE_UPDATE, dbObj, mergedObj)
 				w.WriteHeader(http.StatusOK)
 				errCode = SRSuccess
 				resp.Result = "Success"
@@ -1179,7 +1294,7 @@ func ConfigObjectUpdate(w http.ResponseWriter, r *http.Request) {
 		mergedObj, _ := gApiMgr.dbHdl.MergeDbAndConfigObj(obj, dbObj, diff)
 		mergedObjKey := mergedObj.GetKey()
 		if objKey == mergedObjKey {
-			resourceOwner := gApiMgr.objectMgr.ObjHdlMap[resource].Owner
+			resourceOwner := gApiMgr.objectMgr.GetConfigObjHdlMap()[resource].Owner
 			if resourceOwner.IsConnectedToServer() == false {
 				errString := "Confd not connected to " + resourceOwner.GetServerName()
 				errCode = SRSystemNotReady
@@ -1195,11 +1310,17 @@ func ConfigObjectUpdate(w http.ResponseWriter, r *http.Request) {
 				gApiMgr.StoreApiCallInfo(r, resource, "UPDATE", body, errCode, SRErrString(errCode)+err.Error())
 				return
 			}
+			if err := authorizeTokenOwner(r, dbObj, mergedObj); err != nil {
+				RespondErrorForApiCall(w, SRForbidden, err.Error())
+				gApiMgr.StoreApiCallInfo(r, resource, "UPDATE", body, SRForbidden, err.Error())
+				return
+			}
 			err, success = resourceOwner.UpdateObject(dbObj, mergedObj, diff, patchOpInfoSlice, objKey, gApiMgr.dbHdl.DBUtil)
 			if success == true {
 				//Perform post update processing
 				_ = resourceOwner.PostUpdateProcessing(dbObj, mergedObj, diff, gApiMgr.dbHdl.DBUtil)
-				gApiMgr.ApiCallStats.NumUpdateCallsSuccess++
+				atomic.AddInt32(&gApiMgr.ApiCallStats.NumUpdateCallsSuccess, 1)
+				gApiMgr.objectMgr.ObjectChanged(resource, clients.OBJECT_CHANGE_UPDATE, dbObj, mergedObj)
 				w.WriteHeader(http.StatusOK)
 				errCode = SRSuccess
 				resp.Result = "Success"
@@ -1258,33 +1379,62 @@ func ConfigObjectUpdate(w http.ResponseWriter, r *http.Request) {
 func EventObjectGet(w http.ResponseWriter, r *http.Request) {
 	var obj modelEvents.EventObj
 	var retObj GetEventResponse
+	var evtObjList []interface{}
 	var err error
 
-	gApiMgr.ApiCallStats.NumGetCalls++
-	urlStr := ReplaceMultipleSeperatorInUrl(r.URL.String())
+	atomic.AddInt32(&gApiMgr.ApiCallStats.NumGetCalls, 1)
+	urlStr := ReplaceMultipleSeperatorInUrl(r.URL.Path)
 	resource := strings.Split(strings.TrimPrefix(urlStr, gApiMgr.apiBaseEvent), "/")[0]
 	resource = strings.ToLower(resource)
-	objHdl, ok := modelEvents.EventObjectMap[resource]
-	if !ok {
-		RespondErrorForApiCall(w, SRNotFound, "")
-	}
-	_, obj, err = objects.GetEventObj(r, objHdl)
+	query, err := parseEventQuery(r)
 	if err != nil {
-		RespondErrorForApiCall(w, SRNotFound, err.Error())
+		RespondErrorForApiCall(w, SRInvalidQuery, err.Error())
 		return
 	}
-	evtObjList, err := eventUtils.GetEvents(obj, gApiMgr.dbHdl.DBUtil, gApiMgr.logger)
-	if err != nil {
-		gApiMgr.logger.Err(fmt.Sprintln("Error extracting events", err))
-		RespondErrorForApiCall(w, SRNotFound, err.Error())
+	currentIndex, objCount := ExtractGetBulkParams(r)
+	if objCount > MAX_OBJECTS_IN_GETBULK {
+		gApiMgr.logger.Err(fmt.Sprintln("Too many events requested", objCount))
+		RespondErrorForApiCall(w, SRBulkGetTooLarge, "")
 		return
 	}
-	retObj.Objects = evtObjList
-	w.WriteHeader(http.StatusOK)
+	if eventType, exist := objects.GetConfdEventType(resource); exist {
+		evtObjList, err = gApiMgr.dbHdl.GetConfdEvents(eventType)
+		if err != nil {
+			gApiMgr.logger.Err(fmt.Sprintln("Error extracting events", err))
+			RespondErrorForApiCall(w, SRServerError, err.Error())
+			return
+		}
+	} else {
+		objHdl, ok := modelEvents.EventObjectMap[resource]
+		if !ok {
+			RespondErrorForApiCall(w, SRNotFound, "")
+			return
+		}
+		_, obj, err = objects.GetEventObj(r, objHdl)
+		if err != nil {
+			RespondErrorForApiCall(w, SRNotFound, err.Error())
+			return
+		}
+		evtObjs, err := eventUtils.GetEvents(obj, gApiMgr.dbHdl.DBUtil, gApiMgr.logger)
+		if err != nil {
+			gApiMgr.logger.Err(fmt.Sprintln("Error extracting events", err))
+			RespondErrorForApiCall(w, SRNotFound, err.Error())
+			return
+		}
+		for _, evtObj := range evtObjs {
+			evtObjList = append(evtObjList, evtObj)
+		}
+	}
+	retObj.CurrentMarker = currentIndex
+	retObj.NextMarker, retObj.MoreExist, retObj.Objects = objects.QueryEvents(evtObjList, query, currentIndex, objCount)
+	retObj.ObjCount = int64(len(retObj.Objects))
 	js, err := json.Marshal(retObj)
 	if err != nil {
 		gApiMgr.logger.Err("Error marshalling the object")
+		RespondErrorForApiCall(w, SRServerError, err.Error())
+		return
 	}
+	w.WriteHeader(http.StatusOK)
 	w.Write(js)
 	return
 }
@@ -0,0 +1,179 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package apis
+
+import (
+	"config/audit"
+	"config/auth"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	modelObjs "models/objects"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+type GetAuditResponse struct {
+	MoreExist     bool                       `json:"MoreExist"`
+	ObjCount      int64                      `json:"ObjCount"`
+	CurrentMarker int64                      `json:"CurrentMarker"`
+	NextMarker    int64                      `json:"NextMarker"`
+	Objects       []modelObjs.ConfigLogState `json:"Objects"`
+}
+
+func (mgr *ApiMgr) ConfigureAudit(cfg audit.AuditConfig) error {
+	return mgr.auditMgr.Configure(cfg)
+}
+
+func (mgr *ApiMgr) StopAudit() {
+	mgr.auditMgr.Stop()
+}
+
+//
+// Record the key and ObjectId of the object of r for its audit log entry,
+// once the handler has found them.
+//
+func setAuditObject(r *http.Request, objKey, objId string) {
+	if rw, ok := getMetricsResponseWriter(r); ok {
+		rw.auditKey = objKey
+		rw.auditObjId = objId
+	}
+}
+
+func newAuditEntry(r *http.Request, api, operation string, errCode int, result string) modelObjs.ConfigLogState {
+	entry := modelObjs.ConfigLogState{
+		API:        api,
+		Time:       time.Now().Format(time.RFC3339Nano),
+		Operation:  operation,
+		Result:     result,
+		ResultCode: int32(errCode),
+		UserAddr:   r.RemoteAddr,
+		UserName:   auth.GetRequestUser(r),
+		ObjectId:   mux.Vars(r)["objId"],
+	}
+	if rw, ok := getMetricsResponseWriter(r); ok {
+		rw.audited = true
+		entry.Latency = time.Since(rw.start).String()
+		entry.Key = rw.auditKey
+		if rw.auditObjId != "" {
+			entry.ObjectId = rw.auditObjId
+		}
+	}
+	return entry
+}
+
+//
+// Record reads in the audit log when it keeps them. Changes and actions are
+// recorded by their handlers through StoreApiCallInfo, with their body.
+// Reads keep their query parameters in Data.
+//
+func AuditReads(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inner.ServeHTTP(w, r)
+		rw, ok := getMetricsResponseWriter(r)
+		if !ok || rw.audited || !gApiMgr.auditMgr.RecordsReads() {
+			return
+		}
+		category, verb, object, ok := getRequestPermission(r)
+		if !ok || verb != auth.PERM_GET {
+			return
+		}
+		resource := strings.ToLower(object)
+		if category == auth.PERM_STATE {
+			resource += "state"
+		}
+		errCode := rw.resultCode()
+		result := audit.RESULT_SUCCESS
+		if errCode != SRSuccess {
+			result = SRErrString(errCode)
+		}
+		entry := newAuditEntry(r, resource, "GET", errCode, result)
+		entry.Data = r.URL.RawQuery
+		gApiMgr.auditMgr.Record(entry)
+	})
+}
+
+//
+// Selection of audit log entries. from and to take the same times as
+// history queries; user, resource, operation and result take comma
+// separated lists. result is success, failure or SR codes. Entries are in
+// SeqNum order, newest first with sort=desc. CurrentMarker and Count page
+// as in bulk gets.
+//
+func parseAuditQuery(r *http.Request) (query audit.Query, err error) {
+	now := time.Now()
+	params := r.URL.Query()
+	if query.From, err = parseHistoryTime(params.Get("from"), now); err != nil {
+		return query, errors.New("Invalid from " + params.Get("from"))
+	}
+	if query.To, err = parseHistoryTime(params.Get("to"), now); err != nil {
+		return query, errors.New("Invalid to " + params.Get("to"))
+	}
+	query.Users = parseFilterList(params.Get("user"))
+	query.Resources = parseFilterList(params.Get("resource"))
+	query.Operations = parseFilterList(params.Get("operation"))
+	query.Results = parseFilterList(params.Get("result"))
+	switch params.Get("sort") {
+	case "", "asc":
+	case "desc":
+		query.Descending = true
+	default:
+		return query, errors.New("Invalid sort " + params.Get("sort"))
+	}
+	return query, nil
+}
+
+func AuditLogGet(w http.ResponseWriter, r *http.Request) {
+	var resp GetAuditResponse
+
+	atomic.AddInt32(&gApiMgr.ApiCallStats.NumGetCalls, 1)
+	query, err := parseAuditQuery(r)
+	if err != nil {
+		RespondErrorForApiCall(w, SRInvalidQuery, err.Error())
+		return
+	}
+	currentIndex, objCount := ExtractGetBulkParams(r)
+	if objCount > MAX_OBJECTS_IN_GETBULK {
+		gApiMgr.logger.Err(fmt.Sprintln("Too many audit log entries requested", objCount))
+		RespondErrorForApiCall(w, SRBulkGetTooLarge, "")
+		return
+	}
+	resp.CurrentMarker = currentIndex
+	resp.NextMarker, resp.MoreExist, resp.Objects = gApiMgr.auditMgr.Query(query, currentIndex, objCount)
+	resp.ObjCount = int64(len(resp.Objects))
+	js, err := json.Marshal(resp)
+	if err != nil {
+		gApiMgr.logger.Err("Error marshalling the audit log")
+		RespondErrorForApiCall(w, SRRespMarshalErr, err.Error())
+		return
+	}
+	atomic.AddInt32(&gApiMgr.ApiCallStats.NumGetCallsSuccess, 1)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(js)
+	return
+}
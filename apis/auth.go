@@ -0,0 +1,291 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package apis
+
+import (
+	"config/auth"
+	"config/telemetry"
+	"errors"
+	"github.com/gorilla/mux"
+	modelActions "models/actions"
+	modelObjs "models/objects"
+	"net/http"
+	"strings"
+)
+
+//
+// The local user store is kept in DB as User, ApiToken and Role objects,
+// with password and token hashes in place of the secrets.
+//
+type dbUserStore struct {
+	mgr *ApiMgr
+}
+
+func (store dbUserStore) getUser(userName string) (modelObjs.User, error) {
+	user := modelObjs.User{UserName: userName}
+	dbObj, err := store.mgr.dbHdl.GetObjectFromDb(user, user.GetKey())
+	if err != nil {
+		return user, auth.ErrUnknownUser
+	}
+	return dbObj.(modelObjs.User), nil
+}
+
+func (store dbUserStore) GetUser(userName string) (auth.StoredUser, error) {
+	user, err := store.getUser(userName)
+	if err != nil {
+		return auth.StoredUser{}, err
+	}
+	return auth.StoredUser{
+		Name:         user.UserName,
+		PasswordHash: user.Password,
+		Role:         user.Role,
+		Enabled:      user.Enable,
+	}, nil
+}
+
+func (store dbUserStore) GetRolePermissions(roleName string) ([]string, error) {
+	role := modelObjs.Role{Name: roleName}
+	dbObj, err := store.mgr.dbHdl.GetObjectFromDb(role, role.GetKey())
+	if err != nil {
+		return nil, err
+	}
+	return dbObj.(modelObjs.Role).Permissions, nil
+}
+
+//
+// Tokens of users which are not in the local store are accepted, as such
+// users are authenticated by an external authenticator.
+//
+func (store dbUserStore) FindToken(token string) (string, error) {
+	tokens, err := store.mgr.dbHdl.GetAllObjFromDb(modelObjs.ApiToken{})
+	if err != nil {
+		return "", err
+	}
+	for _, obj := range tokens {
+		apiToken := obj.(modelObjs.ApiToken)
+		if !auth.VerifyToken(apiToken.Token, token) {
+			continue
+		}
+		if user, err := store.getUser(apiToken.UserName); err == nil && !user.Enable {
+			return "", auth.ErrAuthFailed
+		}
+		return apiToken.UserName, nil
+	}
+	return "", auth.ErrAuthFailed
+}
+
+func (mgr *ApiMgr) ConfigureAuth(cfg auth.AuthConfig) error {
+	authMgr, err := auth.InitializeAuthMgr(cfg, dbUserStore{mgr}, mgr.logger)
+	if err != nil {
+		return err
+	}
+	mgr.authMgr = authMgr
+	mgr.allowedOrigins = make(map[string]bool, len(cfg.AllowedOrigins))
+	for _, origin := range cfg.AllowedOrigins {
+		mgr.allowedOrigins[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+	}
+	if authMgr.IsEnabled() {
+		mgr.logger.Info("REST API authentication is enabled")
+	}
+	return nil
+}
+
+//
+// Authenticate API requests and pass the user on in the request context
+//
+func Authenticate(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !gApiMgr.authMgr.IsEnabled() {
+			inner.ServeHTTP(w, r)
+			return
+		}
+		user, err := gApiMgr.authMgr.AuthenticateRequest(r)
+		if err != nil {
+			if err != auth.ErrNoAuth {
+				gApiMgr.logger.Info("Authentication failed from", r.RemoteAddr, err)
+			}
+			RespondErrorForApiCall(w, SRAuthFailed, "")
+			return
+		}
+		inner.ServeHTTP(w, auth.WithUser(r, user))
+	})
+}
+
+//
+// Permission needed for r as category, verb and object name, from the route
+// and method. ok is false for requests which are not API calls.
+//
+func getRequestPermission(r *http.Request) (category, verb, object string, ok bool) {
+	object = mux.Vars(r)["rest"]
+	path := ReplaceMultipleSeperatorInUrl(r.URL.Path) + "/"
+	switch {
+	case path == METRICS_PATH+"/", path == telemetry.METRICS_PATH+"/":
+		category, verb, object = auth.PERM_STATE, auth.PERM_GET, METRICS_OBJECT
+	case strings.HasPrefix(path, gApiMgr.apiBaseConfig):
+		category = auth.PERM_CONFIG
+		switch r.Method {
+		case "POST":
+			verb = auth.PERM_CREATE
+		case "PATCH":
+			verb = auth.PERM_UPDATE
+		case "DELETE":
+			verb = auth.PERM_DELETE
+		default:
+			verb = auth.PERM_GET
+		}
+		if _, exist := modelObjs.ConfigObjectMap[strings.ToLower(object)]; !exist && verb == auth.PERM_GET {
+			object = strings.TrimSuffix(object, "s")
+		}
+	case strings.HasPrefix(path, gApiMgr.apiBaseState), strings.HasPrefix(path, gApiMgr.apiBaseHistory):
+		category, verb = auth.PERM_STATE, auth.PERM_GET
+		if _, exist := modelObjs.ConfigObjectMap[strings.ToLower(object)+"state"]; !exist {
+			object = strings.TrimSuffix(object, "s")
+		}
+	case strings.HasPrefix(path, gApiMgr.apiBaseAction):
+		category, verb = auth.PERM_ACTION, auth.PERM_EXECUTE
+	case strings.HasPrefix(path, gApiMgr.apiBaseEvent), strings.HasPrefix(path, gApiMgr.apiBaseStream):
+		category, verb = auth.PERM_EVENT, auth.PERM_GET
+	case strings.HasPrefix(path, gApiMgr.apiBaseAudit):
+		// Audit log queries read ConfigLog state
+		category, verb, object = auth.PERM_STATE, auth.PERM_GET, "ConfigLog"
+	default:
+		return "", "", "", false
+	}
+	return category, verb, object, object != ""
+}
+
+//
+// Refuse operations which the Access of the object does not allow: changes
+// to objects without "w" and state reads of objects without "r".
+//
+func checkObjectAccess(category, verb, object string) error {
+	key := strings.ToLower(object)
+	if category == auth.PERM_STATE {
+		key = key + "state"
+	} else if category != auth.PERM_CONFIG || verb == auth.PERM_GET {
+		return nil
+	}
+	objInfo, exist := gApiMgr.objectMgr.GetConfigObjHdlMap()[key]
+	if !exist {
+		return nil
+	}
+	access := "w"
+	if category == auth.PERM_STATE {
+		access = "r"
+	}
+	if !strings.Contains(objInfo.Access, access) {
+		return errors.New("Access of " + object + " is " + objInfo.Access)
+	}
+	return nil
+}
+
+//
+// Check Access of the object and, with authentication enabled, the role of
+// the user for API requests. Requests without a permission are left to the
+// admin role.
+//
+func Authorize(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		category, verb, object, ok := getRequestPermission(r)
+		if !ok {
+			if user, _ := auth.GetRequestAuthUser(r); gApiMgr.authMgr.IsEnabled() && user.Role != auth.ROLE_ADMIN {
+				gApiMgr.logger.Info("User", user.Name, "role", user.Role, "may not access", r.URL.Path)
+				RespondErrorForApiCall(w, SRForbidden, "")
+				return
+			}
+			inner.ServeHTTP(w, r)
+			return
+		}
+		if err := checkObjectAccess(category, verb, object); err != nil {
+			RespondErrorForApiCall(w, SRForbidden, err.Error())
+			return
+		}
+		if gApiMgr.authMgr.IsEnabled() {
+			user, _ := auth.GetRequestAuthUser(r)
+			if err := gApiMgr.authMgr.Authorize(user, category, verb, object); err != nil {
+				gApiMgr.logger.Info("User", user.Name, "role", user.Role, "may not", verb, category, object)
+				RespondErrorForApiCall(w, SRForbidden, "")
+				return
+			}
+		}
+		inner.ServeHTTP(w, r)
+	})
+}
+
+//
+// ApplyConfig creates and updates the objects it carries, so the user needs
+// those permissions on every object type in it
+//
+func authorizeActionData(r *http.Request, actionObj modelActions.ActionObj) error {
+	applyConfig, ok := actionObj.(modelActions.ApplyConfig)
+	if !ok || !gApiMgr.authMgr.IsEnabled() {
+		return nil
+	}
+	objTypes := make([]string, 0, len(applyConfig.ConfigData))
+	hasTokens := false
+	for objType, _ := range applyConfig.ConfigData {
+		objTypes = append(objTypes, objType)
+		hasTokens = hasTokens || strings.EqualFold(objType, TOKEN_OBJECT)
+	}
+	user, _ := auth.GetRequestAuthUser(r)
+	err := gApiMgr.authMgr.AuthorizeObjects(user, auth.PERM_CONFIG,
+		[]string{auth.PERM_CREATE, auth.PERM_UPDATE}, objTypes)
+	if err == nil && hasTokens {
+		// The tokens may be of any user, see authorizeTokenOwner
+		err = gApiMgr.authMgr.AuthorizeObjects(user, auth.PERM_CONFIG,
+			[]string{auth.PERM_UPDATE}, []string{TOKEN_OWNER_OBJECT})
+	}
+	if err != nil {
+		gApiMgr.logger.Info("User", user.Name, "role", user.Role, "ApplyConfig:", err)
+	}
+	return err
+}
+
+const (
+	TOKEN_OBJECT       = "ApiToken"
+	TOKEN_OWNER_OBJECT = "User"
+)
+
+//
+// An ApiToken authenticates as its UserName, so creating, changing or
+// deleting a token of another user needs config:update:User as well
+//
+func authorizeTokenOwner(r *http.Request, objs ...modelObjs.ConfigObj) error {
+	if !gApiMgr.authMgr.IsEnabled() {
+		return nil
+	}
+	user, _ := auth.GetRequestAuthUser(r)
+	for _, obj := range objs {
+		apiToken, ok := obj.(modelObjs.ApiToken)
+		if !ok || apiToken.UserName == user.Name {
+			continue
+		}
+		if err := gApiMgr.authMgr.Authorize(user, auth.PERM_CONFIG, auth.PERM_UPDATE, TOKEN_OWNER_OBJECT); err != nil {
+			gApiMgr.logger.Info("User", user.Name, "role", user.Role, "may not manage ApiToken", apiToken.Name,
+				"of user", apiToken.UserName)
+			return errors.New("ApiToken " + apiToken.Name + " belongs to user " + apiToken.UserName)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package apis
+
+import (
+	"config/auth"
+	"config/metrics"
+	"config/objects"
+	"config/telemetry"
+	"fmt"
+	modelObjs "models/objects"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"utils/logging"
+)
+
+var logger *logging.Writer
+
+func TestMain(m *testing.M) {
+	var err error
+	logger, err = logging.NewLogger("confd", "Apis", true)
+	if err != nil {
+		fmt.Println("Failed to start logger", err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+// Users, with their tokens as names, and custom roles
+type testUserStore struct {
+	users map[string]string
+	roles map[string][]string
+}
+
+func (store testUserStore) GetUser(userName string) (auth.StoredUser, error) {
+	role, exist := store.users[userName]
+	if !exist {
+		return auth.StoredUser{}, auth.ErrUnknownUser
+	}
+	return auth.StoredUser{Name: userName, Role: role, Enabled: true}, nil
+}
+
+func (store testUserStore) FindToken(token string) (string, error) {
+	if _, exist := store.users[token]; !exist {
+		return "", auth.ErrAuthFailed
+	}
+	return token, nil
+}
+
+func (store testUserStore) GetRolePermissions(role string) ([]string, error) {
+	perms, exist := store.roles[role]
+	if !exist {
+		return nil, auth.ErrUnknownUser
+	}
+	return perms, nil
+}
+
+func newTestApiMgr(t *testing.T) *ApiMgr {
+	store := testUserStore{
+		users: map[string]string{
+			"viewer": auth.ROLE_READ_ONLY,
+			"ports":  "port-viewer",
+			"root":   auth.ROLE_ADMIN,
+			"tokens": "token-user",
+		},
+		roles: map[string][]string{
+			"port-viewer": {"state:get:PortState"},
+			"token-user":  {"config:create:ApiToken", "config:update:ApiToken", "config:delete:ApiToken"},
+		},
+	}
+	authMgr, err := auth.InitializeAuthMgr(auth.AuthConfig{Enable: true}, store, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr := &ApiMgr{logger: logger, objectMgr: new(objects.ObjectMgr), authMgr: authMgr, apiVer: "v1"}
+	mgr.apiBase = "/public/" + mgr.apiVer + "/"
+	gApiMgr = mgr
+	return mgr
+}
+
+func serveAs(handler http.Handler, token, path string) int {
+	r := httptest.NewRequest("GET", path, nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestMetricsAuthorization(t *testing.T) {
+	newTestApiMgr(t)
+	for path, handler := range map[string]http.Handler{
+		METRICS_PATH:           Authenticate(Authorize(metrics.Handler())),
+		telemetry.METRICS_PATH: Authenticate(Authorize(telemetry.Handler())),
+	} {
+		if code := serveAs(handler, "ports", path); code != http.StatusForbidden {
+			t.Error("Expected a role without", METRICS_OBJECT, "denied", path, "got", code)
+		}
+		if code := serveAs(handler, "viewer", path); code == http.StatusForbidden {
+			t.Error("Expected the read-only role allowed", path)
+		}
+	}
+}
+
+func TestAuthorizeUnknownRoute(t *testing.T) {
+	newTestApiMgr(t)
+	handler := Authenticate(Authorize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	if code := serveAs(handler, "viewer", "/public/v1/other"); code != http.StatusForbidden {
+		t.Error("Expected a route without a permission denied, got", code)
+	}
+	if code := serveAs(handler, "root", "/public/v1/other"); code != http.StatusOK {
+		t.Error("Expected a route without a permission allowed for admin, got", code)
+	}
+}
+
+func TestAuthorizeTokenOwner(t *testing.T) {
+	newTestApiMgr(t)
+	asUser := func(name, role string) *http.Request {
+		return auth.WithUser(httptest.NewRequest("POST", "/public/v1/config/ApiToken", nil),
+			auth.AuthUser{Name: name, Role: role})
+	}
+	own := modelObjs.ApiToken{Name: "ci", UserName: "tokens"}
+	other := modelObjs.ApiToken{Name: "root-ci", UserName: "root"}
+	if err := authorizeTokenOwner(asUser("tokens", "token-user"), own); err != nil {
+		t.Error("Expected a token of the user allowed, got", err)
+	}
+	if err := authorizeTokenOwner(asUser("tokens", "token-user"), own, other); err == nil {
+		t.Error("Expected a token of another user denied")
+	}
+	if err := authorizeTokenOwner(asUser("root", auth.ROLE_ADMIN), own); err != nil {
+		t.Error("Expected admin allowed to manage any token, got", err)
+	}
+}
+
+func TestWebSocketOrigin(t *testing.T) {
+	mgr := newTestApiMgr(t)
+	mgr.allowedOrigins = map[string]bool{"https://noc.example.com": true}
+	for origin, allowed := range map[string]bool{
+		"":                        true,
+		"http://switch1:8080":     true,
+		"https://noc.example.com": true,
+		"https://evil.example":    false,
+		"http://switch1":          false,
+	} {
+		r := httptest.NewRequest("GET", "http://switch1:8080/public/v1/stream/All", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		if err := checkWebSocketOrigin(r); (err == nil) != allowed {
+			t.Error("Origin", origin, "allowed", err == nil)
+		}
+	}
+}
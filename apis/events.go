@@ -0,0 +1,60 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package apis
+
+import (
+	"config/objects"
+	"errors"
+	"net/http"
+	"time"
+)
+
+//
+// Selection of events in an event get. from and to take the same times as
+// history queries, owner, severity and source take comma separated lists
+// and key matches part of the event key. Events are in time order, newest
+// first with sort=desc. CurrentMarker and Count page as in bulk gets.
+//
+func parseEventQuery(r *http.Request) (query objects.EventQuery, err error) {
+	now := time.Now()
+	params := r.URL.Query()
+	if query.From, err = parseHistoryTime(params.Get("from"), now); err != nil {
+		return query, errors.New("Invalid from " + params.Get("from"))
+	}
+	if query.To, err = parseHistoryTime(params.Get("to"), now); err != nil {
+		return query, errors.New("Invalid to " + params.Get("to"))
+	}
+	query.Owners = parseFilterList(params.Get("owner"))
+	query.Severities = parseFilterList(params.Get("severity"))
+	query.Sources = parseFilterList(params.Get("source"))
+	query.Key = params.Get("key")
+	switch params.Get("sort") {
+	case "", "asc":
+	case "desc":
+		query.Descending = true
+	default:
+		return query, errors.New("Invalid sort " + params.Get("sort"))
+	}
+	return query, nil
+}
@@ -0,0 +1,261 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package apis
+
+import (
+	"config/eventstream"
+	"config/objects"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	modelEvents "models/events"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+//
+// Events as they land in the DB, over WebSocket or as server-sent events.
+// The resource is an event type or ALL_EVENT_TYPES. Streams resume after
+// the Last-Event-ID header or lastEventId parameter; owner, severity and
+// type take comma separated lists and key matches part of the event key.
+//
+const (
+	ALL_EVENT_TYPES        = "all"
+	SSE_KEEPALIVE_INTERVAL = 15 * time.Second
+	SSE_RETRY_MSECS        = 3000
+	WS_CLOSE_NORMAL        = 1000
+	WS_CLOSE_GOING_AWAY    = 1001
+	WS_CLOSE_TRY_AGAIN     = 1013
+)
+
+type streamNotice struct {
+	Notice string `json:"Notice"`
+	LastId uint64 `json:"LastId"`
+	Error  string `json:"Error,omitempty"`
+}
+
+// Reads the events of the known event types for the streamer
+type eventReader struct {
+	dbHdl *objects.DbHandler
+}
+
+func (reader eventReader) GetEventKeys() (map[string][]string, error) {
+	keyMap, err := reader.dbHdl.GetEventKeys()
+	if err != nil {
+		return nil, err
+	}
+	for eventType, _ := range keyMap {
+		if !isEventType(eventType) {
+			delete(keyMap, eventType)
+		}
+	}
+	return keyMap, nil
+}
+
+func (reader eventReader) GetEventsByKey(keys []string) ([]interface{}, error) {
+	return reader.dbHdl.GetEventsByKey(keys)
+}
+
+func (mgr *ApiMgr) StopEventStreams() {
+	mgr.eventStreamer.Stop()
+}
+
+func (mgr *ApiMgr) GetEventStreamer() *eventstream.Streamer {
+	return mgr.eventStreamer
+}
+
+func isEventType(resource string) bool {
+	_, exist := modelEvents.EventObjectMap[resource]
+	_, confd := objects.GetConfdEventType(resource)
+	return exist || confd
+}
+
+func parseFilterList(value string) map[string]bool {
+	list := make(map[string]bool)
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			list[name] = true
+		}
+	}
+	return list
+}
+
+func parseStreamRequest(r *http.Request) (filter eventstream.Filter, resume bool, lastId uint64, err error) {
+	params := r.URL.Query()
+	resource := strings.ToLower(mux.Vars(r)["rest"])
+	if resource == ALL_EVENT_TYPES {
+		filter.Types = parseFilterList(params.Get("type"))
+	} else {
+		filter.Types = map[string]bool{resource: true}
+	}
+	for eventType, _ := range filter.Types {
+		if !isEventType(eventType) {
+			return filter, false, 0, fmt.Errorf("Unknown event type %s", eventType)
+		}
+	}
+	filter.Owners = parseFilterList(params.Get("owner"))
+	filter.Severities = parseFilterList(params.Get("severity"))
+	filter.Key = params.Get("key")
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = params.Get("lastEventId")
+	}
+	if value != "" {
+		if lastId, err = strconv.ParseUint(value, 10, 64); err != nil {
+			return filter, false, 0, fmt.Errorf("Invalid last event id %s", value)
+		}
+		resume = true
+	}
+	return filter, resume, lastId, nil
+}
+
+func EventStream(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt32(&gApiMgr.ApiCallStats.NumGetCalls, 1)
+	filter, resume, lastId, err := parseStreamRequest(r)
+	if err != nil {
+		RespondErrorForApiCall(w, SRInvalidQuery, err.Error())
+		return
+	}
+	sub, backlog, gap, err := gApiMgr.eventStreamer.Subscribe(filter, resume, lastId)
+	if err != nil {
+		RespondErrorForApiCall(w, SRSystemNotReady, err.Error())
+		return
+	}
+	defer gApiMgr.eventStreamer.Unsubscribe(sub)
+	if isWebSocketRequest(r) {
+		streamWebSocket(w, r, sub, backlog, gap, lastId)
+	} else {
+		streamServerSentEvents(w, r, sub, backlog, gap, lastId)
+	}
+}
+
+func streamWebSocket(w http.ResponseWriter, r *http.Request, sub *eventstream.Subscriber, backlog []eventstream.Event, gap bool, lastId uint64) {
+	ws, err := upgradeWebSocket(w, r)
+	if err == errOriginNotAllowed {
+		gApiMgr.logger.Info("WebSocket from", r.RemoteAddr, "refused, origin", r.Header.Get("Origin"))
+		RespondErrorForApiCall(w, SRForbidden, err.Error())
+		return
+	}
+	if err != nil {
+		RespondErrorForApiCall(w, SRInvalidQuery, err.Error())
+		return
+	}
+	defer ws.Close()
+	send := func(msg interface{}) bool {
+		data, _ := json.Marshal(msg)
+		return ws.WriteText(data) == nil
+	}
+	if gap && !send(streamNotice{Notice: "gap", LastId: lastId}) {
+		return
+	}
+	for _, event := range backlog {
+		if !send(event) {
+			return
+		}
+		lastId = event.Id
+	}
+	for {
+		select {
+		case <-ws.Done():
+			return
+		case event, ok := <-sub.C:
+			if !ok {
+				if sub.Err() == eventstream.ErrSlowConsumer {
+					send(streamNotice{Notice: "dropped", LastId: lastId, Error: sub.Err().Error()})
+					ws.CloseWithReason(WS_CLOSE_TRY_AGAIN, "slow consumer")
+				} else {
+					ws.CloseWithReason(WS_CLOSE_GOING_AWAY, "shutdown")
+				}
+				return
+			}
+			if !send(event) {
+				return
+			}
+			lastId = event.Id
+		}
+	}
+}
+
+func writeServerSentEvent(w http.ResponseWriter, id uint64, eventType string, msg interface{}) bool {
+	data, _ := json.Marshal(msg)
+	var err error
+	if id > 0 {
+		_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, eventType, data)
+	} else {
+		_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventType, data)
+	}
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return err == nil
+}
+
+func streamServerSentEvents(w http.ResponseWriter, r *http.Request, sub *eventstream.Subscriber, backlog []eventstream.Event, gap bool, lastId uint64) {
+	if _, ok := w.(http.Flusher); !ok {
+		RespondErrorForApiCall(w, SRServerError, "Streaming is not supported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", SSE_RETRY_MSECS)
+	if gap && !writeServerSentEvent(w, 0, "gap", streamNotice{Notice: "gap", LastId: lastId}) {
+		return
+	}
+	for _, event := range backlog {
+		if !writeServerSentEvent(w, event.Id, event.Type, event) {
+			return
+		}
+		lastId = event.Id
+	}
+	keepalive := time.NewTicker(SSE_KEEPALIVE_INTERVAL)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+		case event, ok := <-sub.C:
+			if !ok {
+				if sub.Err() == eventstream.ErrSlowConsumer {
+					writeServerSentEvent(w, 0, "dropped",
+						streamNotice{Notice: "dropped", LastId: lastId, Error: sub.Err().Error()})
+				}
+				return
+			}
+			if !writeServerSentEvent(w, event.Id, event.Type, event) {
+				return
+			}
+			lastId = event.Id
+		}
+	}
+}
@@ -0,0 +1,118 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package apis
+
+import (
+	"config/telemetry"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	modelObjs "models/objects"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//
+// History of state objects sampled by the telemetry exporter. from and to
+// are RFC3339 times, unix seconds, or durations before now such as -1h.
+// step is a duration or a number of seconds. Other parameters filter on
+// key attributes.
+//
+func parseHistoryTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if strings.HasPrefix(value, "-") {
+		if ago, err := time.ParseDuration(value); err == nil {
+			return now.Add(ago), nil
+		}
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Unix(0, int64(seconds*float64(time.Second))), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func parseHistoryStep(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	return time.ParseDuration(value)
+}
+
+func parseHistoryQuery(r *http.Request) (query telemetry.HistoryQuery, err error) {
+	now := time.Now()
+	params := r.URL.Query()
+	if query.From, err = parseHistoryTime(params.Get("from"), now); err != nil {
+		return query, errors.New("Invalid from " + params.Get("from"))
+	}
+	if query.To, err = parseHistoryTime(params.Get("to"), now); err != nil {
+		return query, errors.New("Invalid to " + params.Get("to"))
+	}
+	if query.Step, err = parseHistoryStep(params.Get("step")); err != nil || query.Step < 0 {
+		return query, errors.New("Invalid step " + params.Get("step"))
+	}
+	query.KeyFilters = make(map[string]string)
+	for param, values := range params {
+		if param == "from" || param == "to" || param == "step" || len(values) == 0 {
+			continue
+		}
+		query.KeyFilters[param] = values[0]
+	}
+	return query, nil
+}
+
+func GetStateHistory(w http.ResponseWriter, r *http.Request) {
+	resource := strings.ToLower(mux.Vars(r)["rest"]) + "state"
+	if _, exist := modelObjs.ConfigObjectMap[resource]; !exist {
+		RespondErrorForApiCall(w, SRNotFound, "")
+		return
+	}
+	query, err := parseHistoryQuery(r)
+	if err != nil {
+		RespondErrorForApiCall(w, SRInvalidQuery, err.Error())
+		return
+	}
+	history, err := telemetry.GetHistory(resource, query)
+	if err == telemetry.ErrNoHistory {
+		RespondErrorForApiCall(w, SRNotFound, err.Error())
+		return
+	} else if err != nil {
+		RespondErrorForApiCall(w, SRInvalidQuery, err.Error())
+		return
+	}
+	js, err := json.Marshal(history)
+	if err != nil {
+		RespondErrorForApiCall(w, SRRespMarshalErr, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(js)
+}
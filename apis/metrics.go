@@ -0,0 +1,185 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package apis
+
+import (
+	"bufio"
+	"config/metrics"
+	"context"
+	"errors"
+	modelActions "models/actions"
+	modelEvents "models/events"
+	modelObjs "models/objects"
+	"net"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//
+// Both metrics endpoints need the state get permission on METRICS_OBJECT, as
+// the exported state objects can be read through them
+//
+const (
+	METRICS_PATH   = "/metrics"
+	METRICS_OBJECT = "Metrics"
+)
+
+var (
+	apiRequests = metrics.NewCounterVec("confd_api_requests_total",
+		"REST API requests by method, category, resource and SR result code",
+		"method", "category", "resource", "code")
+	apiRequestLatency = metrics.NewHistogramVec("confd_api_request_duration_seconds",
+		"REST API request latency", metrics.DefaultBuckets,
+		"method", "category", "resource")
+)
+
+type metricsContextKey struct{}
+
+//
+// Response writer of API requests which keeps the HTTP status and the SR
+// code of the response for the request metrics and the audit log. Handlers
+// which do not report an SR code get SRSuccess or SRFail by HTTP status.
+//
+type metricsResponseWriter struct {
+	http.ResponseWriter
+	status     int
+	srCode     int
+	start      time.Time
+	audited    bool
+	auditKey   string
+	auditObjId string
+}
+
+func (rw *metricsResponseWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *metricsResponseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Event streams take over the connection for WebSocket
+func (rw *metricsResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("Connection can not be hijacked")
+	}
+	if rw.status == 0 {
+		rw.status = http.StatusSwitchingProtocols
+	}
+	return hijacker.Hijack()
+}
+
+func (rw *metricsResponseWriter) resultCode() int {
+	switch {
+	case rw.srCode >= 0:
+		return rw.srCode
+	case rw.status == 0 || rw.status < http.StatusBadRequest:
+		return SRSuccess
+	}
+	return SRFail
+}
+
+// Record the SR code of the response to r or w
+func setResultCode(w http.ResponseWriter, r *http.Request, errCode int) {
+	if rw, ok := w.(*metricsResponseWriter); ok {
+		rw.srCode = errCode
+	} else if rw, ok := getMetricsResponseWriter(r); ok {
+		rw.srCode = errCode
+	}
+}
+
+func getMetricsResponseWriter(r *http.Request) (*metricsResponseWriter, bool) {
+	if r == nil {
+		return nil, false
+	}
+	rw, ok := r.Context().Value(metricsContextKey{}).(*metricsResponseWriter)
+	return rw, ok
+}
+
+func objTypeName(obj interface{}) string {
+	objType := reflect.TypeOf(obj)
+	if objType.Kind() == reflect.Ptr {
+		objType = objType.Elem()
+	}
+	return objType.Name()
+}
+
+//
+// Resource label of a request. Names which are not objects of the model are
+// counted as "unknown" to keep the number of series bounded.
+//
+func metricsResource(category, object string) string {
+	key := strings.ToLower(object)
+	var obj interface{}
+	var exist bool
+	switch category {
+	case "config":
+		obj, exist = modelObjs.ConfigObjectMap[key]
+	case "state":
+		obj, exist = modelObjs.ConfigObjectMap[key+"state"]
+	case "action":
+		obj, exist = modelActions.ActionObjectMap[key]
+	case "event":
+		obj, exist = modelEvents.EventObjectMap[key]
+	}
+	if !exist || obj == nil {
+		return "unknown"
+	}
+	return objTypeName(obj)
+}
+
+func recordApiRequest(rw *metricsResponseWriter, r *http.Request, start time.Time) {
+	category, _, object, ok := getRequestPermission(r)
+	if !ok {
+		return
+	}
+	resource := metricsResource(category, object)
+	apiRequests.Inc(r.Method, category, resource, strconv.Itoa(rw.resultCode()))
+	apiRequestLatency.Observe(time.Since(start).Seconds(), r.Method, category, resource)
+}
+
+func withMetrics(w http.ResponseWriter, r *http.Request) (*metricsResponseWriter, *http.Request) {
+	rw := &metricsResponseWriter{ResponseWriter: w, srCode: -1, start: time.Now()}
+	return rw, r.WithContext(context.WithValue(r.Context(), metricsContextKey{}, rw))
+}
+
+func (mgr *ApiMgr) initializeMetrics() {
+	metrics.NewGaugeFunc("confd_api_log_entries", "Entries in the audit log",
+		func() float64 {
+			return float64(mgr.auditMgr.Len())
+		})
+	metrics.NewGaugeFunc("confd_api_log_capacity", "Entries kept in the audit log by MaxEntries",
+		func() float64 {
+			return float64(mgr.auditMgr.Capacity())
+		})
+}
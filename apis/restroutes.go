@@ -25,17 +25,22 @@ package apis
 
 import (
 	"config/actions"
+	"config/audit"
+	"config/auth"
 	"config/clients"
+	"config/eventstream"
+	"config/metrics"
 	"config/objects"
+	"config/telemetry"
 	"github.com/gorilla/mux"
 	"models/events"
 	modelObjs "models/objects"
 	"net/http"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"time"
 	"utils/logging"
-	"utils/ringBuffer"
 )
 
 type ApiRoute struct {
@@ -48,28 +53,34 @@ type ApiRoute struct {
 type ApiRoutes []ApiRoute
 
 type ApiMgr struct {
-	logger        *logging.Writer
-	clientMgr     *clients.ClientMgr
-	objectMgr     *objects.ObjectMgr
-	actionMgr     *actions.ActionMgr
-	dbHdl         *objects.DbHandler
-	apiVer        string
-	apiBase       string
-	apiBaseConfig string
-	apiBaseState  string
-	apiBaseAction string
-	apiBaseEvent  string
-	basePath      string
-	fullPath      string
-	pRestRtr      *mux.Router
-	restRoutes    []ApiRoute
-	apiCallSeqNum uint32
-	apiLogRB      *ringBuffer.RingBuffer
-	ApiCallStats  ApiCallStats
+	logger         *logging.Writer
+	clientMgr      *clients.ClientMgr
+	objectMgr      *objects.ObjectMgr
+	actionMgr      *actions.ActionMgr
+	dbHdl          *objects.DbHandler
+	apiVer         string
+	apiBase        string
+	apiBaseConfig  string
+	apiBaseState   string
+	apiBaseAction  string
+	apiBaseEvent   string
+	apiBaseHistory string
+	apiBaseStream  string
+	apiBaseAudit   string
+	basePath       string
+	fullPath       string
+	pRestRtr       *mux.Router
+	restRoutes     []ApiRoute
+	auditMgr       *audit.AuditMgr
+	ApiCallStats   ApiCallStats
+	authMgr        *auth.AuthMgr
+	eventStreamer  *eventstream.Streamer
+	allowedOrigins map[string]bool
 }
 
 var gApiMgr *ApiMgr
 
+// Counters are updated atomically, read them with Get
 type ApiCallStats struct {
 	NumCreateCalls        int32
 	NumCreateCallsSuccess int32
@@ -83,6 +94,21 @@ type ApiCallStats struct {
 	NumActionCallsSuccess int32
 }
 
+func (stats *ApiCallStats) Get() ApiCallStats {
+	return ApiCallStats{
+		NumCreateCalls:        atomic.LoadInt32(&stats.NumCreateCalls),
+		NumCreateCallsSuccess: atomic.LoadInt32(&stats.NumCreateCallsSuccess),
+		NumDeleteCalls:        atomic.LoadInt32(&stats.NumDeleteCalls),
+		NumDeleteCallsSuccess: atomic.LoadInt32(&stats.NumDeleteCallsSuccess),
+		NumUpdateCalls:        atomic.LoadInt32(&stats.NumUpdateCalls),
+		NumUpdateCallsSuccess: atomic.LoadInt32(&stats.NumUpdateCallsSuccess),
+		NumGetCalls:           atomic.LoadInt32(&stats.NumGetCalls),
+		NumGetCallsSuccess:    atomic.LoadInt32(&stats.NumGetCallsSuccess),
+		NumActionCalls:        atomic.LoadInt32(&stats.NumActionCalls),
+		NumActionCallsSuccess: atomic.LoadInt32(&stats.NumActionCallsSuccess),
+	}
+}
+
 func InitializeApiMgr(paramsDir string, logger *logging.Writer, dbHdl *objects.DbHandler, clientMgr *clients.ClientMgr, objectMgr *objects.ObjectMgr, actionMgr *actions.ActionMgr) *ApiMgr {
 	var err error
 	mgr := new(ApiMgr)
@@ -97,16 +123,18 @@ func InitializeApiMgr(paramsDir string, logger *logging.Writer, dbHdl *objects.D
 	mgr.apiBaseState = mgr.apiBase + "state/"
 	mgr.apiBaseAction = mgr.apiBase + "action/"
 	mgr.apiBaseEvent = mgr.apiBase + "event/"
+	mgr.apiBaseHistory = mgr.apiBase + "history/"
+	mgr.apiBaseStream = mgr.apiBase + "stream/"
+	mgr.apiBaseAudit = mgr.apiBase + "audit/"
 	if mgr.fullPath, err = filepath.Abs(paramsDir); err != nil {
 		logger.Err("Unable to get absolute path for " + paramsDir + " Error: " + err.Error())
 		return nil
 	}
 	mgr.basePath, _ = filepath.Split(mgr.fullPath)
-	mgr.apiCallSeqNum = 0
-	mgr.apiLogRB = new(ringBuffer.RingBuffer)
-	mgr.apiLogRB.SetRingBufferCapacity(1024)
-	mgr.ReadApiCallInfoFromDb()
+	mgr.auditMgr = audit.InitializeAuditMgr(paramsDir, logger, dbHdl)
+	mgr.initializeMetrics()
 	gApiMgr = mgr
+	mgr.eventStreamer = eventstream.NewStreamer(eventReader{mgr.dbHdl}, logger)
 	return mgr
 }
 
@@ -134,6 +162,20 @@ func (mgr *ApiMgr) InitializeEventRestRoutes() bool {
 		}
 		mgr.restRoutes = append(mgr.restRoutes, rt)
 	}
+	for _, resource := range objects.GetConfdEventTypes() {
+		rt = ApiRoute{resource + "events",
+			"GET",
+			mgr.apiBaseEvent + "{rest:[a-zA-Z0-9]+}",
+			HandleRestRouteEvent,
+		}
+		mgr.restRoutes = append(mgr.restRoutes, rt)
+	}
+	rt = ApiRoute{"eventstream",
+		"GET",
+		mgr.apiBaseStream + "{rest:[a-zA-Z0-9]+}",
+		HandleRestRouteEventStream,
+	}
+	mgr.restRoutes = append(mgr.restRoutes, rt)
 	return true
 }
 
@@ -202,6 +244,18 @@ func (mgr *ApiMgr) InitializeRestRoutes() bool {
 		HandleRestRouteGetState,
 	}
 	mgr.restRoutes = append(mgr.restRoutes, rt)
+	rt = ApiRoute{"history",
+		"GET",
+		mgr.apiBaseHistory + "{rest:[a-zA-Z0-9]+}",
+		HandleRestRouteHistory,
+	}
+	mgr.restRoutes = append(mgr.restRoutes, rt)
+	rt = ApiRoute{"audit",
+		"GET",
+		strings.TrimSuffix(mgr.apiBaseAudit, "/"),
+		HandleRestRouteAudit,
+	}
+	mgr.restRoutes = append(mgr.restRoutes, rt)
 	return true
 }
 
@@ -288,6 +342,16 @@ func HandleRestRouteBulkGetState(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
+func HandleRestRouteHistory(w http.ResponseWriter, r *http.Request) {
+	GetStateHistory(w, r)
+	return
+}
+
+func HandleRestRouteAudit(w http.ResponseWriter, r *http.Request) {
+	AuditLogGet(w, r)
+	return
+}
+
 func HandleRestRouteAction(w http.ResponseWriter, r *http.Request) {
 	ExecuteActionObject(w, r)
 	return
@@ -298,59 +362,31 @@ func HandleRestRouteEvent(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
-func (mgr *ApiMgr) ReadApiCallInfoFromDb() error {
-	apiInfo := modelObjs.ConfigLogState{}
-	apiInfos, err := mgr.dbHdl.GetAllObjFromDb(apiInfo)
-	if err == nil {
-		for _, apiInfo := range apiInfos {
-			mgr.apiCallSeqNum++
-			mgr.apiLogRB.InsertIntoRingBuffer(apiInfo)
-		}
-	}
-	return nil
+func HandleRestRouteEventStream(w http.ResponseWriter, r *http.Request) {
+	EventStream(w, r)
+	return
 }
 
 func (mgr *ApiMgr) StoreApiCallInfo(r *http.Request, api, operation string, body []byte, errCode int, errStr string) error {
 	var result string
-	var data string
-	mgr.apiCallSeqNum++
+	setResultCode(nil, r, errCode)
 	if errCode == SRSuccess {
-		result = "Success"
+		result = audit.RESULT_SUCCESS
 	} else {
 		result = errStr
 	}
-	data = strings.Replace(string(body), "\\", "", -1)
-	data = strings.Replace(data, "\"", "", -1)
-	apiInfo := modelObjs.ConfigLogState{
-		SeqNum:    mgr.apiCallSeqNum,
-		API:       api,
-		Time:      time.Now().String(),
-		Operation: operation,
-		Data:      data,
-		Result:    result,
-		UserAddr:  r.RemoteAddr,
-		UserName:  "", // confd does not know username information
-	}
-	err := mgr.dbHdl.StoreObjectInDb(apiInfo)
-	if err != nil {
-		mgr.logger.Info("Failed to store ApiCall information.", err)
-		return err
-	} else {
-		_, oldApiInfo := mgr.apiLogRB.InsertIntoRingBuffer(apiInfo)
-		if oldApiInfo != nil {
-			err = mgr.dbHdl.DeleteObjectFromDb(apiInfo)
-			if err != nil {
-				mgr.logger.Info("Failed to delete old ApiCall information.", err)
-			}
-		}
-	}
-	return nil
+	entry := newAuditEntry(r, api, operation, errCode, result)
+	entry.Data = string(auth.ScrubSecretsJson(body))
+	_, err := mgr.auditMgr.Record(entry)
+	return err
 }
 
 func Logger(inner http.Handler, name string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		inner.ServeHTTP(w, r)
+		rw, r := withMetrics(w, r)
+		inner.ServeHTTP(rw, r)
+		recordApiRequest(rw, r, start)
 		gApiMgr.logger.Debug("%s\t%s\t%s\n", r.Method, r.RequestURI, time.Since(start))
 	})
 }
@@ -365,9 +401,11 @@ func (mgr *ApiMgr) InstantiateRestRtr() *mux.Router {
 
 	for _, route := range mgr.restRoutes {
 		var handler http.Handler
-		handler = Logger(route.HandlerFunc, route.Name)
+		handler = Logger(Authenticate(AuditReads(Authorize(route.HandlerFunc))), route.Name)
 		mgr.pRestRtr.Methods(route.Method).Path(route.Pattern).Handler(handler)
 	}
+	mgr.pRestRtr.Methods("GET").Path(METRICS_PATH).Handler(Authenticate(Authorize(metrics.Handler())))
+	mgr.pRestRtr.Methods("GET").Path(telemetry.METRICS_PATH).Handler(Authenticate(Authorize(telemetry.Handler())))
 	mgr.pRestRtr.PathPrefix("rest:/[a-zA-Z0-9]+").Handler(http.StripPrefix("rest:/[a-zA-Z0-9]+", http.FileServer(http.Dir(mgr.fullPath+"/flexui"))))
 	mgr.pRestRtr.PathPrefix("/settings/").Handler(http.StripPrefix("/settings/", http.FileServer(http.Dir(mgr.fullPath+"/flexui"))))
 	mgr.pRestRtr.PathPrefix("/performance/").Handler(http.StripPrefix("/performance/", http.FileServer(http.Dir(mgr.fullPath+"/flexui"))))
@@ -0,0 +1,238 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package apis
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+//
+// Just enough of RFC 6455 to push text messages to a client: the server
+// side handshake, unfragmented text frames, ping and close. Messages from
+// the client are discarded.
+//
+const (
+	WS_GUID            = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	WS_OP_TEXT         = 0x1
+	WS_OP_CLOSE        = 0x8
+	WS_OP_PING         = 0x9
+	WS_OP_PONG         = 0xA
+	WS_WRITE_TIMEOUT   = 10 * time.Second
+	WS_MAX_READ_LENGTH = 64 * 1024
+)
+
+var errNotWebSocket = errors.New("Not a WebSocket upgrade request")
+var errOriginNotAllowed = errors.New("Origin is not allowed")
+
+type wsConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	mutex  sync.Mutex
+	closed chan struct{}
+	once   sync.Once
+}
+
+func headerContains(r *http.Request, name, value string) bool {
+	for _, field := range strings.Split(r.Header.Get(name), ",") {
+		if strings.EqualFold(strings.TrimSpace(field), value) {
+			return true
+		}
+	}
+	return false
+}
+
+func isWebSocketRequest(r *http.Request) bool {
+	return headerContains(r, "Connection", "upgrade") && headerContains(r, "Upgrade", "websocket")
+}
+
+func wsAcceptKey(key string) string {
+	hash := sha1.Sum([]byte(key + WS_GUID))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+//
+// Browsers open WebSockets to any site, with the user's credentials, and
+// leave it to the server to check the Origin of the page. Only pages served
+// from the same host and origins in Auth AllowedOrigins may open a stream.
+// Clients which are not browsers send no Origin.
+//
+func checkWebSocketOrigin(r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	if originUrl, err := url.Parse(origin); err == nil && strings.EqualFold(originUrl.Host, r.Host) {
+		return nil
+	}
+	if gApiMgr.allowedOrigins[strings.ToLower(origin)] {
+		return nil
+	}
+	return errOriginNotAllowed
+}
+
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !isWebSocketRequest(r) || key == "" || r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return nil, errNotWebSocket
+	}
+	if err := checkWebSocketOrigin(r); err != nil {
+		return nil, err
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, errors.New("Connection can not be upgraded")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + wsAcceptKey(key) + "\r\n\r\n"
+	conn.SetWriteDeadline(time.Now().Add(WS_WRITE_TIMEOUT))
+	if _, err := conn.Write([]byte(response)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	ws := &wsConn{conn: conn, reader: rw.Reader, closed: make(chan struct{})}
+	go ws.readLoop()
+	return ws, nil
+}
+
+func (ws *wsConn) writeFrame(opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode}
+	switch length := len(payload); {
+	case length < 126:
+		header = append(header, byte(length))
+	case length <= 0xFFFF:
+		header = append(header, 126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(length))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(length))
+	}
+	ws.mutex.Lock()
+	defer ws.mutex.Unlock()
+	// A client which does not read is dropped at the deadline
+	ws.conn.SetWriteDeadline(time.Now().Add(WS_WRITE_TIMEOUT))
+	if _, err := ws.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (ws *wsConn) WriteText(payload []byte) error {
+	return ws.writeFrame(WS_OP_TEXT, payload)
+}
+
+func (ws *wsConn) readFrame() (opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err = io.ReadFull(ws.reader, header[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode = header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(ws.reader, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(ws.reader, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if !masked || length > WS_MAX_READ_LENGTH {
+		return 0, nil, errors.New("Invalid WebSocket frame")
+	}
+	var mask [4]byte
+	if _, err = io.ReadFull(ws.reader, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(ws.reader, payload); err != nil {
+		return 0, nil, err
+	}
+	for idx := range payload {
+		payload[idx] ^= mask[idx%4]
+	}
+	return opcode, payload, nil
+}
+
+// Answer pings and notice when the client goes away
+func (ws *wsConn) readLoop() {
+	defer ws.Close()
+	for {
+		opcode, payload, err := ws.readFrame()
+		if err != nil {
+			return
+		}
+		switch opcode {
+		case WS_OP_PING:
+			if ws.writeFrame(WS_OP_PONG, payload) != nil {
+				return
+			}
+		case WS_OP_CLOSE:
+			ws.writeFrame(WS_OP_CLOSE, nil)
+			return
+		}
+	}
+}
+
+// Closed when the connection is
+func (ws *wsConn) Done() <-chan struct{} {
+	return ws.closed
+}
+
+// Close with a close frame carrying code and reason
+func (ws *wsConn) CloseWithReason(code uint16, reason string) {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, code)
+	ws.writeFrame(WS_OP_CLOSE, append(payload, reason...))
+	ws.Close()
+}
+
+func (ws *wsConn) Close() {
+	ws.once.Do(func() {
+		ws.conn.Close()
+		close(ws.closed)
+	})
+}
@@ -0,0 +1,683 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package audit
+
+import (
+	"config/clients"
+	"config/metrics"
+	"config/objects"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	modelObjs "models/objects"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"utils/logging"
+)
+
+//
+// The audit log keeps a ConfigLogState entry for each API call, in
+// SeqNum order, in the DB and in memory. Entries beyond MaxEntries or
+// older than MaxAge are deleted shortly after new ones are recorded and
+// every DEFAULT_PURGE_INTERVAL. Entries are exported in the background;
+// at most MAX_PENDING_EXPORTS wait for a slow export, older ones are
+// dropped from the export.
+//
+const (
+	DEFAULT_MAX_ENTRIES         = 10000
+	DEFAULT_PURGE_INTERVAL      = time.Hour
+	DEFAULT_CHECKPOINT_INTERVAL = 15 * time.Minute
+	MAX_PENDING_EXPORTS         = 10000
+
+	RESULT_SUCCESS = "Success"
+)
+
+var ErrReadOnly = errors.New("ConfigLogState is read only")
+
+//
+// Audit log policy, Audit in systemProfile.json. MaxAge is a duration such
+// as 2160h, MaxEntries defaults to DEFAULT_MAX_ENTRIES. Reads adds GET
+// calls to the log. Entries are also written to syslog with Syslog and
+// appended as JSON lines to File when set. The chain head is signed every
+// CheckpointInterval, DEFAULT_CHECKPOINT_INTERVAL by default.
+//
+type AuditConfig struct {
+	MaxEntries         int    `json:"MaxEntries"`
+	MaxAge             string `json:"MaxAge"`
+	Reads              bool   `json:"Reads"`
+	Syslog             bool   `json:"Syslog"`
+	File               string `json:"File"`
+	CheckpointInterval string `json:"CheckpointInterval"`
+}
+
+type AuditMgr struct {
+	logger             *logging.Writer
+	dbHdl              *objects.DbHandler
+	paramsDir          string
+	mutex              sync.Mutex
+	entries            []modelObjs.ConfigLogState
+	seqNum             uint32
+	headHash           string
+	signingKey         ed25519.PrivateKey
+	signedSeqNum       uint32
+	maxEntries         int
+	maxAge             time.Duration
+	checkpointInterval time.Duration
+	reads              bool
+	purgeCh            chan struct{}
+	pendingMutex       sync.Mutex
+	pending            []modelObjs.ConfigLogState
+	exportCh           chan struct{}
+	exportMutex        sync.Mutex
+	exporters          []exporter
+	stopCh             chan struct{}
+	wg                 sync.WaitGroup
+}
+
+var gAuditMgr *AuditMgr
+
+var auditEntries = metrics.NewCounterVec("confd_audit_entries_total",
+	"Entries recorded in the audit log by operation", "operation")
+
+type entriesBySeqNum []modelObjs.ConfigLogState
+
+func (entries entriesBySeqNum) Len() int {
+	return len(entries)
+}
+
+func (entries entriesBySeqNum) Less(i, j int) bool {
+	return entries[i].SeqNum < entries[j].SeqNum
+}
+
+func (entries entriesBySeqNum) Swap(i, j int) {
+	entries[i], entries[j] = entries[j], entries[i]
+}
+
+//
+// Time of an entry. Entries recorded before the audit log kept RFC3339
+// times have the format of time.Time.String.
+//
+func entryTime(entry modelObjs.ConfigLogState) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339Nano, entry.Time); err == nil {
+		return t, true
+	}
+	value := entry.Time
+	if idx := strings.Index(value, " m="); idx >= 0 {
+		value = value[:idx]
+	}
+	t, err := time.Parse("2006-01-02 15:04:05.999999999 -0700 MST", value)
+	return t, err == nil
+}
+
+//
+// Load the stored audit log and the checkpoint signing key of paramsDir,
+// and register the manager as handler of ConfigLogState objects. The log
+// is kept by the default policy until Configure is called. Without a
+// signing key checkpoints are stored unsigned and fail verification.
+//
+func InitializeAuditMgr(paramsDir string, logger *logging.Writer, dbHdl *objects.DbHandler) *AuditMgr {
+	var err error
+	mgr := new(AuditMgr)
+	mgr.logger = logger
+	mgr.dbHdl = dbHdl
+	mgr.paramsDir = paramsDir
+	mgr.maxEntries = DEFAULT_MAX_ENTRIES
+	mgr.checkpointInterval = DEFAULT_CHECKPOINT_INTERVAL
+	mgr.purgeCh = make(chan struct{}, 1)
+	mgr.exportCh = make(chan struct{}, 1)
+	mgr.stopCh = make(chan struct{})
+	if mgr.signingKey, err = loadSigningKey(paramsDir); err != nil {
+		logger.Err("Failed to load the audit log signing key", err)
+	}
+	objs, err := dbHdl.GetAllObjFromDb(modelObjs.ConfigLogState{})
+	if err != nil {
+		logger.Err("Failed to read the audit log", err)
+	}
+	for _, obj := range objs {
+		if entry, ok := obj.(modelObjs.ConfigLogState); ok {
+			mgr.entries = append(mgr.entries, entry)
+		}
+	}
+	sort.Sort(entriesBySeqNum(mgr.entries))
+	if len(mgr.entries) > 0 {
+		mgr.seqNum = mgr.entries[len(mgr.entries)-1].SeqNum
+		mgr.headHash = mgr.entries[len(mgr.entries)-1].Hash
+	}
+	head, err := mgr.loadCheckpoint(CHECKPOINT_HEAD)
+	if err == ErrNoCheckpoint {
+		// Kept in the DB by earlier versions
+		if head, err = mgr.loadDbCheckpoint(CHECKPOINT_HEAD); err == nil {
+			if err = mgr.saveCheckpoint(head); err == nil {
+				dbHdl.DoLocked("DEL", CHECKPOINT_KEY_PREFIX+CHECKPOINT_HEAD)
+			}
+		}
+	}
+	if err == nil {
+		mgr.signedSeqNum = head.SeqNum
+	} else if err != ErrNoCheckpoint {
+		logger.Err("Failed to read the audit log head", err)
+	}
+	clients.RegisterLocalObjectHandler("ConfigLogState", mgr)
+	mgr.wg.Add(2)
+	go mgr.run()
+	go mgr.runExports()
+	gAuditMgr = mgr
+	return mgr
+}
+
+func GetAuditMgr() *AuditMgr {
+	return gAuditMgr
+}
+
+func parseAuditConfig(cfg AuditConfig) (maxEntries int, maxAge, checkpointInterval time.Duration, err error) {
+	if cfg.MaxAge != "" {
+		if maxAge, err = time.ParseDuration(cfg.MaxAge); err != nil || maxAge <= 0 {
+			return 0, 0, 0, errors.New("Invalid MaxAge " + cfg.MaxAge)
+		}
+	}
+	if cfg.MaxEntries < 0 {
+		return 0, 0, 0, errors.New("Invalid MaxEntries")
+	}
+	maxEntries = cfg.MaxEntries
+	if maxEntries == 0 {
+		maxEntries = DEFAULT_MAX_ENTRIES
+	}
+	checkpointInterval = DEFAULT_CHECKPOINT_INTERVAL
+	if cfg.CheckpointInterval != "" {
+		checkpointInterval, err = time.ParseDuration(cfg.CheckpointInterval)
+		if err != nil || checkpointInterval <= 0 {
+			return 0, 0, 0, errors.New("Invalid CheckpointInterval " + cfg.CheckpointInterval)
+		}
+	}
+	return maxEntries, maxAge, checkpointInterval, nil
+}
+
+//
+// Apply the policy of cfg, replacing the running one. An invalid policy,
+// or an export which can not be opened, keeps the running one.
+//
+func (mgr *AuditMgr) Configure(cfg AuditConfig) error {
+	maxEntries, maxAge, checkpointInterval, err := parseAuditConfig(cfg)
+	if err != nil {
+		return err
+	}
+	exporters, err := newExporters(cfg)
+	if err != nil {
+		return err
+	}
+	mgr.mutex.Lock()
+	mgr.maxEntries = maxEntries
+	mgr.maxAge = maxAge
+	mgr.checkpointInterval = checkpointInterval
+	mgr.reads = cfg.Reads
+	mgr.purge(time.Now())
+	mgr.mutex.Unlock()
+	mgr.exportMutex.Lock()
+	oldExporters := mgr.exporters
+	mgr.exporters = exporters
+	mgr.exportMutex.Unlock()
+	closeExporters(oldExporters)
+	return nil
+}
+
+func (mgr *AuditMgr) Stop() {
+	if mgr == nil {
+		return
+	}
+	close(mgr.stopCh)
+	mgr.wg.Wait()
+	mgr.mutex.Lock()
+	mgr.signHead()
+	mgr.mutex.Unlock()
+	mgr.exportPending()
+	mgr.exportMutex.Lock()
+	closeExporters(mgr.exporters)
+	mgr.exporters = nil
+	mgr.exportMutex.Unlock()
+}
+
+func (mgr *AuditMgr) getCheckpointInterval() time.Duration {
+	mgr.mutex.Lock()
+	defer mgr.mutex.Unlock()
+	return mgr.checkpointInterval
+}
+
+func (mgr *AuditMgr) run() {
+	defer mgr.wg.Done()
+	ticker := time.NewTicker(DEFAULT_PURGE_INTERVAL)
+	defer ticker.Stop()
+	checkpoint := time.NewTimer(mgr.getCheckpointInterval())
+	defer checkpoint.Stop()
+	for {
+		select {
+		case <-mgr.stopCh:
+			return
+		case <-ticker.C:
+			mgr.mutex.Lock()
+			mgr.purge(time.Now())
+			mgr.mutex.Unlock()
+		case <-mgr.purgeCh:
+			mgr.mutex.Lock()
+			mgr.purge(time.Now())
+			mgr.mutex.Unlock()
+		case <-checkpoint.C:
+			mgr.mutex.Lock()
+			mgr.signHead()
+			mgr.mutex.Unlock()
+			checkpoint.Reset(mgr.getCheckpointInterval())
+		}
+	}
+}
+
+func (mgr *AuditMgr) runExports() {
+	defer mgr.wg.Done()
+	for {
+		select {
+		case <-mgr.stopCh:
+			return
+		case <-mgr.exportCh:
+			mgr.exportPending()
+		}
+	}
+}
+
+// Queue entry for export, dropping the oldest beyond MAX_PENDING_EXPORTS
+func (mgr *AuditMgr) queueExport(entry modelObjs.ConfigLogState) {
+	mgr.pendingMutex.Lock()
+	if len(mgr.pending) >= MAX_PENDING_EXPORTS {
+		mgr.logger.Err("Audit log export is behind, not exporting entry", mgr.pending[0].SeqNum)
+		mgr.pending = mgr.pending[1:]
+	}
+	mgr.pending = append(mgr.pending, entry)
+	mgr.pendingMutex.Unlock()
+	select {
+	case mgr.exportCh <- struct{}{}:
+	default:
+	}
+}
+
+// Export the queued entries in SeqNum order
+func (mgr *AuditMgr) exportPending() {
+	mgr.exportMutex.Lock()
+	defer mgr.exportMutex.Unlock()
+	mgr.pendingMutex.Lock()
+	pending := mgr.pending
+	mgr.pending = nil
+	mgr.pendingMutex.Unlock()
+	for _, entry := range pending {
+		for _, exp := range mgr.exporters {
+			if err := exp.Export(entry); err != nil {
+				mgr.logger.Err("Failed to export audit log entry", entry.SeqNum, err)
+			}
+		}
+	}
+}
+
+// Whether GET calls are recorded
+func (mgr *AuditMgr) RecordsReads() bool {
+	mgr.mutex.Lock()
+	defer mgr.mutex.Unlock()
+	return mgr.reads
+}
+
+func (mgr *AuditMgr) Len() int {
+	mgr.mutex.Lock()
+	defer mgr.mutex.Unlock()
+	return len(mgr.entries)
+}
+
+// Entries kept by MaxEntries
+func (mgr *AuditMgr) Capacity() int {
+	mgr.mutex.Lock()
+	defer mgr.mutex.Unlock()
+	return mgr.maxEntries
+}
+
+//
+// Record entry with the next SeqNum. Exporting the entry and deleting the
+// entries the policy no longer keeps are left to the background.
+//
+func (mgr *AuditMgr) Record(entry modelObjs.ConfigLogState) (modelObjs.ConfigLogState, error) {
+	mgr.mutex.Lock()
+	defer mgr.mutex.Unlock()
+	entry.SeqNum = mgr.seqNum + 1
+	if entry.Time == "" {
+		entry.Time = time.Now().Format(time.RFC3339Nano)
+	}
+	entry.PrevHash = mgr.headHash
+	entry.Hash = EntryHash(entry)
+	if mgr.headHash == "" {
+		// Start of the chain, after any entries recorded without one. The
+		// head is signed at the anchor so that it is never missing.
+		if err := mgr.startChain(); err != nil {
+			return entry, err
+		}
+	}
+	if err := mgr.dbHdl.StoreObjectInDb(entry); err != nil {
+		// The SeqNum is used by the next entry, the chain has no gaps
+		mgr.logger.Err("Failed to store audit log entry", entry.SeqNum, err)
+		return entry, err
+	}
+	mgr.seqNum = entry.SeqNum
+	mgr.headHash = entry.Hash
+	mgr.entries = append(mgr.entries, entry)
+	auditEntries.Inc(entry.Operation)
+	mgr.queueExport(entry)
+	if len(mgr.entries) > mgr.maxEntries || mgr.maxAge > 0 {
+		select {
+		case mgr.purgeCh <- struct{}{}:
+		default:
+		}
+	}
+	return entry, nil
+}
+
+//
+// Delete the oldest entries beyond maxEntries or older than maxAge. The
+// last deleted entry is signed first as the anchor of the chain. Must be
+// called with mutex held.
+//
+func (mgr *AuditMgr) purge(now time.Time) {
+	count := 0
+	for count < len(mgr.entries) {
+		if len(mgr.entries)-count <= mgr.maxEntries {
+			if mgr.maxAge == 0 {
+				break
+			}
+			if t, ok := entryTime(mgr.entries[count]); ok && now.Sub(t) <= mgr.maxAge {
+				break
+			}
+		}
+		count++
+	}
+	if count == 0 {
+		return
+	}
+	last := mgr.entries[count-1]
+	if err := mgr.storeCheckpoint(CHECKPOINT_ANCHOR, last.SeqNum, last.Hash); err != nil {
+		mgr.logger.Err("Failed to store the audit log anchor, keeping old entries", err)
+		return
+	}
+	for _, entry := range mgr.entries[:count] {
+		if err := mgr.dbHdl.DeleteObjectFromDb(entry); err != nil {
+			mgr.logger.Err("Failed to delete audit log entry", entry.SeqNum, err)
+		}
+	}
+	mgr.entries = append([]modelObjs.ConfigLogState(nil), mgr.entries[count:]...)
+}
+
+// Anchor and sign the head of a new chain at SeqNum. Must be called with
+// mutex held.
+func (mgr *AuditMgr) startChain() error {
+	if err := mgr.storeCheckpoint(CHECKPOINT_ANCHOR, mgr.seqNum, ""); err != nil {
+		mgr.logger.Err("Failed to store the audit log anchor", err)
+		return err
+	}
+	if err := mgr.storeCheckpoint(CHECKPOINT_HEAD, mgr.seqNum, ""); err != nil {
+		mgr.logger.Err("Failed to store the audit log head", err)
+		return err
+	}
+	mgr.signedSeqNum = mgr.seqNum
+	return nil
+}
+
+//
+// Replace the audit log by entries of a backup, along with the checkpoints
+// of the backup. Later entries continue from the last restored one.
+// Entries keep their chain only when they verify against the checkpoints
+// up to the signed head; otherwise they are kept unchained below a new
+// anchor and are not covered by a signed head.
+//
+func (mgr *AuditMgr) Restore(entries []modelObjs.ConfigLogState, anchor, head *Checkpoint) error {
+	var err error
+	mgr.mutex.Lock()
+	defer mgr.mutex.Unlock()
+	for _, entry := range mgr.entries {
+		mgr.dbHdl.DeleteObjectFromDb(entry)
+	}
+	mgr.entries = make([]modelObjs.ConfigLogState, 0, len(entries))
+	for _, entry := range entries {
+		if storeErr := mgr.dbHdl.StoreObjectInDb(entry); storeErr != nil {
+			mgr.logger.Err("Failed to restore audit log entry", entry.SeqNum, storeErr)
+			err = storeErr
+			continue
+		}
+		mgr.entries = append(mgr.entries, entry)
+	}
+	sort.Sort(entriesBySeqNum(mgr.entries))
+	mgr.headHash = ""
+	if len(mgr.entries) == 0 {
+		if startErr := mgr.startChain(); startErr != nil {
+			err = startErr
+		}
+		return err
+	}
+	last := mgr.entries[len(mgr.entries)-1]
+	mgr.seqNum = last.SeqNum
+	report := VerifyChain(mgr.entries, anchor, head, mgr.publicKey())
+	if report.Verified() && report.EntriesChecked > 0 && report.HeadSeqNum == last.SeqNum {
+		if saveErr := mgr.saveCheckpoint(anchor); saveErr != nil {
+			mgr.logger.Err("Failed to store the audit log anchor", saveErr)
+			err = saveErr
+		}
+		mgr.headHash = last.Hash
+		mgr.signedSeqNum = 0
+		mgr.signHead()
+	} else {
+		if report.Verified() {
+			report.Issue = "Entries are not covered by the signed head of the backup"
+		}
+		mgr.logger.Info("Restored audit log entries up to", last.SeqNum, "are unchained:", report.Issue)
+		if startErr := mgr.startChain(); startErr != nil {
+			err = startErr
+		}
+	}
+	mgr.purge(time.Now())
+	return err
+}
+
+//
+// Entries in SeqNum order along with the anchor and the head checkpoint,
+// signed at the last entry, for a backup
+//
+func (mgr *AuditMgr) Backup() ([]modelObjs.ConfigLogState, *Checkpoint, *Checkpoint, error) {
+	mgr.mutex.Lock()
+	defer mgr.mutex.Unlock()
+	mgr.signHead()
+	anchor, err := mgr.loadCheckpoint(CHECKPOINT_ANCHOR)
+	if err != nil && err != ErrNoCheckpoint {
+		return nil, nil, nil, err
+	}
+	head, err := mgr.loadCheckpoint(CHECKPOINT_HEAD)
+	if err != nil && err != ErrNoCheckpoint {
+		return nil, nil, nil, err
+	}
+	return append([]modelObjs.ConfigLogState(nil), mgr.entries...), anchor, head, nil
+}
+
+// Entries in SeqNum order
+func (mgr *AuditMgr) GetEntries() []modelObjs.ConfigLogState {
+	mgr.mutex.Lock()
+	defer mgr.mutex.Unlock()
+	return append([]modelObjs.ConfigLogState(nil), mgr.entries...)
+}
+
+//
+// LocalObjectHandler of ConfigLogState objects
+//
+func (mgr *AuditMgr) ApplyObject(op string, oldObj, newObj modelObjs.ConfigObj) error {
+	return ErrReadOnly
+}
+
+func (mgr *AuditMgr) GetObject(obj modelObjs.ConfigObj) (modelObjs.ConfigObj, error) {
+	seqNum := obj.(modelObjs.ConfigLogState).SeqNum
+	mgr.mutex.Lock()
+	defer mgr.mutex.Unlock()
+	idx := sort.Search(len(mgr.entries), func(i int) bool {
+		return mgr.entries[i].SeqNum >= seqNum
+	})
+	if idx == len(mgr.entries) || mgr.entries[idx].SeqNum != seqNum {
+		return nil, errors.New("No ConfigLog entry")
+	}
+	return mgr.entries[idx], nil
+}
+
+// All entries, newest first
+func (mgr *AuditMgr) GetAllObjects(obj modelObjs.ConfigObj) ([]modelObjs.ConfigObj, error) {
+	mgr.mutex.Lock()
+	defer mgr.mutex.Unlock()
+	objs := make([]modelObjs.ConfigObj, 0, len(mgr.entries))
+	for idx := len(mgr.entries) - 1; idx >= 0; idx-- {
+		objs = append(objs, mgr.entries[idx])
+	}
+	return objs, nil
+}
+
+func (mgr *AuditMgr) publicKey() ed25519.PublicKey {
+	if mgr.signingKey == nil {
+		return nil
+	}
+	return mgr.signingKey.Public().(ed25519.PublicKey)
+}
+
+func (mgr *AuditMgr) storeCheckpoint(kind string, seqNum uint32, hash string) error {
+	checkpoint := Checkpoint{
+		Kind:   kind,
+		SeqNum: seqNum,
+		Hash:   hash,
+		Time:   time.Now().Format(time.RFC3339),
+	}
+	checkpoint.sign(mgr.signingKey)
+	return mgr.saveCheckpoint(&checkpoint)
+}
+
+//
+// The head is kept in HEAD_CHECKPOINT_FILE of paramsDir rather than in the
+// DB, so that whoever can rewrite the log in the DB can not also roll the
+// signed head back. The anchor is kept in the DB.
+//
+func (mgr *AuditMgr) saveCheckpoint(checkpoint *Checkpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	if checkpoint.Kind == CHECKPOINT_HEAD {
+		fileName := filepath.Join(mgr.paramsDir, HEAD_CHECKPOINT_FILE)
+		tmpName := fileName + ".tmp"
+		if err = ioutil.WriteFile(tmpName, data, 0644); err == nil {
+			err = os.Rename(tmpName, fileName)
+		}
+		return err
+	}
+	_, err = mgr.dbHdl.DoLocked("SET", CHECKPOINT_KEY_PREFIX+checkpoint.Kind, data)
+	return err
+}
+
+// Returns ErrNoCheckpoint when none is stored
+func (mgr *AuditMgr) loadCheckpoint(kind string) (*Checkpoint, error) {
+	if kind != CHECKPOINT_HEAD {
+		return mgr.loadDbCheckpoint(kind)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(mgr.paramsDir, HEAD_CHECKPOINT_FILE))
+	if os.IsNotExist(err) {
+		return nil, ErrNoCheckpoint
+	} else if err != nil {
+		return nil, err
+	}
+	checkpoint := new(Checkpoint)
+	if err = json.Unmarshal(data, checkpoint); err != nil {
+		return nil, err
+	}
+	return checkpoint, nil
+}
+
+func (mgr *AuditMgr) loadDbCheckpoint(kind string) (*Checkpoint, error) {
+	reply, err := mgr.dbHdl.DoLocked("GET", CHECKPOINT_KEY_PREFIX+kind)
+	if err != nil {
+		return nil, err
+	}
+	data, ok := reply.([]byte)
+	if !ok {
+		return nil, ErrNoCheckpoint
+	}
+	checkpoint := new(Checkpoint)
+	if err = json.Unmarshal(data, checkpoint); err != nil {
+		return nil, err
+	}
+	return checkpoint, nil
+}
+
+// Sign the head of the chain if it moved. Must be called with mutex held.
+func (mgr *AuditMgr) signHead() {
+	if mgr.seqNum == mgr.signedSeqNum {
+		return
+	}
+	if err := mgr.storeCheckpoint(CHECKPOINT_HEAD, mgr.seqNum, mgr.headHash); err != nil {
+		mgr.logger.Err("Failed to store the audit log head", err)
+		return
+	}
+	mgr.signedSeqNum = mgr.seqNum
+}
+
+//
+// Verify the stored audit log against its checkpoints. The entries are
+// read back from the DB rather than taken from memory. A checkpoint which
+// is missing fails the verification once there are chained entries.
+//
+func (mgr *AuditMgr) Verify() (ChainReport, error) {
+	var report ChainReport
+	mgr.mutex.Lock()
+	defer mgr.mutex.Unlock()
+	objs, err := mgr.dbHdl.GetAllObjFromDb(modelObjs.ConfigLogState{})
+	if err != nil {
+		return report, err
+	}
+	entries := make([]modelObjs.ConfigLogState, 0, len(objs))
+	for _, obj := range objs {
+		if entry, ok := obj.(modelObjs.ConfigLogState); ok {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Sort(entriesBySeqNum(entries))
+	return mgr.verifyEntries(entries)
+}
+
+// Verify entries, in SeqNum order, against the stored checkpoints
+func (mgr *AuditMgr) verifyEntries(entries []modelObjs.ConfigLogState) (ChainReport, error) {
+	var report ChainReport
+	anchor, err := mgr.loadCheckpoint(CHECKPOINT_ANCHOR)
+	if err != nil && err != ErrNoCheckpoint {
+		return report, err
+	}
+	head, err := mgr.loadCheckpoint(CHECKPOINT_HEAD)
+	if err != nil && err != ErrNoCheckpoint {
+		return report, err
+	}
+	return VerifyChain(entries, anchor, head, mgr.publicKey()), nil
+}
@@ -0,0 +1,418 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package audit
+
+import (
+	"config/objects"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	modelObjs "models/objects"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"utils/logging"
+)
+
+var logger *logging.Writer
+
+func TestMain(m *testing.M) {
+	var err error
+	logger, err = logging.NewLogger("confd", "Audit", true)
+	if err != nil {
+		fmt.Println("Failed to start logger", err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+func newTestAuditMgr(t *testing.T, cfg AuditConfig) *AuditMgr {
+	dir, err := ioutil.TempDir("", "auditkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	mgr := InitializeAuditMgr(dir, logger, objects.NewMemoryDbHandler(logger))
+	if mgr.signingKey == nil {
+		t.Fatal("No signing key generated")
+	}
+	if err := mgr.Configure(cfg); err != nil {
+		t.Fatal(err)
+	}
+	return mgr
+}
+
+// Purge now rather than in the background
+func purgeNow(mgr *AuditMgr) {
+	mgr.mutex.Lock()
+	mgr.purge(time.Now())
+	mgr.mutex.Unlock()
+}
+
+func TestRetention(t *testing.T) {
+	mgr := newTestAuditMgr(t, AuditConfig{MaxEntries: 3})
+	defer mgr.Stop()
+	for idx := 0; idx < 5; idx++ {
+		mgr.Record(modelObjs.ConfigLogState{API: "confdclient", Operation: "POST"})
+	}
+	purgeNow(mgr)
+	entries := mgr.GetEntries()
+	if len(entries) != 3 || entries[0].SeqNum != 3 || entries[2].SeqNum != 5 {
+		t.Fatal("Expected entries 3 to 5, got", entries)
+	}
+
+	if err := mgr.Configure(AuditConfig{MaxAge: "1h"}); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	mgr.Restore([]modelObjs.ConfigLogState{
+		{SeqNum: 1, Time: old.String()},
+		{SeqNum: 2, Time: old.Format(time.RFC3339Nano)},
+		{SeqNum: 3, Time: time.Now().Format(time.RFC3339Nano)},
+	}, nil, nil)
+	if entries = mgr.GetEntries(); len(entries) != 1 || entries[0].SeqNum != 3 {
+		t.Fatal("Expected the entries older than MaxAge purged, got", entries)
+	}
+	// Entries continue the restored log
+	if entry, _ := mgr.Record(modelObjs.ConfigLogState{}); entry.SeqNum != 4 {
+		t.Error("Expected SeqNum 4, got", entry.SeqNum)
+	}
+	if mgr.Configure(AuditConfig{MaxAge: "-1h"}) == nil || mgr.Configure(AuditConfig{MaxEntries: -1}) == nil {
+		t.Error("Accepted invalid policy")
+	}
+}
+
+func TestQuery(t *testing.T) {
+	mgr := newTestAuditMgr(t, AuditConfig{})
+	defer mgr.Stop()
+	start := time.Now()
+	mgr.Record(modelObjs.ConfigLogState{API: "user", Operation: "POST", UserName: "admin", Result: RESULT_SUCCESS, ResultCode: 1})
+	mgr.Record(modelObjs.ConfigLogState{API: "confdclient", Operation: "UPDATE", UserName: "ops", Result: "Not found", ResultCode: 5})
+	mgr.Record(modelObjs.ConfigLogState{API: "confdclient", Operation: "GET", UserName: "ops", Result: RESULT_SUCCESS, ResultCode: 1})
+
+	for _, test := range []struct {
+		query   Query
+		seqNums []uint32
+	}{
+		{Query{}, []uint32{1, 2, 3}},
+		{Query{Descending: true}, []uint32{3, 2, 1}},
+		{Query{Users: map[string]bool{"ops": true}}, []uint32{2, 3}},
+		{Query{Resources: map[string]bool{"user": true}}, []uint32{1}},
+		{Query{Operations: map[string]bool{"get": true}}, []uint32{3}},
+		{Query{Results: map[string]bool{"failure": true}}, []uint32{2}},
+		{Query{Results: map[string]bool{"success": true, "5": true}}, []uint32{1, 2, 3}},
+		{Query{From: start.Add(-time.Minute), To: start.Add(time.Minute)}, []uint32{1, 2, 3}},
+		{Query{From: start.Add(time.Minute)}, nil},
+	} {
+		_, _, page := mgr.Query(test.query, 0, -1)
+		var seqNums []uint32
+		for _, entry := range page {
+			seqNums = append(seqNums, entry.SeqNum)
+		}
+		if len(seqNums) != len(test.seqNums) {
+			t.Error("Query", test.query, "expected", test.seqNums, "got", seqNums)
+			continue
+		}
+		for idx := range seqNums {
+			if seqNums[idx] != test.seqNums[idx] {
+				t.Error("Query", test.query, "expected", test.seqNums, "got", seqNums)
+				break
+			}
+		}
+	}
+
+	next, more, page := mgr.Query(Query{}, 0, 2)
+	if !more || next != 2 || len(page) != 2 {
+		t.Error("Expected a first page of 2, got", next, more, page)
+	}
+	if next, more, page = mgr.Query(Query{}, next, 2); more || len(page) != 1 || page[0].SeqNum != 3 {
+		t.Error("Expected a last page of entry 3, got", next, more, page)
+	}
+}
+
+func TestFileExport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "audit.log")
+	mgr := newTestAuditMgr(t, AuditConfig{File: fileName})
+	mgr.Record(modelObjs.ConfigLogState{API: "user", Operation: "POST", Data: `{"UserName":"ops"}`})
+	mgr.Record(modelObjs.ConfigLogState{API: "user", Operation: "DELETE"})
+	mgr.Stop()
+
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatal("Expected 2 exported entries, got", lines)
+	}
+	var entry modelObjs.ConfigLogState
+	if err = json.Unmarshal([]byte(lines[0]), &entry); err != nil || entry.SeqNum != 1 ||
+		entry.Data != `{"UserName":"ops"}` {
+		t.Error("Unexpected exported entry", lines[0], err)
+	}
+	if mgr.Configure(AuditConfig{File: filepath.Join(dir, "missing", "audit.log")}) == nil {
+		t.Error("Accepted a File which can not be opened")
+	}
+}
+
+type blockedExporter struct {
+	release  chan struct{}
+	exported chan uint32
+}
+
+func (exp *blockedExporter) Export(entry modelObjs.ConfigLogState) error {
+	<-exp.release
+	exp.exported <- entry.SeqNum
+	return nil
+}
+
+func (exp *blockedExporter) Close() error {
+	return nil
+}
+
+func TestRecordDoesNotWaitForExport(t *testing.T) {
+	mgr := newTestAuditMgr(t, AuditConfig{})
+	exp := &blockedExporter{release: make(chan struct{}), exported: make(chan uint32, 3)}
+	mgr.exportMutex.Lock()
+	mgr.exporters = []exporter{exp}
+	mgr.exportMutex.Unlock()
+	recorded := make(chan bool)
+	go func() {
+		for idx := 0; idx < 3; idx++ {
+			mgr.Record(modelObjs.ConfigLogState{API: "user", Operation: "POST"})
+		}
+		recorded <- true
+	}()
+	select {
+	case <-recorded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Record waited for a blocked export")
+	}
+	close(exp.release)
+	mgr.Stop()
+	close(exp.exported)
+	seqNum := uint32(0)
+	for exported := range exp.exported {
+		if exported != seqNum+1 {
+			t.Error("Entries not exported in order, got", exported, "after", seqNum)
+		}
+		seqNum = exported
+	}
+	if seqNum != 3 {
+		t.Error("Expected 3 entries exported, got", seqNum)
+	}
+}
+
+func TestSigningKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auditkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	key, err := loadSigningKey(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, PUBLIC_KEY_FILE)); err != nil {
+		t.Error("Public key not written", err)
+	}
+	if reloaded, err := loadSigningKey(dir); err != nil || !reloaded.Equal(key) {
+		t.Error("Expected the stored key, got", err)
+	}
+}
+
+func verifyTestChain(mgr *AuditMgr, entries []modelObjs.ConfigLogState) ChainReport {
+	anchor, _ := mgr.loadCheckpoint(CHECKPOINT_ANCHOR)
+	head, _ := mgr.loadCheckpoint(CHECKPOINT_HEAD)
+	return VerifyChain(entries, anchor, head, mgr.signingKey.Public().(ed25519.PublicKey))
+}
+
+func TestVerifyChain(t *testing.T) {
+	mgr := newTestAuditMgr(t, AuditConfig{MaxEntries: 5})
+	defer mgr.Stop()
+	for idx := 0; idx < 8; idx++ {
+		mgr.Record(modelObjs.ConfigLogState{API: "confdclient", Operation: "UPDATE", Data: strconv.Itoa(idx)})
+	}
+	mgr.mutex.Lock()
+	mgr.signHead()
+	mgr.mutex.Unlock()
+	mgr.Record(modelObjs.ConfigLogState{API: "user", Operation: "POST"})
+	purgeNow(mgr)
+	entries := mgr.GetEntries()
+	if report := verifyTestChain(mgr, entries); !report.Verified() || report.EntriesChecked != 5 ||
+		report.FirstSeqNum != 5 || report.LastSeqNum != 9 || report.HeadSeqNum != 8 {
+		t.Fatal("Expected entries 5 to 9 verified, got", report)
+	}
+
+	tamper := func(edit func([]modelObjs.ConfigLogState) []modelObjs.ConfigLogState) ChainReport {
+		return verifyTestChain(mgr, edit(append([]modelObjs.ConfigLogState(nil), entries...)))
+	}
+	for _, test := range []struct {
+		name   string
+		edit   func([]modelObjs.ConfigLogState) []modelObjs.ConfigLogState
+		seqNum uint32
+	}{
+		{"edited", func(e []modelObjs.ConfigLogState) []modelObjs.ConfigLogState {
+			e[1].Data = "x"
+			return e
+		}, 6},
+		{"edited and hashed", func(e []modelObjs.ConfigLogState) []modelObjs.ConfigLogState {
+			e[1].Data = "x"
+			e[1].Hash = EntryHash(e[1])
+			return e
+		}, 7},
+		{"deleted", func(e []modelObjs.ConfigLogState) []modelObjs.ConfigLogState {
+			return append(e[:2], e[3:]...)
+		}, 7},
+		{"oldest deleted", func(e []modelObjs.ConfigLogState) []modelObjs.ConfigLogState {
+			return e[1:]
+		}, 5},
+		{"truncated", func(e []modelObjs.ConfigLogState) []modelObjs.ConfigLogState {
+			return e[:2]
+		}, 7},
+		{"rewritten", func(e []modelObjs.ConfigLogState) []modelObjs.ConfigLogState {
+			prevHash := e[0].PrevHash
+			for idx := range e {
+				e[idx].Result = "x"
+				e[idx].PrevHash = prevHash
+				e[idx].Hash = EntryHash(e[idx])
+				prevHash = e[idx].Hash
+			}
+			return e
+		}, 8},
+	} {
+		if report := tamper(test.edit); report.Verified() || report.BrokenSeqNum != test.seqNum {
+			t.Error("Expected", test.name, "log broken at", test.seqNum, "got", report)
+		}
+	}
+
+	anchor, _ := mgr.loadCheckpoint(CHECKPOINT_ANCHOR)
+	anchor.Hash = entries[1].Hash
+	if report := VerifyChain(entries, anchor, nil, mgr.signingKey.Public().(ed25519.PublicKey)); report.Verified() {
+		t.Error("Accepted a forged anchor checkpoint")
+	}
+}
+
+func TestVerifyUnchainedEntries(t *testing.T) {
+	mgr := newTestAuditMgr(t, AuditConfig{})
+	defer mgr.Stop()
+	mgr.Restore([]modelObjs.ConfigLogState{{SeqNum: 1}, {SeqNum: 2}}, nil, nil)
+	mgr.Record(modelObjs.ConfigLogState{API: "user", Operation: "POST"})
+	purgeNow(mgr)
+	entries := mgr.GetEntries()
+	if report := verifyTestChain(mgr, entries); !report.Verified() || report.Unchained != 2 || report.EntriesChecked != 1 {
+		t.Error("Expected 2 unchained and 1 verified entry, got", report)
+	}
+	// Entries stripped of their hashes do not pass for older ones
+	entries[2].PrevHash, entries[2].Hash = "", ""
+	if report := verifyTestChain(mgr, entries); report.Verified() || report.BrokenSeqNum != 3 {
+		t.Error("Expected an unchained entry after the anchor broken, got", report)
+	}
+}
+
+func TestVerifyMissingCheckpoint(t *testing.T) {
+	mgr := newTestAuditMgr(t, AuditConfig{})
+	defer mgr.Stop()
+	if report, err := mgr.verifyEntries(mgr.GetEntries()); err != nil || !report.Verified() {
+		t.Fatal("Expected an empty log verified, got", report, err)
+	}
+	for idx := 0; idx < 3; idx++ {
+		mgr.Record(modelObjs.ConfigLogState{API: "user", Operation: "POST"})
+	}
+	mgr.mutex.Lock()
+	mgr.signHead()
+	mgr.mutex.Unlock()
+	if report, err := mgr.verifyEntries(mgr.GetEntries()); err != nil || !report.Verified() || report.HeadSeqNum != 3 {
+		t.Fatal("Expected entries 1 to 3 verified, got", report, err)
+	}
+	// The head is not kept in the DB
+	if data, _ := mgr.dbHdl.Do("GET", CHECKPOINT_KEY_PREFIX+CHECKPOINT_HEAD); data != nil {
+		t.Error("Expected no head checkpoint in the DB")
+	}
+
+	headFile := filepath.Join(mgr.paramsDir, HEAD_CHECKPOINT_FILE)
+	data, err := ioutil.ReadFile(headFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(headFile)
+	if report, err := mgr.verifyEntries(mgr.GetEntries()); err != nil || report.Verified() || report.BrokenSeqNum != 1 {
+		t.Error("Expected the log broken without the head checkpoint, got", report, err)
+	}
+	ioutil.WriteFile(headFile, []byte("{"), 0644)
+	if _, err := mgr.verifyEntries(mgr.GetEntries()); err == nil {
+		t.Error("Expected an unreadable head checkpoint reported")
+	}
+	ioutil.WriteFile(headFile, data, 0644)
+	mgr.dbHdl.Do("DEL", CHECKPOINT_KEY_PREFIX+CHECKPOINT_ANCHOR)
+	if report, err := mgr.verifyEntries(mgr.GetEntries()); err != nil || report.Verified() || report.BrokenSeqNum != 1 {
+		t.Error("Expected the log broken without the anchor checkpoint, got", report, err)
+	}
+}
+
+func TestRestoreBackup(t *testing.T) {
+	mgr := newTestAuditMgr(t, AuditConfig{MaxEntries: 3})
+	defer mgr.Stop()
+	for idx := 0; idx < 5; idx++ {
+		mgr.Record(modelObjs.ConfigLogState{API: "user", Operation: "POST", Data: strconv.Itoa(idx)})
+	}
+	purgeNow(mgr)
+	entries, anchor, head, err := mgr.Backup()
+	if err != nil || len(entries) != 3 || anchor == nil || head == nil || head.SeqNum != 5 {
+		t.Fatal("Expected entries 3 to 5 with their checkpoints, got", entries, anchor, head, err)
+	}
+
+	mgr.Restore(entries, anchor, head)
+	if report, err := mgr.verifyEntries(mgr.GetEntries()); err != nil || !report.Verified() || report.EntriesChecked != 3 ||
+		report.Unchained != 0 || report.HeadSeqNum != 5 {
+		t.Error("Expected the restored entries verified, got", report, err)
+	}
+	if entry, _ := mgr.Record(modelObjs.ConfigLogState{}); entry.PrevHash != entries[2].Hash {
+		t.Error("Expected the chain continued from the restored entries, got", entry)
+	}
+
+	tampered := append([]modelObjs.ConfigLogState(nil), entries...)
+	tampered[1].Data = "x"
+	tampered[1].Hash = EntryHash(tampered[1])
+	mgr.Restore(tampered, anchor, head)
+	report, err := mgr.verifyEntries(mgr.GetEntries())
+	if err != nil || !report.Verified() || report.Unchained != 3 || report.EntriesChecked != 0 {
+		t.Error("Expected the tampered entries unchained, got", report, err)
+	}
+	if report.HeadSeqNum != 0 {
+		t.Error("Expected the tampered entries not signed, got head", report.HeadSeqNum)
+	}
+	if entry, _ := mgr.Record(modelObjs.ConfigLogState{}); entry.SeqNum != 6 || entry.PrevHash != "" {
+		t.Error("Expected a new chain after the unchained entries, got", entry)
+	}
+}
@@ -0,0 +1,252 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package audit
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	modelObjs "models/objects"
+	"os"
+	"path/filepath"
+)
+
+//
+// Entries are chained by hash: each entry keeps the Hash of the entry
+// before it as PrevHash, and its own Hash covers PrevHash, so editing,
+// inserting or deleting an entry breaks the chain from there on. The head
+// of the chain is signed every CheckpointInterval. The entry before the
+// chain is signed as its anchor when the chain starts, and again whenever
+// old entries are deleted, so that the chain stays verifiable from its
+// first kept entry. The head is also signed at the anchor when the chain
+// starts.
+//
+const (
+	SIGNING_KEY_FILE     = "auditKey.pem"
+	PUBLIC_KEY_FILE      = "auditKey.pub"
+	HEAD_CHECKPOINT_FILE = "auditHead.json"
+
+	CHECKPOINT_HEAD   = "head"
+	CHECKPOINT_ANCHOR = "anchor"
+
+	CHECKPOINT_KEY_PREFIX = "AuditCheckpoint#"
+)
+
+//
+// Signed position in the chain. The head checkpoint is the last entry at
+// the time of signing, the anchor checkpoint the entry before the first
+// chained one, or the last deleted entry.
+//
+type Checkpoint struct {
+	Kind      string `json:"Kind"`
+	SeqNum    uint32 `json:"SeqNum"`
+	Hash      string `json:"Hash"`
+	Time      string `json:"Time"`
+	Signature string `json:"Signature"`
+}
+
+var ErrNoCheckpoint = errors.New("No audit log checkpoint")
+
+func (checkpoint *Checkpoint) message() []byte {
+	return []byte(fmt.Sprintf("confd-audit\n%s\n%d\n%s\n%s", checkpoint.Kind, checkpoint.SeqNum,
+		checkpoint.Hash, checkpoint.Time))
+}
+
+func (checkpoint *Checkpoint) sign(key ed25519.PrivateKey) {
+	checkpoint.Signature = ""
+	if key != nil {
+		checkpoint.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, checkpoint.message()))
+	}
+}
+
+func (checkpoint *Checkpoint) verify(key ed25519.PublicKey) bool {
+	signature, err := base64.StdEncoding.DecodeString(checkpoint.Signature)
+	return err == nil && key != nil && ed25519.Verify(key, checkpoint.message(), signature)
+}
+
+//
+// Hash of an entry: SHA-256, in hex, of the JSON array of its attributes
+// in this order. A fixed list keeps the hash of stored entries when
+// ConfigLogState gains attributes.
+//
+func EntryHash(entry modelObjs.ConfigLogState) string {
+	data, _ := json.Marshal([]interface{}{
+		entry.SeqNum, entry.Time, entry.UserName, entry.UserAddr, entry.API, entry.Operation,
+		entry.Key, entry.ObjectId, entry.Data, entry.Result, entry.ResultCode, entry.Latency,
+		entry.PrevHash,
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+//
+// Load the checkpoint signing key from paramsDir, generating it on first
+// use. The public key is written next to it for verifiers outside confd.
+//
+func loadSigningKey(paramsDir string) (ed25519.PrivateKey, error) {
+	keyFile := filepath.Join(paramsDir, SIGNING_KEY_FILE)
+	data, err := ioutil.ReadFile(keyFile)
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("No PEM key in " + keyFile)
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := parsed.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errors.New("Not an Ed25519 key in " + keyFile)
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	pubKey, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return nil, err
+	}
+	if der, err = x509.MarshalPKIXPublicKey(pubKey); err == nil {
+		err = ioutil.WriteFile(filepath.Join(paramsDir, PUBLIC_KEY_FILE),
+			pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644)
+	}
+	return key, err
+}
+
+//
+// Result of a verification of the chain. BrokenSeqNum is the first entry
+// whose link is broken, Issue says how.
+//
+type ChainReport struct {
+	EntriesChecked int
+	Unchained      int
+	FirstSeqNum    uint32
+	LastSeqNum     uint32
+	HeadSeqNum     uint32
+	HeadTime       string
+	BrokenSeqNum   uint32
+	Issue          string
+}
+
+func (report *ChainReport) Verified() bool {
+	return report.Issue == ""
+}
+
+func (report *ChainReport) broken(seqNum uint32, issue string) ChainReport {
+	report.BrokenSeqNum = seqNum
+	report.Issue = issue
+	return *report
+}
+
+//
+// Verify the chain of entries, in SeqNum order, from the anchor checkpoint
+// up to at least the head checkpoint. Entries up to the anchor, recorded
+// before the chain was kept, are counted as Unchained. Chained entries
+// without both checkpoints fail.
+//
+func VerifyChain(entries []modelObjs.ConfigLogState, anchor, head *Checkpoint, key ed25519.PublicKey) ChainReport {
+	var report ChainReport
+	var prevHash string
+	var next uint32
+	for _, entry := range entries {
+		if entry.Hash == "" || (anchor != nil && entry.SeqNum <= anchor.SeqNum) {
+			continue
+		}
+		if anchor == nil {
+			return report.broken(entry.SeqNum, "No checkpoint of deleted entries")
+		}
+		if head == nil {
+			return report.broken(entry.SeqNum, "No signed chain head checkpoint")
+		}
+		break
+	}
+	if anchor != nil {
+		if !anchor.verify(key) {
+			return report.broken(anchor.SeqNum+1, "Invalid signature of the checkpoint of deleted entries")
+		}
+		prevHash = anchor.Hash
+		next = anchor.SeqNum + 1
+	}
+	if head != nil {
+		if !head.verify(key) {
+			return report.broken(head.SeqNum, "Invalid signature of the chain head checkpoint")
+		}
+		if anchor != nil && head.SeqNum <= anchor.SeqNum {
+			// Signed before the entries it covers were deleted
+			head = nil
+		} else {
+			report.HeadSeqNum = head.SeqNum
+			report.HeadTime = head.Time
+		}
+	}
+	for _, entry := range entries {
+		if anchor != nil && entry.SeqNum <= anchor.SeqNum {
+			report.Unchained++
+			continue
+		}
+		if next != 0 && entry.SeqNum != next {
+			return report.broken(next, fmt.Sprintf("Entries %d to %d are missing", next, entry.SeqNum-1))
+		}
+		if report.FirstSeqNum == 0 {
+			report.FirstSeqNum = entry.SeqNum
+		}
+		report.LastSeqNum = entry.SeqNum
+		next = entry.SeqNum + 1
+		if head != nil && entry.SeqNum == head.SeqNum && entry.Hash != head.Hash {
+			return report.broken(entry.SeqNum, "Entry does not match the signed chain head")
+		}
+		if entry.PrevHash != prevHash {
+			return report.broken(entry.SeqNum, "PrevHash does not match the entry before")
+		}
+		if EntryHash(entry) != entry.Hash {
+			return report.broken(entry.SeqNum, "Hash does not match the entry")
+		}
+		prevHash = entry.Hash
+		report.EntriesChecked++
+	}
+	if head != nil && (next == 0 || head.SeqNum >= next) {
+		if next == 0 {
+			next = 1
+		}
+		return report.broken(next, fmt.Sprintf("Entries %d to %d of the signed chain head are missing", next, head.SeqNum))
+	}
+	return report
+}
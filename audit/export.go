@@ -0,0 +1,101 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package audit
+
+import (
+	"encoding/json"
+	"log/syslog"
+	modelObjs "models/objects"
+	"os"
+)
+
+const (
+	AUDIT_SYSLOG_TAG = "confd-audit"
+	AUDIT_FILE_MODE  = 0600
+)
+
+// Each recorded entry is written to the exporters as a JSON object
+type exporter interface {
+	Export(entry modelObjs.ConfigLogState) error
+	Close() error
+}
+
+type syslogExporter struct {
+	writer *syslog.Writer
+}
+
+func (exp *syslogExporter) Export(entry modelObjs.ConfigLogState) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return exp.writer.Info(string(data))
+}
+
+func (exp *syslogExporter) Close() error {
+	return exp.writer.Close()
+}
+
+type fileExporter struct {
+	file *os.File
+}
+
+func (exp *fileExporter) Export(entry modelObjs.ConfigLogState) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = exp.file.Write(append(data, '\n'))
+	return err
+}
+
+func (exp *fileExporter) Close() error {
+	return exp.file.Close()
+}
+
+func newExporters(cfg AuditConfig) ([]exporter, error) {
+	var exporters []exporter
+	if cfg.Syslog {
+		writer, err := syslog.New(syslog.LOG_INFO|syslog.LOG_AUTHPRIV, AUDIT_SYSLOG_TAG)
+		if err != nil {
+			return nil, err
+		}
+		exporters = append(exporters, &syslogExporter{writer})
+	}
+	if cfg.File != "" {
+		file, err := os.OpenFile(cfg.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, AUDIT_FILE_MODE)
+		if err != nil {
+			closeExporters(exporters)
+			return nil, err
+		}
+		exporters = append(exporters, &fileExporter{file})
+	}
+	return exporters, nil
+}
+
+func closeExporters(exporters []exporter) {
+	for _, exp := range exporters {
+		exp.Close()
+	}
+}
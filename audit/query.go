@@ -0,0 +1,111 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package audit
+
+import (
+	modelObjs "models/objects"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	QUERY_RESULT_SUCCESS = "success"
+	QUERY_RESULT_FAILURE = "failure"
+)
+
+//
+// Selection of audit log entries. From and To bound the entry time. The
+// lists are matched case insensitively; Results holds success, failure or
+// SR codes.
+//
+type Query struct {
+	From       time.Time
+	To         time.Time
+	Users      map[string]bool
+	Resources  map[string]bool
+	Operations map[string]bool
+	Results    map[string]bool
+	Descending bool
+}
+
+func matchList(list map[string]bool, value string) bool {
+	return len(list) == 0 || list[strings.ToLower(value)]
+}
+
+func matchResult(results map[string]bool, entry modelObjs.ConfigLogState) bool {
+	if len(results) == 0 {
+		return true
+	}
+	if entry.Result == RESULT_SUCCESS {
+		if results[QUERY_RESULT_SUCCESS] {
+			return true
+		}
+	} else if results[QUERY_RESULT_FAILURE] {
+		return true
+	}
+	return results[strconv.Itoa(int(entry.ResultCode))]
+}
+
+func (query *Query) Match(entry modelObjs.ConfigLogState) bool {
+	if !query.From.IsZero() || !query.To.IsZero() {
+		t, ok := entryTime(entry)
+		if !ok || (!query.From.IsZero() && t.Before(query.From)) || (!query.To.IsZero() && t.After(query.To)) {
+			return false
+		}
+	}
+	return matchList(query.Users, entry.UserName) && matchList(query.Resources, entry.API) &&
+		matchList(query.Operations, entry.Operation) && matchResult(query.Results, entry)
+}
+
+//
+// Page of the entries selected by query, in SeqNum order. Paging works like
+// GetBulkObjFromDb: marker is the index of the first entry of the page.
+//
+func (mgr *AuditMgr) Query(query Query, marker, count int64) (nextMarker int64, more bool, page []modelObjs.ConfigLogState) {
+	entries := mgr.GetEntries()
+	matched := make([]modelObjs.ConfigLogState, 0, len(entries))
+	for idx := range entries {
+		entry := entries[idx]
+		if query.Descending {
+			entry = entries[len(entries)-1-idx]
+		}
+		if query.Match(entry) {
+			matched = append(matched, entry)
+		}
+	}
+	if marker < 0 || marker > int64(len(matched)) {
+		marker = int64(len(matched))
+	}
+	end := marker + count
+	if count < 0 || end > int64(len(matched)) {
+		end = int64(len(matched))
+	}
+	page = matched[marker:end]
+	more = end < int64(len(matched))
+	if more {
+		nextMarker = end
+	}
+	return nextMarker, more, page
+}
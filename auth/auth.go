@@ -0,0 +1,291 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"utils/logging"
+)
+
+//
+// Authentication of REST API requests. Requests carry HTTP basic
+// credentials, checked against the configured authenticators in order, or a
+// bearer API token, checked against the local token store. Authentication
+// is only enforced when enabled in systemProfile.json; requests on trusted
+// listeners are accepted without credentials.
+//
+const (
+	AUTH_TYPE_LOCAL   = "local"
+	AUTH_TYPE_COMMAND = "command"
+
+	AUTH_METHOD_BASIC   = "basic"
+	AUTH_METHOD_BEARER  = "bearer"
+	AUTH_METHOD_TRUSTED = "trusted"
+
+	AUTH_TRUSTED_USER = "local"
+	AUTH_REALM        = "confd"
+)
+
+var (
+	// An authenticator returns ErrUnknownUser, or any error other than
+	// ErrAuthFailed, to let the next authenticator try
+	ErrUnknownUser = errors.New("Unknown user")
+	ErrAuthFailed  = errors.New("Authentication failed")
+	ErrNoAuth      = errors.New("No credentials")
+)
+
+type AuthenticatorJson struct {
+	Name    string `json:"Name"`
+	Type    string `json:"Type"`
+	Command string `json:"Command"`
+	Timeout int    `json:"Timeout"`
+}
+
+//
+// DefaultRole is the role of users without one, read-only if not set
+//
+type AuthConfig struct {
+	Enable         bool                `json:"Enable"`
+	Authenticators []AuthenticatorJson `json:"Authenticators"`
+	DefaultRole    string              `json:"DefaultRole"`
+	AllowedOrigins []string            `json:"AllowedOrigins"`
+}
+
+//
+// Authenticate returns the role of the user if the authenticator knows it,
+// or an empty role to use the role of the local user or the default role.
+//
+type Authenticator interface {
+	Authenticate(userName, password string) (role string, err error)
+}
+
+type StoredUser struct {
+	Name         string
+	PasswordHash string
+	Role         string
+	Enabled      bool
+}
+
+//
+// The local store of users, API tokens and custom roles. GetUser returns
+// ErrUnknownUser for users it does not have.
+//
+type UserStore interface {
+	GetUser(userName string) (StoredUser, error)
+	FindToken(token string) (userName string, err error)
+	GetRolePermissions(role string) ([]string, error)
+}
+
+type AuthUser struct {
+	Name   string
+	Method string
+	Role   string
+}
+
+type AuthenticatorFactory func(cfg AuthenticatorJson, store UserStore) (Authenticator, error)
+
+//
+// Authenticator types by name. External authenticators, e.g. for RADIUS or
+// TACACS+, are registered here before the auth manager is initialized.
+//
+var AuthenticatorTypes = map[string]AuthenticatorFactory{
+	AUTH_TYPE_LOCAL:   newLocalAuthenticator,
+	AUTH_TYPE_COMMAND: newCommandAuthenticator,
+}
+
+func RegisterAuthenticatorType(authType string, factory AuthenticatorFactory) error {
+	if _, exist := AuthenticatorTypes[authType]; exist {
+		return errors.New("Authenticator type " + authType + " is already registered")
+	}
+	AuthenticatorTypes[authType] = factory
+	return nil
+}
+
+type namedAuthenticator struct {
+	name string
+	Authenticator
+}
+
+type AuthMgr struct {
+	logger         *logging.Writer
+	enabled        bool
+	store          UserStore
+	authenticators []namedAuthenticator
+	defaultRole    string
+}
+
+func InitializeAuthMgr(cfg AuthConfig, store UserStore, logger *logging.Writer) (*AuthMgr, error) {
+	mgr := new(AuthMgr)
+	mgr.logger = logger
+	mgr.enabled = cfg.Enable
+	mgr.store = store
+	mgr.defaultRole = cfg.DefaultRole
+	if mgr.defaultRole == "" {
+		mgr.defaultRole = ROLE_READ_ONLY
+	}
+	authCfgs := cfg.Authenticators
+	if len(authCfgs) == 0 {
+		authCfgs = []AuthenticatorJson{{Name: AUTH_TYPE_LOCAL, Type: AUTH_TYPE_LOCAL}}
+	}
+	for _, authCfg := range authCfgs {
+		factory, exist := AuthenticatorTypes[authCfg.Type]
+		if !exist {
+			return nil, errors.New("Unknown authenticator type " + authCfg.Type)
+		}
+		authenticator, err := factory(authCfg, store)
+		if err != nil {
+			return nil, errors.New("Authenticator " + authCfg.Name + ": " + err.Error())
+		}
+		name := authCfg.Name
+		if name == "" {
+			name = authCfg.Type
+		}
+		mgr.authenticators = append(mgr.authenticators, namedAuthenticator{name, authenticator})
+	}
+	return mgr, nil
+}
+
+func (mgr *AuthMgr) IsEnabled() bool {
+	return mgr != nil && mgr.enabled
+}
+
+func (mgr *AuthMgr) authenticatePassword(userName, password string) (string, error) {
+	for _, authenticator := range mgr.authenticators {
+		role, err := authenticator.Authenticate(userName, password)
+		switch err {
+		case nil:
+			return role, nil
+		case ErrAuthFailed:
+			return "", err
+		case ErrUnknownUser:
+		default:
+			mgr.logger.Err("Authenticator", authenticator.name, "failed for", userName, err)
+		}
+	}
+	return "", ErrAuthFailed
+}
+
+// Role of the local user of that name, or the default role
+func (mgr *AuthMgr) getUserRole(userName string) string {
+	if user, err := mgr.store.GetUser(userName); err == nil && user.Role != "" {
+		return user.Role
+	}
+	return mgr.defaultRole
+}
+
+//
+// Authenticate the credentials of r. Requests without credentials fail with
+// ErrNoAuth unless they came in on a trusted listener.
+//
+func (mgr *AuthMgr) AuthenticateRequest(r *http.Request) (AuthUser, error) {
+	authHdr := r.Header.Get("Authorization")
+	switch {
+	case authHdr == "":
+		if IsTrusted(r) {
+			return AuthUser{Name: AUTH_TRUSTED_USER, Method: AUTH_METHOD_TRUSTED, Role: ROLE_ADMIN}, nil
+		}
+		return AuthUser{}, ErrNoAuth
+	case strings.HasPrefix(authHdr, "Bearer "):
+		userName, err := mgr.store.FindToken(strings.TrimSpace(strings.TrimPrefix(authHdr, "Bearer ")))
+		if err != nil {
+			return AuthUser{}, ErrAuthFailed
+		}
+		return AuthUser{Name: userName, Method: AUTH_METHOD_BEARER, Role: mgr.getUserRole(userName)}, nil
+	default:
+		userName, password, ok := r.BasicAuth()
+		if !ok {
+			return AuthUser{}, ErrAuthFailed
+		}
+		role, err := mgr.authenticatePassword(userName, password)
+		if err != nil {
+			return AuthUser{}, err
+		}
+		if role == "" {
+			role = mgr.getUserRole(userName)
+		}
+		return AuthUser{Name: userName, Method: AUTH_METHOD_BASIC, Role: role}, nil
+	}
+}
+
+type contextKey int
+
+const (
+	userContextKey contextKey = iota
+	trustedContextKey
+)
+
+func WithUser(r *http.Request, user AuthUser) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), userContextKey, user))
+}
+
+// Name of the authenticated user of r, empty if there is none
+func GetRequestUser(r *http.Request) string {
+	user, _ := GetRequestAuthUser(r)
+	return user.Name
+}
+
+func GetRequestAuthUser(r *http.Request) (AuthUser, bool) {
+	user, ok := r.Context().Value(userContextKey).(AuthUser)
+	return user, ok
+}
+
+//
+// Mark requests of a listener as trusted, e.g. a unix socket for local
+// tools. Trusted requests need no credentials.
+//
+func TrustedHandler(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inner.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), trustedContextKey, true)))
+	})
+}
+
+func IsTrusted(r *http.Request) bool {
+	trusted, _ := r.Context().Value(trustedContextKey).(bool)
+	return trusted
+}
+
+type localAuthenticator struct {
+	store UserStore
+}
+
+func newLocalAuthenticator(cfg AuthenticatorJson, store UserStore) (Authenticator, error) {
+	if store == nil {
+		return nil, errors.New("No local user store")
+	}
+	return &localAuthenticator{store}, nil
+}
+
+func (local *localAuthenticator) Authenticate(userName, password string) (string, error) {
+	user, err := local.store.GetUser(userName)
+	if err != nil {
+		return "", err
+	}
+	if !user.Enabled || !VerifyPassword(user.PasswordHash, password) {
+		return "", ErrAuthFailed
+	}
+	return user.Role, nil
+}
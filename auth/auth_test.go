@@ -0,0 +1,295 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package auth
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type testStore struct {
+	users  map[string]StoredUser
+	tokens map[string]string
+	roles  map[string][]string
+}
+
+func (store *testStore) GetUser(userName string) (StoredUser, error) {
+	user, exist := store.users[userName]
+	if !exist {
+		return StoredUser{}, ErrUnknownUser
+	}
+	return user, nil
+}
+
+func (store *testStore) GetRolePermissions(role string) ([]string, error) {
+	perms, exist := store.roles[role]
+	if !exist {
+		return nil, ErrUnknownUser
+	}
+	return perms, nil
+}
+
+func (store *testStore) FindToken(token string) (string, error) {
+	for hash, userName := range store.tokens {
+		if VerifyToken(hash, token) {
+			return userName, nil
+		}
+	}
+	return "", ErrAuthFailed
+}
+
+func newTestStore(t *testing.T) *testStore {
+	adminHash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	guestHash, _ := HashPassword("guest")
+	tokenHash, err := HashToken("0123456789abcdef0123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testStore{
+		users: map[string]StoredUser{
+			"admin": {"admin", adminHash, ROLE_ADMIN, true},
+			"guest": {"guest", guestHash, "", false},
+		},
+		tokens: map[string]string{tokenHash: "admin"},
+		roles:  map[string][]string{"vlan-admin": {"config:*:Vlan", "state:get:*"}},
+	}
+}
+
+func TestPasswordHash(t *testing.T) {
+	hash, err := HashPassword("secret")
+	if err != nil || !IsPasswordHash(hash) {
+		t.Fatal("Bad hash", hash, err)
+	}
+	if other, _ := HashPassword("secret"); other == hash {
+		t.Error("Hashes of the same password are not salted")
+	}
+	if !VerifyPassword(hash, "secret") || VerifyPassword(hash, "Secret") {
+		t.Error("Password verification failed")
+	}
+	if _, err = HashToken("short"); err == nil {
+		t.Error("Short token accepted")
+	}
+}
+
+func newRequest(user, password, token string) *http.Request {
+	r, _ := http.NewRequest("GET", "/public/v1/config/Vlans", nil)
+	if user != "" {
+		r.SetBasicAuth(user, password)
+	}
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	return r
+}
+
+func TestAuthenticateRequest(t *testing.T) {
+	mgr, err := InitializeAuthMgr(AuthConfig{Enable: true}, newTestStore(t), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user, err := mgr.AuthenticateRequest(newRequest("admin", "secret", "")); err != nil || user.Name != "admin" || user.Role != ROLE_ADMIN {
+		t.Error("Basic auth failed", user, err)
+	}
+	if _, err := mgr.AuthenticateRequest(newRequest("admin", "wrong", "")); err != ErrAuthFailed {
+		t.Error("Wrong password accepted", err)
+	}
+	if _, err := mgr.AuthenticateRequest(newRequest("guest", "guest", "")); err != ErrAuthFailed {
+		t.Error("Disabled user accepted", err)
+	}
+	if _, err := mgr.AuthenticateRequest(newRequest("nobody", "secret", "")); err != ErrAuthFailed {
+		t.Error("Unknown user accepted", err)
+	}
+	if user, err := mgr.AuthenticateRequest(newRequest("", "", "0123456789abcdef0123")); err != nil || user.Method != AUTH_METHOD_BEARER || user.Role != ROLE_ADMIN {
+		t.Error("Token auth failed", user, err)
+	}
+	if _, err := mgr.AuthenticateRequest(newRequest("", "", "0123456789abcdef0124")); err != ErrAuthFailed {
+		t.Error("Wrong token accepted", err)
+	}
+	r := newRequest("", "", "")
+	if _, err := mgr.AuthenticateRequest(r); err != ErrNoAuth {
+		t.Error("Request without credentials accepted", err)
+	}
+	var trusted *http.Request
+	TrustedHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		trusted = r
+	})).ServeHTTP(nil, r)
+	if user, err := mgr.AuthenticateRequest(trusted); err != nil || user.Name != AUTH_TRUSTED_USER {
+		t.Error("Trusted request rejected", user, err)
+	}
+}
+
+// Stand-in for a RADIUS or TACACS+ client
+const testAuthScript = `#!/bin/sh
+read user
+read password
+case "$user" in
+operator) [ "$password" = "remote" ] && echo operator && exit 0; exit 1;;
+viewer) exit 0;;
+esac
+exit 2
+`
+
+func TestCommandAuthenticator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "authtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	script := filepath.Join(dir, "auth.sh")
+	if err = ioutil.WriteFile(script, []byte(testAuthScript), 0755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := AuthConfig{
+		Enable: true,
+		Authenticators: []AuthenticatorJson{
+			{Name: "tacacs", Type: AUTH_TYPE_COMMAND, Command: script},
+			{Name: "local", Type: AUTH_TYPE_LOCAL},
+		},
+	}
+	mgr, err := InitializeAuthMgr(cfg, newTestStore(t), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user, err := mgr.AuthenticateRequest(newRequest("operator", "remote", "")); err != nil || user.Name != "operator" || user.Role != ROLE_OPERATOR {
+		t.Error("Remote user rejected", user, err)
+	}
+	if user, err := mgr.AuthenticateRequest(newRequest("viewer", "any", "")); err != nil || user.Role != ROLE_READ_ONLY {
+		t.Error("Remote user without role did not get the default role", user, err)
+	}
+	if _, err := mgr.AuthenticateRequest(newRequest("operator", "secret", "")); err != ErrAuthFailed {
+		t.Error("Remote reject not honoured", err)
+	}
+	// Users unknown to the command fall through to the local store
+	if _, err := mgr.AuthenticateRequest(newRequest("admin", "secret", "")); err != nil {
+		t.Error("Local user rejected", err)
+	}
+}
+
+func TestIsPermitted(t *testing.T) {
+	operator := BuiltinRoles[ROLE_OPERATOR]
+	readOnly := BuiltinRoles[ROLE_READ_ONLY]
+	checks := []struct {
+		perms                  []string
+		category, verb, object string
+		permitted              bool
+	}{
+		{operator, PERM_CONFIG, PERM_CREATE, "Vlan", true},
+		{operator, PERM_CONFIG, PERM_UPDATE, "user", false},
+		{operator, PERM_ACTION, PERM_EXECUTE, "SaveConfig", true},
+		{operator, PERM_ACTION, PERM_EXECUTE, "RestoreDatabase", false},
+		{readOnly, PERM_CONFIG, PERM_GET, "Vlan", true},
+		{readOnly, PERM_CONFIG, PERM_DELETE, "Vlan", false},
+		{readOnly, PERM_CONFIG, PERM_GET, "ApiToken", false},
+		{readOnly, PERM_ACTION, PERM_EXECUTE, "SaveConfig", false},
+		{nil, PERM_STATE, PERM_GET, "Vlan", false},
+	}
+	for _, check := range checks {
+		if IsPermitted(check.perms, check.category, check.verb, check.object) != check.permitted {
+			t.Error("Wrong result for", check.perms, check.category, check.verb, check.object)
+		}
+	}
+}
+
+func TestValidatePermissions(t *testing.T) {
+	if err := ValidatePermissions([]string{"config:get,update:Vlan, Port", "!action:execute:*"}); err != nil {
+		t.Error("Valid permissions rejected", err)
+	}
+	for _, perm := range []string{"config:get", "config:get:", "configs:get:*", "config:read:*"} {
+		if err := ValidatePermissions([]string{perm}); err == nil {
+			t.Error("Invalid permission accepted", perm)
+		}
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	mgr, err := InitializeAuthMgr(AuthConfig{Enable: true}, newTestStore(t), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := AuthUser{Name: "vlans", Role: "vlan-admin"}
+	if err = mgr.Authorize(user, PERM_CONFIG, PERM_DELETE, "Vlan"); err != nil {
+		t.Error("Custom role permission denied", err)
+	}
+	if err = mgr.Authorize(user, PERM_CONFIG, PERM_DELETE, "Port"); err != ErrForbidden {
+		t.Error("Custom role permission not denied", err)
+	}
+	if err = mgr.Authorize(AuthUser{Name: "x", Role: "missing"}, PERM_STATE, PERM_GET, "Vlan"); err != ErrForbidden {
+		t.Error("Unknown role permitted", err)
+	}
+}
+
+func TestScrubSecrets(t *testing.T) {
+	body := []byte(`{"ConfigData":{"User":[{"UserName":"ops","Password":"s3cret"}],` +
+		`"ApiToken":[{"Name":"ci","token":"t0ken"}]},"Secret":"top","Name":"x"}`)
+	scrubbed := string(ScrubSecretsJson(body))
+	for _, secret := range []string{"s3cret", "t0ken", "top"} {
+		if strings.Contains(scrubbed, secret) {
+			t.Error("Secret", secret, "not scrubbed from", scrubbed)
+		}
+	}
+	if !strings.Contains(scrubbed, `"UserName":"ops"`) || !strings.Contains(scrubbed, `"Name":"x"`) {
+		t.Error("Other attributes changed", scrubbed)
+	}
+	if noSecrets := []byte(`{"Name":"x"}`); string(ScrubSecretsJson(noSecrets)) != string(noSecrets) {
+		t.Error("Data without secrets changed")
+	}
+}
+
+func TestOperatorCanNotEscalate(t *testing.T) {
+	mgr, err := InitializeAuthMgr(AuthConfig{Enable: true}, newTestStore(t), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	operator := AuthUser{Name: "ops", Role: ROLE_OPERATOR}
+	admin := AuthUser{Name: "root", Role: ROLE_ADMIN}
+	verbs := []string{PERM_CREATE, PERM_UPDATE}
+	// The object types of an ApplyConfig
+	if err = mgr.AuthorizeObjects(operator, PERM_CONFIG, verbs, []string{"Vlan", "User"}); err == nil {
+		t.Error("Operator may ApplyConfig a User")
+	}
+	if err = mgr.AuthorizeObjects(operator, PERM_CONFIG, verbs, []string{"Vlan", "Port"}); err != nil {
+		t.Error("Operator may not ApplyConfig a Vlan", err)
+	}
+	if err = mgr.AuthorizeObjects(admin, PERM_CONFIG, verbs, []string{"Vlan", "User"}); err != nil {
+		t.Error("Admin may not ApplyConfig a User", err)
+	}
+	for _, action := range AdminOnlyActions {
+		if err = mgr.Authorize(operator, PERM_ACTION, PERM_EXECUTE, action); err != ErrForbidden {
+			t.Error("Operator may execute", action)
+		}
+		if err = mgr.Authorize(admin, PERM_ACTION, PERM_EXECUTE, action); err != nil {
+			t.Error("Admin may not execute", action, err)
+		}
+	}
+	if err = mgr.Authorize(operator, PERM_ACTION, PERM_EXECUTE, "ApplyConfig"); err != nil {
+		t.Error("Operator may not execute ApplyConfig", err)
+	}
+}
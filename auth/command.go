@@ -0,0 +1,90 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package auth
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+//
+// An authenticator backed by an external command, e.g. a RADIUS or TACACS+
+// client. The command gets the user name and password on two lines of its
+// standard input and reports the result by exit status:
+//   0 accepted, 1 rejected, 2 unknown user.
+// Any other status or a timeout lets the next authenticator try. On accept
+// the command may print the role of the user on its first output line.
+//
+const (
+	COMMAND_AUTH_ACCEPT          = 0
+	COMMAND_AUTH_REJECT          = 1
+	COMMAND_AUTH_UNKNOWN_USER    = 2
+	DEFAULT_COMMAND_AUTH_TIMEOUT = 5
+)
+
+type commandAuthenticator struct {
+	command string
+	timeout time.Duration
+}
+
+func newCommandAuthenticator(cfg AuthenticatorJson, store UserStore) (Authenticator, error) {
+	if cfg.Command == "" {
+		return nil, errors.New("Command is required")
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = DEFAULT_COMMAND_AUTH_TIMEOUT
+	}
+	return &commandAuthenticator{cfg.Command, time.Duration(timeout) * time.Second}, nil
+}
+
+func (cmdAuth *commandAuthenticator) Authenticate(userName, password string) (string, error) {
+	if strings.ContainsAny(userName, "\r\n") {
+		return "", ErrAuthFailed
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cmdAuth.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, cmdAuth.command)
+	cmd.Stdin = strings.NewReader(userName + "\n" + password + "\n")
+	output, err := cmd.Output()
+	if err == nil {
+		role := strings.SplitN(string(output), "\n", 2)[0]
+		return strings.TrimSpace(role), nil
+	}
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		switch exitErr.ExitCode() {
+		case COMMAND_AUTH_REJECT:
+			return "", ErrAuthFailed
+		case COMMAND_AUTH_UNKNOWN_USER:
+			return "", ErrUnknownUser
+		}
+	}
+	return "", err
+}
@@ -0,0 +1,135 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+//
+// Passwords are stored as salted PBKDF2-HMAC-SHA256 hashes in the form
+// pbkdf2-sha256$<iterations>$<salt>$<hash>, salt and hash base64 encoded.
+// The iteration count follows current OWASP guidance; hashes made with an
+// older count are verified with the count they carry.
+// API tokens are long random secrets and are stored as plain SHA-256 hashes.
+//
+const (
+	PASSWORD_HASH_SCHEME     = "pbkdf2-sha256"
+	PASSWORD_HASH_ITERATIONS = 600000
+	PASSWORD_SALT_LEN        = 16
+	PASSWORD_KEY_LEN         = 32
+	TOKEN_HASH_PREFIX        = "sha256$"
+	MIN_TOKEN_LEN            = 16
+)
+
+func pbkdf2Sha256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	numBlocks := (keyLen + hashLen - 1) / hashLen
+	var buf [4]byte
+	key := make([]byte, 0, numBlocks*hashLen)
+	for block := 1; block <= numBlocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(buf[:], uint32(block))
+		prf.Write(buf[:4])
+		u := prf.Sum(nil)
+		t := make([]byte, len(u))
+		copy(t, u)
+		for n := 1; n < iterations; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for idx := range t {
+				t[idx] ^= u[idx]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
+
+func IsPasswordHash(value string) bool {
+	return strings.HasPrefix(value, PASSWORD_HASH_SCHEME+"$")
+}
+
+func HashPassword(password string) (string, error) {
+	if password == "" {
+		return "", errors.New("Password must not be empty")
+	}
+	salt := make([]byte, PASSWORD_SALT_LEN)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := pbkdf2Sha256([]byte(password), salt, PASSWORD_HASH_ITERATIONS, PASSWORD_KEY_LEN)
+	return strings.Join([]string{PASSWORD_HASH_SCHEME, strconv.Itoa(PASSWORD_HASH_ITERATIONS),
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)}, "$"), nil
+}
+
+func VerifyPassword(hash, password string) bool {
+	fields := strings.Split(hash, "$")
+	if len(fields) != 4 || fields[0] != PASSWORD_HASH_SCHEME {
+		return false
+	}
+	iterations, err := strconv.Atoi(fields[1])
+	if err != nil || iterations < 1 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(fields[2])
+	if err != nil {
+		return false
+	}
+	key, err := base64.RawStdEncoding.DecodeString(fields[3])
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(key, pbkdf2Sha256([]byte(password), salt, iterations, len(key))) == 1
+}
+
+func IsTokenHash(value string) bool {
+	return strings.HasPrefix(value, TOKEN_HASH_PREFIX)
+}
+
+func HashToken(token string) (string, error) {
+	if len(token) < MIN_TOKEN_LEN {
+		return "", errors.New("Token must have at least " + strconv.Itoa(MIN_TOKEN_LEN) + " characters")
+	}
+	sum := sha256.Sum256([]byte(token))
+	return TOKEN_HASH_PREFIX + hex.EncodeToString(sum[:]), nil
+}
+
+func VerifyToken(hash, token string) bool {
+	sum := sha256.Sum256([]byte(token))
+	expected := TOKEN_HASH_PREFIX + hex.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(expected)) == 1
+}
@@ -0,0 +1,220 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package auth
+
+import (
+	"errors"
+	"strings"
+)
+
+//
+// Role based access control. A role is a list of permissions of the form
+// <category>:<verb>:<object>, where category is config, state, action or
+// event, and verb is get, create, update or delete for config, get for
+// state and event, and execute for action. Each field is *, a name, or a
+// comma separated list of names, matched case insensitively; the object is
+// the name used in the URL. A permission with a leading ! denies, and a
+// deny overrides any grant.
+//
+const (
+	PERM_CONFIG = "config"
+	PERM_STATE  = "state"
+	PERM_ACTION = "action"
+	PERM_EVENT  = "event"
+
+	PERM_GET     = "get"
+	PERM_CREATE  = "create"
+	PERM_UPDATE  = "update"
+	PERM_DELETE  = "delete"
+	PERM_EXECUTE = "execute"
+
+	ROLE_ADMIN     = "admin"
+	ROLE_OPERATOR  = "operator"
+	ROLE_READ_ONLY = "read-only"
+)
+
+var ErrForbidden = errors.New("Operation not permitted")
+
+var BuiltinRoles = map[string][]string{
+	ROLE_ADMIN: {"*:*:*"},
+	ROLE_OPERATOR: {
+		"*:*:*",
+		"!config:*:User,ApiToken,Role",
+		"!action:execute:RestoreDatabase,ResetConfig",
+	},
+	ROLE_READ_ONLY: {
+		"config,state,event:get:*",
+		"!config:get:User,ApiToken",
+	},
+}
+
+//
+// Actions which only the admin role may execute, whatever other roles are
+// granted. They replace or write out User, ApiToken and Role objects along
+// with the rest of the configuration.
+//
+var AdminOnlyActions = []string{
+	"ForceApplyConfig",
+	"SaveConfig",
+	"BackupDatabase",
+	"RestoreDatabase",
+	"ResetConfig",
+}
+
+func isAdminOnlyAction(action string) bool {
+	for _, adminAction := range AdminOnlyActions {
+		if strings.EqualFold(adminAction, action) {
+			return true
+		}
+	}
+	return false
+}
+
+var permVerbs = map[string][]string{
+	PERM_CONFIG: {PERM_GET, PERM_CREATE, PERM_UPDATE, PERM_DELETE},
+	PERM_STATE:  {PERM_GET},
+	PERM_ACTION: {PERM_EXECUTE},
+	PERM_EVENT:  {PERM_GET},
+}
+
+func matchField(field, value string) bool {
+	for _, name := range strings.Split(field, ",") {
+		name = strings.TrimSpace(name)
+		if name == "*" || strings.EqualFold(name, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPermission(perm, category, verb, object string) bool {
+	fields := strings.Split(perm, ":")
+	return len(fields) == 3 && matchField(fields[0], category) &&
+		matchField(fields[1], verb) && matchField(fields[2], object)
+}
+
+func IsPermitted(perms []string, category, verb, object string) bool {
+	permitted := false
+	for _, perm := range perms {
+		if strings.HasPrefix(perm, "!") {
+			if matchPermission(perm[1:], category, verb, object) {
+				return false
+			}
+		} else if matchPermission(perm, category, verb, object) {
+			permitted = true
+		}
+	}
+	return permitted
+}
+
+func validateField(field string, names []string) error {
+	for _, name := range strings.Split(field, ",") {
+		name = strings.TrimSpace(name)
+		if name == "*" {
+			continue
+		}
+		valid := false
+		for _, validName := range names {
+			if strings.EqualFold(name, validName) {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return errors.New("Invalid name " + name)
+		}
+	}
+	return nil
+}
+
+//
+// Check the permissions of a custom role
+//
+func ValidatePermissions(perms []string) error {
+	categories := make([]string, 0, len(permVerbs))
+	verbs := make([]string, 0)
+	for category, categoryVerbs := range permVerbs {
+		categories = append(categories, category)
+		verbs = append(verbs, categoryVerbs...)
+	}
+	for _, perm := range perms {
+		fields := strings.Split(strings.TrimPrefix(perm, "!"), ":")
+		if len(fields) != 3 || fields[2] == "" {
+			return errors.New("Permission " + perm + " is not <category>:<verb>:<object>")
+		}
+		if err := validateField(fields[0], categories); err != nil {
+			return errors.New("Permission " + perm + ": " + err.Error())
+		}
+		if err := validateField(fields[1], verbs); err != nil {
+			return errors.New("Permission " + perm + ": " + err.Error())
+		}
+	}
+	return nil
+}
+
+func IsBuiltinRole(role string) bool {
+	_, exist := BuiltinRoles[role]
+	return exist
+}
+
+func (mgr *AuthMgr) getRolePermissions(role string) ([]string, error) {
+	if perms, exist := BuiltinRoles[role]; exist {
+		return perms, nil
+	}
+	return mgr.store.GetRolePermissions(role)
+}
+
+//
+// Check that user may do verb on object of category. Users with an unknown
+// role may do nothing.
+//
+func (mgr *AuthMgr) Authorize(user AuthUser, category, verb, object string) error {
+	perms, err := mgr.getRolePermissions(user.Role)
+	if err != nil {
+		mgr.logger.Err("Unknown role", user.Role, "of user", user.Name)
+		return ErrForbidden
+	}
+	if !IsPermitted(perms, category, verb, object) {
+		return ErrForbidden
+	}
+	if category == PERM_ACTION && user.Role != ROLE_ADMIN && isAdminOnlyAction(object) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+//
+// Check that user may do all of verbs on every object of category, for
+// actions such as ApplyConfig which change objects on the user's behalf
+//
+func (mgr *AuthMgr) AuthorizeObjects(user AuthUser, category string, verbs, objects []string) error {
+	for _, object := range objects {
+		for _, verb := range verbs {
+			if err := mgr.Authorize(user, category, verb, object); err != nil {
+				return errors.New("May not " + verb + " " + category + " " + object)
+			}
+		}
+	}
+	return nil
+}
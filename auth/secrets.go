@@ -0,0 +1,85 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package auth
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+//
+// Passwords, tokens and secrets are masked wherever objects leave confd
+// other than through the DB, e.g. in the ConfigLog and in webhook
+// notifications. Attributes are matched case insensitively at any depth.
+//
+const SECRET_MASK = "********"
+
+var SecretAttrs = []string{"Password", "Token", "Secret"}
+
+func IsSecretAttr(attr string) bool {
+	for _, secretAttr := range SecretAttrs {
+		if strings.EqualFold(attr, secretAttr) {
+			return true
+		}
+	}
+	return false
+}
+
+//
+// Mask the secret attributes in a decoded JSON value, descending into
+// objects and arrays. Returns whether anything was masked.
+//
+func ScrubSecrets(value interface{}) (scrubbed bool) {
+	switch value.(type) {
+	case map[string]interface{}:
+		attrs := value.(map[string]interface{})
+		for attr, attrValue := range attrs {
+			if IsSecretAttr(attr) {
+				attrs[attr] = SECRET_MASK
+				scrubbed = true
+			} else if ScrubSecrets(attrValue) {
+				scrubbed = true
+			}
+		}
+	case []interface{}:
+		for _, elem := range value.([]interface{}) {
+			if ScrubSecrets(elem) {
+				scrubbed = true
+			}
+		}
+	}
+	return scrubbed
+}
+
+// ScrubSecrets on JSON data. Data which is not JSON is returned as is.
+func ScrubSecretsJson(data []byte) []byte {
+	var value interface{}
+	if json.Unmarshal(data, &value) != nil || !ScrubSecrets(value) {
+		return data
+	}
+	if js, err := json.Marshal(value); err == nil {
+		return js
+	}
+	return data
+}
@@ -25,11 +25,12 @@ package clients
 
 import (
 	"encoding/json"
+	"errors"
 	"infra/sysd/sysdCommonDefs"
 	"io/ioutil"
 	"models/actions"
 	"models/objects"
-	"strconv"
+	"sync"
 	"time"
 	"utils/dbutils"
 	"utils/keepalive"
@@ -43,8 +44,9 @@ type ExecuteConfigurationActionCB func(actions.ActionObj) error
 type ClientMgr struct {
 	logger                       *logging.Writer
 	paramsDir                    string
-	Clients                      map[string]ClientIf
-	reconncetTimer               *time.Ticker
+	clientsMutex                 sync.RWMutex
+	clients                      map[string]ClientIf
+	clientNameCh                 chan string
 	SystemReady                  bool
 	systemStatusCB               SystemStatusCB
 	systemSwVersionCB            SystemSwVersionCB
@@ -54,8 +56,14 @@ type ClientMgr struct {
 var gClientMgr *ClientMgr
 
 type ClientJson struct {
-	Name string `json:Name`
-	Port int    `json:Port`
+	Name       string           `json:"Name"`
+	Type       string           `json:"Type"`
+	Host       string           `json:"Host"`
+	Port       int              `json:"Port"`
+	Transport  string           `json:"Transport"`
+	SocketPath string           `json:"SocketPath"`
+	TLS        *ClientTLSJson   `json:"TLS"`
+	Policy     *json.RawMessage `json:"Policy"`
 }
 
 type DaemonJson struct {
@@ -87,6 +95,46 @@ type ClientIf interface {
 	UnlockApiHandler()
 }
 
+//
+// Register a client implementation for a daemon which is not part of the
+// generated ClientInterfaces. This has to be done before InitializeClientMgr.
+//
+func RegisterClientInterface(name string, client ClientIf) error {
+	clientInterfacesMutex.Lock()
+	defer clientInterfacesMutex.Unlock()
+	if _, exist := ClientInterfaces[name]; exist {
+		return errors.New("Client " + name + " is already registered")
+	}
+	ClientInterfaces[name] = client
+	return nil
+}
+
+// Guards ClientInterfaces, which a SIGHUP reload adds HTTP clients to
+var clientInterfacesMutex sync.RWMutex
+
+//
+// Client implementation for a clients.json entry. HTTP clients are
+// registered on first use. Returns nil if there is no implementation.
+//
+func getClientInterface(name, clientType string) ClientIf {
+	clientInterfacesMutex.Lock()
+	defer clientInterfacesMutex.Unlock()
+	if ClientInterfaces[name] == nil && clientType == CLIENT_TYPE_HTTP {
+		ClientInterfaces[name] = NewHttpClient()
+	}
+	return ClientInterfaces[name]
+}
+
+func getClientInterfaces() map[string]ClientIf {
+	clientInterfacesMutex.RLock()
+	defer clientInterfacesMutex.RUnlock()
+	clientIfs := make(map[string]ClientIf, len(ClientInterfaces))
+	for name, client := range ClientInterfaces {
+		clientIfs[name] = client
+	}
+	return clientIfs
+}
+
 func InitializeClientMgr(paramsDir string, logger *logging.Writer,
 	systemStatusCB SystemStatusCB,
 	systemSwVersionCB SystemSwVersionCB,
@@ -104,10 +152,44 @@ func InitializeClientMgr(paramsDir string, logger *logging.Writer,
 		return nil
 	}
 
+	mgr.initializeMetrics()
 	gClientMgr = mgr
 	return mgr
 }
 
+//
+// The clients map is replaced, never modified, once it is set, so the map
+// returned by GetClients can be read without locking. Callers must not
+// modify it.
+//
+func (mgr *ClientMgr) GetClients() map[string]ClientIf {
+	mgr.clientsMutex.RLock()
+	defer mgr.clientsMutex.RUnlock()
+	return mgr.clients
+}
+
+func (mgr *ClientMgr) GetClient(name string) (ClientIf, bool) {
+	client, exist := mgr.GetClients()[name]
+	return client, exist
+}
+
+func (mgr *ClientMgr) setClients(clients map[string]ClientIf) {
+	mgr.clientsMutex.Lock()
+	mgr.clients = clients
+	mgr.clientsMutex.Unlock()
+}
+
+func (mgr *ClientMgr) addClient(name string, client ClientIf) {
+	mgr.clientsMutex.Lock()
+	defer mgr.clientsMutex.Unlock()
+	clients := make(map[string]ClientIf, len(mgr.clients)+1)
+	for clientName, clientIf := range mgr.clients {
+		clients[clientName] = clientIf
+	}
+	clients[name] = client
+	mgr.clients = clients
+}
+
 //
 //  This method reads the config file and connects to all the clients in the list
 //
@@ -115,7 +197,7 @@ func (mgr *ClientMgr) InitializeClientHandles(clientsFile, sysProfileFile string
 	var clientsList []ClientJson
 	var daemonsList DaemonsList
 
-	mgr.Clients = make(map[string]ClientIf)
+	clients := make(map[string]ClientIf)
 
 	bytes, err := ioutil.ReadFile(clientsFile)
 	if err != nil {
@@ -129,9 +211,33 @@ func (mgr *ClientMgr) InitializeClientHandles(clientsFile, sysProfileFile string
 		return false
 	}
 	for _, client := range clientsList {
-		if ClientInterfaces[client.Name] != nil {
-			mgr.Clients[client.Name] = ClientInterfaces[client.Name]
-			mgr.Clients[client.Name].Initialize(client.Name, "localhost:"+strconv.Itoa(client.Port))
+		if clientIf := getClientInterface(client.Name, client.Type); clientIf != nil {
+			addr, err := client.GetClientAddr()
+			if err != nil {
+				mgr.logger.Err("Invalid address for client", client.Name, err)
+				continue
+			}
+			policy, err := ParseClientPolicy(client.Policy)
+			if err != nil {
+				mgr.logger.Err("Invalid policy for client", client.Name, err, "using defaults")
+			}
+			hdl := NewClientHdl(client.Name, clientIf, policy)
+			hdl.tripCB = mgr.resetClientConnection
+			clients[client.Name] = hdl
+			if err := hdl.Configure(client.Name, addr); err != nil {
+				mgr.logger.Err("Failed to configure client", client.Name, err)
+				continue
+			}
+			mgr.logger.Info("Client", client.Name, "address", addr.String())
+		}
+	}
+	// Clients which are not in clients.json get a handle as well so that
+	// they can be added at runtime. They stay disabled until configured.
+	for name, client := range getClientInterfaces() {
+		if _, exist := clients[name]; !exist {
+			hdl := NewClientHdl(name, client, DefaultClientPolicy())
+			hdl.tripCB = mgr.resetClientConnection
+			clients[name] = hdl
 		}
 	}
 
@@ -145,8 +251,9 @@ func (mgr *ClientMgr) InitializeClientHandles(clientsFile, sysProfileFile string
 		mgr.logger.Err("Failed to unmarshal daemons enable list json")
 		return false
 	}
+	mgr.setClients(clients)
 	for _, daemon := range daemonsList.Daemons {
-		client, exist := mgr.Clients[daemon.Name]
+		client, exist := clients[daemon.Name]
 		if exist {
 			if daemon.Enable == false {
 				client.DisableServer()
@@ -158,6 +265,76 @@ func (mgr *ClientMgr) InitializeClientHandles(clientsFile, sysProfileFile string
 	return true
 }
 
+//
+// Re-read clientsFile at runtime. New clients are added and clients whose
+// address changed are reconnected; clients in keep, whose configuration is
+// stored as ConfdClient objects, are left alone. Clients missing from the
+// file and policy changes are only picked up on restart.
+//
+func (mgr *ClientMgr) ReloadClientHandles(clientsFile string, keep map[string]bool) bool {
+	var clientsList []ClientJson
+	bytes, err := ioutil.ReadFile(clientsFile)
+	if err == nil {
+		err = json.Unmarshal(bytes, &clientsList)
+	}
+	if err != nil {
+		mgr.logger.Err("Failed to reload", clientsFile, err)
+		return false
+	}
+	var added []string
+	for _, client := range clientsList {
+		if keep[client.Name] {
+			continue
+		}
+		addr, err := client.GetClientAddr()
+		if err != nil {
+			mgr.logger.Err("Invalid address for client", client.Name, err)
+			continue
+		}
+		if _, exist := mgr.GetClient(client.Name); !exist {
+			clientIf := getClientInterface(client.Name, client.Type)
+			if clientIf == nil {
+				continue
+			}
+			policy, err := ParseClientPolicy(client.Policy)
+			if err != nil {
+				mgr.logger.Err("Invalid policy for client", client.Name, err, "using defaults")
+			}
+			hdl := NewClientHdl(client.Name, clientIf, policy)
+			hdl.tripCB = mgr.resetClientConnection
+			added = append(added, client.Name)
+			mgr.addClient(client.Name, hdl)
+		}
+		hdl, err := mgr.getClientHdl(client.Name)
+		if err != nil {
+			continue
+		}
+		currAddr := hdl.GetAddr()
+		if hdl.IsConfigured() && addr.Transport == currAddr.Transport && addr.Address == currAddr.Address {
+			continue
+		}
+		if err := hdl.CheckAddr(client.Name, addr); err != nil {
+			mgr.logger.Err("Failed to configure client", client.Name, err)
+			continue
+		}
+		enable := !hdl.IsConfigured() || hdl.IsServerEnabled()
+		mgr.logger.Info("Client", client.Name, "address set to", addr.String())
+		mgr.DisableClient(client.Name)
+		if err := hdl.Configure(client.Name, addr); err != nil {
+			mgr.logger.Err("Failed to configure client", client.Name, err)
+			continue
+		}
+		hdl.DisableServer()
+		if enable {
+			mgr.EnableClient(client.Name)
+		}
+	}
+	if len(added) > 0 {
+		mgr.logger.Info("Added clients", added)
+	}
+	return true
+}
+
 func (mgr *ClientMgr) ListenToClientStateChanges() {
 	clientStatusListener := keepalive.InitDaemonStatusListener()
 	if clientStatusListener != nil {
@@ -183,56 +360,98 @@ func (mgr *ClientMgr) ListenToClientStateChanges() {
 //  This method connects to all the config daemon's clients
 //
 func (mgr *ClientMgr) ConnectToAllClients(clientNameCh chan string) bool {
-	mgr.reconncetTimer = time.NewTicker(time.Millisecond * 1000)
+	var wg sync.WaitGroup
 	mgr.SystemReady = false
-	disabledClientsCount := 0
-	for clientName, client := range mgr.Clients {
+	mgr.clientNameCh = clientNameCh
+	for clientName, client := range mgr.GetClients() {
 		if client.IsServerEnabled() {
-			client.ConnectToServer()
-			if client.IsConnectedToServer() {
-				clientNameCh <- clientName
+			// Simulated daemons which are down keep being retried in the
+			// background without holding up startup
+			wait := !isDownSim(client)
+			if wait {
+				wg.Add(1)
 			}
-		} else {
-			disabledClientsCount++
-		}
-	}
-	logCount := 0
-	for t := range mgr.reconncetTimer.C {
-		_ = t
-		connectedClientsCount := 0
-		for clientName, client := range mgr.Clients {
-			if client.IsServerEnabled() {
-				if client.IsConnectedToServer() == false {
-					if logCount%60 == 0 {
-						mgr.logger.Info("Trying to connect to ", clientName)
-					}
-					client.ConnectToServer()
-					if client.IsConnectedToServer() {
-						clientNameCh <- clientName
-						connectedClientsCount++
-					}
-				} else {
-					connectedClientsCount++
+			go func(clientName string, wait bool) {
+				if wait {
+					defer wg.Done()
 				}
-			}
-		}
-		logCount++
-
-		if len(mgr.Clients) == (disabledClientsCount + connectedClientsCount) {
-			mgr.reconncetTimer.Stop()
-			break
+				if mgr.connectWithBackoff(clientName) {
+					clientNameCh <- clientName
+				}
+			}(clientName, wait)
 		}
 	}
+	wg.Wait()
 	mgr.logger.Info("Connected to all clients")
 	clientNameCh <- "Client_Init_Done"
 	return true
 }
 
+func isDownSim(client ClientIf) bool {
+	if hdl, ok := client.(*ClientHdl); ok {
+		client = hdl.ClientIf
+	}
+	sim, ok := client.(*SimClient)
+	return ok && sim.IsDown()
+}
+
+//
+// Keep trying to connect to a client, waiting as per the client's retry
+// policy between attempts. Returns false if the client got disabled or
+// another routine is already connecting to it.
+//
+func (mgr *ClientMgr) connectWithBackoff(name string) bool {
+	client, exist := mgr.GetClient(name)
+	if !exist {
+		return false
+	}
+	hdl, isHdl := client.(*ClientHdl)
+	policy := DefaultClientPolicy()
+	if isHdl {
+		if !hdl.startConnecting() {
+			return false
+		}
+		defer hdl.doneConnecting()
+		policy = hdl.GetPolicy()
+	}
+	backoff := policy.NewBackoff()
+	attempt := 0
+	for client.IsServerEnabled() {
+		if !client.IsConnectedToServer() {
+			client.ConnectToServer()
+		}
+		if client.IsConnectedToServer() {
+			if attempt > 0 {
+				mgr.logger.Info("Connected to client ", name, "after", attempt, "retries")
+			}
+			return true
+		}
+		delay := backoff.Next()
+		if attempt%10 == 0 {
+			mgr.logger.Info("Trying to connect to ", name, "next attempt in", delay.String())
+		}
+		attempt++
+		time.Sleep(delay)
+	}
+	return false
+}
+
+//
+// Called when a client's circuit breaker opens. Closing the connection
+// unblocks any RPC the daemon is sitting on; the reconnect then follows the
+// client's retry policy.
+//
+func (mgr *ClientMgr) resetClientConnection(name string) {
+	mgr.logger.Err("Too many failed requests to client", name, "resetting connection")
+	mgr.DisconnectFromClient(name)
+	mgr.ConnectToClient(name)
+}
+
 //
 // This method is to disconnect from all clients
 //
 func (mgr *ClientMgr) DisconnectFromAllClients() bool {
-	for _, client := range mgr.Clients {
+	for _, client := range mgr.GetClients() {
 		if client.IsConnectedToServer() {
 			client.DisconnectFromServer()
 		}
@@ -249,7 +468,7 @@ func (mgr *ClientMgr) IsReady() bool {
 
 func (mgr *ClientMgr) GetUnconnectedClients() []string {
 	unconnectedClients := make([]string, 0)
-	for clntName, client := range mgr.Clients {
+	for clntName, client := range mgr.GetClients() {
 		if client.IsServerEnabled() && client.IsConnectedToServer() == false {
 			unconnectedClients = append(unconnectedClients, clntName)
 		}
@@ -258,7 +477,7 @@ func (mgr *ClientMgr) GetUnconnectedClients() []string {
 }
 
 func (mgr *ClientMgr) DisconnectFromClient(name string) error {
-	client, exist := mgr.Clients[name]
+	client, exist := mgr.GetClient(name)
 	if exist {
 		if client.IsConnectedToServer() {
 			client.DisconnectFromServer()
@@ -268,25 +487,6 @@ func (mgr *ClientMgr) DisconnectFromClient(name string) error {
 }
 
 func (mgr *ClientMgr) ConnectToClient(name string) error {
-	client, exist := mgr.Clients[name]
-	waitCount := 0
-	if exist {
-		if client.IsServerEnabled() && !client.IsConnectedToServer() {
-			reconncetTimer := time.NewTicker(time.Millisecond * 1000)
-			for t := range reconncetTimer.C {
-				_ = t
-				waitCount++
-				if waitCount%10 == 0 {
-					mgr.logger.Info("Connecting to client ", name)
-				}
-				if !client.IsConnectedToServer() {
-					client.ConnectToServer()
-				} else {
-					reconncetTimer.Stop()
-					break
-				}
-			}
-		}
-	}
+	mgr.connectWithBackoff(name)
 	return nil
 }
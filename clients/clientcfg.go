@@ -0,0 +1,191 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package clients
+
+import (
+	"errors"
+	"models/objects"
+	"net"
+	"strconv"
+)
+
+//
+// Runtime configuration of clients. These methods back the confd owned
+// ConfdClient object and let a client be added, enabled, disabled or
+// removed without restarting confd. A client can only be added if confd
+// has an implementation for it in ClientInterfaces.
+//
+
+func (mgr *ClientMgr) getClientHdl(name string) (*ClientHdl, error) {
+	client, exist := mgr.GetClient(name)
+	if !exist {
+		return nil, errors.New("No client implementation available for " + name)
+	}
+	hdl, ok := client.(*ClientHdl)
+	if !ok || name == "local" {
+		return nil, errors.New("Client " + name + " cannot be configured at runtime")
+	}
+	return hdl, nil
+}
+
+//
+// Apply a ConfdClient object. The address is only changed when the object
+// carries one, so an object with just Name and Enable toggles a client
+// configured through clients.json.
+//
+func (mgr *ClientMgr) ConfigureClient(cfg objects.ConfdClient) error {
+	hdl, err := mgr.getClientHdl(cfg.Name)
+	if err != nil {
+		return err
+	}
+	currAddr := hdl.GetAddr()
+	if cfg.Port != 0 || cfg.SocketPath != "" {
+		client := ClientJson{
+			Name:       cfg.Name,
+			Host:       cfg.Host,
+			Port:       int(cfg.Port),
+			Transport:  cfg.Transport,
+			SocketPath: cfg.SocketPath,
+			TLS:        currAddr.TLS,
+		}
+		addr, err := client.GetClientAddr()
+		if err != nil {
+			return err
+		}
+		if !hdl.IsConfigured() || addr.Transport != currAddr.Transport || addr.Address != currAddr.Address {
+			// Refuse the address before touching the working connection
+			if err := hdl.CheckAddr(cfg.Name, addr); err != nil {
+				return err
+			}
+			mgr.logger.Info("Client", cfg.Name, "address set to", addr.String())
+			mgr.DisableClient(cfg.Name)
+			if err := hdl.Configure(cfg.Name, addr); err != nil {
+				return err
+			}
+			hdl.DisableServer()
+		}
+	} else if !hdl.IsConfigured() {
+		return errors.New("Port or SocketPath is required to add client " + cfg.Name)
+	}
+	if cfg.Enable {
+		return mgr.EnableClient(cfg.Name)
+	}
+	return mgr.DisableClient(cfg.Name)
+}
+
+//
+// Enable a client and connect to it in the background. Once connected the
+// client name is sent on clientNameCh so that its AutoCreate and
+// AutoDiscover objects get processed.
+//
+func (mgr *ClientMgr) EnableClient(name string) error {
+	hdl, err := mgr.getClientHdl(name)
+	if err != nil {
+		return err
+	}
+	if !hdl.EnableServer() {
+		return errors.New("Client " + name + " is not configured")
+	}
+	mgr.logger.Info("Client", name, "is enabled")
+	if mgr.clientNameCh == nil || hdl.IsConnectedToServer() {
+		return nil
+	}
+	go func() {
+		if mgr.connectWithBackoff(name) {
+			mgr.clientNameCh <- name
+		}
+	}()
+	return nil
+}
+
+func (mgr *ClientMgr) DisableClient(name string) error {
+	hdl, err := mgr.getClientHdl(name)
+	if err != nil {
+		return err
+	}
+	if hdl.IsServerEnabled() {
+		mgr.logger.Info("Client", name, "is disabled")
+	}
+	hdl.DisableServer()
+	return mgr.DisconnectFromClient(name)
+}
+
+func (mgr *ClientMgr) RemoveClient(name string) error {
+	hdl, err := mgr.getClientHdl(name)
+	if err != nil {
+		return err
+	}
+	mgr.DisableClient(name)
+	hdl.unconfigure()
+	mgr.logger.Info("Client", name, "is removed")
+	return nil
+}
+
+// Current configuration of a configured client as a ConfdClient object
+func (mgr *ClientMgr) GetClientConfig(name string) (cfg objects.ConfdClient, err error) {
+	hdl, err := mgr.getClientHdl(name)
+	if err != nil {
+		return cfg, err
+	}
+	if !hdl.IsConfigured() {
+		return cfg, errors.New("Client " + name + " is not configured")
+	}
+	addr := hdl.GetAddr()
+	cfg.Name = name
+	cfg.Enable = hdl.IsServerEnabled()
+	cfg.Transport = addr.Transport
+	if addr.Transport == CLIENT_TRANSPORT_UNIX {
+		cfg.SocketPath = addr.Address
+	} else {
+		host, port, _ := net.SplitHostPort(addr.Address)
+		portNum, _ := strconv.Atoi(port)
+		cfg.Host = host
+		cfg.Port = int32(portNum)
+	}
+	return cfg, nil
+}
+
+func (mgr *ClientMgr) GetClientState(name string) (state objects.ConfdClientState, err error) {
+	client, exist := mgr.GetClient(name)
+	if !exist {
+		return state, errors.New("Unknown client " + name)
+	}
+	state.Name = name
+	state.Enable = client.IsServerEnabled()
+	state.Connected = client.IsConnectedToServer()
+	if hdl, ok := client.(*ClientHdl); ok {
+		state.Configured = hdl.IsConfigured()
+		if state.Configured {
+			state.Address = hdl.GetAddr().String()
+		}
+		state.CircuitBreaker = hdl.GetBreakerState()
+		stats := hdl.GetNotifyStats()
+		state.NotifyPending = stats.Pending
+		state.NotifySent = stats.Sent
+		state.NotifyFailed = stats.Failed
+	} else {
+		state.Configured = true
+	}
+	return state, nil
+}
@@ -0,0 +1,93 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package clients
+
+import (
+	"fmt"
+	"models/objects"
+	"os"
+	"testing"
+	"time"
+	"utils/logging"
+)
+
+var logger *logging.Writer
+
+func TestMain(m *testing.M) {
+	var err error
+	logger, err = logging.NewLogger("confd", "Clients", true)
+	if err != nil {
+		fmt.Println("Failed to start logger", err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+// A client without TransportConfigurer, like the generated Thrift clients
+type tcpOnlyClient struct {
+	ClientIf
+}
+
+func TestConfigureUnsupportedTransport(t *testing.T) {
+	hdl := NewClientHdl("thriftd", tcpOnlyClient{NewSimClient(SimDaemonJson{})}, DefaultClientPolicy())
+	mgr := &ClientMgr{logger: logger, clients: map[string]ClientIf{"thriftd": hdl}}
+	if err := mgr.ConfigureClient(objects.ConfdClient{Name: "thriftd", Port: 10000, Enable: true}); err != nil {
+		t.Fatal("Failed to configure client over tcp", err)
+	}
+	addr := hdl.GetAddr()
+	err := mgr.ConfigureClient(objects.ConfdClient{Name: "thriftd", Transport: CLIENT_TRANSPORT_UNIX,
+		SocketPath: "/var/run/thriftd.sock", Enable: true})
+	if err == nil {
+		t.Error("Unix transport accepted for a client without TransportConfigurer")
+	}
+	if !hdl.IsServerEnabled() || hdl.GetAddr() != addr {
+		t.Error("Refused address changed the client to", hdl.GetAddr(), hdl.IsServerEnabled())
+	}
+}
+
+func TestConnectSkipsDownSims(t *testing.T) {
+	addr := ClientAddr{Transport: CLIENT_TRANSPORT_TCP, Address: "localhost:1"}
+	up := NewClientHdl("upd", NewSimClient(SimDaemonJson{}), DefaultClientPolicy())
+	down := NewClientHdl("downd", NewSimClient(SimDaemonJson{Down: true}), DefaultClientPolicy())
+	up.Configure("upd", addr)
+	down.Configure("downd", addr)
+	defer down.DisableServer()
+	mgr := &ClientMgr{logger: logger, clients: map[string]ClientIf{"upd": up, "downd": down}}
+	clientNameCh := make(chan string, 4)
+	done := make(chan bool)
+	go func() {
+		done <- mgr.ConnectToAllClients(clientNameCh)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ConnectToAllClients waits for a down simulated daemon")
+	}
+	if name := <-clientNameCh; name != "upd" {
+		t.Error("Expected upd connected first, got", name)
+	}
+	if name := <-clientNameCh; name != "Client_Init_Done" {
+		t.Error("Expected Client_Init_Done, got", name)
+	}
+}
@@ -0,0 +1,283 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package clients
+
+import (
+	"errors"
+	"io"
+	"models/actions"
+	"models/objects"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+	"utils/dbutils"
+)
+
+//
+// ClientHdl wraps a daemon's ClientIf and applies the client policy from
+// clients.json to every RPC: a per call deadline, for clients implementing
+// RpcTimeoutConfigurer, and a circuit breaker that fails calls fast after
+// repeated daemon errors. All entries in
+// ClientMgr.clients are ClientHdls.
+//
+// The handle also owns the client's runtime state. A client is configured
+// once it has an address, either from clients.json or from a ConfdClient
+// object, and only enabled clients are connected to.
+//
+type ClientHdl struct {
+	ClientIf
+	name       string
+	policy     ClientPolicyJson
+	breaker    *CircuitBreaker
+	connecting int32
+	enabled    int32
+	tripCB     func(name string)
+	cfgMutex   sync.Mutex
+	configured bool
+	addr       ClientAddr
+
+	notifyMutex sync.Mutex
+	notifier    *changeNotifier
+}
+
+func NewClientHdl(name string, client ClientIf, policy ClientPolicyJson) *ClientHdl {
+	hdl := new(ClientHdl)
+	hdl.ClientIf = client
+	hdl.name = name
+	hdl.policy = policy
+	hdl.breaker = NewCircuitBreaker(policy.BreakerThreshold,
+		time.Duration(policy.BreakerResetTimeout)*time.Millisecond)
+	if configurer, ok := client.(RpcTimeoutConfigurer); ok {
+		configurer.SetRpcTimeout(time.Duration(policy.RpcTimeout) * time.Millisecond)
+	}
+	return hdl
+}
+
+//
+// Check that the client can reach its daemon over addr. Clients which do not
+// implement TransportConfigurer, such as the generated Thrift clients, only
+// support plain tcp.
+//
+func (hdl *ClientHdl) CheckAddr(name string, addr ClientAddr) error {
+	if _, ok := hdl.ClientIf.(TransportConfigurer); ok {
+		_, err := addr.TLSConfig()
+		return err
+	}
+	if addr.Transport != CLIENT_TRANSPORT_TCP || addr.TLS != nil {
+		return errors.New("Client " + name + " does not support " + addr.String() +
+			", only tcp without TLS")
+	}
+	return nil
+}
+
+//
+// Set the client's address and initialize the client with it.
+//
+func (hdl *ClientHdl) Configure(name string, addr ClientAddr) error {
+	if err := hdl.CheckAddr(name, addr); err != nil {
+		return err
+	}
+	if configurer, ok := hdl.ClientIf.(TransportConfigurer); ok {
+		if err := configurer.ConfigureTransport(addr); err != nil {
+			return err
+		}
+	}
+	hdl.cfgMutex.Lock()
+	hdl.configured = true
+	hdl.addr = addr
+	hdl.cfgMutex.Unlock()
+	atomic.StoreInt32(&hdl.enabled, 1)
+	hdl.ClientIf.Initialize(name, addr.Address)
+	return nil
+}
+
+func (hdl *ClientHdl) DisableServer() bool {
+	atomic.StoreInt32(&hdl.enabled, 0)
+	return true
+}
+
+func (hdl *ClientHdl) EnableServer() bool {
+	if !hdl.IsConfigured() {
+		return false
+	}
+	atomic.StoreInt32(&hdl.enabled, 1)
+	return true
+}
+
+func (hdl *ClientHdl) IsServerEnabled() bool {
+	return atomic.LoadInt32(&hdl.enabled) == 1
+}
+
+func (hdl *ClientHdl) IsConfigured() bool {
+	hdl.cfgMutex.Lock()
+	defer hdl.cfgMutex.Unlock()
+	return hdl.configured
+}
+
+func (hdl *ClientHdl) unconfigure() {
+	atomic.StoreInt32(&hdl.enabled, 0)
+	hdl.cfgMutex.Lock()
+	hdl.configured = false
+	hdl.addr = ClientAddr{}
+	hdl.cfgMutex.Unlock()
+}
+
+func (hdl *ClientHdl) GetAddr() ClientAddr {
+	hdl.cfgMutex.Lock()
+	defer hdl.cfgMutex.Unlock()
+	return hdl.addr
+}
+
+func (hdl *ClientHdl) GetPolicy() ClientPolicyJson {
+	return hdl.policy
+}
+
+func (hdl *ClientHdl) GetBreakerState() string {
+	return BreakerStateString[hdl.breaker.State()]
+}
+
+// Errors which indicate that the daemon, rather than the request, is at fault
+func isDaemonError(err error) bool {
+	for err != nil {
+		if err == ErrRpcTimeout || err == io.EOF || err == io.ErrUnexpectedEOF {
+			return true
+		}
+		if _, ok := err.(net.Error); ok {
+			return true
+		}
+		// Transport exceptions carry the underlying error
+		wrapped, ok := err.(interface {
+			Err() error
+		})
+		if !ok {
+			return false
+		}
+		err = wrapped.Err()
+	}
+	return false
+}
+
+//
+// Run an RPC under the client policy. The call runs to completion; clients
+// implementing RpcTimeoutConfigurer fail it at the deadline themselves.
+//
+func (hdl *ClientHdl) invoke(op string, call func() error) error {
+	if err := hdl.breaker.Allow(); err != nil {
+		recordRpc(hdl.name, op, 0, err)
+		return err
+	}
+	start := time.Now()
+	err := call()
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		err = ErrRpcTimeout
+	}
+	recordRpc(hdl.name, op, time.Since(start), err)
+	if hdl.breaker.Record(isDaemonError(err)) && hdl.tripCB != nil {
+		go hdl.tripCB(hdl.name)
+	}
+	return err
+}
+
+func (hdl *ClientHdl) CreateObject(obj objects.ConfigObj, dbHdl *dbutils.DBUtil) (error, bool) {
+	var ok bool
+	err := hdl.invoke("CreateObject", func() (err error) {
+		err, ok = hdl.ClientIf.CreateObject(obj, dbHdl)
+		return err
+	})
+	return err, ok
+}
+
+func (hdl *ClientHdl) DeleteObject(obj objects.ConfigObj, objKey string, dbHdl *dbutils.DBUtil) (error, bool) {
+	var ok bool
+	err := hdl.invoke("DeleteObject", func() (err error) {
+		err, ok = hdl.ClientIf.DeleteObject(obj, objKey, dbHdl)
+		return err
+	})
+	return err, ok
+}
+
+func (hdl *ClientHdl) GetBulkObject(obj objects.ConfigObj, dbHdl *dbutils.DBUtil, currMarker int64, count int64) (err error, objCount int64, nextMarker int64, more bool, objs []objects.ConfigObj) {
+	err = hdl.invoke("GetBulkObject", func() (err error) {
+		err, objCount, nextMarker, more, objs = hdl.ClientIf.GetBulkObject(obj, dbHdl, currMarker, count)
+		return err
+	})
+	return err, objCount, nextMarker, more, objs
+}
+
+func (hdl *ClientHdl) UpdateObject(dbObj objects.ConfigObj, obj objects.ConfigObj, attrSet []bool, op []objects.PatchOpInfo, objKey string, dbHdl *dbutils.DBUtil) (error, bool) {
+	var ok bool
+	err := hdl.invoke("UpdateObject", func() (err error) {
+		err, ok = hdl.ClientIf.UpdateObject(dbObj, obj, attrSet, op, objKey, dbHdl)
+		return err
+	})
+	return err, ok
+}
+
+func (hdl *ClientHdl) GetObject(obj objects.ConfigObj, dbHdl *dbutils.DBUtil) (error, objects.ConfigObj) {
+	var retObj objects.ConfigObj
+	err := hdl.invoke("GetObject", func() (err error) {
+		err, retObj = hdl.ClientIf.GetObject(obj, dbHdl)
+		return err
+	})
+	return err, retObj
+}
+
+func (hdl *ClientHdl) ExecuteAction(obj actions.ActionObj) error {
+	return hdl.invoke("ExecuteAction", func() error {
+		return hdl.ClientIf.ExecuteAction(obj)
+	})
+}
+
+func (hdl *ClientHdl) PreUpdateValidation(dbObj, obj objects.ConfigObj, attrSet []bool, dbHdl *dbutils.DBUtil) error {
+	return hdl.invoke("PreUpdateValidation", func() error {
+		return hdl.ClientIf.PreUpdateValidation(dbObj, obj, attrSet, dbHdl)
+	})
+}
+
+func (hdl *ClientHdl) PostUpdateProcessing(dbObj, obj objects.ConfigObj, attrSet []bool, dbHdl *dbutils.DBUtil) error {
+	return hdl.invoke("PostUpdateProcessing", func() error {
+		return hdl.ClientIf.PostUpdateProcessing(dbObj, obj, attrSet, dbHdl)
+	})
+}
+
+func (hdl *ClientHdl) ConnectToServer() bool {
+	connected := hdl.ClientIf.ConnectToServer()
+	recordConnect(hdl.name, connected)
+	return connected
+}
+
+func (hdl *ClientHdl) DisconnectFromServer() bool {
+	clientDisconnects.Inc(hdl.name)
+	return hdl.ClientIf.DisconnectFromServer()
+}
+
+// Only one reconnect loop is run at a time for a client
+func (hdl *ClientHdl) startConnecting() bool {
+	return atomic.CompareAndSwapInt32(&hdl.connecting, 0, 1)
+}
+
+func (hdl *ClientHdl) doneConnecting() {
+	atomic.StoreInt32(&hdl.connecting, 0)
+}
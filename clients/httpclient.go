@@ -0,0 +1,379 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package clients
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"models/actions"
+	"models/objects"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+	"utils/dbutils"
+	"utils/ipcutils"
+)
+
+//
+// HttpClient is a generic client for daemons that are not built into
+// confd. It speaks the JSON over HTTP contract described in
+// docs/ExternalDaemons.md: every ClientIf call is a POST of an
+// HttpClientRequest to <base>/confd/v1/<Method> and the daemon answers with
+// an HttpClientResponse. As with the generated clients, config objects are
+// stored in DB by the client once the daemon accepts them.
+//
+const (
+	CLIENT_TYPE_HTTP = "http"
+
+	HTTP_CLIENT_API_PREFIX = "/confd/v1/"
+	HTTP_CLIENT_TIMEOUT    = 30 * time.Second
+	HTTP_CLIENT_MAX_RESP   = 16 * 1024 * 1024
+)
+
+type HttpClientRequest struct {
+	ObjectType string                `json:"ObjectType"`
+	Object     json.RawMessage       `json:"Object,omitempty"`
+	DbObject   json.RawMessage       `json:"DbObject,omitempty"`
+	AttrSet    []bool                `json:"AttrSet,omitempty"`
+	PatchOps   []objects.PatchOpInfo `json:"PatchOps,omitempty"`
+	ObjKey     string                `json:"ObjKey,omitempty"`
+	CurrMarker int64                 `json:"CurrMarker"`
+	Count      int64                 `json:"Count"`
+}
+
+type HttpClientResponse struct {
+	Success    bool              `json:"Success"`
+	Error      string            `json:"Error"`
+	Object     json.RawMessage   `json:"Object,omitempty"`
+	Objects    []json.RawMessage `json:"Objects,omitempty"`
+	ObjCount   int64             `json:"ObjCount"`
+	NextMarker int64             `json:"NextMarker"`
+	More       bool              `json:"More"`
+}
+
+type HttpClient struct {
+	ipcutils.IPCClientBase
+	enabled    bool
+	baseUrl    string
+	httpClt    *http.Client
+	rpcTimeout time.Duration
+}
+
+func NewHttpClient() *HttpClient {
+	return &HttpClient{enabled: true}
+}
+
+// Each request, from dialing to reading the response, ends at the deadline
+func (clnt *HttpClient) SetRpcTimeout(timeout time.Duration) {
+	clnt.rpcTimeout = timeout
+}
+
+func (clnt *HttpClient) ConfigureTransport(addr ClientAddr) error {
+	if _, err := addr.TLSConfig(); err != nil {
+		return err
+	}
+	timeout := HTTP_CLIENT_TIMEOUT
+	if clnt.rpcTimeout > 0 {
+		timeout = clnt.rpcTimeout
+	}
+	clnt.httpClt = &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Dial: func(network, address string) (net.Conn, error) {
+				return addr.Dial(timeout)
+			},
+			DisableCompression: true,
+		},
+	}
+	return nil
+}
+
+func (clnt *HttpClient) Initialize(name string, address string) {
+	clnt.Name = name
+	clnt.Address = address
+	clnt.ApiHandlerMutex = sync.RWMutex{}
+	clnt.IsConnected = false
+	clnt.enabled = true
+	// The connection, including TLS, comes from the client address so the
+	// request always uses the plain http scheme. The host part is only used
+	// for the Host header.
+	clnt.baseUrl = "http://" + name
+}
+
+func (clnt *HttpClient) ConnectToServer() bool {
+	if clnt.httpClt == nil {
+		return false
+	}
+	_, err := clnt.call("Ping", HttpClientRequest{})
+	clnt.IsConnected = err == nil
+	return clnt.IsConnected
+}
+
+func (clnt *HttpClient) DisconnectFromServer() bool {
+	clnt.IsConnected = false
+	if clnt.httpClt != nil {
+		if tr, ok := clnt.httpClt.Transport.(*http.Transport); ok {
+			tr.CloseIdleConnections()
+		}
+	}
+	return true
+}
+
+func (clnt *HttpClient) IsConnectedToServer() bool {
+	return clnt.IsConnected
+}
+
+func (clnt *HttpClient) DisableServer() bool {
+	clnt.enabled = false
+	return true
+}
+
+func (clnt *HttpClient) IsServerEnabled() bool {
+	return clnt.enabled
+}
+
+func (clnt *HttpClient) GetServerName() string {
+	return clnt.Name
+}
+
+func (clnt *HttpClient) LockApiHandler() {
+	clnt.ApiHandlerMutex.Lock()
+}
+
+func (clnt *HttpClient) UnlockApiHandler() {
+	clnt.ApiHandlerMutex.Unlock()
+}
+
+func getTypeName(obj interface{}) string {
+	t := reflect.TypeOf(obj)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+func (clnt *HttpClient) call(method string, req interface{}) (resp HttpClientResponse, err error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return resp, err
+	}
+	httpResp, err := clnt.httpClt.Post(clnt.baseUrl+HTTP_CLIENT_API_PREFIX+method, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return resp, err
+	}
+	defer httpResp.Body.Close()
+	body, err = ioutil.ReadAll(io.LimitReader(httpResp.Body, HTTP_CLIENT_MAX_RESP))
+	if err != nil {
+		return resp, err
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return resp, errors.New(clnt.Name + " " + method + " failed: " + httpResp.Status)
+	}
+	if err = json.Unmarshal(body, &resp); err != nil {
+		return resp, err
+	}
+	if resp.Error != "" {
+		return resp, errors.New(resp.Error)
+	}
+	return resp, nil
+}
+
+func (clnt *HttpClient) objRequest(obj objects.ConfigObj) (req HttpClientRequest, err error) {
+	req.ObjectType = getTypeName(obj)
+	req.Object, err = json.Marshal(obj)
+	return req, err
+}
+
+func unmarshalRespObj(objType string, data json.RawMessage) (objects.ConfigObj, error) {
+	objHdl, exist := objects.ConfigObjectMap[strings.ToLower(objType)]
+	if !exist {
+		return nil, errors.New("Unknown object type " + objType)
+	}
+	return objHdl.UnmarshalObject(data)
+}
+
+func (clnt *HttpClient) CreateObject(obj objects.ConfigObj, dbHdl *dbutils.DBUtil) (error, bool) {
+	defer clnt.UnlockApiHandler()
+	clnt.LockApiHandler()
+	req, err := clnt.objRequest(obj)
+	if err != nil {
+		return err, false
+	}
+	resp, err := clnt.call("CreateObject", req)
+	if err != nil {
+		return err, false
+	}
+	if !resp.Success {
+		return errors.New(clnt.Name + " CreateObject failed"), false
+	}
+	if dbHdl != nil {
+		if err = dbHdl.StoreObjectInDb(obj); err != nil {
+			return err, false
+		}
+	}
+	return nil, true
+}
+
+func (clnt *HttpClient) DeleteObject(obj objects.ConfigObj, objKey string, dbHdl *dbutils.DBUtil) (error, bool) {
+	defer clnt.UnlockApiHandler()
+	clnt.LockApiHandler()
+	req, err := clnt.objRequest(obj)
+	if err != nil {
+		return err, false
+	}
+	req.ObjKey = objKey
+	resp, err := clnt.call("DeleteObject", req)
+	if err != nil {
+		return err, false
+	}
+	if !resp.Success {
+		return errors.New(clnt.Name + " DeleteObject failed"), false
+	}
+	if dbHdl != nil {
+		if err = dbHdl.DeleteObjectFromDb(obj); err != nil {
+			return err, false
+		}
+	}
+	return nil, true
+}
+
+func (clnt *HttpClient) UpdateObject(dbObj objects.ConfigObj, obj objects.ConfigObj, attrSet []bool, op []objects.PatchOpInfo, objKey string, dbHdl *dbutils.DBUtil) (error, bool) {
+	defer clnt.UnlockApiHandler()
+	clnt.LockApiHandler()
+	req, err := clnt.objRequest(obj)
+	if err != nil {
+		return err, false
+	}
+	if req.DbObject, err = json.Marshal(dbObj); err != nil {
+		return err, false
+	}
+	req.AttrSet = attrSet
+	req.PatchOps = op
+	req.ObjKey = objKey
+	resp, err := clnt.call("UpdateObject", req)
+	if err != nil {
+		return err, false
+	}
+	if !resp.Success {
+		return errors.New(clnt.Name + " UpdateObject failed"), false
+	}
+	if dbHdl != nil {
+		if err = dbHdl.UpdateObjectInDb(obj, dbObj, attrSet); err != nil {
+			return err, false
+		}
+	}
+	return nil, true
+}
+
+func (clnt *HttpClient) GetObject(obj objects.ConfigObj, dbHdl *dbutils.DBUtil) (error, objects.ConfigObj) {
+	defer clnt.UnlockApiHandler()
+	clnt.LockApiHandler()
+	req, err := clnt.objRequest(obj)
+	if err != nil {
+		return err, nil
+	}
+	resp, err := clnt.call("GetObject", req)
+	if err != nil {
+		return err, nil
+	}
+	retObj, err := unmarshalRespObj(req.ObjectType, resp.Object)
+	return err, retObj
+}
+
+func (clnt *HttpClient) GetBulkObject(obj objects.ConfigObj, dbHdl *dbutils.DBUtil, currMarker int64, count int64) (err error, objCount int64, nextMarker int64, more bool, objs []objects.ConfigObj) {
+	defer clnt.UnlockApiHandler()
+	clnt.LockApiHandler()
+	req, err := clnt.objRequest(obj)
+	if err != nil {
+		return err, 0, 0, false, nil
+	}
+	req.CurrMarker = currMarker
+	req.Count = count
+	resp, err := clnt.call("GetBulkObject", req)
+	if err != nil {
+		return err, 0, 0, false, nil
+	}
+	for _, data := range resp.Objects {
+		retObj, err := unmarshalRespObj(req.ObjectType, data)
+		if err != nil {
+			return err, 0, 0, false, nil
+		}
+		objs = append(objs, retObj)
+	}
+	return nil, resp.ObjCount, resp.NextMarker, resp.More, objs
+}
+
+func (clnt *HttpClient) ExecuteAction(obj actions.ActionObj) error {
+	var err error
+	defer clnt.UnlockApiHandler()
+	clnt.LockApiHandler()
+	req := HttpClientRequest{ObjectType: getTypeName(obj)}
+	if req.Object, err = json.Marshal(obj); err != nil {
+		return err
+	}
+	_, err = clnt.call("ExecuteAction", req)
+	return err
+}
+
+//
+// Validation and post processing hooks are optional for external daemons.
+// A daemon that does not implement them answers 404 which is treated as
+// success.
+//
+func (clnt *HttpClient) updateHook(method string, dbObj, obj objects.ConfigObj, attrSet []bool) error {
+	req, err := clnt.objRequest(obj)
+	if err != nil {
+		return err
+	}
+	if req.DbObject, err = json.Marshal(dbObj); err != nil {
+		return err
+	}
+	req.AttrSet = attrSet
+	_, err = clnt.call(method, req)
+	if err != nil && strings.HasSuffix(err.Error(), http.StatusText(http.StatusNotFound)) {
+		return nil
+	}
+	return err
+}
+
+func (clnt *HttpClient) PreUpdateValidation(dbObj, obj objects.ConfigObj, attrSet []bool, dbHdl *dbutils.DBUtil) error {
+	return clnt.updateHook("PreUpdateValidation", dbObj, obj, attrSet)
+}
+
+func (clnt *HttpClient) PostUpdateProcessing(dbObj, obj objects.ConfigObj, attrSet []bool, dbHdl *dbutils.DBUtil) error {
+	return clnt.updateHook("PostUpdateProcessing", dbObj, obj, attrSet)
+}
+
+func (clnt *HttpClient) NotifyObjectChange(change ObjectChange) error {
+	defer clnt.UnlockApiHandler()
+	clnt.LockApiHandler()
+	_, err := clnt.call("NotifyObjectChange", change)
+	return err
+}
@@ -84,8 +84,29 @@ func (clnt *LocalClient) CreateObject(obj objects.ConfigObj, dbHdl *dbutils.DBUt
 	defer clnt.UnlockApiHandler()
 	clnt.LockApiHandler()
 	switch obj.(type) {
+	case objects.ConfdClient:
+		err = gClientMgr.ConfigureClient(obj.(objects.ConfdClient))
+		if err == nil {
+			err = dbHdl.StoreObjectInDb(obj)
+		}
+		ok = err == nil
+	case objects.User, objects.ApiToken, objects.Role:
+		obj, err = hashSecrets(obj)
+		if err == nil {
+			err = dbHdl.StoreObjectInDb(obj)
+		}
+		ok = err == nil
 	default:
-		break
+		if hdl, exist := getLocalObjectHandler(obj); exist {
+			obj, err = prepareLocalObject(hdl, nil, obj)
+			if err == nil {
+				err = hdl.ApplyObject(OBJECT_CHANGE_CREATE, nil, obj)
+			}
+			if err == nil {
+				err = dbHdl.StoreObjectInDb(obj)
+			}
+			ok = err == nil
+		}
 	}
 	return err, ok
 }
@@ -96,8 +117,35 @@ func (clnt *LocalClient) DeleteObject(obj objects.ConfigObj, objKey string, dbHd
 	defer clnt.UnlockApiHandler()
 	clnt.LockApiHandler()
 	switch obj.(type) {
+	case objects.ConfdClient:
+		err = gClientMgr.RemoveClient(obj.(objects.ConfdClient).Name)
+		if err == nil {
+			err = dbHdl.DeleteObjectFromDb(obj)
+		}
+		ok = err == nil
+	case objects.User:
+		err = dbHdl.DeleteObjectFromDb(obj)
+		if err == nil {
+			deleteUserTokens(obj.(objects.User).UserName, dbHdl)
+		}
+		ok = err == nil
+	case objects.ApiToken:
+		err = dbHdl.DeleteObjectFromDb(obj)
+		ok = err == nil
+	case objects.Role:
+		err = checkRoleUnused(obj.(objects.Role).Name, dbHdl)
+		if err == nil {
+			err = dbHdl.DeleteObjectFromDb(obj)
+		}
+		ok = err == nil
 	default:
-		break
+		if hdl, exist := getLocalObjectHandler(obj); exist {
+			err = hdl.ApplyObject(OBJECT_CHANGE_DELETE, obj, nil)
+			if err == nil {
+				err = dbHdl.DeleteObjectFromDb(obj)
+			}
+			ok = err == nil
+		}
 	}
 	return err, ok
 }
@@ -110,12 +158,22 @@ func (clnt *LocalClient) GetBulkObject(obj objects.ConfigObj, dbHdl *dbutils.DBU
 	defer clnt.UnlockApiHandler()
 	clnt.LockApiHandler()
 	switch obj.(type) {
-	case objects.ConfigLogState:
-		objCount, nextMarker, more, objs = getApiHistory(dbHdl)
+	case objects.ConfdClient:
+		objCount, nextMarker, more, objs = getClientConfigs(currMarker, count)
+	case objects.ConfdClientState:
+		objCount, nextMarker, more, objs = getClientStates(currMarker, count)
+	case objects.DbIntegrityState, objects.ConfigLogIntegrityState:
+		var dbObjs []objects.ConfigObj
+		dbObjs, err = dbHdl.GetAllObjFromDb(obj)
+		objCount, nextMarker, more, objs = getPage(dbObjs, currMarker, count)
 	default:
-		break
+		if hdl, exist := getLocalObjectHandler(obj); exist {
+			var allObjs []objects.ConfigObj
+			allObjs, err = hdl.GetAllObjects(obj)
+			objCount, nextMarker, more, objs = getPage(allObjs, currMarker, count)
+		}
 	}
-	return nil, objCount, nextMarker, more, objs
+	return err, objCount, nextMarker, more, objs
 }
 
 func (clnt *LocalClient) UpdateObject(dbObj objects.ConfigObj, obj objects.ConfigObj, attrSet []bool, op []objects.PatchOpInfo, objKey string, dbHdl *dbutils.DBUtil) (error, bool) {
@@ -124,14 +182,36 @@ func (clnt *LocalClient) UpdateObject(dbObj objects.ConfigObj, obj objects.Confi
 	defer clnt.UnlockApiHandler()
 	clnt.LockApiHandler()
 	switch obj.(type) {
+	case objects.ConfdClient:
+		err = gClientMgr.ConfigureClient(obj.(objects.ConfdClient))
+		if err == nil {
+			err = dbHdl.UpdateObjectInDb(obj, dbObj, attrSet)
+		}
+		ok = err == nil
+	case objects.User, objects.ApiToken, objects.Role:
+		obj, err = hashSecrets(obj)
+		if err == nil {
+			err = dbHdl.UpdateObjectInDb(obj, dbObj, attrSet)
+		}
+		ok = err == nil
 	default:
-		break
+		if hdl, exist := getLocalObjectHandler(obj); exist {
+			obj, err = prepareLocalObject(hdl, dbObj, obj)
+			if err == nil {
+				err = hdl.ApplyObject(OBJECT_CHANGE_UPDATE, dbObj, obj)
+			}
+			if err == nil {
+				err = dbHdl.UpdateObjectInDb(obj, dbObj, attrSet)
+			}
+			ok = err == nil
+		}
 	}
 	return err, ok
 }
 
 func (clnt *LocalClient) GetObject(obj objects.ConfigObj, dbHdl *dbutils.DBUtil) (error, objects.ConfigObj) {
 	var retObj objects.ConfigObj
+	var err error
 	defer clnt.UnlockApiHandler()
 	clnt.LockApiHandler()
 	switch obj.(type) {
@@ -141,19 +221,33 @@ func (clnt *LocalClient) GetObject(obj objects.ConfigObj, dbHdl *dbutils.DBUtil)
 		retObj = gClientMgr.systemSwVersionCB()
 	case objects.ApiInfoState:
 		retObj = getApiInfo(obj)
+	case objects.ConfdClientState:
+		var state objects.ConfdClientState
+		state, err = gClientMgr.GetClientState(obj.(objects.ConfdClientState).Name)
+		retObj = state
+	case objects.DbIntegrityState, objects.ConfigLogIntegrityState:
+		retObj, err = dbHdl.GetObjectFromDb(obj, obj.GetKey())
 	default:
-		break
+		if hdl, exist := getLocalObjectHandler(obj); exist {
+			retObj, err = hdl.GetObject(obj)
+		}
 	}
-	return nil, retObj
+	return err, retObj
 }
 
 func (clnt *LocalClient) ExecuteAction(obj actions.ActionObj) error {
-	defer clnt.UnlockApiHandler()
-	clnt.LockApiHandler()
 	switch obj.(type) {
-	case actions.SaveConfig, actions.ApplyConfig, actions.ForceApplyConfig, actions.ResetConfig:
+	case actions.SaveConfig, actions.ApplyConfig, actions.ForceApplyConfig, actions.ResetConfig,
+		actions.CheckDbIntegrity, actions.BackupDatabase, actions.RestoreDatabase, actions.PurgeEvents,
+		actions.VerifyConfigLog:
+		// Configuration actions create confd owned objects through this
+		// client, so they must not hold the api handler lock
 		err := gClientMgr.executeConfigurationActionCB(obj)
 		return err
+	}
+	defer clnt.UnlockApiHandler()
+	clnt.LockApiHandler()
+	switch obj.(type) {
 	default:
 		break
 	}
@@ -163,34 +257,50 @@ func (clnt *LocalClient) ExecuteAction(obj actions.ActionObj) error {
 /*********************************************************************************************/
 // Below methods are for localclient's own use only
 
-type ApiCalls []objects.ConfigLogState
+func getClientNames() []string {
+	clients := gClientMgr.GetClients()
+	names := make([]string, 0, len(clients))
+	for name, _ := range clients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
 
-func (a ApiCalls) Len() int           { return len(a) }
-func (a ApiCalls) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
-func (a ApiCalls) Less(i, j int) bool { return a[i].SeqNum > a[j].SeqNum }
+func getPage(objs []objects.ConfigObj, currMarker, count int64) (int64, int64, bool, []objects.ConfigObj) {
+	if currMarker < 0 || currMarker >= int64(len(objs)) {
+		return 0, 0, false, nil
+	}
+	end := int64(len(objs))
+	if count > 0 && currMarker+count < end {
+		end = currMarker + count
+	}
+	more := end < int64(len(objs))
+	nextMarker := int64(0)
+	if more {
+		nextMarker = end
+	}
+	return end - currMarker, nextMarker, more, objs[currMarker:end]
+}
 
-func getApiHistory(dbHdl *dbutils.DBUtil) (int64, int64, bool, []objects.ConfigObj) {
-	var currMarker int64
-	var count int64
-	var retApiCalls []objects.ConfigObj
-	ApiCallObj := objects.ConfigLogState{}
-	currMarker = 0
-	count = 1024
-	err, count, next, more, apiCalls := dbHdl.GetBulkObjFromDb(ApiCallObj, currMarker, count)
-	if err != nil {
-		gClientMgr.logger.Err("Failed to get ConfigLog")
-	} else {
-		sortedApiCalls := make([]objects.ConfigLogState, len(apiCalls))
-		for idx, object := range apiCalls {
-			sortedApiCalls[idx] = object.(objects.ConfigLogState)
+func getClientConfigs(currMarker, count int64) (int64, int64, bool, []objects.ConfigObj) {
+	var cfgs []objects.ConfigObj
+	for _, name := range getClientNames() {
+		if cfg, err := gClientMgr.GetClientConfig(name); err == nil {
+			cfgs = append(cfgs, cfg)
 		}
-		sort.Sort(ApiCalls(sortedApiCalls))
-		retApiCalls = make([]objects.ConfigObj, len(sortedApiCalls))
-		for idx, object := range sortedApiCalls {
-			retApiCalls[idx] = object
+	}
+	return getPage(cfgs, currMarker, count)
+}
+
+func getClientStates(currMarker, count int64) (int64, int64, bool, []objects.ConfigObj) {
+	var states []objects.ConfigObj
+	for _, name := range getClientNames() {
+		if state, err := gClientMgr.GetClientState(name); err == nil {
+			states = append(states, state)
 		}
 	}
-	return count, next, more, retApiCalls
+	return getPage(states, currMarker, count)
 }
 
 const (
@@ -0,0 +1,78 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package clients
+
+import (
+	"models/objects"
+	"reflect"
+	"sync"
+)
+
+//
+// Handlers of confd owned objects which are implemented outside of the
+// clients package, such as alarm rules. LocalClient passes creates, updates
+// and deletes of a config object type to its handler before the DB is
+// changed, and reads state object types from their handler. Handlers are
+// registered by object type name, e.g. AlarmRule.
+//
+type LocalObjectHandler interface {
+	ApplyObject(op string, oldObj, newObj objects.ConfigObj) error
+	GetObject(obj objects.ConfigObj) (objects.ConfigObj, error)
+	GetAllObjects(obj objects.ConfigObj) ([]objects.ConfigObj, error)
+}
+
+//
+// Implemented by handlers which change objects before they are stored, e.g.
+// to keep secrets out of the DB. oldObj is nil for creates.
+//
+type LocalObjectPreparer interface {
+	PrepareObject(oldObj, newObj objects.ConfigObj) (objects.ConfigObj, error)
+}
+
+func prepareLocalObject(hdl LocalObjectHandler, oldObj, newObj objects.ConfigObj) (objects.ConfigObj, error) {
+	if preparer, ok := hdl.(LocalObjectPreparer); ok {
+		return preparer.PrepareObject(oldObj, newObj)
+	}
+	return newObj, nil
+}
+
+var localObjectMutex sync.RWMutex
+var localObjectHandlers = make(map[string]LocalObjectHandler)
+
+func RegisterLocalObjectHandler(objType string, hdl LocalObjectHandler) {
+	localObjectMutex.Lock()
+	localObjectHandlers[objType] = hdl
+	localObjectMutex.Unlock()
+}
+
+func getLocalObjectHandler(obj objects.ConfigObj) (LocalObjectHandler, bool) {
+	objType := reflect.TypeOf(obj)
+	if objType.Kind() == reflect.Ptr {
+		objType = objType.Elem()
+	}
+	localObjectMutex.RLock()
+	defer localObjectMutex.RUnlock()
+	hdl, exist := localObjectHandlers[objType.Name()]
+	return hdl, exist
+}
@@ -0,0 +1,76 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package clients
+
+import (
+	"config/metrics"
+	"time"
+)
+
+var (
+	clientRpcs = metrics.NewCounterVec("confd_client_rpcs_total",
+		"Daemon RPCs by client and operation", "client", "op")
+	clientRpcErrors = metrics.NewCounterVec("confd_client_rpc_errors_total",
+		"Failed daemon RPCs by client and operation, including timeouts and calls refused by the circuit breaker",
+		"client", "op")
+	clientRpcLatency = metrics.NewHistogramVec("confd_client_rpc_duration_seconds",
+		"Daemon RPC latency", metrics.DefaultBuckets, "client", "op")
+	clientConnects = metrics.NewCounterVec("confd_client_connects_total",
+		"Successful connects to daemons", "client")
+	clientConnectFailures = metrics.NewCounterVec("confd_client_connect_failures_total",
+		"Failed connect attempts to daemons", "client")
+	clientDisconnects = metrics.NewCounterVec("confd_client_disconnects_total",
+		"Disconnects from daemons", "client")
+)
+
+// Calls refused by the circuit breaker have no latency
+func recordRpc(client, op string, latency time.Duration, err error) {
+	clientRpcs.Inc(client, op)
+	if err != nil {
+		clientRpcErrors.Inc(client, op)
+	}
+	if latency > 0 {
+		clientRpcLatency.Observe(latency.Seconds(), client, op)
+	}
+}
+
+func recordConnect(client string, connected bool) {
+	if connected {
+		clientConnects.Inc(client)
+	} else {
+		clientConnectFailures.Inc(client)
+	}
+}
+
+func (mgr *ClientMgr) initializeMetrics() {
+	metrics.NewGaugeFunc("confd_clients_connected", "Number of connected daemons", func() float64 {
+		count := 0
+		for _, client := range mgr.GetClients() {
+			if client.IsConnectedToServer() {
+				count++
+			}
+		}
+		return float64(count)
+	})
+}
@@ -0,0 +1,235 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package clients
+
+import (
+	"errors"
+	"models/objects"
+	"sync"
+	"time"
+)
+
+//
+// Change notifications for listener daemons. Objects in genObjectConfig.json
+// can name Listeners besides their Owner. After a successful create, update
+// or delete confd queues an ObjectChange for every listener, and a per
+// client notifier delivers them in order, retrying with the client's backoff
+// policy. A change the listener refuses MAX_NOTIFY_ATTEMPTS times is given
+// up so that later changes are not held behind it. Only clients implementing
+// ObjectChangeListener, which the generated Thrift clients do not, can be
+// listeners.
+//
+const (
+	OBJECT_CHANGE_CREATE = "create"
+	OBJECT_CHANGE_UPDATE = "update"
+	OBJECT_CHANGE_DELETE = "delete"
+
+	MAX_PENDING_CHANGES = 1024
+	MAX_NOTIFY_ATTEMPTS = 10
+)
+
+var ErrNotListener = errors.New("Client does not accept change notifications")
+
+type ObjectChange struct {
+	Op           string            `json:"Op"`
+	ObjectType   string            `json:"ObjectType"`
+	OldObj       objects.ConfigObj `json:"OldObj"`
+	NewObj       objects.ConfigObj `json:"NewObj"`
+	ChangedAttrs []string          `json:"ChangedAttrs"`
+}
+
+//
+// Implemented by clients whose daemon can receive change notifications.
+//
+type ObjectChangeListener interface {
+	NotifyObjectChange(change ObjectChange) error
+}
+
+//
+// Failed counts the changes given up after MAX_NOTIFY_ATTEMPTS and Dropped
+// the ones pushed out of a full queue.
+//
+type NotifyStats struct {
+	Pending int32
+	Sent    uint32
+	Failed  uint32
+	Dropped uint32
+}
+
+// Changes are numbered so that a delivered change which was dropped from
+// the queue meanwhile does not take another one out with it
+type pendingChange struct {
+	seq    uint64
+	change ObjectChange
+}
+
+type changeNotifier struct {
+	hdl     *ClientHdl
+	mutex   sync.Mutex
+	seq     uint64
+	pending []pendingChange
+	kickCh  chan bool
+	stats   NotifyStats
+}
+
+func newChangeNotifier(hdl *ClientHdl) *changeNotifier {
+	notifier := &changeNotifier{
+		hdl:    hdl,
+		kickCh: make(chan bool, 1),
+	}
+	go notifier.run()
+	return notifier
+}
+
+func (notifier *changeNotifier) kick() {
+	select {
+	case notifier.kickCh <- true:
+	default:
+	}
+}
+
+func (notifier *changeNotifier) queue(change ObjectChange) {
+	notifier.mutex.Lock()
+	if len(notifier.pending) >= MAX_PENDING_CHANGES {
+		// Oldest changes are dropped first, newer ones carry later state
+		notifier.pending = notifier.pending[1:]
+		notifier.stats.Dropped++
+	}
+	notifier.seq++
+	notifier.pending = append(notifier.pending, pendingChange{seq: notifier.seq, change: change})
+	notifier.stats.Pending = int32(len(notifier.pending))
+	notifier.mutex.Unlock()
+	notifier.kick()
+}
+
+func (notifier *changeNotifier) head() (pending pendingChange, ok bool) {
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+	if len(notifier.pending) == 0 {
+		return pending, false
+	}
+	return notifier.pending[0], true
+}
+
+// Take a change off the queue once it is delivered or given up
+func (notifier *changeNotifier) done(seq uint64, failed bool) {
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+	if len(notifier.pending) > 0 && notifier.pending[0].seq == seq {
+		notifier.pending = notifier.pending[1:]
+	}
+	notifier.stats.Pending = int32(len(notifier.pending))
+	if failed {
+		notifier.stats.Failed++
+	} else {
+		notifier.stats.Sent++
+	}
+}
+
+func (notifier *changeNotifier) getStats() NotifyStats {
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+	return notifier.stats
+}
+
+func (notifier *changeNotifier) run() {
+	hdl := notifier.hdl
+	backoff := hdl.policy.NewBackoff()
+	var attemptSeq uint64
+	attempts := 0
+	for {
+		pending, ok := notifier.head()
+		if !ok {
+			<-notifier.kickCh
+			continue
+		}
+		if pending.seq != attemptSeq {
+			attemptSeq = pending.seq
+			attempts = 0
+		}
+		if !hdl.IsServerEnabled() || !hdl.IsConnectedToServer() {
+			// Reconnects are noticed on the next change or after a
+			// backoff interval
+			select {
+			case <-notifier.kickCh:
+			case <-time.After(backoff.Next()):
+			}
+			continue
+		}
+		change := pending.change
+		listener := hdl.ClientIf.(ObjectChangeListener)
+		err := hdl.invoke("NotifyObjectChange", func() error {
+			return listener.NotifyObjectChange(change)
+		})
+		if err != nil {
+			attempts++
+			if attempts >= MAX_NOTIFY_ATTEMPTS {
+				notifier.done(pending.seq, true)
+				backoff.Reset()
+				gClientMgr.logger.Err("Failed to notify", hdl.name, "of", change.Op, change.ObjectType, err,
+					"giving up after", attempts, "attempts")
+				continue
+			}
+			interval := backoff.Next()
+			gClientMgr.logger.Err("Failed to notify", hdl.name, "of", change.Op, change.ObjectType, err, "retry in", interval)
+			time.Sleep(interval)
+			continue
+		}
+		notifier.done(pending.seq, false)
+		backoff.Reset()
+	}
+}
+
+//
+// Queue a change notification for this client. Clients whose daemon can not
+// receive notifications return ErrNotListener.
+//
+func (hdl *ClientHdl) QueueObjectChange(change ObjectChange) error {
+	if _, ok := hdl.ClientIf.(ObjectChangeListener); !ok {
+		return ErrNotListener
+	}
+	hdl.notifyMutex.Lock()
+	if hdl.notifier == nil {
+		hdl.notifier = newChangeNotifier(hdl)
+	}
+	notifier := hdl.notifier
+	hdl.notifyMutex.Unlock()
+	notifier.queue(change)
+	return nil
+}
+
+func (hdl *ClientHdl) IsChangeListener() bool {
+	_, ok := hdl.ClientIf.(ObjectChangeListener)
+	return ok
+}
+
+func (hdl *ClientHdl) GetNotifyStats() (stats NotifyStats) {
+	hdl.notifyMutex.Lock()
+	notifier := hdl.notifier
+	hdl.notifyMutex.Unlock()
+	if notifier != nil {
+		stats = notifier.getStats()
+	}
+	return stats
+}
@@ -0,0 +1,144 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package clients
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testListener struct {
+	*SimClient
+	started   chan bool
+	release   chan bool
+	mutex     sync.Mutex
+	delivered []string
+}
+
+func (lsnr *testListener) NotifyObjectChange(change ObjectChange) error {
+	if change.ObjectType == "0" {
+		lsnr.started <- true
+		<-lsnr.release
+	}
+	lsnr.mutex.Lock()
+	lsnr.delivered = append(lsnr.delivered, change.ObjectType)
+	lsnr.mutex.Unlock()
+	return nil
+}
+
+type failingListener struct {
+	*SimClient
+	mutex    sync.Mutex
+	attempts map[string]int
+}
+
+func (lsnr *failingListener) NotifyObjectChange(change ObjectChange) error {
+	lsnr.mutex.Lock()
+	defer lsnr.mutex.Unlock()
+	lsnr.attempts[change.ObjectType]++
+	if change.ObjectType == "bad" {
+		return ErrSimInjected
+	}
+	return nil
+}
+
+func TestNotifyGivesUpFailingChange(t *testing.T) {
+	gClientMgr = &ClientMgr{logger: logger}
+	lsnr := &failingListener{
+		SimClient: NewSimClient(SimDaemonJson{}),
+		attempts:  make(map[string]int),
+	}
+	policy := DefaultClientPolicy()
+	policy.RpcTimeout = 0
+	policy.RetryInitialInterval = 1
+	policy.RetryMaxInterval = 1
+	policy.RetryJitter = 0
+	policy.BreakerThreshold = 0
+	hdl := NewClientHdl("listenerd", lsnr, policy)
+	if err := hdl.Configure("listenerd", ClientAddr{Transport: CLIENT_TRANSPORT_TCP, Address: "localhost:1"}); err != nil {
+		t.Fatal("Failed to configure client", err)
+	}
+	hdl.ConnectToServer()
+
+	hdl.QueueObjectChange(ObjectChange{Op: OBJECT_CHANGE_UPDATE, ObjectType: "bad"})
+	hdl.QueueObjectChange(ObjectChange{Op: OBJECT_CHANGE_UPDATE, ObjectType: "good"})
+	deadline := time.Now().Add(5 * time.Second)
+	for hdl.GetNotifyStats().Pending > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	stats := hdl.GetNotifyStats()
+	if stats.Pending != 0 || stats.Failed != 1 || stats.Sent != 1 {
+		t.Fatal("Unexpected notify stats", stats)
+	}
+	lsnr.mutex.Lock()
+	defer lsnr.mutex.Unlock()
+	if lsnr.attempts["bad"] != MAX_NOTIFY_ATTEMPTS || lsnr.attempts["good"] != 1 {
+		t.Error("Unexpected notification attempts", lsnr.attempts)
+	}
+}
+
+func TestQueueFullDuringDelivery(t *testing.T) {
+	lsnr := &testListener{
+		SimClient: NewSimClient(SimDaemonJson{}),
+		started:   make(chan bool),
+		release:   make(chan bool),
+	}
+	policy := DefaultClientPolicy()
+	policy.RpcTimeout = 0
+	hdl := NewClientHdl("listenerd", lsnr, policy)
+	if err := hdl.Configure("listenerd", ClientAddr{Transport: CLIENT_TRANSPORT_TCP, Address: "localhost:1"}); err != nil {
+		t.Fatal("Failed to configure client", err)
+	}
+	hdl.ConnectToServer()
+
+	// The first change is being delivered while the queue fills up and
+	// drops it
+	hdl.QueueObjectChange(ObjectChange{Op: OBJECT_CHANGE_UPDATE, ObjectType: "0"})
+	<-lsnr.started
+	for i := 1; i <= MAX_PENDING_CHANGES; i++ {
+		hdl.QueueObjectChange(ObjectChange{Op: OBJECT_CHANGE_UPDATE, ObjectType: strconv.Itoa(i)})
+	}
+	close(lsnr.release)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for hdl.GetNotifyStats().Pending > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	stats := hdl.GetNotifyStats()
+	if stats.Pending != 0 || stats.Dropped != 1 || stats.Sent != MAX_PENDING_CHANGES+1 {
+		t.Fatal("Unexpected notify stats", stats)
+	}
+	lsnr.mutex.Lock()
+	defer lsnr.mutex.Unlock()
+	if len(lsnr.delivered) != MAX_PENDING_CHANGES+1 {
+		t.Fatal("Expected", MAX_PENDING_CHANGES+1, "deliveries, got", len(lsnr.delivered))
+	}
+	for i, objType := range lsnr.delivered {
+		if objType != strconv.Itoa(i) {
+			t.Fatal("Change", i, "delivered as", objType, ", a queued change was lost")
+		}
+	}
+}
@@ -0,0 +1,242 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package clients
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+//
+// Per client connection and RPC policy. The policy is read from the optional
+// "Policy" section of a client entry in clients.json. All intervals are in
+// milliseconds. Attributes that are not present in the json take the default
+// values below. A RpcTimeout or BreakerThreshold of 0 disables that feature.
+//
+type ClientPolicyJson struct {
+	RetryInitialInterval int     `json:"RetryInitialInterval"`
+	RetryMaxInterval     int     `json:"RetryMaxInterval"`
+	RetryMultiplier      float64 `json:"RetryMultiplier"`
+	RetryJitter          float64 `json:"RetryJitter"`
+	RpcTimeout           int     `json:"RpcTimeout"`
+	BreakerThreshold     int     `json:"BreakerThreshold"`
+	BreakerResetTimeout  int     `json:"BreakerResetTimeout"`
+}
+
+const (
+	DEFAULT_RETRY_INITIAL_INTERVAL = 1000
+	DEFAULT_RETRY_MAX_INTERVAL     = 30000
+	DEFAULT_RETRY_MULTIPLIER       = 2.0
+	DEFAULT_RETRY_JITTER           = 0.2
+	DEFAULT_RPC_TIMEOUT            = 30000
+	DEFAULT_BREAKER_THRESHOLD      = 5
+	DEFAULT_BREAKER_RESET_TIMEOUT  = 30000
+)
+
+var ErrRpcTimeout = errors.New("Request to daemon timed out. The daemon may still apply it")
+var ErrCircuitOpen = errors.New("Daemon is failing requests, not sending request until it recovers")
+
+//
+// Implemented by clients which can bound each call on their connection, e.g.
+// with a socket deadline. The RpcTimeout of the client policy is handed to
+// the client before it is configured, so that a call which times out fails
+// in the client, before anything is stored in DB. RpcTimeout does not apply
+// to clients without it.
+//
+type RpcTimeoutConfigurer interface {
+	SetRpcTimeout(timeout time.Duration)
+}
+
+func DefaultClientPolicy() ClientPolicyJson {
+	return ClientPolicyJson{
+		RetryInitialInterval: DEFAULT_RETRY_INITIAL_INTERVAL,
+		RetryMaxInterval:     DEFAULT_RETRY_MAX_INTERVAL,
+		RetryMultiplier:      DEFAULT_RETRY_MULTIPLIER,
+		RetryJitter:          DEFAULT_RETRY_JITTER,
+		RpcTimeout:           DEFAULT_RPC_TIMEOUT,
+		BreakerThreshold:     DEFAULT_BREAKER_THRESHOLD,
+		BreakerResetTimeout:  DEFAULT_BREAKER_RESET_TIMEOUT,
+	}
+}
+
+// Overlay the policy given in clients.json on top of the defaults
+func ParseClientPolicy(data *json.RawMessage) (ClientPolicyJson, error) {
+	policy := DefaultClientPolicy()
+	if data == nil {
+		return policy, nil
+	}
+	err := json.Unmarshal(*data, &policy)
+	if err != nil {
+		return DefaultClientPolicy(), err
+	}
+	if policy.RetryInitialInterval <= 0 {
+		policy.RetryInitialInterval = DEFAULT_RETRY_INITIAL_INTERVAL
+	}
+	if policy.RetryMaxInterval < policy.RetryInitialInterval {
+		policy.RetryMaxInterval = policy.RetryInitialInterval
+	}
+	if policy.RetryMultiplier < 1 {
+		policy.RetryMultiplier = 1
+	}
+	if policy.RetryJitter < 0 || policy.RetryJitter > 1 {
+		policy.RetryJitter = DEFAULT_RETRY_JITTER
+	}
+	return policy, nil
+}
+
+func (policy ClientPolicyJson) NewBackoff() *Backoff {
+	return &Backoff{
+		initial:    time.Duration(policy.RetryInitialInterval) * time.Millisecond,
+		max:        time.Duration(policy.RetryMaxInterval) * time.Millisecond,
+		multiplier: policy.RetryMultiplier,
+		jitter:     policy.RetryJitter,
+	}
+}
+
+//
+// Exponential backoff with jitter. Each call to Next returns the time to wait
+// before the next attempt. The un-jittered interval grows by multiplier on
+// every call until it reaches max.
+//
+type Backoff struct {
+	initial    time.Duration
+	max        time.Duration
+	multiplier float64
+	jitter     float64
+	current    time.Duration
+}
+
+func (b *Backoff) Next() time.Duration {
+	if b.current == 0 {
+		b.current = b.initial
+	} else {
+		b.current = time.Duration(float64(b.current) * b.multiplier)
+		if b.current > b.max {
+			b.current = b.max
+		}
+	}
+	if b.jitter == 0 {
+		return b.current
+	}
+	delta := b.jitter * float64(b.current)
+	return time.Duration(float64(b.current) - delta + rand.Float64()*2*delta)
+}
+
+func (b *Backoff) Reset() {
+	b.current = 0
+}
+
+const (
+	BreakerClosed = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+var BreakerStateString = map[int]string{
+	BreakerClosed:   "Closed",
+	BreakerOpen:     "Open",
+	BreakerHalfOpen: "HalfOpen",
+}
+
+//
+// Circuit breaker for daemon RPCs. After threshold consecutive daemon failures
+// the breaker opens and requests fail immediately. Once resetTimeout has
+// elapsed a single trial request is let through; its result closes or re-opens
+// the breaker.
+//
+type CircuitBreaker struct {
+	sync.Mutex
+	threshold    int
+	resetTimeout time.Duration
+	state        int
+	failures     int
+	openedAt     time.Time
+	trialPending bool
+}
+
+func NewCircuitBreaker(threshold int, resetTimeout time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold:    threshold,
+		resetTimeout: resetTimeout,
+		state:        BreakerClosed,
+	}
+}
+
+// Returns ErrCircuitOpen if the request should not be sent to the daemon
+func (cb *CircuitBreaker) Allow() error {
+	if cb.threshold <= 0 {
+		return nil
+	}
+	cb.Lock()
+	defer cb.Unlock()
+	switch cb.state {
+	case BreakerOpen:
+		if time.Since(cb.openedAt) < cb.resetTimeout {
+			return ErrCircuitOpen
+		}
+		cb.state = BreakerHalfOpen
+		cb.trialPending = true
+		return nil
+	case BreakerHalfOpen:
+		if cb.trialPending {
+			return ErrCircuitOpen
+		}
+		cb.trialPending = true
+	}
+	return nil
+}
+
+// Record the result of a request let through by Allow. Returns true if this
+// failure moved the breaker to open state.
+func (cb *CircuitBreaker) Record(failed bool) bool {
+	if cb.threshold <= 0 {
+		return false
+	}
+	cb.Lock()
+	defer cb.Unlock()
+	if !failed {
+		cb.failures = 0
+		cb.state = BreakerClosed
+		cb.trialPending = false
+		return false
+	}
+	cb.failures++
+	if cb.state == BreakerHalfOpen || cb.failures >= cb.threshold {
+		tripped := cb.state != BreakerOpen
+		cb.state = BreakerOpen
+		cb.openedAt = time.Now()
+		cb.trialPending = false
+		return tripped
+	}
+	return false
+}
+
+func (cb *CircuitBreaker) State() int {
+	cb.Lock()
+	defer cb.Unlock()
+	return cb.state
+}
@@ -0,0 +1,108 @@
+package clients
+
+import (
+	"encoding/json"
+	"models/objects"
+	"testing"
+	"time"
+)
+
+func TestParseClientPolicy(t *testing.T) {
+	policy, err := ParseClientPolicy(nil)
+	if err != nil || policy != DefaultClientPolicy() {
+		t.Error("Expected default policy for client without policy, got", policy, err)
+	}
+	data := json.RawMessage(`{"RpcTimeout": 0, "RetryMaxInterval": 10}`)
+	policy, err = ParseClientPolicy(&data)
+	if err != nil {
+		t.Error("Failed to parse policy", err)
+	}
+	if policy.RpcTimeout != 0 {
+		t.Error("Expected RpcTimeout 0, got", policy.RpcTimeout)
+	}
+	if policy.RetryMaxInterval != policy.RetryInitialInterval {
+		t.Error("Expected RetryMaxInterval to be raised to RetryInitialInterval, got", policy.RetryMaxInterval)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := DefaultClientPolicy()
+	policy.RetryJitter = 0
+	backoff := policy.NewBackoff()
+	expected := []time.Duration{1, 2, 4, 8, 16, 30, 30}
+	for _, exp := range expected {
+		if delay := backoff.Next(); delay != exp*time.Second {
+			t.Error("Expected delay", exp*time.Second, "got", delay)
+		}
+	}
+	backoff.Reset()
+	if delay := backoff.Next(); delay != time.Second {
+		t.Error("Expected delay to restart at 1s after reset, got", delay)
+	}
+
+	policy.RetryJitter = 0.5
+	backoff = policy.NewBackoff()
+	for i := 0; i < 100; i++ {
+		delay := backoff.Next()
+		if delay < 500*time.Millisecond || delay > 45*time.Second {
+			t.Error("Jittered delay out of range", delay)
+		}
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	cb := NewCircuitBreaker(3, 50*time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if cb.Allow() != nil || cb.Record(true) {
+			t.Error("Breaker opened before reaching threshold")
+		}
+	}
+	if cb.Allow() != nil || !cb.Record(true) {
+		t.Error("Breaker did not open at threshold")
+	}
+	if cb.Allow() != ErrCircuitOpen {
+		t.Error("Open breaker let a request through")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if cb.Allow() != nil {
+		t.Error("Breaker did not allow trial request after reset timeout")
+	}
+	if cb.Allow() != ErrCircuitOpen {
+		t.Error("Half open breaker let a second request through")
+	}
+	cb.Record(false)
+	if cb.State() != BreakerClosed || cb.Allow() != nil {
+		t.Error("Successful trial request did not close the breaker")
+	}
+
+	disabled := NewCircuitBreaker(0, 0)
+	for i := 0; i < 10; i++ {
+		disabled.Record(true)
+	}
+	if disabled.Allow() != nil {
+		t.Error("Disabled breaker failed a request")
+	}
+}
+
+func TestRpcTimeout(t *testing.T) {
+	policy := DefaultClientPolicy()
+	policy.RpcTimeout = 20
+	sim := NewSimClient(SimDaemonJson{Latency: 1000})
+	hdl := NewClientHdl("simd", sim, policy)
+	if err := hdl.Configure("simd", ClientAddr{Transport: CLIENT_TRANSPORT_TCP, Address: "localhost:1"}); err != nil {
+		t.Fatal("Failed to configure client", err)
+	}
+	start := time.Now()
+	err, ok := hdl.CreateObject(objects.ConfdClient{Name: "simd"}, nil)
+	if err != ErrRpcTimeout || ok {
+		t.Error("Expected the call to time out, got", err, ok)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Error("Call returned after", elapsed, "rather than at the deadline")
+	}
+	// The call ended in the client, so nothing was stored after the deadline
+	time.Sleep(50 * time.Millisecond)
+	if objs := sim.getObjs("ConfdClient", nil); len(objs) != 0 {
+		t.Error("Timed out call stored", objs)
+	}
+}
@@ -0,0 +1,403 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package clients
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"models/actions"
+	"models/objects"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"utils/dbutils"
+	"utils/ipcutils"
+	"utils/logging"
+)
+
+//
+// Simulation mode replaces every daemon client with SimClient, an in-memory
+// backend. Config objects are kept in memory and stored in DB like the
+// generated clients do, state objects are synthesized from the config object
+// of the same name without the State suffix, and actions are accepted.
+// Latency and errors can be injected per daemon through simulation.json.
+//
+const (
+	SIM_CONFIG_FILE  = "simulation.json"
+	SIM_STATE_SUFFIX = "State"
+)
+
+var ErrSimInjected = errors.New("Simulated daemon error")
+
+type SimDaemonJson struct {
+	Latency   int      `json:"Latency"`
+	ErrorRate float64  `json:"ErrorRate"`
+	FailOps   []string `json:"FailOps"`
+	Down      bool     `json:"Down"`
+}
+
+type SimConfigJson struct {
+	Default SimDaemonJson            `json:"Default"`
+	Daemons map[string]SimDaemonJson `json:"Daemons"`
+}
+
+type SimClient struct {
+	ipcutils.IPCClientBase
+	enabled    bool
+	cfg        SimDaemonJson
+	rpcTimeout time.Duration
+	objLock    sync.RWMutex
+	objs       map[string]map[string]objects.ConfigObj
+	loaded     map[string]bool
+}
+
+func NewSimClient(cfg SimDaemonJson) *SimClient {
+	return &SimClient{
+		enabled: true,
+		cfg:     cfg,
+		objs:    make(map[string]map[string]objects.ConfigObj),
+		loaded:  make(map[string]bool),
+	}
+}
+
+//
+// Replace all daemon clients but local with simulated ones. This has to be
+// done before InitializeClientMgr.
+//
+func EnableSimulation(cfgFile string, logger *logging.Writer) error {
+	var simCfg SimConfigJson
+	bytes, err := ioutil.ReadFile(cfgFile)
+	if err == nil {
+		err = json.Unmarshal(bytes, &simCfg)
+		if err != nil {
+			return err
+		}
+	} else {
+		logger.Info("No simulation config", cfgFile, "simulated daemons have no latency or errors")
+	}
+	clientInterfacesMutex.Lock()
+	defer clientInterfacesMutex.Unlock()
+	for name, _ := range ClientInterfaces {
+		if name == "local" {
+			continue
+		}
+		cfg, exist := simCfg.Daemons[name]
+		if !exist {
+			cfg = simCfg.Default
+		}
+		ClientInterfaces[name] = NewSimClient(cfg)
+	}
+	logger.Info("Simulation mode, all daemons are simulated")
+	return nil
+}
+
+// Simulated daemons are not dialed, so any address will do
+func (clnt *SimClient) ConfigureTransport(addr ClientAddr) error {
+	return nil
+}
+
+// A Latency above the deadline fails calls with ErrRpcTimeout at the deadline
+func (clnt *SimClient) SetRpcTimeout(timeout time.Duration) {
+	clnt.rpcTimeout = timeout
+}
+
+func (clnt *SimClient) Initialize(name string, address string) {
+	clnt.Name = name
+	clnt.Address = "sim://" + name
+	clnt.ApiHandlerMutex = sync.RWMutex{}
+	clnt.IsConnected = false
+}
+
+// A Down daemon never connects, so startup does not wait for it
+func (clnt *SimClient) IsDown() bool {
+	return clnt.cfg.Down
+}
+
+func (clnt *SimClient) ConnectToServer() bool {
+	clnt.IsConnected = !clnt.cfg.Down
+	return clnt.IsConnected
+}
+
+func (clnt *SimClient) DisconnectFromServer() bool {
+	clnt.IsConnected = false
+	return true
+}
+
+func (clnt *SimClient) IsConnectedToServer() bool {
+	return clnt.IsConnected
+}
+
+func (clnt *SimClient) DisableServer() bool {
+	clnt.enabled = false
+	return true
+}
+
+func (clnt *SimClient) IsServerEnabled() bool {
+	return clnt.enabled
+}
+
+func (clnt *SimClient) GetServerName() string {
+	return clnt.Name
+}
+
+func (clnt *SimClient) LockApiHandler() {
+	clnt.ApiHandlerMutex.Lock()
+}
+
+func (clnt *SimClient) UnlockApiHandler() {
+	clnt.ApiHandlerMutex.Unlock()
+}
+
+// Apply the configured latency and decide whether op fails
+func (clnt *SimClient) simulate(op string) error {
+	if clnt.cfg.Latency > 0 {
+		latency := time.Duration(clnt.cfg.Latency) * time.Millisecond
+		if clnt.rpcTimeout > 0 && latency > clnt.rpcTimeout {
+			time.Sleep(clnt.rpcTimeout)
+			return ErrRpcTimeout
+		}
+		time.Sleep(latency)
+	}
+	for _, failOp := range clnt.cfg.FailOps {
+		if failOp == op {
+			return ErrSimInjected
+		}
+	}
+	if clnt.cfg.ErrorRate > 0 && rand.Float64() < clnt.cfg.ErrorRate {
+		return ErrSimInjected
+	}
+	return nil
+}
+
+func (clnt *SimClient) storeObj(obj objects.ConfigObj) {
+	objType := getTypeName(obj)
+	clnt.objLock.Lock()
+	defer clnt.objLock.Unlock()
+	if clnt.objs[objType] == nil {
+		clnt.objs[objType] = make(map[string]objects.ConfigObj)
+	}
+	clnt.objs[objType][obj.GetKey()] = obj
+}
+
+func (clnt *SimClient) deleteObj(obj objects.ConfigObj) {
+	clnt.objLock.Lock()
+	defer clnt.objLock.Unlock()
+	delete(clnt.objs[getTypeName(obj)], obj.GetKey())
+}
+
+//
+// Objects of a type sorted by key so that bulk gets are stable. Objects
+// stored in DB by an earlier run are loaded the first time a type is used.
+//
+func (clnt *SimClient) getObjs(objType string, dbHdl *dbutils.DBUtil) []objects.ConfigObj {
+	clnt.objLock.Lock()
+	defer clnt.objLock.Unlock()
+	if !clnt.loaded[objType] && dbHdl != nil {
+		clnt.loaded[objType] = true
+		if objHdl, exist := objects.ConfigObjectMap[strings.ToLower(objType)]; exist {
+			dbObjs, _ := dbHdl.GetAllObjFromDb(objHdl)
+			for _, dbObj := range dbObjs {
+				if clnt.objs[objType] == nil {
+					clnt.objs[objType] = make(map[string]objects.ConfigObj)
+				}
+				if _, exist := clnt.objs[objType][dbObj.GetKey()]; !exist {
+					clnt.objs[objType][dbObj.GetKey()] = dbObj
+				}
+			}
+		}
+	}
+	keys := make([]string, 0, len(clnt.objs[objType]))
+	for key, _ := range clnt.objs[objType] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	objs := make([]objects.ConfigObj, 0, len(keys))
+	for _, key := range keys {
+		objs = append(objs, clnt.objs[objType][key])
+	}
+	return objs
+}
+
+// Copy the fields which exist with the same name and type in both objects
+func copyCommonFields(dst reflect.Value, src objects.ConfigObj) {
+	srcVal := reflect.ValueOf(src)
+	if srcVal.Kind() != reflect.Struct {
+		return
+	}
+	for idx := 0; idx < dst.NumField(); idx++ {
+		field := dst.Type().Field(idx)
+		if field.PkgPath != "" || field.Anonymous {
+			continue
+		}
+		srcField := srcVal.FieldByName(field.Name)
+		if srcField.IsValid() && srcField.Type() == field.Type {
+			dst.Field(idx).Set(srcField)
+		}
+	}
+}
+
+// Whether every non zero field of filter has the same value in obj
+func matchesFilter(filter, obj objects.ConfigObj) bool {
+	filterVal := reflect.ValueOf(filter)
+	objVal := reflect.ValueOf(obj)
+	if filterVal.Kind() != reflect.Struct || objVal.Kind() != reflect.Struct {
+		return false
+	}
+	for idx := 0; idx < filterVal.NumField(); idx++ {
+		field := filterVal.Type().Field(idx)
+		if field.PkgPath != "" || field.Anonymous {
+			continue
+		}
+		value := filterVal.Field(idx)
+		if reflect.DeepEqual(value.Interface(), reflect.Zero(field.Type).Interface()) {
+			continue
+		}
+		objField := objVal.FieldByName(field.Name)
+		if objField.IsValid() && !reflect.DeepEqual(objField.Interface(), value.Interface()) {
+			return false
+		}
+	}
+	return true
+}
+
+func synthesizeState(stateObj, cfgObj objects.ConfigObj) objects.ConfigObj {
+	state := reflect.New(reflect.TypeOf(stateObj)).Elem()
+	state.Set(reflect.ValueOf(stateObj))
+	copyCommonFields(state, cfgObj)
+	return state.Interface().(objects.ConfigObj)
+}
+
+//
+// Config objects are returned as stored. State objects are synthesized
+// from the stored objects of the matching config type.
+//
+func (clnt *SimClient) getSimObjs(obj objects.ConfigObj, dbHdl *dbutils.DBUtil) []objects.ConfigObj {
+	objType := getTypeName(obj)
+	if !strings.HasSuffix(objType, SIM_STATE_SUFFIX) {
+		return clnt.getObjs(objType, dbHdl)
+	}
+	cfgObjs := clnt.getObjs(strings.TrimSuffix(objType, SIM_STATE_SUFFIX), dbHdl)
+	stateObjs := make([]objects.ConfigObj, 0, len(cfgObjs))
+	for _, cfgObj := range cfgObjs {
+		stateObjs = append(stateObjs, synthesizeState(obj, cfgObj))
+	}
+	return stateObjs
+}
+
+func (clnt *SimClient) CreateObject(obj objects.ConfigObj, dbHdl *dbutils.DBUtil) (error, bool) {
+	defer clnt.UnlockApiHandler()
+	clnt.LockApiHandler()
+	if err := clnt.simulate("CreateObject"); err != nil {
+		return err, false
+	}
+	if dbHdl != nil {
+		if err := dbHdl.StoreObjectInDb(obj); err != nil {
+			return err, false
+		}
+	}
+	clnt.storeObj(obj)
+	return nil, true
+}
+
+func (clnt *SimClient) DeleteObject(obj objects.ConfigObj, objKey string, dbHdl *dbutils.DBUtil) (error, bool) {
+	defer clnt.UnlockApiHandler()
+	clnt.LockApiHandler()
+	if err := clnt.simulate("DeleteObject"); err != nil {
+		return err, false
+	}
+	if dbHdl != nil {
+		if err := dbHdl.DeleteObjectFromDb(obj); err != nil {
+			return err, false
+		}
+	}
+	clnt.deleteObj(obj)
+	return nil, true
+}
+
+func (clnt *SimClient) UpdateObject(dbObj objects.ConfigObj, obj objects.ConfigObj, attrSet []bool, op []objects.PatchOpInfo, objKey string, dbHdl *dbutils.DBUtil) (error, bool) {
+	defer clnt.UnlockApiHandler()
+	clnt.LockApiHandler()
+	if err := clnt.simulate("UpdateObject"); err != nil {
+		return err, false
+	}
+	if dbHdl != nil {
+		if err := dbHdl.UpdateObjectInDb(obj, dbObj, attrSet); err != nil {
+			return err, false
+		}
+	}
+	clnt.storeObj(obj)
+	return nil, true
+}
+
+func (clnt *SimClient) GetObject(obj objects.ConfigObj, dbHdl *dbutils.DBUtil) (error, objects.ConfigObj) {
+	defer clnt.UnlockApiHandler()
+	clnt.LockApiHandler()
+	if err := clnt.simulate("GetObject"); err != nil {
+		return err, nil
+	}
+	objType := getTypeName(obj)
+	if !strings.HasSuffix(objType, SIM_STATE_SUFFIX) {
+		for _, cfgObj := range clnt.getObjs(objType, dbHdl) {
+			if matchesFilter(obj, cfgObj) {
+				return nil, cfgObj
+			}
+		}
+		return errors.New("Object not found"), nil
+	}
+	for _, cfgObj := range clnt.getObjs(strings.TrimSuffix(objType, SIM_STATE_SUFFIX), dbHdl) {
+		if matchesFilter(obj, cfgObj) {
+			return nil, synthesizeState(obj, cfgObj)
+		}
+	}
+	// State objects without a config counterpart echo the requested key
+	return nil, obj
+}
+
+func (clnt *SimClient) GetBulkObject(obj objects.ConfigObj, dbHdl *dbutils.DBUtil, currMarker int64, count int64) (err error, objCount int64, nextMarker int64, more bool, objs []objects.ConfigObj) {
+	defer clnt.UnlockApiHandler()
+	clnt.LockApiHandler()
+	if err = clnt.simulate("GetBulkObject"); err != nil {
+		return err, 0, 0, false, nil
+	}
+	objCount, nextMarker, more, objs = getPage(clnt.getSimObjs(obj, dbHdl), currMarker, count)
+	return nil, objCount, nextMarker, more, objs
+}
+
+func (clnt *SimClient) ExecuteAction(obj actions.ActionObj) error {
+	defer clnt.UnlockApiHandler()
+	clnt.LockApiHandler()
+	return clnt.simulate("ExecuteAction")
+}
+
+func (clnt *SimClient) PreUpdateValidation(dbObj, obj objects.ConfigObj, attrSet []bool, dbHdl *dbutils.DBUtil) error {
+	return clnt.simulate("PreUpdateValidation")
+}
+
+func (clnt *SimClient) PostUpdateProcessing(dbObj, obj objects.ConfigObj, attrSet []bool, dbHdl *dbutils.DBUtil) error {
+	return nil
+}
@@ -0,0 +1,150 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package clients
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	CLIENT_TRANSPORT_TCP  = "tcp"
+	CLIENT_TRANSPORT_UNIX = "unix"
+	DEFAULT_CLIENT_HOST   = "localhost"
+)
+
+//
+// Optional TLS settings for a client connection. CertFile and KeyFile are
+// only needed when the daemon verifies client certificates. CaFile replaces
+// the system roots when verifying the daemon's certificate.
+//
+type ClientTLSJson struct {
+	CertFile           string `json:"CertFile"`
+	KeyFile            string `json:"KeyFile"`
+	CaFile             string `json:"CaFile"`
+	ServerName         string `json:"ServerName"`
+	InsecureSkipVerify bool   `json:"InsecureSkipVerify"`
+}
+
+//
+// Where and how to reach a daemon. Address is host:port for tcp and the
+// socket path for unix transport.
+//
+type ClientAddr struct {
+	Transport string
+	Address   string
+	TLS       *ClientTLSJson
+}
+
+func (client ClientJson) GetClientAddr() (ClientAddr, error) {
+	var addr ClientAddr
+	addr.TLS = client.TLS
+	switch client.Transport {
+	case "", CLIENT_TRANSPORT_TCP:
+		host := client.Host
+		if host == "" {
+			host = DEFAULT_CLIENT_HOST
+		}
+		addr.Transport = CLIENT_TRANSPORT_TCP
+		addr.Address = net.JoinHostPort(host, strconv.Itoa(client.Port))
+	case CLIENT_TRANSPORT_UNIX:
+		if client.SocketPath == "" {
+			return addr, errors.New("SocketPath is required for unix transport")
+		}
+		addr.Transport = CLIENT_TRANSPORT_UNIX
+		addr.Address = client.SocketPath
+	default:
+		return addr, errors.New("Unsupported transport " + client.Transport)
+	}
+	return addr, nil
+}
+
+func (addr ClientAddr) String() string {
+	if addr.TLS != nil {
+		return addr.Transport + "+tls://" + addr.Address
+	}
+	return addr.Transport + "://" + addr.Address
+}
+
+func (addr ClientAddr) TLSConfig() (*tls.Config, error) {
+	if addr.TLS == nil {
+		return nil, nil
+	}
+	config := &tls.Config{
+		ServerName:         addr.TLS.ServerName,
+		InsecureSkipVerify: addr.TLS.InsecureSkipVerify,
+	}
+	if config.ServerName == "" && addr.Transport == CLIENT_TRANSPORT_TCP {
+		config.ServerName, _, _ = net.SplitHostPort(addr.Address)
+	}
+	if addr.TLS.CertFile != "" || addr.TLS.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(addr.TLS.CertFile, addr.TLS.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if addr.TLS.CaFile != "" {
+		caCert, err := ioutil.ReadFile(addr.TLS.CaFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(caCert) {
+			return nil, errors.New("No certificates found in " + addr.TLS.CaFile)
+		}
+	}
+	return config, nil
+}
+
+//
+// Implemented by clients which can reach their daemon over any ClientAddr.
+// ConfigureTransport is called before Initialize whenever the client's
+// address is set. Clients without it are initialized with the tcp host:port
+// and cannot use unix sockets or TLS.
+//
+type TransportConfigurer interface {
+	ConfigureTransport(addr ClientAddr) error
+}
+
+//
+// Open a connection to the daemon. Client implementations wrap the returned
+// connection in their IPC transport.
+//
+func (addr ClientAddr) Dial(timeout time.Duration) (net.Conn, error) {
+	tlsConfig, err := addr.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	if tlsConfig != nil {
+		return tls.DialWithDialer(dialer, addr.Transport, addr.Address, tlsConfig)
+	}
+	return dialer.Dial(addr.Transport, addr.Address)
+}
@@ -0,0 +1,125 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package clients
+
+import (
+	"config/auth"
+	"errors"
+	"models/objects"
+	"utils/dbutils"
+)
+
+//
+// Users, API tokens and roles of the REST API are confd owned objects. Passwords
+// and tokens are replaced by their hashes before they are stored. Values
+// which are hashes already, e.g. from a restored backup, are kept.
+//
+func hashSecrets(obj objects.ConfigObj) (objects.ConfigObj, error) {
+	var err error
+	switch obj.(type) {
+	case objects.User:
+		user := obj.(objects.User)
+		if !auth.IsPasswordHash(user.Password) {
+			user.Password, err = auth.HashPassword(user.Password)
+		}
+		return user, err
+	case objects.ApiToken:
+		apiToken := obj.(objects.ApiToken)
+		if apiToken.UserName == "" {
+			return obj, errors.New("UserName is required for ApiToken " + apiToken.Name)
+		}
+		if !auth.IsTokenHash(apiToken.Token) {
+			apiToken.Token, err = auth.HashToken(apiToken.Token)
+		}
+		return apiToken, err
+	case objects.Role:
+		role := obj.(objects.Role)
+		if auth.IsBuiltinRole(role.Name) {
+			return obj, errors.New("Role " + role.Name + " is a built-in role")
+		}
+		return obj, auth.ValidatePermissions(role.Permissions)
+	}
+	return obj, nil
+}
+
+//
+// Lookup of object keys in the secondary indexes, set by the object manager.
+// It fails for attributes which are not indexed.
+//
+type ObjKeyFinder func(resource string, filters map[string]string) ([]string, error)
+
+var findObjKeys ObjKeyFinder
+
+func SetObjKeyFinder(finder ObjKeyFinder) {
+	findObjKeys = finder
+}
+
+//
+// Objects of resource whose attr may have value. Indexed attributes are
+// looked up in their index, otherwise all objects are returned, so callers
+// still check attr.
+//
+func findObjsByAttr(obj dbutils.ObjIf, resource, attr, value string, dbHdl *dbutils.DBUtil) ([]dbutils.ObjIf, error) {
+	if findObjKeys != nil {
+		if keys, err := findObjKeys(resource, map[string]string{attr: value}); err == nil {
+			objs := make([]dbutils.ObjIf, 0, len(keys))
+			for _, key := range keys {
+				if dbObj, err := dbHdl.GetObjectFromDb(obj, key); err == nil {
+					objs = append(objs, dbObj)
+				}
+			}
+			return objs, nil
+		}
+	}
+	return dbHdl.GetAllObjFromDb(obj)
+}
+
+// A role can not be deleted while users have it
+func checkRoleUnused(roleName string, dbHdl *dbutils.DBUtil) error {
+	users, err := findObjsByAttr(objects.User{}, "user", "Role", roleName, dbHdl)
+	if err != nil {
+		return nil
+	}
+	for _, obj := range users {
+		if obj.(objects.User).Role == roleName {
+			return errors.New("Role " + roleName + " is in use by user " + obj.(objects.User).UserName)
+		}
+	}
+	return nil
+}
+
+// Tokens of a deleted user are deleted with it
+func deleteUserTokens(userName string, dbHdl *dbutils.DBUtil) {
+	tokens, err := findObjsByAttr(objects.ApiToken{}, "apitoken", "UserName", userName, dbHdl)
+	if err != nil {
+		return
+	}
+	for _, obj := range tokens {
+		if obj.(objects.ApiToken).UserName == userName {
+			if err = dbHdl.DeleteObjectFromDb(obj); err != nil {
+				gClientMgr.logger.Err("Failed to delete ApiToken", obj.GetKey(), err)
+			}
+		}
+	}
+}
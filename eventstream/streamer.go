@@ -0,0 +1,332 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package eventstream
+
+import (
+	"config/metrics"
+	"config/objects"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"utils/logging"
+)
+
+//
+// The streamer lists the event keys in the DB every POLL_INTERVAL while
+// clients are streaming, and every IDLE_POLL_INTERVAL otherwise, and reads
+// and numbers the events under keys it has not seen before. The last
+// RING_SIZE events are
+// kept so that a client can resume after the last event id it received.
+// Each subscriber has a queue of SUBSCRIBER_QUEUE_SIZE events; a subscriber
+// which falls that far behind is dropped and resumes by reconnecting.
+//
+const (
+	POLL_INTERVAL         = time.Second
+	IDLE_POLL_INTERVAL    = 30 * time.Second
+	RING_SIZE             = 4096
+	SUBSCRIBER_QUEUE_SIZE = 256
+)
+
+var ErrSlowConsumer = errors.New("Event stream dropped, client is too slow")
+var ErrStopped = errors.New("Event stream stopped")
+
+type Event struct {
+	Id       uint64          `json:"Id"`
+	Type     string          `json:"Type"`
+	Time     string          `json:"Time"`
+	Owner    string          `json:"Owner"`
+	Severity string          `json:"Severity"`
+	Source   string          `json:"Source"`
+	Key      string          `json:"Key"`
+	Data     json.RawMessage `json:"Event"`
+}
+
+//
+// Reads the events in the DB. GetEventKeys lists the keys of the stored
+// events by event type, GetEventsByKey reads the events of keys of a type.
+// Events are matched between reads by their key.
+//
+type EventReader interface {
+	GetEventKeys() (map[string][]string, error)
+	GetEventsByKey(keys []string) ([]interface{}, error)
+}
+
+// Empty fields match all events
+type Filter struct {
+	Types      map[string]bool
+	Owners     map[string]bool
+	Severities map[string]bool
+	Key        string
+}
+
+func (filter *Filter) Match(event *Event) bool {
+	if len(filter.Types) > 0 && !filter.Types[strings.ToLower(event.Type)] {
+		return false
+	}
+	if len(filter.Owners) > 0 && !filter.Owners[strings.ToLower(event.Owner)] {
+		return false
+	}
+	if len(filter.Severities) > 0 && !filter.Severities[strings.ToLower(event.Severity)] {
+		return false
+	}
+	return filter.Key == "" || strings.Contains(strings.ToLower(event.Key), strings.ToLower(filter.Key))
+}
+
+type Subscriber struct {
+	filter Filter
+	C      chan Event
+	err    error
+}
+
+// Why the events channel was closed
+func (sub *Subscriber) Err() error {
+	return sub.err
+}
+
+type Streamer struct {
+	logger      *logging.Writer
+	read        EventReader
+	mutex       sync.Mutex
+	lastId      uint64
+	ring        []Event
+	known       map[string]map[string]bool
+	subscribers map[*Subscriber]bool
+	stopped     bool
+	stopCh      chan struct{}
+	wg          sync.WaitGroup
+}
+
+var (
+	streamsDropped = metrics.NewCounterVec("confd_event_streams_dropped_total",
+		"Event streams dropped for falling behind")
+	eventsStreamed = metrics.NewCounterVec("confd_events_streamed_total",
+		"Events read from the DB for streaming", "type")
+)
+
+func NewStreamer(read EventReader, logger *logging.Writer) *Streamer {
+	streamer := &Streamer{
+		logger:      logger,
+		read:        read,
+		subscribers: make(map[*Subscriber]bool),
+		stopCh:      make(chan struct{}),
+	}
+	// Ids of a run are above those of the runs before it, so an id from
+	// before a restart shows as a gap
+	streamer.lastId = uint64(time.Now().UnixNano()/int64(time.Millisecond)) * 1000
+	metrics.NewGaugeFunc("confd_event_streams", "Connected event streams", func() float64 {
+		streamer.mutex.Lock()
+		defer streamer.mutex.Unlock()
+		return float64(len(streamer.subscribers))
+	})
+	streamer.wg.Add(1)
+	go streamer.run()
+	return streamer
+}
+
+// Close all streams
+func (streamer *Streamer) Stop() {
+	streamer.mutex.Lock()
+	if streamer.stopped {
+		streamer.mutex.Unlock()
+		return
+	}
+	streamer.stopped = true
+	for sub, _ := range streamer.subscribers {
+		streamer.closeSubscriber(sub, ErrStopped)
+	}
+	streamer.mutex.Unlock()
+	close(streamer.stopCh)
+	streamer.wg.Wait()
+}
+
+func (streamer *Streamer) run() {
+	defer streamer.wg.Done()
+	lastPoll := time.Now()
+	streamer.poll(lastPoll)
+	ticker := time.NewTicker(POLL_INTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-streamer.stopCh:
+			return
+		case now := <-ticker.C:
+			streamer.mutex.Lock()
+			idle := len(streamer.subscribers) == 0
+			streamer.mutex.Unlock()
+			if !idle || now.Sub(lastPoll) >= IDLE_POLL_INTERVAL {
+				streamer.poll(now)
+				lastPoll = now
+			}
+		}
+	}
+}
+
+func newEvent(eventType string, obj interface{}, now time.Time) (Event, error) {
+	info, data, err := objects.GetEventInfo(obj)
+	if err != nil {
+		return Event{}, err
+	}
+	event := Event{
+		Type:     eventType,
+		Time:     now.Format(time.RFC3339),
+		Owner:    info.Owner,
+		Severity: info.Severity,
+		Source:   info.Source,
+		Key:      info.Key,
+		Data:     data,
+	}
+	if !info.Time.IsZero() {
+		event.Time = info.Time.Format(time.RFC3339Nano)
+	}
+	return event, nil
+}
+
+//
+// Read the events under new keys and hand them to the subscribers. The
+// events found by the first read are history, they are kept for resuming
+// but not sent. Keys of a type which fails to read are tried again by the
+// next poll.
+//
+func (streamer *Streamer) poll(now time.Time) {
+	keyMap, err := streamer.read.GetEventKeys()
+	if err != nil {
+		streamer.logger.Debug("Failed to read event keys for streaming", err)
+		return
+	}
+	types := make([]string, 0, len(keyMap))
+	for eventType, _ := range keyMap {
+		types = append(types, eventType)
+	}
+	sort.Strings(types)
+	known := make(map[string]map[string]bool, len(keyMap))
+	newEvents := make([]Event, 0)
+	for _, eventType := range types {
+		typeKeys := make(map[string]bool, len(keyMap[eventType]))
+		newKeys := make([]string, 0)
+		for _, key := range keyMap[eventType] {
+			typeKeys[key] = true
+			if !streamer.known[eventType][key] {
+				newKeys = append(newKeys, key)
+			}
+		}
+		if len(newKeys) == 0 {
+			known[eventType] = typeKeys
+			continue
+		}
+		objs, err := streamer.read.GetEventsByKey(newKeys)
+		if err != nil {
+			streamer.logger.Debug("Failed to read", eventType, "events for streaming", err)
+			known[eventType] = streamer.known[eventType]
+			continue
+		}
+		known[eventType] = typeKeys
+		for _, obj := range objs {
+			event, err := newEvent(eventType, obj, now)
+			if err != nil {
+				streamer.logger.Debug("Failed to encode event", err)
+				continue
+			}
+			newEvents = append(newEvents, event)
+		}
+	}
+	streamer.mutex.Lock()
+	defer streamer.mutex.Unlock()
+	history := streamer.known == nil
+	streamer.known = known
+	for _, event := range newEvents {
+		streamer.lastId++
+		event.Id = streamer.lastId
+		if len(streamer.ring) >= RING_SIZE {
+			streamer.ring = streamer.ring[1:]
+		}
+		streamer.ring = append(streamer.ring, event)
+		if history {
+			continue
+		}
+		eventsStreamed.Inc(event.Type)
+		for sub, _ := range streamer.subscribers {
+			if !sub.filter.Match(&event) {
+				continue
+			}
+			select {
+			case sub.C <- event:
+			default:
+				streamsDropped.Inc()
+				streamer.closeSubscriber(sub, ErrSlowConsumer)
+			}
+		}
+	}
+}
+
+// Must be called with mutex held
+func (streamer *Streamer) closeSubscriber(sub *Subscriber, err error) {
+	if _, exist := streamer.subscribers[sub]; !exist {
+		return
+	}
+	delete(streamer.subscribers, sub)
+	sub.err = err
+	close(sub.C)
+}
+
+//
+// Subscribe to the events matching filter. With resume, the retained
+// events after lastId are returned to be sent first; gap tells that some
+// events after lastId are no longer retained.
+//
+func (streamer *Streamer) Subscribe(filter Filter, resume bool, lastId uint64) (sub *Subscriber, backlog []Event, gap bool, err error) {
+	streamer.mutex.Lock()
+	defer streamer.mutex.Unlock()
+	if streamer.stopped {
+		return nil, nil, false, ErrStopped
+	}
+	if resume {
+		if lastId > streamer.lastId {
+			// Id of a previous run
+			gap = true
+			lastId = 0
+		} else if len(streamer.ring) > 0 && streamer.ring[0].Id > lastId+1 {
+			gap = true
+		}
+		for _, event := range streamer.ring {
+			if event.Id > lastId && filter.Match(&event) {
+				backlog = append(backlog, event)
+			}
+		}
+	}
+	sub = &Subscriber{
+		filter: filter,
+		C:      make(chan Event, SUBSCRIBER_QUEUE_SIZE),
+	}
+	streamer.subscribers[sub] = true
+	return sub, backlog, gap, nil
+}
+
+func (streamer *Streamer) Unsubscribe(sub *Subscriber) {
+	streamer.mutex.Lock()
+	streamer.closeSubscriber(sub, nil)
+	streamer.mutex.Unlock()
+}
@@ -0,0 +1,209 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package eventstream
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+	"utils/logging"
+)
+
+var logger *logging.Writer
+
+func TestMain(m *testing.M) {
+	var err error
+	logger, err = logging.NewLogger("confd", "EventStream", true)
+	if err != nil {
+		fmt.Println("Failed to start logger", err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+type testEvent struct {
+	OwnerName string
+	Severity  string
+	SrcObjKey map[string]string
+	TimeStamp string
+}
+
+type testReader struct {
+	keys   map[string][]string
+	events map[string]interface{}
+	reads  int
+	fail   bool
+}
+
+func (reader *testReader) GetEventKeys() (map[string][]string, error) {
+	return reader.keys, nil
+}
+
+func (reader *testReader) GetEventsByKey(keys []string) ([]interface{}, error) {
+	if reader.fail {
+		return nil, errors.New("Read failed")
+	}
+	events := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		if event, exist := reader.events[key]; exist {
+			events = append(events, event)
+		}
+	}
+	reader.reads += len(events)
+	return events, nil
+}
+
+func (reader *testReader) add(eventType, owner, severity, key string) {
+	eventKey := "Events#" + owner + "#" + strconv.Itoa(len(reader.events))
+	reader.keys[eventType] = append(reader.keys[eventType], eventKey)
+	reader.events[eventKey] = testEvent{
+		OwnerName: owner,
+		Severity:  severity,
+		SrcObjKey: map[string]string{"IntfRef": key},
+		TimeStamp: time.Now().String(),
+	}
+}
+
+func newTestStreamer() (*Streamer, *testReader) {
+	reader := &testReader{keys: make(map[string][]string), events: make(map[string]interface{})}
+	streamer := &Streamer{
+		logger:      logger,
+		read:        reader,
+		lastId:      100,
+		subscribers: make(map[*Subscriber]bool),
+		stopCh:      make(chan struct{}),
+	}
+	return streamer, reader
+}
+
+func receive(sub *Subscriber) []Event {
+	events := make([]Event, 0)
+	for {
+		select {
+		case event, ok := <-sub.C:
+			if !ok {
+				return events
+			}
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestStreamNewEvents(t *testing.T) {
+	streamer, reader := newTestStreamer()
+	reader.add("asicd", "ASICD", "Info", "fpPort1")
+	streamer.poll(time.Now())
+	all, _, _, _ := streamer.Subscribe(Filter{}, false, 0)
+	filtered, _, _, _ := streamer.Subscribe(Filter{
+		Owners:     map[string]bool{"arpd": true},
+		Severities: map[string]bool{"major": true},
+		Key:        "port2",
+	}, false, 0)
+	reader.add("arpd", "ARPD", "Major", "fpPort2")
+	reader.add("arpd", "ARPD", "Minor", "fpPort2")
+	streamer.poll(time.Now())
+	events := receive(all)
+	if len(events) != 2 || events[0].Id != 102 || events[1].Id != 103 {
+		t.Fatal("Expected the two new events, got", events)
+	}
+	if events[0].Owner != "ARPD" || events[0].Severity != "Major" || events[0].Key != `{"IntfRef":"fpPort2"}` {
+		t.Error("Event attributes not extracted", events[0])
+	}
+	if events := receive(filtered); len(events) != 1 || events[0].Severity != "Major" {
+		t.Error("Filter did not match one event, got", events)
+	}
+	reads := reader.reads
+	streamer.poll(time.Now())
+	if events := receive(all); len(events) != 0 || reader.reads != reads {
+		t.Error("Events read or sent again, got", events)
+	}
+}
+
+func TestStreamReadFailure(t *testing.T) {
+	streamer, reader := newTestStreamer()
+	streamer.poll(time.Now())
+	sub, _, _, _ := streamer.Subscribe(Filter{}, false, 0)
+	reader.add("asicd", "ASICD", "Info", "fpPort1")
+	reader.fail = true
+	streamer.poll(time.Now())
+	reader.fail = false
+	streamer.poll(time.Now())
+	if events := receive(sub); len(events) != 1 {
+		t.Error("Events of a failed read not sent by the next poll, got", events)
+	}
+}
+
+func TestStreamResume(t *testing.T) {
+	streamer, reader := newTestStreamer()
+	streamer.poll(time.Now())
+	for idx := 0; idx < 3; idx++ {
+		reader.add("asicd", "ASICD", "Info", string(rune('a'+idx)))
+		streamer.poll(time.Now())
+	}
+	_, backlog, gap, _ := streamer.Subscribe(Filter{}, true, 101)
+	if gap || len(backlog) != 2 || backlog[0].Id != 102 {
+		t.Error("Expected backlog after 101 without gap, got", backlog, gap)
+	}
+	streamer.ring = streamer.ring[1:]
+	if _, _, gap, _ := streamer.Subscribe(Filter{}, true, 100); !gap {
+		t.Error("Resume from an event no longer kept is not a gap")
+	}
+	if _, backlog, gap, _ := streamer.Subscribe(Filter{}, true, 5000); !gap || len(backlog) != 2 {
+		t.Error("Resume from an id of another run is not a gap with all kept events, got", backlog, gap)
+	}
+}
+
+func TestStreamSlowConsumer(t *testing.T) {
+	streamer, reader := newTestStreamer()
+	streamer.poll(time.Now())
+	sub, _, _, _ := streamer.Subscribe(Filter{}, false, 0)
+	for idx := 0; idx <= SUBSCRIBER_QUEUE_SIZE; idx++ {
+		reader.add("asicd", "ASICD", "Info", string(rune('a'+idx)))
+	}
+	streamer.poll(time.Now())
+	if events := receive(sub); len(events) != SUBSCRIBER_QUEUE_SIZE {
+		t.Error("Expected a full queue, got", len(events))
+	}
+	if sub.Err() != ErrSlowConsumer {
+		t.Error("Slow subscriber not dropped", sub.Err())
+	}
+	streamer.Unsubscribe(sub)
+}
+
+func TestStreamStop(t *testing.T) {
+	streamer, _ := newTestStreamer()
+	sub, _, _, _ := streamer.Subscribe(Filter{}, false, 0)
+	streamer.Stop()
+	if _, ok := <-sub.C; ok || sub.Err() != ErrStopped {
+		t.Error("Stream not closed on stop")
+	}
+	if _, _, _, err := streamer.Subscribe(Filter{}, false, 0); err != ErrStopped {
+		t.Error("Subscribed to a stopped streamer")
+	}
+}
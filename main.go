@@ -24,10 +24,11 @@
 package main
 
 import (
+	"config/clients"
+	"config/objects"
 	"config/server"
 	"flag"
 	"fmt"
-	"net/http"
 	"utils/keepalive"
 	"utils/logging"
 )
@@ -35,6 +36,9 @@ import (
 func main() {
 	fmt.Println("Starting ConfigMgr daemon")
 	paramsDir := flag.String("params", "./params", "Directory Location for config files")
+	simulate := flag.Bool("simulate", false, "Simulate all daemons in memory")
+	dbBackend := flag.String("db", objects.DB_BACKEND_REDIS, "DB backend: redis, memory or file")
+	dbFile := flag.String("dbfile", "", "DB file for the file backend, default confd.db in the params directory")
 	flag.Parse()
 	paramsDirName := *paramsDir
 	if paramsDirName[len(paramsDirName)-1] != '/' {
@@ -47,26 +51,38 @@ func main() {
 		fmt.Println("Failed to start logger. Nothing will be logged ...")
 	}
 
+	dbCfg := objects.DbConfig{Backend: *dbBackend, File: *dbFile}
+	if dbCfg.File == "" {
+		dbCfg.File = paramsDirName + "confd.db"
+	}
+	err = objects.SetDbConfig(dbCfg)
+	if err != nil {
+		logger.Err("Invalid DB configuration:", err)
+		return
+	}
+
+	if *simulate {
+		err = clients.EnableSimulation(paramsDirName+clients.SIM_CONFIG_FILE, logger)
+		if err != nil {
+			logger.Err("Failed to enable simulation:", err)
+			return
+		}
+	}
+
 	configMgr := server.NewConfigMgr(paramsDirName, logger)
 	if configMgr == nil {
 		logger.Err("Failed to initialize CONF Mgr. Exiting!!!")
 		return
 	}
-	restRtr := configMgr.ApiMgr.GetRestRtr()
 
 	// Start keepalive routine
 	go keepalive.InitKeepAlive("confd", paramsDirName)
 
-	foundConfPort, confPort := server.GetConfigHandlerPort(paramsDirName)
-	if foundConfPort {
-		logger.Info("Starting config listener on port:", confPort)
-		err = http.ListenAndServe(":"+confPort, restRtr)
-	} else {
-		logger.Info("Starting config listener on port: 8080")
-		err = http.ListenAndServe(":8080", restRtr)
-	}
+	logger.Info("Starting config listeners")
+	err = configMgr.Serve(server.GetListeners(paramsDirName))
 	if err != nil {
 		logger.Err("Failed to start config listener:", err)
+		panic("ConfigMgr Exiting!!!")
 	}
-	panic("ConfigMgr Exiting!!!")
+	logger.Info("ConfigMgr exited")
 }
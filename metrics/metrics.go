@@ -0,0 +1,450 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//
+// Metrics of confd internals in the Prometheus text exposition format.
+// Packages create their metrics once, usually as package variables, and
+// update them as they go; the registry writes all of them on a scrape.
+//
+const (
+	CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8"
+
+	TYPE_COUNTER   = "counter"
+	TYPE_GAUGE     = "gauge"
+	TYPE_HISTOGRAM = "histogram"
+)
+
+// Latency buckets in seconds for API requests and daemon RPCs
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Latency buckets in seconds for DB operations
+var DbBuckets = []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25}
+
+type collector interface {
+	name() string
+	write(buf *bytes.Buffer)
+}
+
+type Registry struct {
+	mutex      sync.Mutex
+	collectors map[string]collector
+}
+
+var DefaultRegistry = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]collector)}
+}
+
+// A metric of the same name replaces the one registered before
+func (reg *Registry) register(c collector) {
+	reg.mutex.Lock()
+	reg.collectors[c.name()] = c
+	reg.mutex.Unlock()
+}
+
+func (reg *Registry) Write(buf *bytes.Buffer) {
+	reg.mutex.Lock()
+	names := make([]string, 0, len(reg.collectors))
+	for name, _ := range reg.collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	collectors := make([]collector, 0, len(names))
+	for _, name := range names {
+		collectors = append(collectors, reg.collectors[name])
+	}
+	reg.mutex.Unlock()
+	for _, c := range collectors {
+		c.write(buf)
+	}
+}
+
+func (reg *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	reg.Write(&buf)
+	w.Header().Set("Content-Type", CONTENT_TYPE)
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+func Handler() http.Handler {
+	return DefaultRegistry
+}
+
+func escapeLabelValue(value string) string {
+	value = strings.Replace(value, "\\", "\\\\", -1)
+	value = strings.Replace(value, "\"", "\\\"", -1)
+	return strings.Replace(value, "\n", "\\n", -1)
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for idx, name := range names {
+		pairs[idx] = name + "=\"" + escapeLabelValue(values[idx]) + "\""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func writeHeader(buf *bytes.Buffer, name, help, metricType string) {
+	buf.WriteString("# HELP " + name + " " + strings.Replace(help, "\n", " ", -1) + "\n")
+	buf.WriteString("# TYPE " + name + " " + metricType + "\n")
+}
+
+//
+// Series of a metric by label values. Label values are joined with a 0 byte
+// to form the series key.
+//
+type series struct {
+	labelNames []string
+	mutex      sync.Mutex
+	values     map[string]interface{}
+}
+
+func (s *series) get(labelValues []string, create func() interface{}) interface{} {
+	if len(labelValues) != len(s.labelNames) {
+		panic("metrics: wrong number of label values")
+	}
+	key := strings.Join(labelValues, "\x00")
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	value, exist := s.values[key]
+	if !exist {
+		value = create()
+		s.values[key] = value
+	}
+	return value
+}
+
+func (s *series) sortedKeys() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	keys := make([]string, 0, len(s.values))
+	for key, _ := range s.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *series) labelValues(key string) []string {
+	if len(s.labelNames) == 0 {
+		return nil
+	}
+	return strings.Split(key, "\x00")
+}
+
+type floatValue struct {
+	mutex sync.Mutex
+	value float64
+}
+
+func (v *floatValue) add(delta float64) {
+	v.mutex.Lock()
+	v.value += delta
+	v.mutex.Unlock()
+}
+
+func (v *floatValue) set(value float64) {
+	v.mutex.Lock()
+	v.value = value
+	v.mutex.Unlock()
+}
+
+func (v *floatValue) get() float64 {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	return v.value
+}
+
+type CounterVec struct {
+	metricName string
+	help       string
+	series
+}
+
+func (reg *Registry) NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	counter := &CounterVec{metricName: name, help: help}
+	counter.labelNames = labelNames
+	counter.values = make(map[string]interface{})
+	reg.register(counter)
+	return counter
+}
+
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return DefaultRegistry.NewCounterVec(name, help, labelNames...)
+}
+
+func newFloatValue() interface{} {
+	return new(floatValue)
+}
+
+func (counter *CounterVec) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		return
+	}
+	counter.get(labelValues, newFloatValue).(*floatValue).add(delta)
+}
+
+func (counter *CounterVec) Inc(labelValues ...string) {
+	counter.Add(1, labelValues...)
+}
+
+func (counter *CounterVec) name() string {
+	return counter.metricName
+}
+
+func (counter *CounterVec) write(buf *bytes.Buffer) {
+	writeHeader(buf, counter.metricName, counter.help, TYPE_COUNTER)
+	for _, key := range counter.sortedKeys() {
+		value := counter.get(counter.labelValues(key), newFloatValue).(*floatValue)
+		buf.WriteString(counter.metricName + formatLabels(counter.labelNames, counter.labelValues(key)) +
+			" " + formatValue(value.get()) + "\n")
+	}
+}
+
+type GaugeVec struct {
+	metricName string
+	help       string
+	series
+}
+
+func (reg *Registry) NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	gauge := &GaugeVec{metricName: name, help: help}
+	gauge.labelNames = labelNames
+	gauge.values = make(map[string]interface{})
+	reg.register(gauge)
+	return gauge
+}
+
+func NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	return DefaultRegistry.NewGaugeVec(name, help, labelNames...)
+}
+
+func (gauge *GaugeVec) Set(value float64, labelValues ...string) {
+	gauge.get(labelValues, newFloatValue).(*floatValue).set(value)
+}
+
+func (gauge *GaugeVec) Add(delta float64, labelValues ...string) {
+	gauge.get(labelValues, newFloatValue).(*floatValue).add(delta)
+}
+
+func (gauge *GaugeVec) name() string {
+	return gauge.metricName
+}
+
+func (gauge *GaugeVec) write(buf *bytes.Buffer) {
+	writeHeader(buf, gauge.metricName, gauge.help, TYPE_GAUGE)
+	for _, key := range gauge.sortedKeys() {
+		value := gauge.get(gauge.labelValues(key), newFloatValue).(*floatValue)
+		buf.WriteString(gauge.metricName + formatLabels(gauge.labelNames, gauge.labelValues(key)) +
+			" " + formatValue(value.get()) + "\n")
+	}
+}
+
+// A gauge whose value is read when the metrics are written
+type GaugeFunc struct {
+	metricName string
+	help       string
+	fn         func() float64
+}
+
+func (reg *Registry) NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	gauge := &GaugeFunc{name, help, fn}
+	reg.register(gauge)
+	return gauge
+}
+
+func NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	return DefaultRegistry.NewGaugeFunc(name, help, fn)
+}
+
+func (gauge *GaugeFunc) name() string {
+	return gauge.metricName
+}
+
+func (gauge *GaugeFunc) write(buf *bytes.Buffer) {
+	writeHeader(buf, gauge.metricName, gauge.help, TYPE_GAUGE)
+	buf.WriteString(gauge.metricName + " " + formatValue(gauge.fn()) + "\n")
+}
+
+type histogramValue struct {
+	mutex  sync.Mutex
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+type HistogramVec struct {
+	metricName string
+	help       string
+	buckets    []float64
+	series
+}
+
+func (reg *Registry) NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	histogram := &HistogramVec{metricName: name, help: help, buckets: buckets}
+	histogram.labelNames = labelNames
+	histogram.values = make(map[string]interface{})
+	reg.register(histogram)
+	return histogram
+}
+
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	return DefaultRegistry.NewHistogramVec(name, help, buckets, labelNames...)
+}
+
+func (histogram *HistogramVec) newValue() interface{} {
+	return &histogramValue{counts: make([]uint64, len(histogram.buckets))}
+}
+
+func (histogram *HistogramVec) Observe(value float64, labelValues ...string) {
+	hValue := histogram.get(labelValues, histogram.newValue).(*histogramValue)
+	hValue.mutex.Lock()
+	for idx, bound := range histogram.buckets {
+		if value <= bound {
+			hValue.counts[idx]++
+		}
+	}
+	hValue.count++
+	hValue.sum += value
+	hValue.mutex.Unlock()
+}
+
+func (histogram *HistogramVec) name() string {
+	return histogram.metricName
+}
+
+func (histogram *HistogramVec) write(buf *bytes.Buffer) {
+	writeHeader(buf, histogram.metricName, histogram.help, TYPE_HISTOGRAM)
+	bucketLabels := append(append([]string{}, histogram.labelNames...), "le")
+	for _, key := range histogram.sortedKeys() {
+		labelValues := histogram.labelValues(key)
+		hValue := histogram.get(labelValues, histogram.newValue).(*histogramValue)
+		hValue.mutex.Lock()
+		counts := append([]uint64{}, hValue.counts...)
+		count, sum := hValue.count, hValue.sum
+		hValue.mutex.Unlock()
+		for idx, bound := range histogram.buckets {
+			buf.WriteString(histogram.metricName + "_bucket" +
+				formatLabels(bucketLabels, append(append([]string{}, labelValues...), formatValue(bound))) +
+				" " + strconv.FormatUint(counts[idx], 10) + "\n")
+		}
+		buf.WriteString(histogram.metricName + "_bucket" +
+			formatLabels(bucketLabels, append(append([]string{}, labelValues...), "+Inf")) +
+			" " + strconv.FormatUint(count, 10) + "\n")
+		labels := formatLabels(histogram.labelNames, labelValues)
+		buf.WriteString(histogram.metricName + "_sum" + labels + " " + formatValue(sum) + "\n")
+		buf.WriteString(histogram.metricName + "_count" + labels + " " + strconv.FormatUint(count, 10) + "\n")
+	}
+}
+
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+//
+// A metric whose series are replaced as a whole, for values polled from
+// elsewhere such as daemon state objects
+//
+type snapshot struct {
+	metricName string
+	help       string
+	metricType string
+	labelNames []string
+	samples    []Sample
+}
+
+func (snap *snapshot) name() string {
+	return snap.metricName
+}
+
+type sampleSorter struct {
+	samples []Sample
+	keys    []string
+}
+
+func (sorter sampleSorter) Len() int {
+	return len(sorter.samples)
+}
+
+func (sorter sampleSorter) Less(i, j int) bool {
+	return sorter.keys[i] < sorter.keys[j]
+}
+
+func (sorter sampleSorter) Swap(i, j int) {
+	sorter.samples[i], sorter.samples[j] = sorter.samples[j], sorter.samples[i]
+	sorter.keys[i], sorter.keys[j] = sorter.keys[j], sorter.keys[i]
+}
+
+func (snap *snapshot) write(buf *bytes.Buffer) {
+	writeHeader(buf, snap.metricName, snap.help, snap.metricType)
+	for _, sample := range snap.samples {
+		buf.WriteString(snap.metricName + formatLabels(snap.labelNames, sample.LabelValues) +
+			" " + formatValue(sample.Value) + "\n")
+	}
+}
+
+func (reg *Registry) SetSnapshot(name, help, metricType string, labelNames []string, samples []Sample) {
+	sorter := sampleSorter{append([]Sample{}, samples...), make([]string, len(samples))}
+	for idx, sample := range sorter.samples {
+		if len(sample.LabelValues) != len(labelNames) {
+			panic("metrics: wrong number of label values")
+		}
+		sorter.keys[idx] = strings.Join(sample.LabelValues, "\x00")
+	}
+	sort.Sort(sorter)
+	reg.register(&snapshot{name, help, metricType, labelNames, sorter.samples})
+}
+
+func (reg *Registry) Unregister(name string) {
+	reg.mutex.Lock()
+	delete(reg.collectors, name)
+	reg.mutex.Unlock()
+}
@@ -0,0 +1,108 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	reg := NewRegistry()
+	requests := reg.NewCounterVec("test_requests_total", "Requests", "method", "code")
+	requests.Inc("GET", "1")
+	requests.Inc("GET", "1")
+	requests.Add(3, "POST", "16")
+	requests.Add(-1, "POST", "16")
+	reg.NewGaugeFunc("test_entries", "Entries", func() float64 { return 7 })
+	latency := reg.NewHistogramVec("test_duration_seconds", "Latency", []float64{0.1, 1}, "op")
+	latency.Observe(0.05, "get")
+	latency.Observe(0.5, "get")
+	latency.Observe(5, "get")
+	var buf bytes.Buffer
+	reg.Write(&buf)
+	expected := `# HELP test_duration_seconds Latency
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{op="get",le="0.1"} 1
+test_duration_seconds_bucket{op="get",le="1"} 2
+test_duration_seconds_bucket{op="get",le="+Inf"} 3
+test_duration_seconds_sum{op="get"} 5.55
+test_duration_seconds_count{op="get"} 3
+# HELP test_entries Entries
+# TYPE test_entries gauge
+test_entries 7
+# HELP test_requests_total Requests
+# TYPE test_requests_total counter
+test_requests_total{method="GET",code="1"} 2
+test_requests_total{method="POST",code="16"} 3
+`
+	if buf.String() != expected {
+		t.Errorf("Unexpected output:\n%s", buf.String())
+	}
+}
+
+func TestLabelEscaping(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewGaugeVec("test_info", "Info", "name").Set(1, "a\"b\\c\nd")
+	var buf bytes.Buffer
+	reg.Write(&buf)
+	if !strings.Contains(buf.String(), `test_info{name="a\"b\\c\nd"} 1`) {
+		t.Errorf("Label value not escaped:\n%s", buf.String())
+	}
+}
+
+func TestHandler(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewCounterVec("test_total", "Total").Inc()
+	w := httptest.NewRecorder()
+	reg.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Header().Get("Content-Type") != CONTENT_TYPE || !strings.Contains(w.Body.String(), "test_total 1\n") {
+		t.Errorf("Unexpected response %v %s", w.Header(), w.Body.String())
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	reg := NewRegistry()
+	reg.SetSnapshot("test_octets_total", "Octets", TYPE_COUNTER, []string{"port"},
+		[]Sample{{[]string{"eth2"}, 20}, {[]string{"eth1"}, 10}})
+	reg.SetSnapshot("test_octets_total", "Octets", TYPE_COUNTER, []string{"port"},
+		[]Sample{{[]string{"eth1"}, 15}})
+	var buf bytes.Buffer
+	reg.Write(&buf)
+	expected := `# HELP test_octets_total Octets
+# TYPE test_octets_total counter
+test_octets_total{port="eth1"} 15
+`
+	if buf.String() != expected {
+		t.Errorf("Unexpected output:\n%s", buf.String())
+	}
+	reg.Unregister("test_octets_total")
+	buf.Reset()
+	reg.Write(&buf)
+	if buf.Len() != 0 {
+		t.Errorf("Unregistered metric written:\n%s", buf.String())
+	}
+}
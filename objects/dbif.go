@@ -24,6 +24,7 @@
 package objects
 
 import (
+	"errors"
 	"github.com/garyburd/redigo/redis"
 	"github.com/nu7hatch/gouuid"
 	"strings"
@@ -33,7 +34,40 @@ import (
 
 type DbHandler struct {
 	*dbutils.DBUtil
-	logger *logging.Writer
+	logger    *logging.Writer
+	fileStore *fileStore
+	keyedIds  bool
+}
+
+//
+// Object IDs are random v4 UUIDs by default. With keyed IDs they are v5
+// UUIDs derived from the object key, so an object gets the same ID every
+// time it is created.
+//
+const (
+	OBJECT_ID_RANDOM = "random"
+	OBJECT_ID_KEYED  = "keyed"
+)
+
+var confdIdNamespace, _ = uuid.NewV5(uuid.NamespaceURL, []byte("urn:snaproute:confd:objects"))
+
+func (d *DbHandler) SetObjectIdType(idType string) error {
+	switch idType {
+	case "", OBJECT_ID_RANDOM:
+		d.keyedIds = false
+	case OBJECT_ID_KEYED:
+		d.keyedIds = true
+	default:
+		return errors.New("Unknown object id type " + idType)
+	}
+	return nil
+}
+
+func (d *DbHandler) newObjectId(objKey string) (*uuid.UUID, error) {
+	if d.keyedIds {
+		return uuid.NewV5(confdIdNamespace, []byte(objKey))
+	}
+	return uuid.NewV4()
 }
 
 //  This method initializes the db handler
@@ -42,37 +76,54 @@ func InstantiateDbIf(logger *logging.Writer) *DbHandler {
 
 	dbHdl := new(DbHandler)
 	dbHdl.DBUtil = dbutils.NewDBUtil(logger)
-	err = dbHdl.DBUtil.Connect()
-	if err != nil {
-		logger.Err("Failed to dial out to Redis server")
-		return nil
+	switch gDbConfig.Backend {
+	case DB_BACKEND_MEMORY:
+		dbHdl.DBUtil.Conn = newMemConn(newMemStore())
+	case DB_BACKEND_FILE:
+		dbHdl.fileStore, err = openFileStore(gDbConfig.File)
+		if err != nil {
+			logger.Err("Failed to open DB file", gDbConfig.File, err)
+			return nil
+		}
+		dbHdl.DBUtil.Conn = newMemConn(dbHdl.fileStore.memStore)
+	default:
+		err = dbHdl.DBUtil.Connect()
+		if err != nil {
+			logger.Err("Failed to dial out to Redis server")
+			return nil
+		}
 	}
+	logger.Info("Using", gDbConfig.Backend, "DB backend")
+	dbHdl.DBUtil.Conn = newTimedConn(dbHdl.DBUtil.Conn)
 	dbHdl.logger = logger
 	return dbHdl
 }
 
 func (d *DbHandler) DisconnectDbIf() {
 	d.Disconnect()
+	if d.fileStore != nil {
+		d.fileStore.Close()
+	}
 	return
 }
 
+//
+// The UUID to object key map is kept in two entries, UUID -> objKey and
+// "UUID"+objKey -> UUID. Both are written and deleted in one MULTI/EXEC
+// transaction so that a failure can not leave one without the other.
+//
 func (d *DbHandler) StoreUUIDToObjKeyMap(objKey string) (string, error) {
-	UUId, err := uuid.NewV4()
+	UUId, err := d.newObjectId(objKey)
 	if err != nil {
 		d.logger.Err("Failed to get UUID " + err.Error())
 		return "", err
 	}
 	defer d.DBUtil.DbLock.Unlock()
 	d.DBUtil.DbLock.Lock()
-	_, err = d.Do("SET", UUId.String(), objKey)
-	if err != nil {
-		d.logger.Err("Failed to insert uuid to objkey entry in db " + err.Error())
-		return "", err
-	}
-	objKeyWithUUIDPrefix := "UUID" + objKey
-	_, err = d.Do("SET", objKeyWithUUIDPrefix, UUId.String())
+	err = d.execTxn([]string{"SET", UUId.String(), objKey},
+		[]string{"SET", "UUID" + objKey, UUId.String()})
 	if err != nil {
-		d.logger.Err("Failed to insert objkey to uuid entry in db " + err.Error())
+		d.logger.Err("Failed to insert uuid map entries in db " + err.Error())
 		return "", err
 	}
 	return UUId.String(), nil
@@ -81,20 +132,69 @@ func (d *DbHandler) StoreUUIDToObjKeyMap(objKey string) (string, error) {
 func (d *DbHandler) DeleteUUIDToObjKeyMap(uuid, objKey string) error {
 	defer d.DBUtil.DbLock.Unlock()
 	d.DBUtil.DbLock.Lock()
-	_, err := d.Do("DEL", uuid)
+	err := d.execTxn([]string{"DEL", uuid}, []string{"DEL", "UUID" + objKey})
 	if err != nil {
-		d.logger.Err("Failed to delete uuid to objkey entry in db " + err.Error())
+		d.logger.Err("Failed to delete uuid map entries in db " + err.Error())
 		return err
 	}
-	objKeyWithUUIDPrefix := "UUID" + objKey
-	_, err = d.Do("DEL", objKeyWithUUIDPrefix)
+	return nil
+}
+
+//
+// Run a command with DbLock held. The DB connection must not be used by two
+// goroutines at once, so every Do outside of DBUtil goes through DbLock.
+//
+func (d *DbHandler) DoLocked(cmd string, args ...interface{}) (interface{}, error) {
+	defer d.DBUtil.DbLock.Unlock()
+	d.DBUtil.DbLock.Lock()
+	return d.Do(cmd, args...)
+}
+
+// Run cmds in one transaction. Must be called with DbLock held.
+func (d *DbHandler) execTxn(cmds ...[]string) error {
+	if err := d.Send("MULTI"); err != nil {
+		return err
+	}
+	for _, cmd := range cmds {
+		args := make([]interface{}, 0, len(cmd)-1)
+		for _, arg := range cmd[1:] {
+			args = append(args, arg)
+		}
+		if err := d.Send(cmd[0], args...); err != nil {
+			d.Do("DISCARD")
+			return err
+		}
+	}
+	replies, err := redis.Values(d.Do("EXEC"))
 	if err != nil {
-		d.logger.Err("Failed to delete objkey to uuid entry in db " + err.Error())
 		return err
 	}
+	for _, reply := range replies {
+		if replyErr, ok := reply.(error); ok {
+			return replyErr
+		}
+	}
 	return nil
 }
 
+//
+// Give objKey the ObjectId id, as when restoring a backup. The current ID of
+// objKey and any object holding id lose their entries.
+//
+func (d *DbHandler) SetObjectId(objKey, id string) error {
+	defer d.DBUtil.DbLock.Unlock()
+	d.DBUtil.DbLock.Lock()
+	cmds := make([][]string, 0, 4)
+	if oldId, err := redis.String(d.Do("GET", "UUID"+objKey)); err == nil && oldId != id {
+		cmds = append(cmds, []string{"DEL", oldId})
+	}
+	if oldKey, err := redis.String(d.Do("GET", id)); err == nil && oldKey != objKey {
+		cmds = append(cmds, []string{"DEL", "UUID" + oldKey})
+	}
+	cmds = append(cmds, []string{"SET", id, objKey}, []string{"SET", "UUID" + objKey, id})
+	return d.execTxn(cmds...)
+}
+
 func (d *DbHandler) GetUUIDFromObjKey(objKey string) (string, error) {
 	defer d.DBUtil.DbLock.Unlock()
 	d.DBUtil.DbLock.Lock()
@@ -113,6 +213,42 @@ func (d *DbHandler) GetObjKeyFromUUID(uuid string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	objKey = strings.TrimRight(objKey, "UUID")
 	return objKey, nil
 }
+
+//
+// Move existing objects to keyed IDs. Objects keep working through the
+// reverse entry; only the ID changes. Returns the number of objects whose
+// ID was changed.
+//
+func (d *DbHandler) MigrateToKeyedIds() (int, error) {
+	if !d.keyedIds {
+		return 0, nil
+	}
+	defer d.DBUtil.DbLock.Unlock()
+	d.DBUtil.DbLock.Lock()
+	revEntries, err := d.getStrEntries(UUID_REV_PREFIX + "*")
+	if err != nil {
+		return 0, err
+	}
+	migrated := 0
+	for revKey, oldId := range revEntries {
+		objKey := strings.TrimPrefix(revKey, UUID_REV_PREFIX)
+		newId, err := d.newObjectId(objKey)
+		if err != nil {
+			return migrated, err
+		}
+		if newId.String() == oldId {
+			continue
+		}
+		err = d.execTxn([]string{"DEL", oldId},
+			[]string{"SET", newId.String(), objKey},
+			[]string{"SET", revKey, newId.String()})
+		if err != nil {
+			d.logger.Err("Failed to migrate id of", objKey, err)
+			return migrated, err
+		}
+		migrated++
+	}
+	return migrated, nil
+}
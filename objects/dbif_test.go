@@ -0,0 +1,88 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package objects
+
+import (
+	"testing"
+)
+
+func TestKeyedObjectIds(t *testing.T) {
+	dbHdl := NewMemoryDbHandler(nil)
+	randomId, err := dbHdl.StoreUUIDToObjKeyMap("Vlan#1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = dbHdl.SetObjectIdType(OBJECT_ID_KEYED); err != nil {
+		t.Fatal(err)
+	}
+	if migrated, err := dbHdl.MigrateToKeyedIds(); err != nil || migrated != 1 {
+		t.Fatal("Expected 1 migrated object, got", migrated, err)
+	}
+	keyedId, _ := dbHdl.GetUUIDFromObjKey("Vlan#1")
+	if keyedId == randomId {
+		t.Error("Object id not migrated")
+	}
+	if dbHdl.keyExists(randomId) {
+		t.Error("Old id entry not removed")
+	}
+	if objKey, err := dbHdl.GetObjKeyFromUUID(keyedId); err != nil || objKey != "Vlan#1" {
+		t.Error("Keyed id does not map to object, got", objKey, err)
+	}
+	// Reset followed by apply recreates the object with the same id
+	dbHdl.DeleteUUIDToObjKeyMap(keyedId, "Vlan#1")
+	if newId, _ := dbHdl.StoreUUIDToObjKeyMap("Vlan#1"); newId != keyedId {
+		t.Error("Recreated object got id", newId, "expected", keyedId)
+	}
+	if migrated, _ := dbHdl.MigrateToKeyedIds(); migrated != 0 {
+		t.Error("Second migration changed", migrated, "objects")
+	}
+	if dbHdl.SetObjectIdType("sequential") == nil {
+		t.Error("Unknown id type accepted")
+	}
+}
+
+func TestSetObjectId(t *testing.T) {
+	dbHdl := NewMemoryDbHandler(nil)
+	oldId, _ := dbHdl.StoreUUIDToObjKeyMap("Vlan#1")
+	dbHdl.StoreUUIDToObjKeyMap("Vlan#2")
+	if err := dbHdl.SetObjectId("Vlan#1", testUUID1); err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := dbHdl.GetUUIDFromObjKey("Vlan#1"); id != testUUID1 {
+		t.Error("Expected", testUUID1, "got", id)
+	}
+	if dbHdl.keyExists(oldId) {
+		t.Error("Old id of Vlan#1 not removed")
+	}
+	// Moving the id to another object removes it from Vlan#1
+	if err := dbHdl.SetObjectId("Vlan#2", testUUID1); err != nil {
+		t.Fatal(err)
+	}
+	if objKey, _ := dbHdl.GetObjKeyFromUUID(testUUID1); objKey != "Vlan#2" {
+		t.Error("Expected Vlan#2, got", objKey)
+	}
+	if dbHdl.keyExists("UUIDVlan#1") {
+		t.Error("Vlan#1 still maps to the moved id")
+	}
+}
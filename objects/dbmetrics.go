@@ -0,0 +1,68 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package objects
+
+import (
+	"config/metrics"
+	"github.com/garyburd/redigo/redis"
+	"strings"
+	"time"
+)
+
+var (
+	dbOps = metrics.NewCounterVec("confd_db_operations_total",
+		"DB commands by command name", "command")
+	dbOpErrors = metrics.NewCounterVec("confd_db_operation_errors_total",
+		"Failed DB commands by command name", "command")
+	dbOpLatency = metrics.NewHistogramVec("confd_db_operation_duration_seconds",
+		"DB command latency", metrics.DbBuckets, "command")
+)
+
+//
+// timedConn records the count and latency of the DB commands run through
+// Do. Commands queued with Send are counted when their EXEC or flush is
+// done.
+//
+type timedConn struct {
+	redis.Conn
+}
+
+func newTimedConn(conn redis.Conn) redis.Conn {
+	return &timedConn{conn}
+}
+
+func (conn *timedConn) Do(name string, args ...interface{}) (interface{}, error) {
+	start := time.Now()
+	reply, err := conn.Conn.Do(name, args...)
+	command := strings.ToUpper(name)
+	if command == "" {
+		command = "FLUSH"
+	}
+	dbOps.Inc(command)
+	dbOpLatency.Observe(time.Since(start).Seconds(), command)
+	if err != nil {
+		dbOpErrors.Inc(command)
+	}
+	return reply, err
+}
@@ -0,0 +1,570 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package objects
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/garyburd/redigo/redis"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"utils/logging"
+)
+
+//
+// The daemons log events through eventUtils as JSON values under keys
+// matching EVENT_KEY_PATTERN. confd reads them back with eventUtils, and
+// deletes old ones to keep the event store within the retention policy.
+// Event types logged by confd itself, such as Alarm, are stored the same way
+// under Events#<Type>#<SeqNum>, numbered by the counter at EventSeq#<Type>.
+//
+const (
+	EVENT_KEY_PATTERN            = "Events#*"
+	EVENT_KEY_PREFIX             = "Events#"
+	EVENT_SEQ_KEY_PREFIX         = "EventSeq#"
+	EVENT_SCAN_BATCH_SIZE        = 1000
+	EVENT_PURGE_BATCH_SIZE       = 512
+	DEFAULT_EVENT_PURGE_INTERVAL = time.Hour
+)
+
+//
+// What confd needs to know of an event. Events of the daemons and the
+// alarm events name these attributes differently.
+//
+type EventInfo struct {
+	Owner    string
+	Severity string
+	Source   string
+	Key      string
+	Time     time.Time
+}
+
+func getEventAttr(attrs map[string]interface{}, names ...string) string {
+	for _, name := range names {
+		switch value := attrs[name].(type) {
+		case nil:
+			continue
+		case string:
+			return value
+		default:
+			data, _ := json.Marshal(value)
+			return string(data)
+		}
+	}
+	return ""
+}
+
+// Times are written by encoding/json, or as time.Time String by older daemons
+func parseEventTime(value string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999 -0700 MST"} {
+		if eventTime, err := time.Parse(layout, value); err == nil {
+			return eventTime, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func ParseEventInfo(data []byte) (info EventInfo) {
+	var attrs map[string]interface{}
+	if json.Unmarshal(data, &attrs) != nil {
+		return info
+	}
+	info.Owner = getEventAttr(attrs, "OwnerName", "Owner")
+	info.Severity = getEventAttr(attrs, "Severity")
+	info.Source = getEventAttr(attrs, "SrcObjName", "Rule")
+	info.Key = getEventAttr(attrs, "SrcObjKey", "ObjectKey", "Key")
+	info.Time, _ = parseEventTime(getEventAttr(attrs, "TimeStamp", "Time"))
+	return info
+}
+
+// EventInfo of an event along with its JSON encoding
+func GetEventInfo(obj interface{}) (EventInfo, []byte, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return EventInfo{}, nil, err
+	}
+	return ParseEventInfo(data), data, nil
+}
+
+// Names of the event types logged by confd, by resource
+var confdEventTypes = make(map[string]string)
+
+// Register an event type logged by confd. Must be called from init.
+func RegisterConfdEventType(name string) {
+	confdEventTypes[strings.ToLower(name)] = name
+}
+
+// Name of the event type logged by confd with the given resource, e.g. alarm
+func GetConfdEventType(resource string) (string, bool) {
+	name, exist := confdEventTypes[strings.ToLower(resource)]
+	return name, exist
+}
+
+// Resources of the event types logged by confd
+func GetConfdEventTypes() []string {
+	resources := make([]string, 0, len(confdEventTypes))
+	for resource, _ := range confdEventTypes {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+	return resources
+}
+
+//
+// Store an event of a type logged by confd. The SET needs the number from
+// INCR so the two can not share a MULTI; both are run under DbLock, and a
+// failed SET only leaves a gap in the numbers.
+//
+func (d *DbHandler) LogEvent(eventType string, event interface{}) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	defer d.DBUtil.DbLock.Unlock()
+	d.DBUtil.DbLock.Lock()
+	seqNum, err := redis.Int64(d.Do("INCR", EVENT_SEQ_KEY_PREFIX+eventType))
+	if err != nil {
+		return err
+	}
+	_, err = d.Do("SET", EVENT_KEY_PREFIX+eventType+"#"+strconv.FormatInt(seqNum, 10), data)
+	return err
+}
+
+type eventKeys struct {
+	keys    []string
+	seqNums []int64
+}
+
+func (keys *eventKeys) Len() int {
+	return len(keys.keys)
+}
+
+func (keys *eventKeys) Less(i, j int) bool {
+	if keys.seqNums[i] != keys.seqNums[j] {
+		return keys.seqNums[i] < keys.seqNums[j]
+	}
+	return keys.keys[i] < keys.keys[j]
+}
+
+func (keys *eventKeys) Swap(i, j int) {
+	keys.keys[i], keys.keys[j] = keys.keys[j], keys.keys[i]
+	keys.seqNums[i], keys.seqNums[j] = keys.seqNums[j], keys.seqNums[i]
+}
+
+// Sort event keys by the number which ends them, if any, then by name
+func sortEventKeys(keys []string) {
+	sorted := &eventKeys{keys: keys, seqNums: make([]int64, len(keys))}
+	for idx, key := range keys {
+		sorted.seqNums[idx], _ = strconv.ParseInt(key[strings.LastIndex(key, "#")+1:], 10, 64)
+	}
+	sort.Sort(sorted)
+}
+
+//
+// Keys matching pattern. They are read with SCAN, one batch at a time under
+// DbLock, so that neither redis nor other users of the DB wait for all keys
+// to be listed.
+//
+func (d *DbHandler) scanKeys(pattern string) ([]string, error) {
+	var keys []string
+	seen := make(map[string]bool)
+	cursor := "0"
+	for {
+		reply, err := redis.Values(d.DoLocked("SCAN", cursor, "MATCH", pattern, "COUNT", EVENT_SCAN_BATCH_SIZE))
+		if err == nil && len(reply) != 2 {
+			err = errors.New("Unexpected SCAN reply")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if cursor, err = redis.String(reply[0], nil); err != nil {
+			return nil, err
+		}
+		batch, err := redis.Strings(reply[1], nil)
+		if err != nil && err != redis.ErrNil {
+			return nil, err
+		}
+		// A key can be returned more than once
+		for _, key := range batch {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+		if cursor == "0" {
+			return keys, nil
+		}
+	}
+}
+
+//
+// Keys of the stored events by event type, the part of the key after
+// Events# in lower case, e.g. asicd or alarm
+//
+func (d *DbHandler) GetEventKeys() (map[string][]string, error) {
+	keys, err := d.scanKeys(EVENT_KEY_PATTERN)
+	if err != nil {
+		return nil, err
+	}
+	keyMap := make(map[string][]string)
+	for _, key := range keys {
+		parts := strings.SplitN(key, "#", 3)
+		if len(parts) < 3 {
+			continue
+		}
+		eventType := strings.ToLower(parts[1])
+		keyMap[eventType] = append(keyMap[eventType], key)
+	}
+	for _, typeKeys := range keyMap {
+		sortEventKeys(typeKeys)
+	}
+	return keyMap, nil
+}
+
+//
+// Stored events of keys, in the order of keys, as json.RawMessage. Events
+// which are gone, as when purged since their keys were read, are skipped.
+//
+func (d *DbHandler) GetEventsByKey(keys []string) ([]interface{}, error) {
+	events := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		data, err := redis.Bytes(d.DoLocked("GET", key))
+		if err == redis.ErrNil {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		events = append(events, json.RawMessage(data))
+	}
+	return events, nil
+}
+
+// Events of a type logged by confd, oldest first
+func (d *DbHandler) GetConfdEvents(eventType string) ([]interface{}, error) {
+	keys, err := d.scanKeys(EVENT_KEY_PREFIX + eventType + "#*")
+	if err != nil {
+		return nil, err
+	}
+	sortEventKeys(keys)
+	return d.GetEventsByKey(keys)
+}
+
+type storedEvent struct {
+	key  string
+	time time.Time
+}
+
+type storedEvents []storedEvent
+
+func (events storedEvents) Len() int {
+	return len(events)
+}
+
+func (events storedEvents) Less(i, j int) bool {
+	return events[i].time.Before(events[j].time)
+}
+
+func (events storedEvents) Swap(i, j int) {
+	events[i], events[j] = events[j], events[i]
+}
+
+//
+// Delete the events logged before before, if it is set, and the oldest
+// events beyond maxEvents, if it is above 0. Events whose time can not be
+// read count as older than all others, in key order, and are only deleted
+// by count. Returns the number of events deleted. Each command holds DbLock
+// on its own so a long purge does not stall the other DB users.
+//
+func (d *DbHandler) PurgeEvents(before time.Time, maxEvents int) (int, error) {
+	keys, err := d.scanKeys(EVENT_KEY_PATTERN)
+	if err != nil {
+		return 0, err
+	}
+	dated := make(storedEvents, 0, len(keys))
+	undated := make([]string, 0)
+	for _, key := range keys {
+		data, err := redis.Bytes(d.DoLocked("GET", key))
+		if err != nil {
+			continue
+		}
+		if info := ParseEventInfo(data); !info.Time.IsZero() {
+			dated = append(dated, storedEvent{key, info.Time})
+		} else {
+			undated = append(undated, key)
+		}
+	}
+	sortEventKeys(undated)
+	sort.Sort(dated)
+	events := make(storedEvents, 0, len(undated)+len(dated))
+	for _, key := range undated {
+		events = append(events, storedEvent{key: key})
+	}
+	events = append(events, dated...)
+	purge := make([]string, 0)
+	next := 0
+	if maxEvents > 0 && len(events) > maxEvents {
+		for ; next < len(events)-maxEvents; next++ {
+			purge = append(purge, events[next].key)
+		}
+	}
+	if !before.IsZero() {
+		if next < len(undated) {
+			next = len(undated)
+		}
+		for ; next < len(events) && events[next].time.Before(before); next++ {
+			purge = append(purge, events[next].key)
+		}
+	}
+	purged := 0
+	for start := 0; start < len(purge); start += EVENT_PURGE_BATCH_SIZE {
+		end := start + EVENT_PURGE_BATCH_SIZE
+		if end > len(purge) {
+			end = len(purge)
+		}
+		args := make([]interface{}, 0, end-start)
+		for _, key := range purge[start:end] {
+			args = append(args, key)
+		}
+		deleted, err := redis.Int(d.DoLocked("DEL", args...))
+		purged += deleted
+		if err != nil {
+			return purged, err
+		}
+	}
+	return purged, nil
+}
+
+//
+// Event retention policy, Events in systemProfile.json. MaxAge and
+// Interval are durations such as 720h. An empty policy keeps all events.
+//
+type EventRetentionConfig struct {
+	MaxAge    string `json:"MaxAge"`
+	MaxEvents int    `json:"MaxEvents"`
+	Interval  string `json:"Interval"`
+}
+
+type EventRetentionMgr struct {
+	logger    *logging.Writer
+	dbHdl     *DbHandler
+	maxAge    time.Duration
+	maxEvents int
+	interval  time.Duration
+	stopCh    chan struct{}
+	wg        sync.WaitGroup
+}
+
+var gEventRetentionMutex sync.Mutex
+var gEventRetentionMgr *EventRetentionMgr
+
+func parseEventRetention(cfg EventRetentionConfig) (maxAge, interval time.Duration, err error) {
+	if cfg.MaxAge != "" {
+		if maxAge, err = time.ParseDuration(cfg.MaxAge); err != nil || maxAge <= 0 {
+			return 0, 0, errors.New("Invalid MaxAge " + cfg.MaxAge)
+		}
+	}
+	if cfg.MaxEvents < 0 {
+		return 0, 0, errors.New("Invalid MaxEvents")
+	}
+	interval = DEFAULT_EVENT_PURGE_INTERVAL
+	if cfg.Interval != "" {
+		if interval, err = time.ParseDuration(cfg.Interval); err != nil || interval <= 0 {
+			return 0, 0, errors.New("Invalid Interval " + cfg.Interval)
+		}
+	}
+	return maxAge, interval, nil
+}
+
+//
+// Start purging events by the policy of cfg, replacing the running policy.
+// An invalid policy keeps the running one.
+//
+func InitializeEventRetentionMgr(cfg EventRetentionConfig, logger *logging.Writer, dbHdl *DbHandler) (*EventRetentionMgr, error) {
+	maxAge, interval, err := parseEventRetention(cfg)
+	if err != nil {
+		return nil, err
+	}
+	mgr := &EventRetentionMgr{
+		logger:    logger,
+		dbHdl:     dbHdl,
+		maxAge:    maxAge,
+		maxEvents: cfg.MaxEvents,
+		interval:  interval,
+		stopCh:    make(chan struct{}),
+	}
+	gEventRetentionMutex.Lock()
+	oldMgr := gEventRetentionMgr
+	gEventRetentionMgr = mgr
+	gEventRetentionMutex.Unlock()
+	oldMgr.Stop()
+	if mgr.maxAge > 0 || mgr.maxEvents > 0 {
+		mgr.wg.Add(1)
+		go mgr.run()
+	}
+	return mgr, nil
+}
+
+func (mgr *EventRetentionMgr) Stop() {
+	if mgr == nil {
+		return
+	}
+	select {
+	case <-mgr.stopCh:
+	default:
+		close(mgr.stopCh)
+	}
+	mgr.wg.Wait()
+}
+
+func (mgr *EventRetentionMgr) run() {
+	defer mgr.wg.Done()
+	ticker := time.NewTicker(mgr.interval)
+	defer ticker.Stop()
+	for {
+		mgr.Purge()
+		select {
+		case <-mgr.stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge by the policy
+func (mgr *EventRetentionMgr) Purge() (int, error) {
+	var before time.Time
+	if mgr.maxAge > 0 {
+		before = time.Now().Add(-mgr.maxAge)
+	}
+	if before.IsZero() && mgr.maxEvents == 0 {
+		return 0, nil
+	}
+	purged, err := mgr.dbHdl.PurgeEvents(before, mgr.maxEvents)
+	if err != nil {
+		mgr.logger.Err("Failed to purge events", err)
+	} else if purged > 0 {
+		mgr.logger.Info("Purged", purged, "events")
+	}
+	return purged, err
+}
+
+// Running retention policy, nil if there is none
+func GetEventRetentionMgr() *EventRetentionMgr {
+	gEventRetentionMutex.Lock()
+	defer gEventRetentionMutex.Unlock()
+	return gEventRetentionMgr
+}
+
+//
+// Selection of events. From and To bound the event time, events without a
+// time are only selected without them. The lists are matched case
+// insensitively, Key matches part of the event key.
+//
+type EventQuery struct {
+	From       time.Time
+	To         time.Time
+	Owners     map[string]bool
+	Severities map[string]bool
+	Sources    map[string]bool
+	Key        string
+	Descending bool
+}
+
+func matchEventList(list map[string]bool, value string) bool {
+	return len(list) == 0 || list[strings.ToLower(value)]
+}
+
+func (query *EventQuery) Match(info EventInfo) bool {
+	if (!query.From.IsZero() || !query.To.IsZero()) && info.Time.IsZero() {
+		return false
+	}
+	if !query.From.IsZero() && info.Time.Before(query.From) {
+		return false
+	}
+	if !query.To.IsZero() && info.Time.After(query.To) {
+		return false
+	}
+	if !matchEventList(query.Owners, info.Owner) || !matchEventList(query.Severities, info.Severity) ||
+		!matchEventList(query.Sources, info.Source) {
+		return false
+	}
+	return query.Key == "" || strings.Contains(strings.ToLower(info.Key), strings.ToLower(query.Key))
+}
+
+type queriedEvent struct {
+	obj  interface{}
+	time time.Time
+}
+
+type queriedEvents []queriedEvent
+
+func (events queriedEvents) Len() int {
+	return len(events)
+}
+
+func (events queriedEvents) Less(i, j int) bool {
+	return events[i].time.Before(events[j].time)
+}
+
+func (events queriedEvents) Swap(i, j int) {
+	events[i], events[j] = events[j], events[i]
+}
+
+//
+// Page of the events selected by query, in time order. Paging works like
+// GetBulkObjFromDb: marker is the index of the first event of the page.
+//
+func QueryEvents(events []interface{}, query EventQuery, marker, count int64) (nextMarker int64, more bool, page []interface{}) {
+	matched := make(queriedEvents, 0, len(events))
+	for _, obj := range events {
+		info, _, err := GetEventInfo(obj)
+		if err == nil && query.Match(info) {
+			matched = append(matched, queriedEvent{obj, info.Time})
+		}
+	}
+	if query.Descending {
+		sort.Stable(sort.Reverse(matched))
+	} else {
+		sort.Stable(matched)
+	}
+	if marker < 0 || marker > int64(len(matched)) {
+		marker = int64(len(matched))
+	}
+	end := marker + count
+	if count < 0 || end > int64(len(matched)) {
+		end = int64(len(matched))
+	}
+	page = make([]interface{}, 0, end-marker)
+	for _, event := range matched[marker:end] {
+		page = append(page, event.obj)
+	}
+	more = end < int64(len(matched))
+	if more {
+		nextMarker = end
+	}
+	return nextMarker, more, page
+}
@@ -0,0 +1,156 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package objects
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParseEventInfo(t *testing.T) {
+	info := ParseEventInfo([]byte(`{"OwnerName": "ASICD", "Severity": "Major", "SrcObjName": "Port",
+		"SrcObjKey": {"IntfRef": "fpPort1"}, "TimeStamp": "2016-10-19T18:40:00.5Z"}`))
+	if info.Owner != "ASICD" || info.Severity != "Major" || info.Source != "Port" ||
+		info.Key != `{"IntfRef":"fpPort1"}` || info.Time.UnixNano() != 1476902400500000000 {
+		t.Error("Unexpected event info", info)
+	}
+	info = ParseEventInfo([]byte(`{"TimeStamp": "2016-10-19 18:40:00.5 +0000 UTC"}`))
+	if info.Time.UnixNano() != 1476902400500000000 {
+		t.Error("Time String not parsed, got", info.Time)
+	}
+}
+
+func TestPurgeEvents(t *testing.T) {
+	dbHdl := NewMemoryDbHandler(nil)
+	conn := dbHdl.DBUtil.Conn
+	now := time.Now()
+	for idx := 0; idx < 10; idx++ {
+		eventTime := now.Add(-time.Duration(idx) * time.Hour).Format(time.RFC3339Nano)
+		conn.Do("SET", fmt.Sprintf("Events#ASICD#PortDown#%d", idx), `{"TimeStamp": "`+eventTime+`"}`)
+	}
+	conn.Do("SET", "Events#ASICD#Broken#10", "{}")
+	conn.Do("SET", "Events#ASICD#Broken#2", "{}")
+	conn.Do("SET", "UUIDVlan#1", testUUID1)
+
+	purged, err := dbHdl.PurgeEvents(now.Add(-7*time.Hour-time.Minute), 0)
+	if err != nil || purged != 2 {
+		t.Error("Expected events older than 7h purged, got", purged, err)
+	}
+	if !dbHdl.keyExists("Events#ASICD#Broken#2") {
+		t.Error("Event without a time purged by age")
+	}
+	// Events without a time count as the oldest, in key order
+	purged, err = dbHdl.PurgeEvents(time.Time{}, 9)
+	if err != nil || purged != 1 || dbHdl.keyExists("Events#ASICD#Broken#2") || !dbHdl.keyExists("Events#ASICD#Broken#10") {
+		t.Error("Expected the oldest event without a time purged, got", purged, err)
+	}
+	purged, err = dbHdl.PurgeEvents(time.Time{}, 5)
+	if err != nil || purged != 4 {
+		t.Error("Expected 4 oldest events purged, got", purged, err)
+	}
+	for idx := 0; idx < 10; idx++ {
+		if dbHdl.keyExists(fmt.Sprintf("Events#ASICD#PortDown#%d", idx)) != (idx < 5) {
+			t.Error("Unexpected events left after purge, at", idx)
+		}
+	}
+	if dbHdl.keyExists("Events#ASICD#Broken#10") || !dbHdl.keyExists("UUIDVlan#1") {
+		t.Error("Purge deleted keys other than the oldest events")
+	}
+}
+
+func TestEventRetentionConfig(t *testing.T) {
+	invalid := []EventRetentionConfig{
+		{MaxAge: "week"},
+		{MaxAge: "-1h"},
+		{MaxEvents: -1},
+		{Interval: "0s"},
+	}
+	for _, cfg := range invalid {
+		if _, _, err := parseEventRetention(cfg); err == nil {
+			t.Error("Accepted invalid retention", cfg)
+		}
+	}
+	maxAge, interval, err := parseEventRetention(EventRetentionConfig{MaxAge: "720h"})
+	if err != nil || maxAge != 720*time.Hour || interval != DEFAULT_EVENT_PURGE_INTERVAL {
+		t.Error("Unexpected retention", maxAge, interval, err)
+	}
+}
+
+type testEvent struct {
+	OwnerName  string
+	Severity   string
+	SrcObjName string
+	TimeStamp  time.Time
+}
+
+func TestQueryEvents(t *testing.T) {
+	start := time.Date(2016, 10, 19, 0, 0, 0, 0, time.UTC)
+	events := []interface{}{
+		testEvent{"ASICD", "Major", "Port", start.Add(2 * time.Hour)},
+		testEvent{"ARPD", "Info", "ArpEntry", start},
+		testEvent{"ASICD", "Info", "Port", start.Add(time.Hour)},
+		testEvent{"ASICD", "Minor", "Vlan", start.Add(3 * time.Hour)},
+	}
+	nextMarker, more, page := QueryEvents(events, EventQuery{}, 0, 3)
+	if !more || nextMarker != 3 || len(page) != 3 || page[0].(testEvent).OwnerName != "ARPD" {
+		t.Error("Expected first page of 3 in time order, got", page, more, nextMarker)
+	}
+	if _, more, page := QueryEvents(events, EventQuery{}, 3, 3); more || len(page) != 1 {
+		t.Error("Expected last page of 1, got", page, more)
+	}
+	query := EventQuery{Owners: map[string]bool{"asicd": true}, From: start.Add(time.Hour), Descending: true}
+	if _, _, page := QueryEvents(events, query, 0, 10); len(page) != 3 ||
+		!page[0].(testEvent).TimeStamp.Equal(start.Add(3*time.Hour)) {
+		t.Error("Expected 3 ASICD events newest first, got", page)
+	}
+	query = EventQuery{Severities: map[string]bool{"info": true}, Sources: map[string]bool{"port": true},
+		To: start.Add(90 * time.Minute)}
+	if _, _, page := QueryEvents(events, query, 0, 10); len(page) != 1 || page[0].(testEvent).SrcObjName != "Port" {
+		t.Error("Expected the Info Port event, got", page)
+	}
+}
+
+func TestConfdEvents(t *testing.T) {
+	dbHdl := NewMemoryDbHandler(nil)
+	for idx := 0; idx < 12; idx++ {
+		if err := dbHdl.LogEvent("Test", map[string]int{"Idx": idx}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	events, err := dbHdl.GetConfdEvents("Test")
+	if err != nil || len(events) != 12 {
+		t.Fatal("Expected 12 events, got", len(events), err)
+	}
+	for idx, event := range events {
+		if string(event.(json.RawMessage)) != fmt.Sprintf(`{"Idx":%d}`, idx) {
+			t.Error("Events not in order at", idx, string(event.(json.RawMessage)))
+		}
+	}
+	keyMap, err := dbHdl.GetEventKeys()
+	if err != nil || len(keyMap["test"]) != 12 || keyMap["test"][1] != "Events#Test#2" || keyMap["test"][11] != "Events#Test#12" {
+		t.Error("Expected the event keys of test in order, got", keyMap, err)
+	}
+}
@@ -0,0 +1,223 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package objects
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+)
+
+//
+// fileStore makes a memStore durable in a single file. Every batch of write
+// commands is appended to the file as one JSON line and synced before it is
+// applied, so a batch from MULTI/EXEC is either fully replayed or not at
+// all. The file is rewritten as a snapshot once it holds many more records
+// than there are keys.
+//
+const (
+	FILE_DB_COMPACT_RECORDS = 10000
+	FILE_DB_COMPACT_RATIO   = 4
+)
+
+type fileRecord struct {
+	Cmds []memCmd `json:"b"`
+}
+
+type fileStore struct {
+	*memStore
+	path    string
+	file    *os.File
+	records int
+}
+
+func openFileStore(path string) (*fileStore, error) {
+	store := &fileStore{memStore: newMemStore(), path: path}
+	size, err := store.replay()
+	if err != nil {
+		return nil, err
+	}
+	// Drop a partial last line so that new records start on a line of
+	// their own
+	if info, err := os.Stat(path); err == nil && info.Size() > size {
+		if err = os.Truncate(path, size); err != nil {
+			return nil, err
+		}
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	store.file = file
+	store.writeHook = store.persist
+	return store, nil
+}
+
+//
+// Load the file and return the size of its complete lines. Only a partial
+// last line is skipped. A complete line which does not decode fails the
+// load, since replaying past it would silently lose that batch.
+//
+func (store *fileStore) replay() (int64, error) {
+	var size int64
+	file, err := os.Open(store.path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	for lineNum := 1; ; lineNum++ {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// A partial last line is a write which was never synced
+			return size, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		size += int64(len(line))
+		var record fileRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return 0, errors.New(store.path + " line " + strconv.Itoa(lineNum) + " is corrupt: " + err.Error())
+		}
+		for _, cmd := range record.Cmds {
+			store.apply(cmd)
+		}
+		store.records++
+	}
+}
+
+func (store *fileStore) write(file *os.File, record fileRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+// Called by memStore.exec with the store locked
+func (store *fileStore) persist(cmds []memCmd) error {
+	if err := store.write(store.file, fileRecord{Cmds: cmds}); err != nil {
+		return err
+	}
+	if err := store.file.Sync(); err != nil {
+		return err
+	}
+	store.records++
+	if store.records > FILE_DB_COMPACT_RECORDS && store.records > FILE_DB_COMPACT_RATIO*len(store.keys()) {
+		// The batch is already durable, a failed compaction only means the
+		// file keeps growing until the next attempt
+		store.compact(cmds)
+	}
+	return nil
+}
+
+//
+// Rewrite the file with one record per key. cmds have been persisted but not
+// yet applied, so they are written after the snapshot.
+//
+func (store *fileStore) compact(cmds []memCmd) error {
+	tmpPath := store.path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	records := 0
+	for _, cmd := range store.snapshot() {
+		if err == nil {
+			err = store.write(file, fileRecord{Cmds: []memCmd{cmd}})
+			records++
+		}
+	}
+	if err == nil {
+		err = store.write(file, fileRecord{Cmds: cmds})
+		records++
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	file.Close()
+	if err == nil {
+		err = os.Rename(tmpPath, store.path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	newFile, err := os.OpenFile(store.path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	store.file.Close()
+	store.file = newFile
+	store.records = records
+	return nil
+}
+
+// Commands which recreate the current contents of the store
+func (store *fileStore) snapshot() []memCmd {
+	var cmds []memCmd
+	for _, key := range store.keys() {
+		bKey := []byte(key)
+		switch store.keyType(key) {
+		case "string":
+			cmds = append(cmds, memCmd{Name: "SET", Args: [][]byte{bKey, store.strs[key]}})
+		case "hash":
+			args := [][]byte{bKey}
+			fields := make([]string, 0, len(store.hashes[key]))
+			for field, _ := range store.hashes[key] {
+				fields = append(fields, field)
+			}
+			sort.Strings(fields)
+			for _, field := range fields {
+				args = append(args, []byte(field), store.hashes[key][field])
+			}
+			cmds = append(cmds, memCmd{Name: "HMSET", Args: args})
+		case "set":
+			args := [][]byte{bKey}
+			for member, _ := range store.sets[key] {
+				args = append(args, []byte(member))
+			}
+			cmds = append(cmds, memCmd{Name: "SADD", Args: args})
+		case "list":
+			args := append([][]byte{bKey}, store.lists[key]...)
+			cmds = append(cmds, memCmd{Name: "RPUSH", Args: args})
+		}
+	}
+	return cmds
+}
+
+func (store *fileStore) Close() error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	return store.file.Close()
+}
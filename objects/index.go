@@ -0,0 +1,272 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package objects
+
+import (
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"models/objects"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+//
+// Secondary indexes on config object attributes. Object types list indexed
+// attributes with "indexedAttrs" in genObjectConfig.json or a drop-in file.
+// Each attribute value is kept in a set IDX#<resource>#<attr>#<value> of
+// the keys of the objects holding it; slice attributes index every element.
+// Indexes are rebuilt at startup and maintained through ObjectChanged.
+//
+const INDEX_KEY_PREFIX = "IDX#"
+
+func indexKey(resource, attr, value string) string {
+	return INDEX_KEY_PREFIX + resource + "#" + attr + "#" + value
+}
+
+// Values of attr in obj as they are indexed and matched against filters
+func attrValues(obj objects.ConfigObj, attr string) []string {
+	if obj == nil {
+		return nil
+	}
+	objVal := reflect.ValueOf(obj)
+	if objVal.Kind() != reflect.Struct {
+		return nil
+	}
+	field := objVal.FieldByName(attr)
+	if !field.IsValid() {
+		return nil
+	}
+	if field.Kind() == reflect.Slice || field.Kind() == reflect.Array {
+		values := make([]string, 0, field.Len())
+		for idx := 0; idx < field.Len(); idx++ {
+			values = append(values, fmt.Sprint(field.Index(idx).Interface()))
+		}
+		return values
+	}
+	return []string{fmt.Sprint(field.Interface())}
+}
+
+func objKeyOf(obj objects.ConfigObj) string {
+	if obj == nil {
+		return ""
+	}
+	return obj.GetKey()
+}
+
+// Send the index updates for a change. Must be called with DbLock held.
+func (mgr *ObjectMgr) sendIndexUpdates(resource string, attrs []string, oldObj, newObj objects.ConfigObj) {
+	d := mgr.dbHdl
+	oldKey, newKey := objKeyOf(oldObj), objKeyOf(newObj)
+	for _, attr := range attrs {
+		newValues := make(map[string]bool)
+		for _, value := range attrValues(newObj, attr) {
+			newValues[value] = true
+		}
+		for _, value := range attrValues(oldObj, attr) {
+			if !newValues[value] || oldKey != newKey {
+				d.Send("SREM", indexKey(resource, attr, value), oldKey)
+			}
+		}
+		for value, _ := range newValues {
+			d.Send("SADD", indexKey(resource, attr, value), newKey)
+		}
+	}
+}
+
+func (mgr *ObjectMgr) updateIndexes(resource string, oldObj, newObj objects.ConfigObj) {
+	objInfo, exist := mgr.GetConfigObjHdlMap()[resource]
+	if !exist || len(objInfo.IndexedAttrs) == 0 {
+		return
+	}
+	defer mgr.dbHdl.DbLock.Unlock()
+	mgr.dbHdl.DbLock.Lock()
+	mgr.sendIndexUpdates(resource, objInfo.IndexedAttrs, oldObj, newObj)
+	if _, err := mgr.dbHdl.Do(""); err != nil {
+		mgr.logger.Err("Failed to update indexes of", resource, err)
+	}
+}
+
+//
+// Drop and recreate the indexes of all object types with indexed
+// attributes from the objects in DB.
+//
+func (mgr *ObjectMgr) RebuildIndexes() error {
+	d := mgr.dbHdl
+	for resource, objInfo := range mgr.GetConfigObjHdlMap() {
+		if len(objInfo.IndexedAttrs) == 0 {
+			continue
+		}
+		objHdl, exist := objects.ConfigObjectMap[resource]
+		if !exist {
+			mgr.logger.Err("No object for indexed resource", resource)
+			continue
+		}
+		objs, err := d.GetAllObjFromDb(objHdl)
+		if err != nil {
+			return err
+		}
+		d.DbLock.Lock()
+		keys, err := redis.Values(d.Do("KEYS", INDEX_KEY_PREFIX+resource+"#*"))
+		if err == nil {
+			for _, key := range keys {
+				d.Send("DEL", key)
+			}
+			for _, obj := range objs {
+				mgr.sendIndexUpdates(resource, objInfo.IndexedAttrs, nil, obj)
+			}
+			_, err = d.Do("")
+		}
+		d.DbLock.Unlock()
+		if err != nil {
+			return err
+		}
+		mgr.logger.Info("Indexed", len(objs), resource, "objects on", objInfo.IndexedAttrs)
+	}
+	return nil
+}
+
+// Name of attr as declared in indexedAttrs, matched case insensitively
+func (mgr *ObjectMgr) GetIndexedAttr(resource, attr string) (string, bool) {
+	for _, indexedAttr := range mgr.GetConfigObjHdlMap()[resource].IndexedAttrs {
+		if strings.EqualFold(indexedAttr, attr) {
+			return indexedAttr, true
+		}
+	}
+	return "", false
+}
+
+//
+// Keys of the objects of resource whose indexed attributes have the given
+// values. All filter attributes must be indexed.
+//
+func (mgr *ObjectMgr) FindObjKeys(resource string, filters map[string]string) ([]string, error) {
+	d := mgr.dbHdl
+	var result map[string]bool
+	defer d.DbLock.Unlock()
+	d.DbLock.Lock()
+	for attr, value := range filters {
+		indexedAttr, ok := mgr.GetIndexedAttr(resource, attr)
+		if !ok {
+			return nil, fmt.Errorf("Attribute %s of %s is not indexed", attr, resource)
+		}
+		members, err := redis.Values(d.Do("SMEMBERS", indexKey(resource, indexedAttr, value)))
+		if err != nil {
+			return nil, err
+		}
+		matched := make(map[string]bool)
+		for _, member := range members {
+			key, _ := redis.String(member, nil)
+			if result == nil || result[key] {
+				matched[key] = true
+			}
+		}
+		result = matched
+	}
+	keys := make([]string, 0, len(result))
+	for key, _ := range result {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func matchesAttrFilters(obj objects.ConfigObj, filters map[string]string) bool {
+	for attr, value := range filters {
+		found := false
+		for _, objValue := range attrValues(obj, attr) {
+			if objValue == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+//
+// Split filters into indexed attributes and attributes which have to be
+// checked on the objects, by their declared names. Attributes the object does
+// not have fail.
+//
+func (mgr *ObjectMgr) ResolveAttrFilters(resource string, obj objects.ConfigObj, filters map[string]string) (indexed, scanned map[string]string, err error) {
+	indexed = make(map[string]string)
+	scanned = make(map[string]string)
+	objType := reflect.TypeOf(obj)
+	for attr, value := range filters {
+		if indexedAttr, ok := mgr.GetIndexedAttr(resource, attr); ok {
+			indexed[indexedAttr] = value
+		} else if field, ok := objType.FieldByNameFunc(func(name string) bool {
+			return strings.EqualFold(name, attr)
+		}); ok {
+			scanned[field.Name] = value
+		} else {
+			return nil, nil, fmt.Errorf("Unknown attribute %s of %s", attr, resource)
+		}
+	}
+	return indexed, scanned, nil
+}
+
+//
+// Config objects of resource matching filters, attribute name to value.
+// Indexed attributes are looked up in their indexes; the rest are checked on
+// the objects, which needs a scan of all objects if no filter is indexed.
+//
+func (mgr *ObjectMgr) GetFilteredObjs(resource string, obj objects.ConfigObj, filters map[string]string) ([]objects.ConfigObj, error) {
+	d := mgr.dbHdl
+	indexed, scanned, err := mgr.ResolveAttrFilters(resource, obj, filters)
+	if err != nil {
+		return nil, err
+	}
+	var objs []objects.ConfigObj
+	if len(indexed) > 0 {
+		keys, err := mgr.FindObjKeys(resource, indexed)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			dbObj, err := d.GetObjectFromDb(obj, key)
+			if err == nil {
+				objs = append(objs, dbObj)
+			}
+		}
+	} else {
+		if objs, err = d.GetAllObjFromDb(obj); err != nil {
+			return nil, err
+		}
+	}
+	filtered := objs[:0]
+	seen := make(map[string]bool)
+	for _, dbObj := range objs {
+		key := dbObj.GetKey()
+		if !seen[key] && matchesAttrFilters(dbObj, scanned) {
+			seen[key] = true
+			filtered = append(filtered, dbObj)
+		}
+	}
+	return filtered, nil
+}
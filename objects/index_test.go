@@ -0,0 +1,79 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package objects
+
+import (
+	"models/objects"
+	"testing"
+)
+
+type testIndexedObj struct {
+	objects.ConfigObj
+	Name string
+	Vrf  string
+	Tags []string
+}
+
+func (obj testIndexedObj) GetKey() string {
+	return "TestIndexedObj#" + obj.Name
+}
+
+func TestIndexUpdates(t *testing.T) {
+	mgr := &ObjectMgr{
+		dbHdl:     NewMemoryDbHandler(nil),
+		objHdlMap: map[string]ConfigObjInfo{"testindexedobj": {IndexedAttrs: []string{"Vrf", "Tags"}}},
+	}
+	obj1 := testIndexedObj{Name: "a", Vrf: "default", Tags: []string{"x", "y"}}
+	obj2 := testIndexedObj{Name: "b", Vrf: "default", Tags: []string{"y"}}
+	mgr.updateIndexes("testindexedobj", nil, obj1)
+	mgr.updateIndexes("testindexedobj", nil, obj2)
+
+	keys, err := mgr.FindObjKeys("testindexedobj", map[string]string{"vrf": "default", "Tags": "y"})
+	if err != nil || len(keys) != 2 {
+		t.Fatal("Expected both objects, got", keys, err)
+	}
+	keys, _ = mgr.FindObjKeys("testindexedobj", map[string]string{"Tags": "x"})
+	if len(keys) != 1 || keys[0] != obj1.GetKey() {
+		t.Error("Expected only a for tag x, got", keys)
+	}
+
+	updated := obj1
+	updated.Vrf = "mgmt"
+	updated.Tags = []string{"y"}
+	mgr.updateIndexes("testindexedobj", obj1, updated)
+	if keys, _ = mgr.FindObjKeys("testindexedobj", map[string]string{"Tags": "x"}); len(keys) != 0 {
+		t.Error("Stale entry for tag x", keys)
+	}
+	if keys, _ = mgr.FindObjKeys("testindexedobj", map[string]string{"Vrf": "default"}); len(keys) != 1 || keys[0] != obj2.GetKey() {
+		t.Error("Expected only b in vrf default, got", keys)
+	}
+
+	mgr.updateIndexes("testindexedobj", obj2, nil)
+	if keys, _ = mgr.FindObjKeys("testindexedobj", map[string]string{"Tags": "y"}); len(keys) != 1 || keys[0] != obj1.GetKey() {
+		t.Error("Deleted object still indexed", keys)
+	}
+	if _, err = mgr.FindObjKeys("testindexedobj", map[string]string{"Name": "a"}); err == nil {
+		t.Error("Lookup on an attribute without index succeeded")
+	}
+}
@@ -0,0 +1,253 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package objects
+
+import (
+	"github.com/garyburd/redigo/redis"
+	"models/objects"
+	"strings"
+)
+
+//
+// Integrity check of the UUID to object key maps. Every writable config
+// object in DB should have a UUID entry and a reverse entry which point at
+// each other, and neither entry should exist without its object.
+//
+const (
+	INTEGRITY_OBJ_WITHOUT_UUID = "ObjectWithoutUUID"
+	INTEGRITY_UUID_WITHOUT_OBJ = "UUIDWithoutObject"
+	INTEGRITY_MISMATCHED_ENTRY = "MismatchedEntry"
+
+	UUID_KEY_PATTERN = "????????-????-????-????-????????????"
+	UUID_REV_PREFIX  = "UUID"
+)
+
+type IntegrityIssue struct {
+	Kind     string
+	ObjKey   string
+	UUID     string
+	Repaired bool
+}
+
+func (issue IntegrityIssue) String() string {
+	str := issue.Kind + " " + issue.ObjKey + " " + issue.UUID
+	if issue.Repaired {
+		str += " repaired"
+	}
+	return str
+}
+
+type IntegrityReport struct {
+	ObjectsChecked int
+	UUIDsChecked   int
+	Issues         []IntegrityIssue
+	RepairFailed   int
+}
+
+func (report IntegrityReport) Count(kind string) (count int) {
+	for _, issue := range report.Issues {
+		if issue.Kind == kind {
+			count++
+		}
+	}
+	return count
+}
+
+func (report IntegrityReport) Repaired() (count int) {
+	for _, issue := range report.Issues {
+		if issue.Repaired {
+			count++
+		}
+	}
+	return count
+}
+
+// Read all string entries matching pattern. Must be called with DbLock held.
+func (d *DbHandler) getStrEntries(pattern string) (map[string]string, error) {
+	entries := make(map[string]string)
+	keys, err := redis.Values(d.Do("KEYS", pattern))
+	if err != nil {
+		return entries, err
+	}
+	for _, key := range keys {
+		keyStr, err := redis.String(key, nil)
+		if err != nil {
+			continue
+		}
+		// Keys of other types match the pattern as well, skip them
+		value, err := redis.String(d.Do("GET", keyStr))
+		if err == nil {
+			entries[keyStr] = value
+		}
+	}
+	return entries, nil
+}
+
+func (d *DbHandler) keyExists(key string) bool {
+	defer d.DBUtil.DbLock.Unlock()
+	d.DBUtil.DbLock.Lock()
+	count, err := redis.Int64(d.Do("EXISTS", key))
+	return err == nil && count > 0
+}
+
+func (d *DbHandler) repairUUIDMap(cmds ...[]string) error {
+	defer d.DBUtil.DbLock.Unlock()
+	d.DBUtil.DbLock.Lock()
+	return d.execTxn(cmds...)
+}
+
+//
+// Check the UUID maps of all writable config objects and, if repair is set,
+// fix them. The reverse entry is what confd uses to find the UUID of an
+// object, so a dangling UUID entry is removed rather than repointed.
+//
+func (mgr *ObjectMgr) CheckUUIDMaps(repair bool) (report IntegrityReport, err error) {
+	d := mgr.dbHdl
+	objKeys := make(map[string]bool)
+	for resource, objInfo := range mgr.GetConfigObjHdlMap() {
+		if !strings.Contains(objInfo.Access, "w") {
+			continue
+		}
+		objHdl, exist := objects.ConfigObjectMap[resource]
+		if !exist {
+			continue
+		}
+		objs, err := d.GetAllObjFromDb(objHdl)
+		if err != nil {
+			mgr.logger.Err("Integrity check failed to read", resource, err)
+			continue
+		}
+		for _, obj := range objs {
+			objKeys[d.GetKey(obj)] = true
+		}
+	}
+	d.DBUtil.DbLock.Lock()
+	fwd, err := d.getStrEntries(UUID_KEY_PATTERN)
+	var revEntries map[string]string
+	if err == nil {
+		revEntries, err = d.getStrEntries(UUID_REV_PREFIX + "*")
+	}
+	d.DBUtil.DbLock.Unlock()
+	if err == nil {
+		rev := make(map[string]string)
+		for key, uuid := range revEntries {
+			rev[strings.TrimPrefix(key, UUID_REV_PREFIX)] = uuid
+		}
+		report = mgr.checkUUIDEntries(objKeys, fwd, rev, repair)
+	}
+	if err != nil {
+		return report, err
+	}
+	mgr.logger.Info("UUID map integrity check:", report.ObjectsChecked, "objects,", report.UUIDsChecked,
+		"UUIDs,", len(report.Issues), "issues,", report.Repaired(), "repaired")
+	return report, nil
+}
+
+func (mgr *ObjectMgr) checkUUIDEntries(objKeys map[string]bool, fwd, rev map[string]string, repair bool) (report IntegrityReport) {
+	d := mgr.dbHdl
+	report.ObjectsChecked = len(objKeys)
+	report.UUIDsChecked = len(fwd)
+	addIssue := func(kind, objKey, uuid string, cmds ...[]string) {
+		issue := IntegrityIssue{Kind: kind, ObjKey: objKey, UUID: uuid}
+		if repair {
+			if err := d.repairUUIDMap(cmds...); err != nil {
+				mgr.logger.Err("Failed to repair", issue.String(), err)
+				report.RepairFailed++
+			} else {
+				issue.Repaired = true
+			}
+		}
+		report.Issues = append(report.Issues, issue)
+	}
+	addNewUUID := func(kind, objKey string) {
+		issue := IntegrityIssue{Kind: kind, ObjKey: objKey}
+		if repair {
+			if newUUID, err := d.StoreUUIDToObjKeyMap(objKey); err != nil {
+				report.RepairFailed++
+			} else {
+				issue.UUID = newUUID
+				issue.Repaired = true
+				fwd[newUUID] = objKey
+				rev[objKey] = newUUID
+			}
+		}
+		report.Issues = append(report.Issues, issue)
+	}
+	// UUID entries by the object they point at
+	fwdByObj := make(map[string][]string)
+	for uuid, objKey := range fwd {
+		fwdByObj[objKey] = append(fwdByObj[objKey], uuid)
+	}
+	for objKey, _ := range objKeys {
+		uuid, exist := rev[objKey]
+		switch {
+		case !exist && len(fwdByObj[objKey]) > 0:
+			// Keep an existing UUID so clients holding it keep working
+			uuid = fwdByObj[objKey][0]
+			addIssue(INTEGRITY_OBJ_WITHOUT_UUID, objKey, uuid, []string{"SET", UUID_REV_PREFIX + objKey, uuid})
+			rev[objKey] = uuid
+		case !exist:
+			addNewUUID(INTEGRITY_OBJ_WITHOUT_UUID, objKey)
+		case fwd[uuid] != objKey:
+			if owner, taken := fwd[uuid]; taken && rev[owner] == uuid && (objKeys[owner] || d.keyExists(owner)) {
+				// The UUID belongs to another object, repointing it would
+				// take it away from that one
+				addNewUUID(INTEGRITY_MISMATCHED_ENTRY, objKey)
+				continue
+			}
+			addIssue(INTEGRITY_MISMATCHED_ENTRY, objKey, uuid, []string{"SET", uuid, objKey})
+			fwd[uuid] = objKey
+		}
+	}
+	for uuid, objKey := range fwd {
+		revUUID, hasRev := rev[objKey]
+		switch {
+		case !objKeys[objKey] && !d.keyExists(objKey):
+			cmds := [][]string{{"DEL", uuid}}
+			if revUUID == uuid {
+				cmds = append(cmds, []string{"DEL", UUID_REV_PREFIX + objKey})
+				delete(rev, objKey)
+			}
+			addIssue(INTEGRITY_UUID_WITHOUT_OBJ, objKey, uuid, cmds...)
+		case revUUID == uuid:
+		case !hasRev:
+			addIssue(INTEGRITY_OBJ_WITHOUT_UUID, objKey, uuid, []string{"SET", UUID_REV_PREFIX + objKey, uuid})
+			rev[objKey] = uuid
+		default:
+			// Another UUID is the one in use for this object
+			addIssue(INTEGRITY_MISMATCHED_ENTRY, objKey, uuid, []string{"DEL", uuid})
+		}
+	}
+	for objKey, uuid := range rev {
+		if fwd[uuid] == objKey {
+			continue
+		}
+		if !objKeys[objKey] && !d.keyExists(objKey) {
+			addIssue(INTEGRITY_UUID_WITHOUT_OBJ, objKey, uuid, []string{"DEL", UUID_REV_PREFIX + objKey})
+		} else if _, exist := fwd[uuid]; !exist {
+			addIssue(INTEGRITY_MISMATCHED_ENTRY, objKey, uuid, []string{"SET", uuid, objKey})
+		}
+	}
+	return report
+}
@@ -0,0 +1,105 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package objects
+
+import (
+	"testing"
+)
+
+const (
+	testUUID1 = "11111111-1111-1111-1111-111111111111"
+	testUUID2 = "22222222-2222-2222-2222-222222222222"
+	testUUID3 = "33333333-3333-3333-3333-333333333333"
+)
+
+func TestCheckUUIDEntries(t *testing.T) {
+	dbHdl := NewMemoryDbHandler(nil)
+	mgr := &ObjectMgr{dbHdl: dbHdl}
+	conn := dbHdl.DBUtil.Conn
+	// Vlan#1 is consistent
+	conn.Do("HMSET", "Vlan#1", "VlanId", 1)
+	conn.Do("SET", testUUID1, "Vlan#1")
+	conn.Do("SET", "UUIDVlan#1", testUUID1)
+	// Vlan#2 has a UUID entry but lost its reverse entry
+	conn.Do("HMSET", "Vlan#2", "VlanId", 2)
+	conn.Do("SET", testUUID2, "Vlan#2")
+	// Vlan#3 was deleted but its map entries were not
+	conn.Do("SET", testUUID3, "Vlan#3")
+	conn.Do("SET", "UUIDVlan#3", testUUID3)
+	// Vlan#4 has no map entries at all
+	conn.Do("HMSET", "Vlan#4", "VlanId", 4)
+
+	objKeys := map[string]bool{"Vlan#1": true, "Vlan#2": true, "Vlan#4": true}
+	fwd := map[string]string{testUUID1: "Vlan#1", testUUID2: "Vlan#2", testUUID3: "Vlan#3"}
+	rev := map[string]string{"Vlan#1": testUUID1, "Vlan#3": testUUID3}
+	report := mgr.checkUUIDEntries(objKeys, fwd, rev, true)
+	if report.Count(INTEGRITY_OBJ_WITHOUT_UUID) != 2 || report.Count(INTEGRITY_UUID_WITHOUT_OBJ) != 1 {
+		t.Fatal("Unexpected issues", report.Issues)
+	}
+	if report.Repaired() != 3 || report.RepairFailed != 0 {
+		t.Error("Not all issues repaired", report.Issues)
+	}
+	if uuid, err := dbHdl.GetUUIDFromObjKey("Vlan#2"); err != nil || uuid != testUUID2 {
+		t.Error("Reverse entry of Vlan#2 not restored, got", uuid, err)
+	}
+	if _, err := dbHdl.GetUUIDFromObjKey("Vlan#4"); err != nil {
+		t.Error("No UUID created for Vlan#4")
+	}
+	if dbHdl.keyExists(testUUID3) || dbHdl.keyExists("UUIDVlan#3") {
+		t.Error("Entries of deleted Vlan#3 not removed")
+	}
+	if objKey, err := dbHdl.GetObjKeyFromUUID(testUUID1); err != nil || objKey != "Vlan#1" {
+		t.Error("Consistent entry changed, got", objKey, err)
+	}
+}
+
+func TestCheckUUIDEntryInUse(t *testing.T) {
+	dbHdl := NewMemoryDbHandler(nil)
+	mgr := &ObjectMgr{dbHdl: dbHdl}
+	conn := dbHdl.DBUtil.Conn
+	// Vlan#2's reverse entry names the UUID of Vlan#1
+	conn.Do("HMSET", "Vlan#1", "VlanId", 1)
+	conn.Do("SET", testUUID1, "Vlan#1")
+	conn.Do("SET", "UUIDVlan#1", testUUID1)
+	conn.Do("HMSET", "Vlan#2", "VlanId", 2)
+	conn.Do("SET", "UUIDVlan#2", testUUID1)
+
+	objKeys := map[string]bool{"Vlan#1": true, "Vlan#2": true}
+	fwd := map[string]string{testUUID1: "Vlan#1"}
+	rev := map[string]string{"Vlan#1": testUUID1, "Vlan#2": testUUID1}
+	report := mgr.checkUUIDEntries(objKeys, fwd, rev, true)
+	if len(report.Issues) != 1 || report.Count(INTEGRITY_MISMATCHED_ENTRY) != 1 || report.Repaired() != 1 {
+		t.Fatal("Unexpected issues", report.Issues)
+	}
+	if objKey, err := dbHdl.GetObjKeyFromUUID(testUUID1); err != nil || objKey != "Vlan#1" {
+		t.Error("UUID of Vlan#1 was taken away, it points at", objKey, err)
+	}
+	uuid, err := dbHdl.GetUUIDFromObjKey("Vlan#2")
+	if err != nil || uuid == testUUID1 {
+		t.Fatal("Vlan#2 did not get a UUID of its own, got", uuid, err)
+	}
+	if objKey, err := dbHdl.GetObjKeyFromUUID(uuid); err != nil || objKey != "Vlan#2" {
+		t.Error("New UUID of Vlan#2 points at", objKey, err)
+	}
+}
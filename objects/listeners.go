@@ -0,0 +1,139 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package objects
+
+import (
+	"config/clients"
+	"models/objects"
+	"reflect"
+)
+
+//
+// Names of the exported attributes which differ between two objects of the
+// same type. A nil object is compared as the zero value so creates and
+// deletes report every attribute which is set.
+//
+func GetChangedAttrs(oldObj, newObj objects.ConfigObj) []string {
+	var changed []string
+	var oldVal, newVal reflect.Value
+	if oldObj != nil {
+		oldVal = reflect.ValueOf(oldObj)
+	}
+	if newObj != nil {
+		newVal = reflect.ValueOf(newObj)
+	}
+	if !oldVal.IsValid() {
+		if !newVal.IsValid() {
+			return changed
+		}
+		oldVal = reflect.Zero(newVal.Type())
+	}
+	if !newVal.IsValid() {
+		newVal = reflect.Zero(oldVal.Type())
+	}
+	if oldVal.Type() != newVal.Type() || oldVal.Kind() != reflect.Struct {
+		return changed
+	}
+	objType := oldVal.Type()
+	for idx := 0; idx < objType.NumField(); idx++ {
+		field := objType.Field(idx)
+		if field.PkgPath != "" || field.Anonymous {
+			continue
+		}
+		if !reflect.DeepEqual(oldVal.Field(idx).Interface(), newVal.Field(idx).Interface()) {
+			changed = append(changed, field.Name)
+		}
+	}
+	return changed
+}
+
+//
+// Called after every successful create, update or delete of a config object,
+// with a nil oldObj for creates and a nil newObj for deletes.
+//
+func (mgr *ObjectMgr) ObjectChanged(resource, op string, oldObj, newObj objects.ConfigObj) {
+	mgr.updateIndexes(resource, oldObj, newObj)
+	mgr.NotifyListeners(resource, op, oldObj, newObj)
+	mgr.notifyObservers(op, oldObj, newObj)
+}
+
+func newObjectChange(op string, oldObj, newObj objects.ConfigObj) clients.ObjectChange {
+	obj := newObj
+	if obj == nil {
+		obj = oldObj
+	}
+	return clients.ObjectChange{
+		Op:           op,
+		ObjectType:   reflect.TypeOf(obj).Name(),
+		OldObj:       oldObj,
+		NewObj:       newObj,
+		ChangedAttrs: GetChangedAttrs(oldObj, newObj),
+	}
+}
+
+//
+// Queue a change notification for every listener of resource. This is called
+// after the owner has successfully applied the change.
+//
+func (mgr *ObjectMgr) NotifyListeners(resource, op string, oldObj, newObj objects.ConfigObj) {
+	objInfo, exist := mgr.GetConfigObjHdlMap()[resource]
+	if !exist || len(objInfo.Listeners) == 0 {
+		return
+	}
+	change := newObjectChange(op, oldObj, newObj)
+	for _, lsnr := range objInfo.Listeners {
+		hdl, ok := lsnr.(*clients.ClientHdl)
+		if !ok {
+			continue
+		}
+		if err := hdl.QueueObjectChange(change); err != nil {
+			mgr.logger.Debug("Not notifying", hdl.GetServerName(), "of", op, resource, err)
+		}
+	}
+}
+
+//
+// Observers within confd see every config object change, e.g. to forward
+// it to webhooks. They are called in the request path and must not block.
+//
+type ChangeObserver func(change clients.ObjectChange)
+
+func (mgr *ObjectMgr) AddChangeObserver(observer ChangeObserver) {
+	mgr.observerMutex.Lock()
+	mgr.observers = append(mgr.observers, observer)
+	mgr.observerMutex.Unlock()
+}
+
+func (mgr *ObjectMgr) notifyObservers(op string, oldObj, newObj objects.ConfigObj) {
+	mgr.observerMutex.RLock()
+	observers := mgr.observers
+	mgr.observerMutex.RUnlock()
+	if len(observers) == 0 || (oldObj == nil && newObj == nil) {
+		return
+	}
+	change := newObjectChange(op, oldObj, newObj)
+	for _, observer := range observers {
+		observer(change)
+	}
+}
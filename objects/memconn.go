@@ -0,0 +1,185 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package objects
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+//
+// memConn implements redis.Conn on top of a memStore, including pipelining
+// with Send/Flush/Receive and MULTI/EXEC transactions. Unlike a redigo
+// connection it is safe for concurrent use, although pipelines and
+// transactions of concurrent users are interleaved like on a shared redis
+// connection.
+//
+
+var (
+	errMemConnClosed = errors.New("Connection closed")
+	errMemNoReply    = errors.New("No pending reply")
+)
+
+type memConn struct {
+	mutex   sync.Mutex
+	store   *memStore
+	pending []memCmd
+	replies []interface{}
+	inMulti bool
+	multi   []memCmd
+	closed  bool
+}
+
+func newMemConn(store *memStore) *memConn {
+	return &memConn{store: store}
+}
+
+func (conn *memConn) Close() error {
+	defer conn.mutex.Unlock()
+	conn.mutex.Lock()
+	conn.closed = true
+	return nil
+}
+
+func (conn *memConn) Err() error {
+	defer conn.mutex.Unlock()
+	conn.mutex.Lock()
+	if conn.closed {
+		return errMemConnClosed
+	}
+	return nil
+}
+
+func (conn *memConn) Send(name string, args ...interface{}) error {
+	defer conn.mutex.Unlock()
+	conn.mutex.Lock()
+	return conn.send(name, args)
+}
+
+func (conn *memConn) send(name string, args []interface{}) error {
+	if conn.closed {
+		return errMemConnClosed
+	}
+	conn.pending = append(conn.pending, newMemCmd(name, args))
+	return nil
+}
+
+func (conn *memConn) Flush() error {
+	defer conn.mutex.Unlock()
+	conn.mutex.Lock()
+	return conn.flush()
+}
+
+func (conn *memConn) flush() error {
+	if conn.closed {
+		return errMemConnClosed
+	}
+	for _, cmd := range conn.pending {
+		conn.replies = append(conn.replies, conn.run(cmd))
+	}
+	conn.pending = nil
+	return nil
+}
+
+func (conn *memConn) Receive() (interface{}, error) {
+	defer conn.mutex.Unlock()
+	conn.mutex.Lock()
+	if len(conn.replies) == 0 {
+		return nil, errMemNoReply
+	}
+	reply := conn.replies[0]
+	conn.replies = conn.replies[1:]
+	if err, ok := reply.(error); ok {
+		return nil, err
+	}
+	return reply, nil
+}
+
+//
+// Do sends name along with any pending commands and returns the last reply.
+// An empty name returns all pending replies, as redigo does.
+//
+func (conn *memConn) Do(name string, args ...interface{}) (interface{}, error) {
+	defer conn.mutex.Unlock()
+	conn.mutex.Lock()
+	if name != "" {
+		if err := conn.send(name, args); err != nil {
+			return nil, err
+		}
+	}
+	if err := conn.flush(); err != nil {
+		return nil, err
+	}
+	replies := conn.replies
+	conn.replies = nil
+	if name == "" {
+		for _, reply := range replies {
+			if err, ok := reply.(error); ok {
+				return replies, err
+			}
+		}
+		return replies, nil
+	}
+	if len(replies) == 0 {
+		return nil, errMemNoReply
+	}
+	reply := replies[len(replies)-1]
+	if err, ok := reply.(error); ok {
+		return nil, err
+	}
+	return reply, nil
+}
+
+func (conn *memConn) run(cmd memCmd) interface{} {
+	switch strings.ToUpper(cmd.Name) {
+	case "MULTI":
+		if conn.inMulti {
+			return errors.New("ERR MULTI calls can not be nested")
+		}
+		conn.inMulti = true
+		conn.multi = nil
+		return "OK"
+	case "DISCARD":
+		if !conn.inMulti {
+			return errors.New("ERR DISCARD without MULTI")
+		}
+		conn.inMulti = false
+		conn.multi = nil
+		return "OK"
+	case "EXEC":
+		if !conn.inMulti {
+			return errors.New("ERR EXEC without MULTI")
+		}
+		conn.inMulti = false
+		cmds := conn.multi
+		conn.multi = nil
+		return conn.store.exec(cmds)
+	}
+	if conn.inMulti {
+		conn.multi = append(conn.multi, cmd)
+		return "QUEUED"
+	}
+	return conn.store.exec([]memCmd{cmd})[0]
+}
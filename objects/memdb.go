@@ -0,0 +1,637 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package objects
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//
+// memStore is an embedded key value store which understands the subset of
+// redis commands used by DBUtil, the generated model objects and confd
+// itself: strings, hashes, sets and lists, KEYS and SCAN with redis glob
+// patterns and MULTI/EXEC. The SCAN cursor is the position in the sorted
+// keys. Replies have the same types as redigo replies so the redis
+// helper functions work unchanged.
+//
+
+var (
+	errMemWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	errMemNotInt    = errors.New("ERR value is not an integer or out of range")
+	errMemNoKey     = errors.New("ERR no such key")
+)
+
+type memCmd struct {
+	Name string   `json:"c"`
+	Args [][]byte `json:"a"`
+}
+
+type memStore struct {
+	mutex  sync.Mutex
+	strs   map[string][]byte
+	hashes map[string]map[string][]byte
+	sets   map[string]map[string]bool
+	lists  map[string][][]byte
+	// Called with the write commands of a batch before they are applied
+	writeHook func(cmds []memCmd) error
+}
+
+func newMemStore() *memStore {
+	store := new(memStore)
+	store.flush()
+	return store
+}
+
+func (store *memStore) flush() {
+	store.strs = make(map[string][]byte)
+	store.hashes = make(map[string]map[string][]byte)
+	store.sets = make(map[string]map[string]bool)
+	store.lists = make(map[string][][]byte)
+}
+
+var memWriteCmds = map[string]bool{
+	"SET": true, "DEL": true, "INCR": true, "RENAME": true,
+	"HSET": true, "HMSET": true, "HDEL": true,
+	"SADD": true, "SREM": true,
+	"RPUSH": true, "LPUSH": true, "LPOP": true, "LTRIM": true,
+	"FLUSHDB": true, "FLUSHALL": true,
+}
+
+func isMemWriteCmd(name string) bool {
+	return memWriteCmds[name]
+}
+
+// Convert a command argument the way redigo writes it on the wire
+func memArg(arg interface{}) []byte {
+	switch arg := arg.(type) {
+	case string:
+		return []byte(arg)
+	case []byte:
+		return arg
+	case int:
+		return []byte(strconv.FormatInt(int64(arg), 10))
+	case int64:
+		return []byte(strconv.FormatInt(arg, 10))
+	case float64:
+		return []byte(strconv.FormatFloat(arg, 'g', -1, 64))
+	case bool:
+		if arg {
+			return []byte("1")
+		}
+		return []byte("0")
+	case nil:
+		return []byte("")
+	default:
+		return []byte(fmt.Sprint(arg))
+	}
+}
+
+func newMemCmd(name string, args []interface{}) memCmd {
+	cmd := memCmd{Name: strings.ToUpper(name), Args: make([][]byte, len(args))}
+	for idx, arg := range args {
+		cmd.Args[idx] = memArg(arg)
+	}
+	return cmd
+}
+
+//
+// Run a batch of commands atomically. Errors of individual commands are
+// returned as error values in the reply list.
+//
+func (store *memStore) exec(cmds []memCmd) []interface{} {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	replies := make([]interface{}, len(cmds))
+	if store.writeHook != nil {
+		var writes []memCmd
+		for _, cmd := range cmds {
+			if isMemWriteCmd(cmd.Name) {
+				writes = append(writes, cmd)
+			}
+		}
+		if len(writes) > 0 {
+			if err := store.writeHook(writes); err != nil {
+				for idx, _ := range replies {
+					replies[idx] = err
+				}
+				return replies
+			}
+		}
+	}
+	for idx, cmd := range cmds {
+		replies[idx] = store.apply(cmd)
+	}
+	return replies
+}
+
+func (store *memStore) keyType(key string) string {
+	if _, exist := store.strs[key]; exist {
+		return "string"
+	}
+	if _, exist := store.hashes[key]; exist {
+		return "hash"
+	}
+	if _, exist := store.sets[key]; exist {
+		return "set"
+	}
+	if _, exist := store.lists[key]; exist {
+		return "list"
+	}
+	return "none"
+}
+
+// Whether key is free or already holds a value of type keyType
+func (store *memStore) typeOk(key, keyType string) bool {
+	currType := store.keyType(key)
+	return currType == "none" || currType == keyType
+}
+
+func (store *memStore) del(key string) bool {
+	found := store.keyType(key) != "none"
+	delete(store.strs, key)
+	delete(store.hashes, key)
+	delete(store.sets, key)
+	delete(store.lists, key)
+	return found
+}
+
+func (store *memStore) keys() []string {
+	var keys []string
+	for key, _ := range store.strs {
+		keys = append(keys, key)
+	}
+	for key, _ := range store.hashes {
+		keys = append(keys, key)
+	}
+	for key, _ := range store.sets {
+		keys = append(keys, key)
+	}
+	for key, _ := range store.lists {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func bulkList(values []string) []interface{} {
+	reply := make([]interface{}, len(values))
+	for idx, value := range values {
+		reply[idx] = []byte(value)
+	}
+	return reply
+}
+
+func argCountErr(name string) error {
+	return errors.New("ERR wrong number of arguments for '" + strings.ToLower(name) + "' command")
+}
+
+// List index as used by LRANGE and LTRIM, negative values count from the end
+func listIndex(arg []byte, length int) (int, error) {
+	idx, err := strconv.Atoi(string(arg))
+	if err != nil {
+		return 0, errMemNotInt
+	}
+	if idx < 0 {
+		idx += length
+	}
+	return idx, nil
+}
+
+func listRange(list [][]byte, startArg, stopArg []byte) (int, int, error) {
+	start, err := listIndex(startArg, len(list))
+	if err != nil {
+		return 0, 0, err
+	}
+	stop, err := listIndex(stopArg, len(list))
+	if err != nil {
+		return 0, 0, err
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= len(list) {
+		stop = len(list) - 1
+	}
+	if start > stop {
+		return 0, 0, nil
+	}
+	return start, stop + 1, nil
+}
+
+func (store *memStore) apply(cmd memCmd) interface{} {
+	args := cmd.Args
+	minArgs := map[string]int{
+		"GET": 1, "SET": 2, "DEL": 1, "EXISTS": 1, "KEYS": 1, "SCAN": 1, "TYPE": 1, "INCR": 1, "RENAME": 2,
+		"HSET": 3, "HMSET": 3, "HGET": 2, "HGETALL": 1, "HDEL": 2, "HKEYS": 1, "HEXISTS": 2, "HLEN": 1,
+		"SADD": 2, "SREM": 2, "SMEMBERS": 1, "SISMEMBER": 2, "SCARD": 1,
+		"RPUSH": 2, "LPUSH": 2, "LPOP": 1, "LRANGE": 3, "LLEN": 1, "LTRIM": 3,
+	}
+	if len(args) < minArgs[cmd.Name] {
+		return argCountErr(cmd.Name)
+	}
+	var key string
+	if len(args) > 0 {
+		key = string(args[0])
+	}
+	switch cmd.Name {
+	case "PING":
+		return "PONG"
+	case "SELECT":
+		return "OK"
+	case "DBSIZE":
+		return int64(len(store.keys()))
+	case "FLUSHDB", "FLUSHALL":
+		store.flush()
+		return "OK"
+	case "GET":
+		if !store.typeOk(key, "string") {
+			return errMemWrongType
+		}
+		if value, exist := store.strs[key]; exist {
+			return value
+		}
+		return nil
+	case "SET":
+		if len(args) != 2 {
+			return argCountErr(cmd.Name)
+		}
+		store.del(key)
+		store.strs[key] = args[1]
+		return "OK"
+	case "INCR":
+		if !store.typeOk(key, "string") {
+			return errMemWrongType
+		}
+		value := int64(0)
+		if curr, exist := store.strs[key]; exist {
+			var err error
+			if value, err = strconv.ParseInt(string(curr), 10, 64); err != nil {
+				return errMemNotInt
+			}
+		}
+		value++
+		store.strs[key] = []byte(strconv.FormatInt(value, 10))
+		return value
+	case "DEL":
+		count := int64(0)
+		for _, arg := range args {
+			if store.del(string(arg)) {
+				count++
+			}
+		}
+		return count
+	case "EXISTS":
+		count := int64(0)
+		for _, arg := range args {
+			if store.keyType(string(arg)) != "none" {
+				count++
+			}
+		}
+		return count
+	case "TYPE":
+		return store.keyType(key)
+	case "KEYS":
+		var matched []string
+		for _, name := range store.keys() {
+			if globMatch(key, name) {
+				matched = append(matched, name)
+			}
+		}
+		return bulkList(matched)
+	case "SCAN":
+		cursor, err := strconv.Atoi(key)
+		if err != nil || cursor < 0 || len(args)%2 != 1 {
+			return errors.New("ERR syntax error")
+		}
+		pattern, count := "*", 10
+		for idx := 1; idx < len(args); idx += 2 {
+			switch strings.ToUpper(string(args[idx])) {
+			case "MATCH":
+				pattern = string(args[idx+1])
+			case "COUNT":
+				if count, err = strconv.Atoi(string(args[idx+1])); err != nil || count <= 0 {
+					return errors.New("ERR syntax error")
+				}
+			default:
+				return errors.New("ERR syntax error")
+			}
+		}
+		names := store.keys()
+		var matched []string
+		for ; cursor < len(names) && count > 0; cursor, count = cursor+1, count-1 {
+			if globMatch(pattern, names[cursor]) {
+				matched = append(matched, names[cursor])
+			}
+		}
+		if cursor >= len(names) {
+			cursor = 0
+		}
+		return []interface{}{[]byte(strconv.Itoa(cursor)), bulkList(matched)}
+	case "RENAME":
+		keyType := store.keyType(key)
+		if keyType == "none" {
+			return errMemNoKey
+		}
+		newKey := string(args[1])
+		str, hash, set, list := store.strs[key], store.hashes[key], store.sets[key], store.lists[key]
+		store.del(key)
+		store.del(newKey)
+		switch keyType {
+		case "string":
+			store.strs[newKey] = str
+		case "hash":
+			store.hashes[newKey] = hash
+		case "set":
+			store.sets[newKey] = set
+		case "list":
+			store.lists[newKey] = list
+		}
+		return "OK"
+	case "HSET", "HMSET":
+		if len(args)%2 != 1 {
+			return argCountErr(cmd.Name)
+		}
+		if !store.typeOk(key, "hash") {
+			return errMemWrongType
+		}
+		hash := store.hashes[key]
+		if hash == nil {
+			hash = make(map[string][]byte)
+			store.hashes[key] = hash
+		}
+		added := int64(0)
+		for idx := 1; idx < len(args); idx += 2 {
+			if _, exist := hash[string(args[idx])]; !exist {
+				added++
+			}
+			hash[string(args[idx])] = args[idx+1]
+		}
+		if cmd.Name == "HMSET" {
+			return "OK"
+		}
+		return added
+	case "HGET":
+		if !store.typeOk(key, "hash") {
+			return errMemWrongType
+		}
+		if value, exist := store.hashes[key][string(args[1])]; exist {
+			return value
+		}
+		return nil
+	case "HEXISTS":
+		if !store.typeOk(key, "hash") {
+			return errMemWrongType
+		}
+		if _, exist := store.hashes[key][string(args[1])]; exist {
+			return int64(1)
+		}
+		return int64(0)
+	case "HGETALL", "HKEYS", "HLEN":
+		if !store.typeOk(key, "hash") {
+			return errMemWrongType
+		}
+		hash := store.hashes[key]
+		if cmd.Name == "HLEN" {
+			return int64(len(hash))
+		}
+		fields := make([]string, 0, len(hash))
+		for field, _ := range hash {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		if cmd.Name == "HKEYS" {
+			return bulkList(fields)
+		}
+		reply := make([]interface{}, 0, 2*len(fields))
+		for _, field := range fields {
+			reply = append(reply, []byte(field), hash[field])
+		}
+		return reply
+	case "HDEL":
+		if !store.typeOk(key, "hash") {
+			return errMemWrongType
+		}
+		count := int64(0)
+		for _, arg := range args[1:] {
+			if _, exist := store.hashes[key][string(arg)]; exist {
+				delete(store.hashes[key], string(arg))
+				count++
+			}
+		}
+		if len(store.hashes[key]) == 0 {
+			delete(store.hashes, key)
+		}
+		return count
+	case "SADD":
+		if !store.typeOk(key, "set") {
+			return errMemWrongType
+		}
+		set := store.sets[key]
+		if set == nil {
+			set = make(map[string]bool)
+			store.sets[key] = set
+		}
+		added := int64(0)
+		for _, arg := range args[1:] {
+			if !set[string(arg)] {
+				set[string(arg)] = true
+				added++
+			}
+		}
+		return added
+	case "SREM":
+		if !store.typeOk(key, "set") {
+			return errMemWrongType
+		}
+		count := int64(0)
+		for _, arg := range args[1:] {
+			if store.sets[key][string(arg)] {
+				delete(store.sets[key], string(arg))
+				count++
+			}
+		}
+		if len(store.sets[key]) == 0 {
+			delete(store.sets, key)
+		}
+		return count
+	case "SMEMBERS":
+		if !store.typeOk(key, "set") {
+			return errMemWrongType
+		}
+		members := make([]string, 0, len(store.sets[key]))
+		for member, _ := range store.sets[key] {
+			members = append(members, member)
+		}
+		sort.Strings(members)
+		return bulkList(members)
+	case "SISMEMBER":
+		if !store.typeOk(key, "set") {
+			return errMemWrongType
+		}
+		if store.sets[key][string(args[1])] {
+			return int64(1)
+		}
+		return int64(0)
+	case "SCARD":
+		if !store.typeOk(key, "set") {
+			return errMemWrongType
+		}
+		return int64(len(store.sets[key]))
+	case "RPUSH", "LPUSH":
+		if !store.typeOk(key, "list") {
+			return errMemWrongType
+		}
+		list := store.lists[key]
+		for _, arg := range args[1:] {
+			if cmd.Name == "RPUSH" {
+				list = append(list, arg)
+			} else {
+				list = append([][]byte{arg}, list...)
+			}
+		}
+		store.lists[key] = list
+		return int64(len(list))
+	case "LPOP":
+		if !store.typeOk(key, "list") {
+			return errMemWrongType
+		}
+		list := store.lists[key]
+		if len(list) == 0 {
+			return nil
+		}
+		if len(list) == 1 {
+			delete(store.lists, key)
+		} else {
+			store.lists[key] = list[1:]
+		}
+		return list[0]
+	case "LLEN":
+		if !store.typeOk(key, "list") {
+			return errMemWrongType
+		}
+		return int64(len(store.lists[key]))
+	case "LRANGE", "LTRIM":
+		if !store.typeOk(key, "list") {
+			return errMemWrongType
+		}
+		list := store.lists[key]
+		start, end, err := listRange(list, args[1], args[2])
+		if err != nil {
+			return err
+		}
+		if cmd.Name == "LTRIM" {
+			if start >= end {
+				delete(store.lists, key)
+			} else {
+				store.lists[key] = append([][]byte(nil), list[start:end]...)
+			}
+			return "OK"
+		}
+		reply := make([]interface{}, 0, end-start)
+		for _, value := range list[start:end] {
+			reply = append(reply, value)
+		}
+		return reply
+	}
+	return errors.New("ERR unknown command '" + cmd.Name + "'")
+}
+
+//
+// Match str against a redis glob pattern: * and ? wildcards, [...] classes
+// with ^ negation and ranges, and \ escapes. Unlike path.Match, * also
+// matches /, which appears in keys with IP prefixes.
+//
+func globMatch(pattern, str string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for idx := 0; idx <= len(str); idx++ {
+				if globMatch(pattern, str[idx:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(str) == 0 {
+				return false
+			}
+		case '[':
+			if len(str) == 0 {
+				return false
+			}
+			end := strings.IndexByte(pattern[1:], ']')
+			if end < 0 {
+				// Unterminated class matches literally
+				if str[0] != '[' {
+					return false
+				}
+				break
+			}
+			class := pattern[1 : end+1]
+			negate := len(class) > 0 && class[0] == '^'
+			if negate {
+				class = class[1:]
+			}
+			matched := false
+			for idx := 0; idx < len(class); idx++ {
+				if class[idx] == '\\' && idx+1 < len(class) {
+					idx++
+					matched = matched || class[idx] == str[0]
+				} else if idx+2 < len(class) && class[idx+1] == '-' {
+					matched = matched || (class[idx] <= str[0] && str[0] <= class[idx+2])
+					idx += 2
+				} else {
+					matched = matched || class[idx] == str[0]
+				}
+			}
+			if matched == negate {
+				return false
+			}
+			pattern = pattern[end+1:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(str) == 0 || pattern[0] != str[0] {
+				return false
+			}
+		}
+		pattern = pattern[1:]
+		str = str[1:]
+	}
+	return len(str) == 0
+}
@@ -0,0 +1,245 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package objects
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"strconv"
+	"strings"
+)
+
+//
+// Migrations keep objects stored by an older release usable when a model
+// attribute is renamed or retyped. Each migration belongs to the model
+// version that introduced the change. The version of the stored objects is
+// kept in DB and saved config files record the version they were saved
+// with; objects older than MODEL_VERSION are migrated when confd starts and
+// when an older file is applied.
+//
+// A migration changes one object type. MigrateDb gets the attributes of a
+// stored object as the strings kept in DB, MigrateJson gets the attributes
+// of an object in a config file as decoded JSON. Both change the map in
+// place. Add new migrations at the end of objectMigrations.
+//
+type ObjectMigration struct {
+	Version     int
+	ObjectType  string
+	Description string
+	MigrateDb   func(attrs map[string]string)
+	MigrateJson func(attrs map[string]interface{})
+}
+
+const (
+	MODEL_VERSION_INITIAL = 1
+	MODEL_VERSION_KEY     = "ConfdModelVersion"
+)
+
+var objectMigrations = []ObjectMigration{}
+
+// Model version of this release
+var MODEL_VERSION = getModelVersion(objectMigrations)
+
+func getModelVersion(migrations []ObjectMigration) int {
+	version := MODEL_VERSION_INITIAL
+	for _, migration := range migrations {
+		if migration.Version > version {
+			version = migration.Version
+		}
+	}
+	return version
+}
+
+//
+// Migration renaming attribute oldName of objType to newName
+//
+func RenameAttrMigration(version int, objType, oldName, newName string) ObjectMigration {
+	return ObjectMigration{
+		Version:     version,
+		ObjectType:  objType,
+		Description: fmt.Sprintf("Rename %s.%s to %s", objType, oldName, newName),
+		MigrateDb: func(attrs map[string]string) {
+			if value, exist := attrs[oldName]; exist {
+				attrs[newName] = value
+				delete(attrs, oldName)
+			}
+		},
+		MigrateJson: func(attrs map[string]interface{}) {
+			if value, exist := attrs[oldName]; exist {
+				attrs[newName] = value
+				delete(attrs, oldName)
+			}
+		},
+	}
+}
+
+// Migrations to apply to objects of objType stored with model version from
+func getMigrations(migrations []ObjectMigration, objType string, from int) []ObjectMigration {
+	var result []ObjectMigration
+	for _, migration := range migrations {
+		if migration.Version > from && (objType == "" || strings.EqualFold(migration.ObjectType, objType)) {
+			result = append(result, migration)
+		}
+	}
+	return result
+}
+
+func (d *DbHandler) GetModelVersion() (int, error) {
+	defer d.DBUtil.DbLock.Unlock()
+	d.DBUtil.DbLock.Lock()
+	value, err := redis.String(d.Do("GET", MODEL_VERSION_KEY))
+	if err == redis.ErrNil {
+		return MODEL_VERSION_INITIAL, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(value)
+}
+
+//
+// Migrate stored objects to MODEL_VERSION and record it in DB. Returns the
+// number of objects changed.
+//
+func (d *DbHandler) MigrateStoredObjects() (int, error) {
+	return d.migrateStoredObjects(objectMigrations, MODEL_VERSION)
+}
+
+func (d *DbHandler) migrateStoredObjects(migrations []ObjectMigration, toVersion int) (int, error) {
+	fromVersion, err := d.GetModelVersion()
+	if err != nil {
+		return 0, err
+	}
+	if fromVersion > toVersion {
+		return 0, fmt.Errorf("Stored objects have model version %d, newer than %d", fromVersion, toVersion)
+	}
+	defer d.DBUtil.DbLock.Unlock()
+	d.DBUtil.DbLock.Lock()
+	migrated := 0
+	for _, migration := range getMigrations(migrations, "", fromVersion) {
+		if migration.MigrateDb == nil {
+			continue
+		}
+		objKeys, err := redis.Values(d.Do("KEYS", migration.ObjectType+"#*"))
+		if err != nil {
+			return migrated, err
+		}
+		for _, key := range objKeys {
+			objKey, _ := redis.String(key, nil)
+			if changed, err := d.migrateStoredObject(migration, objKey); err != nil {
+				return migrated, err
+			} else if changed {
+				migrated++
+			}
+		}
+	}
+	_, err = d.Do("SET", MODEL_VERSION_KEY, strconv.Itoa(toVersion))
+	return migrated, err
+}
+
+// Must be called with DbLock held
+func (d *DbHandler) migrateStoredObject(migration ObjectMigration, objKey string) (bool, error) {
+	if keyType, _ := redis.String(d.Do("TYPE", objKey)); keyType != "hash" {
+		return false, nil
+	}
+	attrs, err := redis.StringMap(d.Do("HGETALL", objKey))
+	if err != nil {
+		return false, err
+	}
+	orig := make(map[string]string, len(attrs))
+	for attr, value := range attrs {
+		orig[attr] = value
+	}
+	migration.MigrateDb(attrs)
+	changed := len(orig) != len(attrs)
+	for attr, value := range attrs {
+		if origValue, exist := orig[attr]; !exist || origValue != value {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return false, nil
+	}
+	cmds := [][]string{{"DEL", objKey}}
+	if len(attrs) > 0 {
+		hmset := []string{"HMSET", objKey}
+		for attr, value := range attrs {
+			hmset = append(hmset, attr, value)
+		}
+		cmds = append(cmds, hmset)
+	}
+	if err = d.execTxn(cmds...); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+//
+// Migrate the objects of a config file saved with model version fromVersion.
+// configData maps object types to their objects, as in ApplyConfig.
+//
+func MigrateConfigData(configData map[string][]json.RawMessage, fromVersion int) error {
+	return migrateConfigData(objectMigrations, configData, fromVersion)
+}
+
+func migrateConfigData(migrations []ObjectMigration, configData map[string][]json.RawMessage, fromVersion int) error {
+	for objType, objs := range configData {
+		for idx, obj := range objs {
+			migratedObj, err := migrateJsonObject(migrations, objType, obj, fromVersion)
+			if err != nil {
+				return fmt.Errorf("Failed to migrate %s: %s", objType, err)
+			}
+			objs[idx] = migratedObj
+		}
+	}
+	return nil
+}
+
+//
+// Migrate one object of objType in JSON saved with model version fromVersion
+//
+func MigrateJsonObject(objType string, obj json.RawMessage, fromVersion int) (json.RawMessage, error) {
+	return migrateJsonObject(objectMigrations, objType, obj, fromVersion)
+}
+
+func migrateJsonObject(migrations []ObjectMigration, objType string, obj json.RawMessage, fromVersion int) (json.RawMessage, error) {
+	if fromVersion < MODEL_VERSION_INITIAL {
+		fromVersion = MODEL_VERSION_INITIAL
+	}
+	objMigrations := getMigrations(migrations, objType, fromVersion)
+	if len(objMigrations) == 0 {
+		return obj, nil
+	}
+	attrs := make(map[string]interface{})
+	if err := json.Unmarshal(obj, &attrs); err != nil {
+		return nil, err
+	}
+	for _, migration := range objMigrations {
+		if migration.MigrateJson != nil {
+			migration.MigrateJson(attrs)
+		}
+	}
+	return json.Marshal(attrs)
+}
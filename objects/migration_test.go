@@ -0,0 +1,87 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package objects
+
+import (
+	"encoding/json"
+	"github.com/garyburd/redigo/redis"
+	"testing"
+)
+
+var testMigrations = []ObjectMigration{
+	RenameAttrMigration(2, "Vlan", "IfIndexList", "IntfList"),
+	RenameAttrMigration(3, "Vlan", "IntfList", "Members"),
+}
+
+func TestMigrateStoredObjects(t *testing.T) {
+	dbHdl := NewMemoryDbHandler(nil)
+	conn := dbHdl.DBUtil.Conn
+	conn.Do("HMSET", "Vlan#1", "VlanId", "1", "IfIndexList", "fpPort1")
+	conn.Do("HMSET", "Vlan#1Default", "VlanId", "1", "IfIndexList", "")
+	conn.Do("HMSET", "VlanState#1", "IfIndexList", "fpPort1")
+	conn.Do("SET", "UUIDVlan#1", testUUID1)
+
+	migrated, err := dbHdl.migrateStoredObjects(testMigrations, 3)
+	if err != nil || migrated != 4 {
+		t.Fatal("Expected 4 migrations, got", migrated, err)
+	}
+	attrs, _ := redis.StringMap(conn.Do("HGETALL", "Vlan#1"))
+	if attrs["Members"] != "fpPort1" || len(attrs) != 2 {
+		t.Error("Vlan#1 not migrated", attrs)
+	}
+	attrs, _ = redis.StringMap(conn.Do("HGETALL", "VlanState#1"))
+	if attrs["IfIndexList"] != "fpPort1" {
+		t.Error("VlanState#1 changed", attrs)
+	}
+	if uuid, _ := dbHdl.GetUUIDFromObjKey("Vlan#1"); uuid != testUUID1 {
+		t.Error("UUID entry changed", uuid)
+	}
+	if version, _ := dbHdl.GetModelVersion(); version != 3 {
+		t.Error("Expected model version 3, got", version)
+	}
+	if migrated, _ = dbHdl.migrateStoredObjects(testMigrations, 3); migrated != 0 {
+		t.Error("Migrations applied twice")
+	}
+	if _, err = dbHdl.migrateStoredObjects(testMigrations, 2); err == nil {
+		t.Error("Migration to an older model version succeeded")
+	}
+}
+
+func TestMigrateConfigData(t *testing.T) {
+	configData := map[string][]json.RawMessage{
+		"Vlan":   {json.RawMessage(`{"VlanId":1,"IntfList":["fpPort1"]}`)},
+		"Subnet": {json.RawMessage(`{"IfIndexList":"x"}`)},
+	}
+	if err := migrateConfigData(testMigrations, configData, 2); err != nil {
+		t.Fatal(err)
+	}
+	var vlan map[string]interface{}
+	json.Unmarshal(configData["Vlan"][0], &vlan)
+	if _, exist := vlan["Members"]; !exist || len(vlan) != 2 {
+		t.Error("Expected only the version 3 rename, got", vlan)
+	}
+	if string(configData["Subnet"][0]) != `{"IfIndexList":"x"}` {
+		t.Error("Subnet changed", string(configData["Subnet"][0]))
+	}
+}
@@ -33,6 +33,7 @@ import (
 	"models/objects"
 	"net/http"
 	"strings"
+	"sync"
 	"utils/commonDefs"
 	"utils/logging"
 )
@@ -48,10 +49,13 @@ type AutoDiscoverStruct struct {
 type ObjectMgr struct {
 	logger             *logging.Writer
 	dbHdl              *DbHandler
-	ObjHdlMap          map[string]ConfigObjInfo
+	hdlMutex           sync.RWMutex
+	objHdlMap          map[string]ConfigObjInfo
 	clientMgr          *clients.ClientMgr
-	AutoCreateObjMap   map[string]AutoCreateStruct
-	AutoDiscoverObjMap map[string]AutoDiscoverStruct
+	autoCreateObjMap   map[string]AutoCreateStruct
+	autoDiscoverObjMap map[string]AutoDiscoverStruct
+	observerMutex      sync.RWMutex
+	observers          []ChangeObserver
 }
 
 type PatchOp map[string]*json.RawMessage
@@ -70,6 +74,7 @@ type ConfigObjJson struct {
 	AutoCreate    bool     `json:"autoCreate"`
 	AutoDiscover  bool     `json:"autoDiscover"`
 	LinkedObjects []string `json:"linkedObjects"`
+	IndexedAttrs  []string `json:"indexedAttrs"`
 }
 
 //
@@ -81,6 +86,7 @@ type ConfigObjInfo struct {
 	AutoDiscover  bool
 	LinkedObjects []string
 	Listeners     []clients.ClientIf
+	IndexedAttrs  []string
 }
 
 func resolveUnmarshalErr(data []byte, err error) string {
@@ -257,6 +263,7 @@ func InitializeObjectMgr(infoFiles []string, logger *logging.Writer, dbHdl *DbHa
 		logger.Err("Error in initializing object handles")
 		return nil
 	}
+	clients.SetObjKeyFinder(mgr.FindObjKeys)
 	gObjectMgr = mgr
 	return mgr
 }
@@ -265,11 +272,13 @@ func InitializeObjectMgr(infoFiles []string, logger *logging.Writer, dbHdl *DbHa
 //  This method reads the config file and connects to all the clients in the list
 //
 func (mgr *ObjectMgr) InitializeObjectHandles(infoFiles []string) bool {
-	var objMap map[string]ConfigObjJson
-	mgr.ObjHdlMap = make(map[string]ConfigObjInfo)
-	mgr.AutoCreateObjMap = make(map[string]AutoCreateStruct)
-	mgr.AutoDiscoverObjMap = make(map[string]AutoDiscoverStruct)
+	// Maps are built aside and swapped in at the end so that a reload does
+	// not expose partial maps and keeps the old ones if it fails
+	objHdlMap := make(map[string]ConfigObjInfo)
+	autoCreateObjMap := make(map[string]AutoCreateStruct)
+	autoDiscoverObjMap := make(map[string]AutoDiscoverStruct)
 	for _, objFile := range infoFiles {
+		var objMap map[string]ConfigObjJson
 		bytes, err := ioutil.ReadFile(objFile)
 		if err != nil {
 			mgr.logger.Info("Error in reading Object configuration file", objFile)
@@ -277,7 +286,8 @@ func (mgr *ObjectMgr) InitializeObjectHandles(infoFiles []string) bool {
 		}
 		err = json.Unmarshal(bytes, &objMap)
 		if err != nil {
-			mgr.logger.Info("Error in unmarshaling data from ", objFile)
+			mgr.logger.Err("Error in unmarshaling data from ", objFile, err)
+			return false
 		}
 
 		for k, v := range objMap {
@@ -285,35 +295,102 @@ func (mgr *ObjectMgr) InitializeObjectHandles(infoFiles []string) bool {
 				v.Access, " Auto Create ", v.AutoCreate, " Auto Discover ", v.AutoDiscover)
 			key := strings.ToLower(k)
 			entry := new(ConfigObjInfo)
-			entry.Owner = mgr.clientMgr.Clients[v.Owner]
+			entry.Owner, _ = mgr.clientMgr.GetClient(v.Owner)
+			if entry.Owner == nil {
+				mgr.logger.Err("No client", v.Owner, "for Object", k, "in", objFile, "skipping it")
+				continue
+			}
 			entry.Access = v.Access
 			entry.AutoCreate = v.AutoCreate
 			entry.AutoDiscover = v.AutoDiscover
 			for _, lsnr := range v.Listeners {
-				entry.Listeners = append(entry.Listeners, mgr.clientMgr.Clients[lsnr])
+				if client, exist := mgr.clientMgr.GetClient(lsnr); exist {
+					if hdl, ok := client.(*clients.ClientHdl); !ok || !hdl.IsChangeListener() {
+						mgr.logger.Err("Client", lsnr, "can not receive change notifications, ignoring it as Listener of Object", k, "in", objFile)
+						continue
+					}
+					entry.Listeners = append(entry.Listeners, client)
+				} else {
+					mgr.logger.Err("No client", lsnr, "for Listener of Object", k, "in", objFile)
+				}
 			}
 			entry.LinkedObjects = append(entry.LinkedObjects, v.LinkedObjects...)
-			mgr.ObjHdlMap[key] = *entry
+			entry.IndexedAttrs = append(entry.IndexedAttrs, v.IndexedAttrs...)
+			objHdlMap[key] = *entry
 
 			if v.AutoCreate == true {
-				ent, _ := mgr.AutoCreateObjMap[v.Owner]
+				ent, _ := autoCreateObjMap[v.Owner]
 				ent.ObjList = append(ent.ObjList, key)
-				mgr.AutoCreateObjMap[v.Owner] = ent
+				autoCreateObjMap[v.Owner] = ent
 			}
 
 			if v.AutoDiscover == true {
-				ent, _ := mgr.AutoDiscoverObjMap[v.Owner]
+				ent, _ := autoDiscoverObjMap[v.Owner]
 				ent.ObjList = append(ent.ObjList, key)
-				mgr.AutoDiscoverObjMap[v.Owner] = ent
+				autoDiscoverObjMap[v.Owner] = ent
 			}
 		}
 	}
+	mgr.hdlMutex.Lock()
+	mgr.objHdlMap = objHdlMap
+	mgr.autoCreateObjMap = autoCreateObjMap
+	mgr.autoDiscoverObjMap = autoDiscoverObjMap
+	mgr.hdlMutex.Unlock()
 	return true
 }
+
+//
+// The maps are replaced, never modified, on reload, so the returned maps can
+// be read without locking. Callers must not modify them.
+//
 func (mgr *ObjectMgr) GetConfigObjHdlMap() map[string]ConfigObjInfo {
-	return mgr.ObjHdlMap
+	mgr.hdlMutex.RLock()
+	defer mgr.hdlMutex.RUnlock()
+	return mgr.objHdlMap
+}
+
+func (mgr *ObjectMgr) GetAutoCreateObjMap() map[string]AutoCreateStruct {
+	mgr.hdlMutex.RLock()
+	defer mgr.hdlMutex.RUnlock()
+	return mgr.autoCreateObjMap
+}
+
+const STATE_POLL_PAGE_SIZE int64 = 1024
+
+//
+// All objects of the state type with the given key, e.g. portstate, from
+// the owner of the type, for confd subsystems which poll daemon state
+//
+func (mgr *ObjectMgr) GetAllStateObjects(resource string) ([]objects.ConfigObj, error) {
+	objInfo, exist := mgr.GetConfigObjHdlMap()[resource]
+	objHdl, known := objects.ConfigObjectMap[resource]
+	if !exist || !known || objInfo.Owner == nil {
+		return nil, errors.New("No owner for " + resource)
+	}
+	if !objInfo.Owner.IsConnectedToServer() {
+		return nil, errors.New("Owner " + objInfo.Owner.GetServerName() + " of " + resource + " is not connected")
+	}
+	_, obj, err := GetConfigObjFromJsonData(nil, objHdl)
+	if err != nil {
+		return nil, err
+	}
+	var stateObjs []objects.ConfigObj
+	marker := int64(0)
+	for {
+		err, _, nextMarker, more, objs := objInfo.Owner.GetBulkObject(obj, mgr.dbHdl.DBUtil, marker, STATE_POLL_PAGE_SIZE)
+		if err != nil {
+			return nil, err
+		}
+		stateObjs = append(stateObjs, objs...)
+		if !more || nextMarker == marker {
+			return stateObjs, nil
+		}
+		marker = nextMarker
+	}
 }
 
 func (mgr *ObjectMgr) GetAutoDiscoverObjMap() map[string]AutoDiscoverStruct {
-	return mgr.AutoDiscoverObjMap
+	mgr.hdlMutex.RLock()
+	defer mgr.hdlMutex.RUnlock()
+	return mgr.autoDiscoverObjMap
 }
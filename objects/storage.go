@@ -0,0 +1,74 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package objects
+
+import (
+	"errors"
+	"utils/dbutils"
+	"utils/logging"
+)
+
+//
+// Storage backends. The generated model objects issue redis commands on
+// DBUtil's connection, so backends plug in below DbHandler as that
+// connection. The redis backend dials a redis server, the memory backend
+// keeps everything in process and the file backend adds a single durable
+// file to the memory backend.
+//
+const (
+	DB_BACKEND_REDIS  = "redis"
+	DB_BACKEND_MEMORY = "memory"
+	DB_BACKEND_FILE   = "file"
+)
+
+type DbConfig struct {
+	Backend string
+	File    string
+}
+
+var gDbConfig = DbConfig{Backend: DB_BACKEND_REDIS}
+
+// Select the storage backend. This has to be done before InstantiateDbIf.
+func SetDbConfig(cfg DbConfig) error {
+	switch cfg.Backend {
+	case DB_BACKEND_REDIS, DB_BACKEND_MEMORY:
+	case DB_BACKEND_FILE:
+		if cfg.File == "" {
+			return errors.New("File backend requires a file name")
+		}
+	default:
+		return errors.New("Unknown DB backend " + cfg.Backend)
+	}
+	gDbConfig = cfg
+	return nil
+}
+
+// DbHandler with a private in-memory store, for tests and tools
+func NewMemoryDbHandler(logger *logging.Writer) *DbHandler {
+	dbHdl := new(DbHandler)
+	dbHdl.DBUtil = dbutils.NewDBUtil(logger)
+	dbHdl.DBUtil.Conn = newMemConn(newMemStore())
+	dbHdl.logger = logger
+	return dbHdl
+}
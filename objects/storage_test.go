@@ -0,0 +1,231 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package objects
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func doCmd(t *testing.T, conn *memConn, name string, args ...interface{}) interface{} {
+	reply, err := conn.Do(name, args...)
+	if err != nil {
+		t.Fatal(name, args, "failed:", err)
+	}
+	return reply
+}
+
+func TestMemStoreCommands(t *testing.T) {
+	conn := newMemConn(newMemStore())
+	doCmd(t, conn, "SET", "UUID10.1.1.0/24", "abc")
+	if reply := doCmd(t, conn, "GET", "UUID10.1.1.0/24"); string(reply.([]byte)) != "abc" {
+		t.Error("GET returned", reply)
+	}
+	if reply := doCmd(t, conn, "GET", "missing"); reply != nil {
+		t.Error("GET of missing key returned", reply)
+	}
+	doCmd(t, conn, "HMSET", "IPv4Route#10.1.1.0/24", "Cost", 10, "Enable", true)
+	reply := doCmd(t, conn, "HGETALL", "IPv4Route#10.1.1.0/24")
+	expected := []interface{}{[]byte("Cost"), []byte("10"), []byte("Enable"), []byte("1")}
+	if !reflect.DeepEqual(reply, expected) {
+		t.Error("HGETALL returned", reply)
+	}
+	if _, err := conn.Do("GET", "IPv4Route#10.1.1.0/24"); err != errMemWrongType {
+		t.Error("Expected WRONGTYPE for GET on a hash, got", err)
+	}
+	reply = doCmd(t, conn, "KEYS", "IPv4Route#*")
+	if !reflect.DeepEqual(reply, []interface{}{[]byte("IPv4Route#10.1.1.0/24")}) {
+		t.Error("KEYS returned", reply)
+	}
+	doCmd(t, conn, "SET", "IPv4Route#2", "x")
+	var scanned []interface{}
+	cursor := "0"
+	for idx := 0; idx == 0 || cursor != "0"; idx++ {
+		reply := doCmd(t, conn, "SCAN", cursor, "MATCH", "IPv4Route#*", "COUNT", 1).([]interface{})
+		cursor = string(reply[0].([]byte))
+		scanned = append(scanned, reply[1].([]interface{})...)
+		if idx > 3 {
+			t.Fatal("SCAN did not end")
+		}
+	}
+	if len(scanned) != 2 {
+		t.Error("SCAN returned", scanned)
+	}
+	doCmd(t, conn, "SADD", "idx", "b", "a", "b")
+	if reply := doCmd(t, conn, "SMEMBERS", "idx"); len(reply.([]interface{})) != 2 {
+		t.Error("SMEMBERS returned", reply)
+	}
+	doCmd(t, conn, "RPUSH", "queue", "1", "2", "3")
+	doCmd(t, conn, "LTRIM", "queue", 1, -1)
+	if reply := doCmd(t, conn, "LPOP", "queue"); string(reply.([]byte)) != "2" {
+		t.Error("LPOP returned", reply)
+	}
+	if reply := doCmd(t, conn, "DEL", "idx", "queue", "missing"); reply != int64(2) {
+		t.Error("DEL returned", reply)
+	}
+}
+
+func TestMemConnMultiExec(t *testing.T) {
+	conn := newMemConn(newMemStore())
+	conn.Send("MULTI")
+	conn.Send("SET", "a", "1")
+	conn.Send("INCR", "a")
+	conn.Send("HGET", "h", "f")
+	reply := doCmd(t, conn, "EXEC")
+	expected := []interface{}{"OK", int64(2), nil}
+	if !reflect.DeepEqual(reply, expected) {
+		t.Error("EXEC returned", reply)
+	}
+	conn.Send("SET", "b", "1")
+	conn.Send("GET", "b")
+	conn.Flush()
+	if reply, _ := conn.Receive(); reply != "OK" {
+		t.Error("First pipelined reply", reply)
+	}
+	if reply, _ := conn.Receive(); string(reply.([]byte)) != "1" {
+		t.Error("Second pipelined reply", reply)
+	}
+}
+
+func TestGlobMatch(t *testing.T) {
+	cases := []struct {
+		pattern, str string
+		match        bool
+	}{
+		{"*", "a/b", true},
+		{"Vlan#*", "Vlan#100", true},
+		{"Vlan#*", "VlanState#100", false},
+		{"h?llo", "hello", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"a\\*", "a*", true},
+		{"a\\*", "ab", false},
+		{"*b*", "aaa", false},
+	}
+	for _, c := range cases {
+		if globMatch(c.pattern, c.str) != c.match {
+			t.Error("globMatch(", c.pattern, ",", c.str, ") expected", c.match)
+		}
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "confddb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "confd.db")
+
+	store, err := openFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := newMemConn(store.memStore)
+	doCmd(t, conn, "HMSET", "Vlan#100", "VlanId", 100)
+	doCmd(t, conn, "SET", "UUIDVlan#100", "abc")
+	conn.Send("MULTI")
+	conn.Send("SET", "x", "1")
+	conn.Send("DEL", "x")
+	doCmd(t, conn, "EXEC")
+	store.Close()
+
+	// Simulate a crash in the middle of a write
+	file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	file.WriteString(`{"b":[{"c":"SET","a":["eA=="`)
+	file.Close()
+
+	store, err = openFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn = newMemConn(store.memStore)
+	if reply := doCmd(t, conn, "HGET", "Vlan#100", "VlanId"); string(reply.([]byte)) != "100" {
+		t.Error("Hash not replayed, got", reply)
+	}
+	if reply := doCmd(t, conn, "EXISTS", "x"); reply != int64(0) {
+		t.Error("Transaction not replayed, x exists")
+	}
+	doCmd(t, conn, "SET", "y", "2")
+	for i := 0; i <= FILE_DB_COMPACT_RECORDS; i++ {
+		doCmd(t, conn, "SET", "counter", strconv.Itoa(i))
+	}
+	if store.records > 10 {
+		t.Error("File not compacted, records", store.records)
+	}
+	store.Close()
+
+	store, err = openFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	conn = newMemConn(store.memStore)
+	if reply := doCmd(t, conn, "GET", "y"); string(reply.([]byte)) != "2" {
+		t.Error("Write after partial line lost, got", reply)
+	}
+	if reply := doCmd(t, conn, "GET", "counter"); string(reply.([]byte)) != strconv.Itoa(FILE_DB_COMPACT_RECORDS) {
+		t.Error("Compacted value wrong, got", reply)
+	}
+}
+
+func TestFileStoreCorruptLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filedb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "confd.db")
+	lines := `{"b":[{"c":"SET","a":["eA==","MQ=="]}]}` + "\n" + `{"b":[{"c":"SET"` + "\n" +
+		`{"b":[{"c":"SET","a":["eQ==","Mg=="]}]}` + "\n"
+	if err := ioutil.WriteFile(path, []byte(lines), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if store, err := openFileStore(path); err == nil {
+		store.Close()
+		t.Error("File with a corrupt line opened")
+	}
+}
+
+func TestMemoryDbHandlerUUIDMap(t *testing.T) {
+	dbHdl := NewMemoryDbHandler(nil)
+	uuid, err := dbHdl.StoreUUIDToObjKeyMap("Vlan#100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := dbHdl.GetUUIDFromObjKey("Vlan#100"); err != nil || got != uuid {
+		t.Error("GetUUIDFromObjKey returned", got, err)
+	}
+	if err := dbHdl.DeleteUUIDToObjKeyMap(uuid, "Vlan#100"); err != nil {
+		t.Error(err)
+	}
+	if _, err := dbHdl.GetUUIDFromObjKey("Vlan#100"); err == nil {
+		t.Error("UUID map not deleted")
+	}
+}
@@ -25,16 +25,25 @@ package server
 
 import (
 	"config/actions"
+	"config/alarms"
 	"config/apis"
+	"config/audit"
+	"config/auth"
 	"config/clients"
 	"config/objects"
+	"config/telemetry"
+	"config/webhooks"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	modelObjs "models/objects"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"sort"
 	"strconv"
+	"sync"
 	"syscall"
 	"time"
 	"utils/logging"
@@ -51,6 +60,14 @@ type ConfigMgr struct {
 	objectMgr    *objects.ObjectMgr
 	actionMgr    *actions.ActionMgr
 	clientNameCh chan string
+	serverMutex  sync.Mutex
+	httpServers  []*http.Server
+	shuttingDown bool
+	shutdownDone chan struct{}
+	telemetryMgr *telemetry.TelemetryMgr
+	alarmMgr     *alarms.AlarmMgr
+	retentionMgr *objects.EventRetentionMgr
+	webhookMgr   *webhooks.WebhookMgr
 }
 
 var gConfigMgr *ConfigMgr
@@ -60,7 +77,22 @@ const (
 )
 
 type SysProfile struct {
-	API_Port int `json:"API_Port"`
+	API_Port     int                          `json:"API_Port"`
+	ObjectIdType string                       `json:"ObjectIdType"`
+	Listeners    []ListenerJson               `json:"Listeners"`
+	Auth         auth.AuthConfig              `json:"Auth"`
+	Telemetry    telemetry.TelemetryConfig    `json:"Telemetry"`
+	Events       objects.EventRetentionConfig `json:"Events"`
+	Audit        audit.AuditConfig            `json:"Audit"`
+}
+
+func readSysProfile(paramsDir string) (SysProfile, error) {
+	var sysProfile SysProfile
+	bytes, err := ioutil.ReadFile(paramsDir + "systemProfile.json")
+	if err == nil {
+		err = json.Unmarshal(bytes, &sysProfile)
+	}
+	return sysProfile, err
 }
 
 // Get the http port on which rest api calls will be received
@@ -84,6 +116,115 @@ func GetConfigHandlerPort(paramsDir string) (bool, string) {
 	return true, port
 }
 
+//
+// Object and action ownership for daemons which are not part of the
+// generated files are read from drop-in directories beside
+// genObjectConfig.json and genObjectAction.json. Files are read in name order.
+//
+func getDropInFiles(dir string, logger *logging.Writer) []string {
+	files, err := filepath.Glob(dir + "/*.json")
+	if err != nil {
+		logger.Err("Failed to read drop-in directory", dir, err)
+		return nil
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		logger.Info("Using drop-in file", file)
+	}
+	return files
+}
+
+//
+// Select random or keyed object ids as set by ObjectIdType in
+// systemProfile.json, and move existing objects to keyed ids when selected.
+//
+func (mgr *ConfigMgr) ConfigureObjectIds() bool {
+	sysProfile, err := readSysProfile(mgr.paramsDir)
+	if err != nil {
+		mgr.logger.Err("Failed to read systemProfile, using random object ids", err)
+		return true
+	}
+	if err = mgr.dbHdl.SetObjectIdType(sysProfile.ObjectIdType); err != nil {
+		mgr.logger.Err("Invalid ObjectIdType in systemProfile", err)
+		return false
+	}
+	migrated, err := mgr.dbHdl.MigrateToKeyedIds()
+	if err != nil {
+		mgr.logger.Err("Failed to migrate to keyed object ids", err)
+		return false
+	}
+	if migrated > 0 {
+		mgr.logger.Info("Migrated", migrated, "objects to keyed object ids")
+	}
+	return true
+}
+
+//
+// Set up REST API authentication as configured by Auth in
+// systemProfile.json. Authentication is off without it.
+//
+func (mgr *ConfigMgr) ConfigureAuth() bool {
+	sysProfile, err := readSysProfile(mgr.paramsDir)
+	if err != nil {
+		mgr.logger.Err("Failed to read systemProfile, REST API authentication is off", err)
+	}
+	if err = mgr.ApiMgr.ConfigureAuth(sysProfile.Auth); err != nil {
+		mgr.logger.Err("Invalid Auth in systemProfile", err)
+		return false
+	}
+	return true
+}
+
+//
+// Start the telemetry exporter as configured by Telemetry in
+// systemProfile.json, replacing the running one. An invalid configuration
+// keeps the running exporter.
+//
+func (mgr *ConfigMgr) ConfigureTelemetry() {
+	sysProfile, err := readSysProfile(mgr.paramsDir)
+	if err != nil {
+		mgr.logger.Err("Failed to read systemProfile, telemetry is off", err)
+	}
+	telemetryMgr, err := telemetry.InitializeTelemetryMgr(sysProfile.Telemetry, mgr.paramsDir+"../models/",
+		mgr.logger, mgr.objectMgr, mgr.dbHdl)
+	if err != nil {
+		mgr.logger.Err("Invalid Telemetry in systemProfile", err)
+		return
+	}
+	mgr.telemetryMgr = telemetryMgr
+}
+
+//
+// Purge events by the retention policy of Events in systemProfile.json,
+// replacing the running policy. An invalid policy keeps the running one.
+//
+func (mgr *ConfigMgr) ConfigureEventRetention() {
+	sysProfile, err := readSysProfile(mgr.paramsDir)
+	if err != nil {
+		mgr.logger.Err("Failed to read systemProfile, events are kept", err)
+	}
+	retentionMgr, err := objects.InitializeEventRetentionMgr(sysProfile.Events, mgr.logger, mgr.dbHdl)
+	if err != nil {
+		mgr.logger.Err("Invalid Events in systemProfile", err)
+		return
+	}
+	mgr.retentionMgr = retentionMgr
+}
+
+//
+// Keep the audit log by Audit in systemProfile.json, replacing the running
+// policy. An invalid policy keeps the running one.
+//
+func (mgr *ConfigMgr) ConfigureAudit() {
+	sysProfile, err := readSysProfile(mgr.paramsDir)
+	if err != nil {
+		mgr.logger.Err("Failed to read systemProfile, using the default audit log policy", err)
+	}
+	if err = mgr.ApiMgr.ConfigureAudit(sysProfile.Audit); err != nil {
+		mgr.logger.Err("Invalid Audit in systemProfile", err)
+	}
+}
+
 //
 // This function would work as a classical constructor for the
 // configMgr object
@@ -92,12 +233,22 @@ func NewConfigMgr(paramsDir string, logger *logging.Writer) *ConfigMgr {
 	mgr := new(ConfigMgr)
 	mgr.logger = logger
 	mgr.paramsDir = paramsDir
+	mgr.shutdownDone = make(chan struct{})
 
 	mgr.dbHdl = objects.InstantiateDbIf(logger)
 	if mgr.dbHdl == nil {
 		logger.Err("Error initializing configMgr dbHdl")
 		return nil
 	}
+	if !mgr.ConfigureObjectIds() {
+		return nil
+	}
+	if migrated, err := mgr.dbHdl.MigrateStoredObjects(); err != nil {
+		logger.Err("Failed to migrate stored objects to model version", objects.MODEL_VERSION, err)
+		return nil
+	} else if migrated > 0 {
+		logger.Info("Migrated", migrated, "stored objects to model version", objects.MODEL_VERSION)
+	}
 
 	mgr.clientMgr = clients.InitializeClientMgr(paramsDir, logger,
 		GetSystemStatus,
@@ -109,22 +260,24 @@ func NewConfigMgr(paramsDir string, logger *logging.Writer) *ConfigMgr {
 	}
 
 	objects.CreateObjectMap()
-	objectConfigFiles := [...]string{paramsDir + "/genObjectConfig.json"}
-	mgr.objectMgr = objects.InitializeObjectMgr(objectConfigFiles[:], logger,
+	mgr.objectMgr = objects.InitializeObjectMgr(mgr.getObjectConfigFiles(), logger,
 		mgr.dbHdl, mgr.clientMgr)
 	if mgr.objectMgr == nil {
 		logger.Err("Error initializing objectMgr")
 		return nil
 	}
+	if err := mgr.objectMgr.RebuildIndexes(); err != nil {
+		logger.Err("Error rebuilding object indexes", err)
+	}
 
 	actions.CreateActionMap()
-	actionConfigFiles := [...]string{paramsDir + "/genObjectAction.json"}
-	mgr.actionMgr = actions.InitializeActionMgr(paramsDir, actionConfigFiles[:], logger,
+	mgr.actionMgr = actions.InitializeActionMgr(paramsDir, mgr.getActionConfigFiles(), logger,
 		mgr.dbHdl, mgr.objectMgr, mgr.clientMgr)
 	if mgr.actionMgr == nil {
 		logger.Err("Error initializing actionMgr")
 		return nil
 	}
+	mgr.alarmMgr = alarms.InitializeAlarmMgr(logger, mgr.objectMgr, mgr.dbHdl)
 
 	mgr.ApiMgr = apis.InitializeApiMgr(paramsDir, logger,
 		mgr.dbHdl, mgr.clientMgr, mgr.objectMgr, mgr.actionMgr)
@@ -132,11 +285,19 @@ func NewConfigMgr(paramsDir string, logger *logging.Writer) *ConfigMgr {
 		logger.Err("Error initializing ApiMgr")
 		return nil
 	}
+	if !mgr.ConfigureAuth() {
+		return nil
+	}
+	mgr.ConfigureAudit()
+	mgr.webhookMgr = webhooks.InitializeWebhookMgr(logger, mgr.objectMgr, mgr.dbHdl,
+		mgr.ApiMgr.GetEventStreamer())
 
 	mgr.ApiMgr.InitializeRestRoutes()
 	mgr.ApiMgr.InitializeActionRestRoutes()
 	mgr.ApiMgr.InitializeEventRestRoutes()
 	mgr.ApiMgr.InstantiateRestRtr()
+	mgr.ConfigureTelemetry()
+	mgr.ConfigureEventRetention()
 
 	mgr.bringUpTime = time.Now()
 	// Initialize channel to receive connected client name.
@@ -148,6 +309,7 @@ func NewConfigMgr(paramsDir string, logger *logging.Writer) *ConfigMgr {
 	logger.Info("Initialization Done!")
 
 	mgr.ReadSystemSwVersion()
+	mgr.ApplyStoredClientConfig()
 	go mgr.AutoCreateConfigObjects()
 	go mgr.clientMgr.ListenToClientStateChanges()
 	go mgr.clientMgr.ConnectToAllClients(mgr.clientNameCh)
@@ -157,9 +319,13 @@ func NewConfigMgr(paramsDir string, logger *logging.Writer) *ConfigMgr {
 	return mgr
 }
 
+//
+// SIGTERM and SIGINT shut confd down gracefully, a second one exits at once.
+// SIGHUP reloads the configuration files.
+//
 func (mgr *ConfigMgr) SigHandler() {
 	sigChan := make(chan os.Signal, 1)
-	signalList := []os.Signal{syscall.SIGHUP}
+	signalList := []os.Signal{syscall.SIGHUP, syscall.SIGTERM, syscall.SIGINT}
 	signal.Notify(sigChan, signalList...)
 
 	for {
@@ -167,10 +333,13 @@ func (mgr *ConfigMgr) SigHandler() {
 		case signal := <-sigChan:
 			switch signal {
 			case syscall.SIGHUP:
-				mgr.logger.Info("Exting!!!")
-				mgr.dbHdl.DisconnectDbIf()
-				mgr.clientMgr.DisconnectFromAllClients()
-				os.Exit(0)
+				mgr.ReloadConfig()
+			case syscall.SIGTERM, syscall.SIGINT:
+				if mgr.isShuttingDown() {
+					mgr.logger.Info("Exiting without waiting for shutdown!!!")
+					os.Exit(1)
+				}
+				go mgr.Shutdown()
 			default:
 			}
 		}
@@ -187,7 +356,7 @@ func (mgr *ConfigMgr) storeUUID(key string) {
 func (mgr *ConfigMgr) ConfigureGlobalConfig(clientName string) {
 	var obj modelObjs.ConfigObj
 	var err error
-	if ent, ok := mgr.objectMgr.AutoCreateObjMap[clientName]; ok {
+	if ent, ok := mgr.objectMgr.GetAutoCreateObjMap()[clientName]; ok {
 		mgr.logger.Err("AutoCreate : ", clientName, ent)
 		for _, resource := range ent.ObjList {
 			if objHdl, ok := modelObjs.ConfigObjectMap[resource]; ok {
@@ -196,11 +365,12 @@ func (mgr *ConfigMgr) ConfigureGlobalConfig(clientName string) {
 				objKey := mgr.dbHdl.GetKey(obj)
 				_, err = mgr.dbHdl.GetObjectFromDb(obj, objKey)
 				if err != nil {
-					client, exist := mgr.clientMgr.Clients[clientName]
+					client, exist := mgr.clientMgr.GetClient(clientName)
 					if exist {
 						err, success := client.CreateObject(obj, mgr.dbHdl.DBUtil)
 						if err == nil && success == true {
 							mgr.storeUUID(obj.GetKey())
+							mgr.objectMgr.ObjectChanged(resource, clients.OBJECT_CHANGE_CREATE, nil, obj)
 							err = mgr.dbHdl.StoreObjectDefaultInDb(obj)
 							if err != nil {
 								mgr.logger.Err(fmt.Sprintln("Failed to store"+resource+" default config in DB ", obj, err))
@@ -215,6 +385,29 @@ func (mgr *ConfigMgr) ConfigureGlobalConfig(clientName string) {
 	}
 }
 
+//
+// Apply ConfdClient objects stored in DB so that clients added or toggled at
+// runtime keep their configuration across restarts. This has to run before
+// confd starts connecting to clients.
+//
+func (mgr *ConfigMgr) ApplyStoredClientConfig() {
+	var obj modelObjs.ConfdClient
+	objs, err := mgr.dbHdl.GetAllObjFromDb(obj)
+	if err != nil {
+		mgr.logger.Err("Failed to read ConfdClient objects from DB", err)
+		return
+	}
+	for _, obj := range objs {
+		cfg, ok := obj.(modelObjs.ConfdClient)
+		if !ok {
+			continue
+		}
+		if err := mgr.clientMgr.ConfigureClient(cfg); err != nil {
+			mgr.logger.Err("Failed to apply stored config for client", cfg.Name, err)
+		}
+	}
+}
+
 func (mgr *ConfigMgr) AutoCreateConfigObjects() {
 	var clientNameList []string
 	for {
@@ -226,10 +419,18 @@ func (mgr *ConfigMgr) AutoCreateConfigObjects() {
 				for _, name := range clientNameList {
 					mgr.ConfigureGlobalConfig(name)
 				}
-				close(mgr.clientNameCh)
 				mgr.clientMgr.SystemReady = true
-				return
 			default:
+				if mgr.clientMgr.SystemReady {
+					// Client enabled or added at runtime
+					mgr.logger.Info("Do Global Init and Discover objects for late Client: " + clientName)
+					mgr.ConstructSystemParam(clientName)
+					mgr.AutoDiscoverObjects(clientName)
+					mgr.ConfigureComponentLoggingLevel(clientName)
+					mgr.ConfigureGlobalConfig(clientName)
+					mgr.logger.Info("Done Global Init and Discover objects for late Client: " + clientName)
+					continue
+				}
 				//Cache list of client names to use for autocreate
 				clientNameList = append(clientNameList, clientName)
 				mgr.logger.Info("Do Global Init and Discover objects for Client: " + clientName)
@@ -244,7 +445,7 @@ func (mgr *ConfigMgr) AutoCreateConfigObjects() {
 
 func (mgr *ConfigMgr) AutoDiscoverObjects(clientName string) {
 	mgr.logger.Debug("AutoDiscover for: ", clientName)
-	if ent, ok := mgr.objectMgr.AutoDiscoverObjMap[clientName]; ok {
+	if ent, ok := mgr.objectMgr.GetAutoDiscoverObjMap()[clientName]; ok {
 		for _, resource := range ent.ObjList {
 			mgr.logger.Debug("AutoDiscover: ", resource)
 			if objHdl, ok := modelObjs.ConfigObjectMap[resource]; ok {
@@ -253,7 +454,7 @@ func (mgr *ConfigMgr) AutoDiscoverObjects(clientName string) {
 				_, obj, _ := objects.GetConfigObjFromJsonData(nil, objHdl)
 				currentIndex := int64(0)
 				objCount := int64(MAX_COUNT_AUTO_DISCOVER_OBJ)
-				resourceOwner := mgr.objectMgr.ObjHdlMap[resource].Owner
+				resourceOwner := mgr.objectMgr.GetConfigObjHdlMap()[resource].Owner
 				err, _, _, _, objs = resourceOwner.GetBulkObject(obj, mgr.dbHdl.DBUtil,
 					currentIndex, objCount)
 				mgr.logger.Debug("AutoDiscover response: ", err, objs)
@@ -267,6 +468,7 @@ func (mgr *ConfigMgr) AutoDiscoverObjects(clientName string) {
 								mgr.logger.Err(fmt.Sprintln("Failed to store"+resource+" config in DB ", obj, err))
 							} else {
 								mgr.storeUUID(obj.GetKey())
+								mgr.objectMgr.ObjectChanged(resource, clients.OBJECT_CHANGE_CREATE, nil, obj)
 								err = mgr.dbHdl.StoreObjectDefaultInDb(obj)
 								if err != nil {
 									mgr.logger.Err(fmt.Sprintln("Failed to store"+resource+" default config in DB ", obj, err))
@@ -0,0 +1,132 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package server
+
+import (
+	"context"
+	modelObjs "models/objects"
+	"net/http"
+	"sync"
+	"time"
+)
+
+//
+// Time given to in-flight requests to finish on shutdown
+//
+const SHUTDOWN_TIMEOUT = 30 * time.Second
+
+func (mgr *ConfigMgr) getObjectConfigFiles() []string {
+	files := []string{mgr.paramsDir + "/genObjectConfig.json"}
+	return append(files, getDropInFiles(mgr.paramsDir+"/objects.d", mgr.logger)...)
+}
+
+func (mgr *ConfigMgr) getActionConfigFiles() []string {
+	files := []string{mgr.paramsDir + "/genObjectAction.json"}
+	return append(files, getDropInFiles(mgr.paramsDir+"/actions.d", mgr.logger)...)
+}
+
+func (mgr *ConfigMgr) isShuttingDown() bool {
+	mgr.serverMutex.Lock()
+	defer mgr.serverMutex.Unlock()
+	return mgr.shuttingDown
+}
+
+//
+// Stop accepting requests, let in-flight requests with their daemon calls
+// and ApiLog writes finish, then disconnect from the daemons and the DB.
+//
+func (mgr *ConfigMgr) Shutdown() {
+	mgr.serverMutex.Lock()
+	if mgr.shuttingDown {
+		mgr.serverMutex.Unlock()
+		return
+	}
+	mgr.shuttingDown = true
+	httpServers := mgr.httpServers
+	mgr.serverMutex.Unlock()
+
+	mgr.logger.Info("Shutting down")
+	// Streams last until closed, end them so that the listeners can stop
+	mgr.ApiMgr.StopEventStreams()
+	ctx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+	var wg sync.WaitGroup
+	for _, httpServer := range httpServers {
+		wg.Add(1)
+		go func(httpServer *http.Server) {
+			defer wg.Done()
+			if err := httpServer.Shutdown(ctx); err != nil {
+				mgr.logger.Err("Requests still running after", SHUTDOWN_TIMEOUT.String(), err)
+			}
+		}(httpServer)
+	}
+	wg.Wait()
+	cancel()
+	mgr.telemetryMgr.Stop()
+	mgr.alarmMgr.Stop()
+	mgr.retentionMgr.Stop()
+	mgr.webhookMgr.Stop()
+	mgr.ApiMgr.StopAudit()
+	mgr.clientMgr.DisconnectFromAllClients()
+	mgr.dbHdl.DisconnectDbIf()
+	mgr.logger.Info("Shutdown complete")
+	close(mgr.shutdownDone)
+}
+
+// Names of clients configured through stored ConfdClient objects
+func (mgr *ConfigMgr) getStoredClientNames() map[string]bool {
+	names := make(map[string]bool)
+	objs, _ := mgr.dbHdl.GetAllObjFromDb(modelObjs.ConfdClient{})
+	for _, obj := range objs {
+		if cfg, ok := obj.(modelObjs.ConfdClient); ok {
+			names[cfg.Name] = true
+		}
+	}
+	return names
+}
+
+//
+// Re-read clients.json, object and action ownership with their drop-in
+// files, configOrder.json and the telemetry configuration. Stored objects, client connections and
+// statistics are kept. A file that fails to load leaves its previous
+// configuration in place.
+//
+func (mgr *ConfigMgr) ReloadConfig() {
+	mgr.logger.Info("Reloading configuration")
+	mgr.clientMgr.ReloadClientHandles(mgr.paramsDir+"/clients.json", mgr.getStoredClientNames())
+	if !mgr.objectMgr.InitializeObjectHandles(mgr.getObjectConfigFiles()) {
+		mgr.logger.Err("Failed to reload object configuration")
+	} else if err := mgr.objectMgr.RebuildIndexes(); err != nil {
+		mgr.logger.Err("Error rebuilding object indexes", err)
+	}
+	if !mgr.actionMgr.InitializeActionObjectHandles(mgr.getActionConfigFiles()) {
+		mgr.logger.Err("Failed to reload action configuration")
+	}
+	if err := mgr.actionMgr.ReadConfigOrder(); err != nil {
+		mgr.logger.Err("Failed to reload config order", err)
+	}
+	mgr.ConfigureTelemetry()
+	mgr.ConfigureEventRetention()
+	mgr.ConfigureAudit()
+	mgr.logger.Info("Reload done")
+}
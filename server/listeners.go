@@ -0,0 +1,262 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package server
+
+import (
+	"config/auth"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+const (
+	LISTENER_TRANSPORT_TCP  = "tcp"
+	LISTENER_TRANSPORT_UNIX = "unix"
+	DEFAULT_API_PORT        = 8080
+	DEFAULT_SOCKET_MODE     = 0660
+)
+
+//
+// TLS settings of a listener. Clients must present a certificate signed by
+// ClientCaFile when it is set, unless ClientCertOptional is set, in which case
+// certificates are only verified when presented.
+//
+type ListenerTLSJson struct {
+	CertFile           string `json:"CertFile"`
+	KeyFile            string `json:"KeyFile"`
+	MinVersion         string `json:"MinVersion"`
+	ClientCaFile       string `json:"ClientCaFile"`
+	ClientCertOptional bool   `json:"ClientCertOptional"`
+}
+
+//
+// A REST API listener from the Listeners list in systemProfile.json. Address
+// is the bind address, empty for all interfaces. SocketPath is used instead
+// for unix transport. Requests on a NoAuth listener need no credentials when
+// authentication is enabled; NoAuth needs a unix socket or a loopback
+// Address.
+//
+type ListenerJson struct {
+	Name       string           `json:"Name"`
+	Transport  string           `json:"Transport"`
+	Address    string           `json:"Address"`
+	Port       int              `json:"Port"`
+	SocketPath string           `json:"SocketPath"`
+	SocketMode string           `json:"SocketMode"`
+	TLS        *ListenerTLSJson `json:"TLS"`
+	NoAuth     bool             `json:"NoAuth"`
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func (lsnr ListenerJson) String() string {
+	scheme := "http"
+	if lsnr.TLS != nil {
+		scheme = "https"
+	}
+	if lsnr.Transport == LISTENER_TRANSPORT_UNIX {
+		return scheme + "+unix://" + lsnr.SocketPath
+	}
+	return scheme + "://" + net.JoinHostPort(lsnr.Address, strconv.Itoa(lsnr.Port))
+}
+
+//
+// Listeners from systemProfile.json. Without a Listeners list confd listens
+// on API_Port, or 8080, on all interfaces as before.
+//
+func GetListeners(paramsDir string) []ListenerJson {
+	sysProfile, err := readSysProfile(paramsDir)
+	if err == nil && len(sysProfile.Listeners) > 0 {
+		return sysProfile.Listeners
+	}
+	port := sysProfile.API_Port
+	if port == 0 {
+		port = DEFAULT_API_PORT
+	}
+	return []ListenerJson{{Name: "default", Port: port}}
+}
+
+func (lsnr ListenerJson) TLSConfig() (*tls.Config, error) {
+	if lsnr.TLS == nil {
+		return nil, nil
+	}
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if lsnr.TLS.MinVersion != "" {
+		version, exist := tlsVersions[lsnr.TLS.MinVersion]
+		if !exist {
+			return nil, errors.New("Unsupported TLS MinVersion " + lsnr.TLS.MinVersion)
+		}
+		config.MinVersion = version
+	}
+	cert, err := tls.LoadX509KeyPair(lsnr.TLS.CertFile, lsnr.TLS.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	config.Certificates = []tls.Certificate{cert}
+	if lsnr.TLS.ClientCaFile != "" {
+		caCert, err := ioutil.ReadFile(lsnr.TLS.ClientCaFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(caCert) {
+			return nil, errors.New("No certificates found in " + lsnr.TLS.ClientCaFile)
+		}
+		if lsnr.TLS.ClientCertOptional {
+			config.ClientAuth = tls.VerifyClientCertIfGiven
+		} else {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return config, nil
+}
+
+//
+// NoAuth listeners serve anonymous requests with the admin role, so they
+// must not be reachable from other hosts
+//
+func (lsnr ListenerJson) CheckNoAuth() error {
+	if !lsnr.NoAuth || lsnr.Transport == LISTENER_TRANSPORT_UNIX {
+		return nil
+	}
+	if ip := net.ParseIP(lsnr.Address); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return errors.New("NoAuth is only allowed on unix sockets and loopback addresses")
+}
+
+func (lsnr ListenerJson) Listen() (net.Listener, error) {
+	tlsConfig, err := lsnr.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	var listener net.Listener
+	switch lsnr.Transport {
+	case "", LISTENER_TRANSPORT_TCP:
+		listener, err = net.Listen("tcp", net.JoinHostPort(lsnr.Address, strconv.Itoa(lsnr.Port)))
+	case LISTENER_TRANSPORT_UNIX:
+		if lsnr.SocketPath == "" {
+			return nil, errors.New("SocketPath is required for unix transport")
+		}
+		// A socket left behind by an earlier run would fail the bind
+		if info, statErr := os.Lstat(lsnr.SocketPath); statErr == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(lsnr.SocketPath)
+		}
+		mode := uint64(DEFAULT_SOCKET_MODE)
+		if lsnr.SocketMode != "" {
+			if mode, err = strconv.ParseUint(lsnr.SocketMode, 8, 32); err != nil {
+				return nil, errors.New("Invalid SocketMode " + lsnr.SocketMode)
+			}
+		}
+		if listener, err = net.Listen("unix", lsnr.SocketPath); err == nil {
+			err = os.Chmod(lsnr.SocketPath, os.FileMode(mode))
+		}
+	default:
+		return nil, errors.New("Unsupported transport " + lsnr.Transport)
+	}
+	if err != nil {
+		if listener != nil {
+			listener.Close()
+		}
+		return nil, err
+	}
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+	return listener, nil
+}
+
+//
+// Serve the REST API on listeners until Shutdown. All listeners are opened
+// before serving, so a bad listener stops confd from starting. Returns nil
+// once shutdown is complete. If a listener fails while serving, all of them
+// are closed and its error is returned.
+//
+func (mgr *ConfigMgr) Serve(listeners []ListenerJson) error {
+	netListeners := make([]net.Listener, 0, len(listeners))
+	for _, lsnr := range listeners {
+		err := lsnr.CheckNoAuth()
+		var netListener net.Listener
+		if err == nil {
+			netListener, err = lsnr.Listen()
+		}
+		if err != nil {
+			for _, opened := range netListeners {
+				opened.Close()
+			}
+			return errors.New("Listener " + lsnr.Name + " " + lsnr.String() + ": " + err.Error())
+		}
+		mgr.logger.Info("Listening on", lsnr.Name, lsnr.String())
+		netListeners = append(netListeners, netListener)
+	}
+	mgr.serverMutex.Lock()
+	if mgr.shuttingDown {
+		mgr.serverMutex.Unlock()
+		for _, netListener := range netListeners {
+			netListener.Close()
+		}
+		<-mgr.shutdownDone
+		return nil
+	}
+	for _, lsnr := range listeners {
+		var handler http.Handler = mgr.ApiMgr.GetRestRtr()
+		if lsnr.NoAuth {
+			handler = auth.TrustedHandler(handler)
+		}
+		mgr.httpServers = append(mgr.httpServers, &http.Server{Handler: handler})
+	}
+	mgr.serverMutex.Unlock()
+	errCh := make(chan error, len(netListeners))
+	for idx, netListener := range netListeners {
+		go func(httpServer *http.Server, netListener net.Listener) {
+			errCh <- httpServer.Serve(netListener)
+		}(mgr.httpServers[idx], netListener)
+	}
+	err := <-errCh
+	if err != http.ErrServerClosed {
+		// Do not leave the other listeners serving without the failed one
+		mgr.logger.Err("Listener failed, closing all listeners:", err)
+		mgr.serverMutex.Lock()
+		for _, httpServer := range mgr.httpServers {
+			httpServer.Close()
+		}
+		mgr.serverMutex.Unlock()
+		for idx := 1; idx < len(netListeners); idx++ {
+			<-errCh
+		}
+		return err
+	}
+	<-mgr.shutdownDone
+	return nil
+}
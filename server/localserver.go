@@ -24,6 +24,7 @@
 package server
 
 import (
+	"config/clients"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -149,11 +150,12 @@ func (mgr *ConfigMgr) ConstructSystemParam(clientName string) error {
 	}
 	if objHdl, ok := modelObjs.ConfigObjectMap["systemparam"]; ok {
 		sysObj, _ := objHdl.UnmarshalObject(sysBody)
-		client, exist := mgr.clientMgr.Clients[clientName]
+		client, exist := mgr.clientMgr.GetClient(clientName)
 		if exist {
 			err, success := client.CreateObject(sysObj, mgr.dbHdl.DBUtil)
 			if err == nil && success == true {
 				mgr.storeUUID(sysObj.GetKey())
+				mgr.objectMgr.ObjectChanged("systemparam", clients.OBJECT_CHANGE_CREATE, nil, sysObj)
 			} else {
 				mgr.logger.Err("Failed to create system info: ", err)
 			}
@@ -188,6 +190,7 @@ func (mgr *ConfigMgr) ConfigureComponentLoggingLevel(compName string) {
 		err = mgr.dbHdl.StoreObjectInDb(data)
 		if err == nil {
 			mgr.storeUUID(data.GetKey())
+			mgr.objectMgr.ObjectChanged("componentlogging", clients.OBJECT_CHANGE_CREATE, nil, data)
 		}
 	}
 }
@@ -207,16 +210,17 @@ func GetSystemStatus() modelObjs.SystemStatusState {
 		systemStatus.Reason = "None"
 	}
 	systemStatus.UpTime = time.Since(gConfigMgr.bringUpTime).String()
+	apiCallStats := gConfigMgr.ApiMgr.ApiCallStats.Get()
 	systemStatus.NumCreateCalls =
-		fmt.Sprintf("Total %d Success %d", gConfigMgr.ApiMgr.ApiCallStats.NumCreateCalls, gConfigMgr.ApiMgr.ApiCallStats.NumCreateCallsSuccess)
+		fmt.Sprintf("Total %d Success %d", apiCallStats.NumCreateCalls, apiCallStats.NumCreateCallsSuccess)
 	systemStatus.NumDeleteCalls =
-		fmt.Sprintf("Total %d Success %d", gConfigMgr.ApiMgr.ApiCallStats.NumDeleteCalls, gConfigMgr.ApiMgr.ApiCallStats.NumDeleteCallsSuccess)
+		fmt.Sprintf("Total %d Success %d", apiCallStats.NumDeleteCalls, apiCallStats.NumDeleteCallsSuccess)
 	systemStatus.NumUpdateCalls =
-		fmt.Sprintf("Total %d Success %d", gConfigMgr.ApiMgr.ApiCallStats.NumUpdateCalls, gConfigMgr.ApiMgr.ApiCallStats.NumUpdateCallsSuccess)
+		fmt.Sprintf("Total %d Success %d", apiCallStats.NumUpdateCalls, apiCallStats.NumUpdateCallsSuccess)
 	systemStatus.NumGetCalls =
-		fmt.Sprintf("Total %d Success %d", gConfigMgr.ApiMgr.ApiCallStats.NumGetCalls, gConfigMgr.ApiMgr.ApiCallStats.NumGetCallsSuccess)
+		fmt.Sprintf("Total %d Success %d", apiCallStats.NumGetCalls, apiCallStats.NumGetCallsSuccess)
 	systemStatus.NumActionCalls =
-		fmt.Sprintf("Total %d Success %d", gConfigMgr.ApiMgr.ApiCallStats.NumActionCalls, gConfigMgr.ApiMgr.ApiCallStats.NumActionCallsSuccess)
+		fmt.Sprintf("Total %d Success %d", apiCallStats.NumActionCalls, apiCallStats.NumActionCallsSuccess)
 
 	// Read DaemonStates from db
 	var daemonState modelObjs.DaemonState
@@ -0,0 +1,242 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package telemetry
+
+import (
+	"config/metrics"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	modelObjs "models/objects"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"utils/logging"
+)
+
+//
+// Attribute metadata from <ObjectType>Members.json in the models directory
+//
+type MemberInfo struct {
+	Type        string `json:"type"`
+	IsKey       bool   `json:"isKey"`
+	IsCounter   bool   `json:"isCounter"`
+	Description string `json:"description"`
+}
+
+func readMembers(modelsDir, objectType string) (map[string]MemberInfo, error) {
+	var members map[string]MemberInfo
+	bytes, err := ioutil.ReadFile(modelsDir + objectType + "Members.json")
+	if err == nil {
+		err = json.Unmarshal(bytes, &members)
+	}
+	return members, err
+}
+
+type stateExporter struct {
+	objectType string
+	resource   string
+	attrs      map[string]bool
+	interval   time.Duration
+	members    map[string]MemberInfo
+	written    map[string]bool
+	history    *stateHistory
+}
+
+type metricFamily struct {
+	attr       string
+	name       string
+	help       string
+	metricType string
+	labelNames []string
+	samples    []metrics.Sample
+}
+
+func newStateExporter(cfg TelemetryObjectJson, interval int, modelsDir string, logger *logging.Writer) (*stateExporter, error) {
+	exporter := new(stateExporter)
+	exporter.objectType = cfg.ObjectType
+	exporter.resource = strings.ToLower(cfg.ObjectType)
+	if !isStateObject(exporter.resource) {
+		return nil, errors.New("Unknown state object " + cfg.ObjectType)
+	}
+	if len(cfg.Attributes) > 0 {
+		exporter.attrs = make(map[string]bool, len(cfg.Attributes))
+		for _, attr := range cfg.Attributes {
+			exporter.attrs[attr] = true
+		}
+	}
+	if cfg.Interval > 0 {
+		interval = cfg.Interval
+	}
+	exporter.interval = time.Duration(interval) * time.Second
+	members, err := readMembers(modelsDir, cfg.ObjectType)
+	if err != nil {
+		// String attributes are taken as keys, numeric ones as gauges
+		logger.Info("No members metadata for", cfg.ObjectType, err)
+	}
+	exporter.members = members
+	if cfg.History > MAX_HISTORY_SAMPLES {
+		return nil, errors.New("History of " + cfg.ObjectType + " is more than " + strconv.Itoa(MAX_HISTORY_SAMPLES) + " samples")
+	}
+	if cfg.History > 0 {
+		exporter.history = newStateHistory(cfg.History)
+	}
+	return exporter, nil
+}
+
+//
+// Prometheus style name of a CamelCase name, e.g. BGPv4Neighbor is
+// bgpv4_neighbor and IfInOctets is if_in_octets. Acronyms are not split.
+//
+func snakeCase(name string) string {
+	runes := []rune(name)
+	out := make([]rune, 0, len(runes)+4)
+	isUpper := func(r rune) bool { return r >= 'A' && r <= 'Z' }
+	isLower := func(r rune) bool { return r >= 'a' && r <= 'z' }
+	isDigit := func(r rune) bool { return r >= '0' && r <= '9' }
+	for idx, r := range runes {
+		if isUpper(r) && idx > 0 && (isLower(runes[idx-1]) || isDigit(runes[idx-1])) {
+			out = append(out, '_')
+		}
+		switch {
+		case isUpper(r):
+			out = append(out, r-'A'+'a')
+		case isLower(r), isDigit(r):
+			out = append(out, r)
+		default:
+			out = append(out, '_')
+		}
+	}
+	return string(out)
+}
+
+func (exporter *stateExporter) metricName(attr string, counter bool) string {
+	name := "confd_" + snakeCase(strings.TrimSuffix(exporter.objectType, "State")) + "_" + snakeCase(attr)
+	if counter && !strings.HasSuffix(name, "_total") {
+		name += "_total"
+	}
+	return name
+}
+
+func (exporter *stateExporter) isKey(field reflect.StructField) bool {
+	if member, exist := exporter.members[field.Name]; exist {
+		return member.IsKey
+	}
+	return exporter.members == nil && field.Type.Kind() == reflect.String
+}
+
+func numericValue(value reflect.Value) (float64, bool) {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), true
+	case reflect.Bool:
+		if value.Bool() {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func structValue(obj modelObjs.ConfigObj) (reflect.Value, bool) {
+	value := reflect.ValueOf(obj)
+	if value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+	return value, value.Kind() == reflect.Struct
+}
+
+//
+// Metric families of the selected numeric attributes of objs, in attribute
+// order
+//
+func (exporter *stateExporter) convert(objs []modelObjs.ConfigObj) []*metricFamily {
+	if len(objs) == 0 {
+		return nil
+	}
+	value, ok := structValue(objs[0])
+	if !ok {
+		return nil
+	}
+	objType := value.Type()
+	var keyFields, valueFields []int
+	var labelNames []string
+	families := make([]*metricFamily, 0)
+	for idx := 0; idx < objType.NumField(); idx++ {
+		field := objType.Field(idx)
+		if field.Anonymous || field.PkgPath != "" {
+			continue
+		}
+		if exporter.isKey(field) {
+			keyFields = append(keyFields, idx)
+			labelNames = append(labelNames, field.Name)
+			continue
+		}
+		if exporter.attrs != nil && !exporter.attrs[field.Name] {
+			continue
+		}
+		if _, numeric := numericValue(value.Field(idx)); !numeric {
+			continue
+		}
+		member := exporter.members[field.Name]
+		family := &metricFamily{
+			attr:       field.Name,
+			name:       exporter.metricName(field.Name, member.IsCounter),
+			help:       member.Description,
+			metricType: metrics.TYPE_GAUGE,
+		}
+		if member.IsCounter {
+			family.metricType = metrics.TYPE_COUNTER
+		}
+		if family.help == "" {
+			family.help = exporter.objectType + " " + field.Name
+		}
+		valueFields = append(valueFields, idx)
+		families = append(families, family)
+	}
+	for _, obj := range objs {
+		value, ok := structValue(obj)
+		if !ok || value.Type() != objType {
+			continue
+		}
+		labelValues := make([]string, len(keyFields))
+		for idx, fieldIdx := range keyFields {
+			labelValues[idx] = fmt.Sprint(value.Field(fieldIdx).Interface())
+		}
+		for idx, fieldIdx := range valueFields {
+			fieldValue, _ := numericValue(value.Field(fieldIdx))
+			families[idx].samples = append(families[idx].samples, metrics.Sample{LabelValues: labelValues, Value: fieldValue})
+		}
+	}
+	for _, family := range families {
+		family.labelNames = labelNames
+	}
+	return families
+}
@@ -0,0 +1,95 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package telemetry
+
+import (
+	"config/metrics"
+	modelObjs "models/objects"
+	"reflect"
+	"testing"
+)
+
+func TestSnakeCase(t *testing.T) {
+	names := map[string]string{
+		"IfInOctets":    "if_in_octets",
+		"BGPv4Neighbor": "bgpv4_neighbor",
+		"Port":          "port",
+		"OperState":     "oper_state",
+		"NumUUIDs":      "num_uuids",
+	}
+	for name, expected := range names {
+		if snakeCase(name) != expected {
+			t.Error("snakeCase of", name, "is", snakeCase(name), "expected", expected)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	exporter := &stateExporter{
+		objectType: "DbIntegrityState",
+		attrs:      map[string]bool{"ObjectsChecked": true, "Mismatched": true, "Repair": true},
+		members: map[string]MemberInfo{
+			"Name":           {IsKey: true},
+			"ObjectsChecked": {IsCounter: true, Description: "Objects checked"},
+		},
+	}
+	objs := []modelObjs.ConfigObj{
+		modelObjs.DbIntegrityState{Name: "last", ObjectsChecked: 10, Mismatched: 2, Repair: true},
+		modelObjs.DbIntegrityState{Name: "prev", ObjectsChecked: 7},
+	}
+	families := exporter.convert(objs)
+	if len(families) != 3 {
+		t.Fatal("Expected 3 metric families, got", len(families))
+	}
+	repair, checked, mismatched := families[0], families[1], families[2]
+	if repair.name != "confd_db_integrity_repair" || repair.metricType != metrics.TYPE_GAUGE ||
+		repair.samples[0].Value != 1 || repair.samples[1].Value != 0 {
+		t.Error("Bad bool gauge", repair)
+	}
+	if checked.name != "confd_db_integrity_objects_checked_total" || checked.metricType != metrics.TYPE_COUNTER ||
+		checked.help != "Objects checked" {
+		t.Error("Bad counter", checked)
+	}
+	expected := []metrics.Sample{
+		{LabelValues: []string{"last"}, Value: 2},
+		{LabelValues: []string{"prev"}, Value: 0},
+	}
+	if mismatched.metricType != metrics.TYPE_GAUGE || !reflect.DeepEqual(mismatched.labelNames, []string{"Name"}) ||
+		!reflect.DeepEqual(mismatched.samples, expected) {
+		t.Error("Bad gauge", mismatched)
+	}
+}
+
+func TestConvertWithoutMembers(t *testing.T) {
+	exporter := &stateExporter{objectType: "DbIntegrityState"}
+	families := exporter.convert([]modelObjs.ConfigObj{modelObjs.DbIntegrityState{Name: "last", LastRun: "now"}})
+	for _, family := range families {
+		if family.metricType != metrics.TYPE_GAUGE || !reflect.DeepEqual(family.labelNames, []string{"Name", "LastRun"}) {
+			t.Error("Bad metric family without members metadata", family)
+		}
+	}
+	if len(families) != 8 {
+		t.Error("Expected all numeric attributes, got", len(families))
+	}
+}
@@ -0,0 +1,382 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package telemetry
+
+import (
+	"config/metrics"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//
+// History of state objects is kept in memory as a ring of samples per
+// object key. Objects which have not been seen for a whole ring are
+// dropped. History survives a reload of the configuration when the ring
+// size of the type is unchanged. Rings stop growing and new objects are
+// not sampled while all histories together hold MAX_TOTAL_HISTORY_SAMPLES.
+//
+const (
+	MAX_HISTORY_SAMPLES       = 100000
+	MAX_TOTAL_HISTORY_SAMPLES = 10000000
+)
+
+var ErrNoHistory = errors.New("No history is kept for object")
+
+// Samples held by all histories
+var historySamples int64
+
+type HistoryQuery struct {
+	From       time.Time
+	To         time.Time
+	Step       time.Duration
+	KeyFilters map[string]string
+}
+
+//
+// Rate is the per second increase since the previous point, for counters
+// only. A counter which went down is taken to have been reset.
+//
+type HistoryPoint struct {
+	Time  time.Time `json:"Time"`
+	Value float64   `json:"Value"`
+	Rate  *float64  `json:"Rate,omitempty"`
+}
+
+type HistorySeries struct {
+	Key       map[string]string `json:"Key"`
+	Attribute string            `json:"Attribute"`
+	Counter   bool              `json:"Counter"`
+	Points    []HistoryPoint    `json:"Points"`
+}
+
+type HistoryResult struct {
+	ObjectType string          `json:"ObjectType"`
+	Interval   string          `json:"Interval"`
+	Series     []HistorySeries `json:"Series"`
+}
+
+type historySample struct {
+	time   time.Time
+	values []float64
+}
+
+type keyHistory struct {
+	labelValues []string
+	samples     []historySample
+	next        int
+}
+
+//
+// Add sample, growing the ring up to size when grow is set. Returns true
+// when the ring grew.
+//
+func (keyHist *keyHistory) add(sample historySample, size int, grow bool) bool {
+	if len(keyHist.samples) < size && keyHist.next == 0 && grow {
+		keyHist.samples = append(keyHist.samples, sample)
+		return true
+	}
+	keyHist.samples[keyHist.next] = sample
+	keyHist.next = (keyHist.next + 1) % len(keyHist.samples)
+	return false
+}
+
+func (keyHist *keyHistory) last() historySample {
+	if keyHist.next == 0 {
+		return keyHist.samples[len(keyHist.samples)-1]
+	}
+	return keyHist.samples[keyHist.next-1]
+}
+
+// Samples oldest first
+func (keyHist *keyHistory) ordered() []historySample {
+	samples := make([]historySample, 0, len(keyHist.samples))
+	samples = append(samples, keyHist.samples[keyHist.next:]...)
+	return append(samples, keyHist.samples[:keyHist.next]...)
+}
+
+type stateHistory struct {
+	mutex      sync.Mutex
+	size       int
+	labelNames []string
+	attrs      []string
+	counters   []bool
+	keys       map[string]*keyHistory
+	count      int
+	capped     bool
+}
+
+func newStateHistory(size int) *stateHistory {
+	return &stateHistory{size: size, keys: make(map[string]*keyHistory)}
+}
+
+func sameNames(names1, names2 []string) bool {
+	if len(names1) != len(names2) {
+		return false
+	}
+	for idx, name := range names1 {
+		if names2[idx] != name {
+			return false
+		}
+	}
+	return true
+}
+
+//
+// Add the values of a poll at now. A change of the key or value attributes,
+// as after a model update, starts the history over. Returns true when the
+// history first hits MAX_TOTAL_HISTORY_SAMPLES.
+//
+func (hist *stateHistory) record(families []*metricFamily, now time.Time, interval time.Duration) bool {
+	if len(families) == 0 {
+		return false
+	}
+	attrs := make([]string, len(families))
+	counters := make([]bool, len(families))
+	for idx, family := range families {
+		attrs[idx] = family.attr
+		counters[idx] = family.metricType == metrics.TYPE_COUNTER
+	}
+	hist.mutex.Lock()
+	defer hist.mutex.Unlock()
+	if !sameNames(hist.attrs, attrs) || !sameNames(hist.labelNames, families[0].labelNames) {
+		hist.attrs = attrs
+		hist.counters = counters
+		hist.labelNames = families[0].labelNames
+		hist.keys = make(map[string]*keyHistory)
+		hist.addCount(-hist.count)
+	}
+	capped := false
+	for objIdx, sample := range families[0].samples {
+		values := make([]float64, len(families))
+		for idx, family := range families {
+			values[idx] = family.samples[objIdx].Value
+		}
+		key := strings.Join(sample.LabelValues, "\x00")
+		grow := atomic.LoadInt64(&historySamples) < MAX_TOTAL_HISTORY_SAMPLES
+		keyHist, exist := hist.keys[key]
+		if !exist {
+			if !grow {
+				capped = true
+				continue
+			}
+			keyHist = &keyHistory{labelValues: sample.LabelValues}
+			hist.keys[key] = keyHist
+		}
+		if keyHist.add(historySample{now, values}, hist.size, grow) {
+			hist.addCount(1)
+		} else if len(keyHist.samples) < hist.size {
+			capped = true
+		}
+	}
+	expiry := now.Add(-time.Duration(hist.size) * interval)
+	for key, keyHist := range hist.keys {
+		if keyHist.last().time.Before(expiry) {
+			hist.addCount(-len(keyHist.samples))
+			delete(hist.keys, key)
+		}
+	}
+	first := capped && !hist.capped
+	hist.capped = capped
+	return first
+}
+
+func (hist *stateHistory) addCount(delta int) {
+	hist.count += delta
+	atomic.AddInt64(&historySamples, int64(delta))
+}
+
+// Give up the samples of a history which is no longer kept
+func (hist *stateHistory) release() {
+	hist.mutex.Lock()
+	defer hist.mutex.Unlock()
+	hist.keys = make(map[string]*keyHistory)
+	hist.addCount(-hist.count)
+}
+
+func (hist *stateHistory) labelIdx(name string) int {
+	for idx, labelName := range hist.labelNames {
+		if strings.EqualFold(labelName, name) {
+			return idx
+		}
+	}
+	return -1
+}
+
+func (hist *stateHistory) matches(labelValues []string, filters map[string]string) bool {
+	for name, value := range filters {
+		if idx := hist.labelIdx(name); idx >= 0 && labelValues[idx] != value {
+			return false
+		}
+	}
+	return true
+}
+
+//
+// Points of samples within the query range. With a step only the last
+// sample of each step from the start of the range is kept.
+//
+func selectSamples(samples []historySample, query HistoryQuery) []historySample {
+	selected := make([]historySample, 0, len(samples))
+	from := query.From
+	lastStep := int64(-1)
+	for _, sample := range samples {
+		if (!query.From.IsZero() && sample.time.Before(query.From)) ||
+			(!query.To.IsZero() && sample.time.After(query.To)) {
+			continue
+		}
+		if from.IsZero() {
+			from = sample.time
+		}
+		if query.Step > 0 {
+			step := int64(sample.time.Sub(from) / query.Step)
+			if step == lastStep {
+				selected[len(selected)-1] = sample
+				continue
+			}
+			lastStep = step
+		}
+		selected = append(selected, sample)
+	}
+	return selected
+}
+
+func counterRate(prev, curr historySample, idx int) *float64 {
+	seconds := curr.time.Sub(prev.time).Seconds()
+	if seconds <= 0 {
+		return nil
+	}
+	increase := curr.values[idx] - prev.values[idx]
+	if increase < 0 {
+		increase = curr.values[idx]
+	}
+	rate := increase / seconds
+	return &rate
+}
+
+//
+// Series of the objects matching the key filters of query. Filters which
+// name no key attribute are rejected once the key attributes are known
+// from a poll.
+//
+func (hist *stateHistory) query(query HistoryQuery) ([]HistorySeries, error) {
+	hist.mutex.Lock()
+	defer hist.mutex.Unlock()
+	if hist.attrs != nil {
+		for name, _ := range query.KeyFilters {
+			if hist.labelIdx(name) < 0 {
+				return nil, errors.New(name + " is not a key attribute")
+			}
+		}
+	}
+	keys := make([]string, 0, len(hist.keys))
+	for key, keyHist := range hist.keys {
+		if hist.matches(keyHist.labelValues, query.KeyFilters) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	series := make([]HistorySeries, 0, len(keys)*len(hist.attrs))
+	for _, key := range keys {
+		keyHist := hist.keys[key]
+		samples := selectSamples(keyHist.ordered(), query)
+		if len(samples) == 0 {
+			continue
+		}
+		keyMap := make(map[string]string, len(hist.labelNames))
+		for idx, labelName := range hist.labelNames {
+			keyMap[labelName] = keyHist.labelValues[idx]
+		}
+		for idx, attr := range hist.attrs {
+			points := make([]HistoryPoint, len(samples))
+			for sampleIdx, sample := range samples {
+				points[sampleIdx] = HistoryPoint{Time: sample.time, Value: sample.values[idx]}
+				if hist.counters[idx] && sampleIdx > 0 {
+					points[sampleIdx].Rate = counterRate(samples[sampleIdx-1], sample, idx)
+				}
+			}
+			series = append(series, HistorySeries{keyMap, attr, hist.counters[idx], points})
+		}
+	}
+	return series, nil
+}
+
+// Keep the history of types which are still sampled with the same ring size
+func (mgr *TelemetryMgr) keepHistory(oldMgr *TelemetryMgr) {
+	for _, exporter := range mgr.exporters {
+		for _, oldExporter := range oldMgr.exporters {
+			if exporter.resource == oldExporter.resource && exporter.history != nil &&
+				oldExporter.history != nil && exporter.history.size == oldExporter.history.size {
+				exporter.history = oldExporter.history
+			}
+		}
+	}
+}
+
+// Release the history of types which newMgr, if any, does not keep
+func (mgr *TelemetryMgr) releaseHistory(newMgr *TelemetryMgr) {
+	for _, oldExporter := range mgr.exporters {
+		if oldExporter.history == nil {
+			continue
+		}
+		kept := false
+		if newMgr != nil {
+			for _, exporter := range newMgr.exporters {
+				kept = kept || exporter.history == oldExporter.history
+			}
+		}
+		if !kept {
+			oldExporter.history.release()
+		}
+	}
+}
+
+//
+// History of state objects of the type with the given model key, e.g.
+// portstate. Returns ErrNoHistory for types without history.
+//
+func GetHistory(resource string, query HistoryQuery) (HistoryResult, error) {
+	gMutex.Lock()
+	mgr := gTelemetryMgr
+	gMutex.Unlock()
+	if mgr != nil {
+		for _, exporter := range mgr.exporters {
+			if exporter.resource == resource && exporter.history != nil {
+				series, err := exporter.history.query(query)
+				if err != nil {
+					return HistoryResult{}, err
+				}
+				return HistoryResult{
+					ObjectType: exporter.objectType,
+					Interval:   exporter.interval.String(),
+					Series:     series,
+				}, nil
+			}
+		}
+	}
+	return HistoryResult{}, ErrNoHistory
+}
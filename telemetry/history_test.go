@@ -0,0 +1,131 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package telemetry
+
+import (
+	"config/metrics"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func portFamilies(octets map[string]float64) []*metricFamily {
+	counter := &metricFamily{attr: "IfInOctets", metricType: metrics.TYPE_COUNTER, labelNames: []string{"IntfRef"}}
+	for port, value := range octets {
+		counter.samples = append(counter.samples, metrics.Sample{LabelValues: []string{port}, Value: value})
+	}
+	return []*metricFamily{counter}
+}
+
+func TestHistoryRing(t *testing.T) {
+	hist := newStateHistory(3)
+	start := time.Unix(1000, 0)
+	for idx := 0; idx < 5; idx++ {
+		hist.record(portFamilies(map[string]float64{"eth0": float64(idx * 100)}),
+			start.Add(time.Duration(idx)*10*time.Second), 10*time.Second)
+	}
+	series, _ := hist.query(HistoryQuery{})
+	if len(series) != 1 || len(series[0].Points) != 3 {
+		t.Fatal("Expected 3 points of eth0", series)
+	}
+	points := series[0].Points
+	if points[0].Value != 200 || points[2].Value != 400 || points[0].Rate != nil {
+		t.Error("Ring not ordered oldest first", points)
+	}
+	if points[1].Rate == nil || *points[1].Rate != 10 {
+		t.Error("Bad counter rate", points[1])
+	}
+}
+
+func TestHistoryQuery(t *testing.T) {
+	hist := newStateHistory(100)
+	start := time.Unix(1000, 0)
+	values := []float64{0, 100, 200, 50, 150, 250}
+	for idx, value := range values {
+		hist.record(portFamilies(map[string]float64{"eth0": value, "eth1": 1}),
+			start.Add(time.Duration(idx)*10*time.Second), 10*time.Second)
+	}
+	series, _ := hist.query(HistoryQuery{KeyFilters: map[string]string{"intfref": "eth0"}})
+	if len(series) != 1 || series[0].Key["IntfRef"] != "eth0" {
+		t.Fatal("Key filter not applied", series)
+	}
+	// The counter was reset before 50
+	if rate := series[0].Points[3].Rate; rate == nil || *rate != 5 {
+		t.Error("Bad rate after counter reset", series[0].Points[3])
+	}
+	series, _ = hist.query(HistoryQuery{
+		From:       start.Add(10 * time.Second),
+		To:         start.Add(50 * time.Second),
+		Step:       20 * time.Second,
+		KeyFilters: map[string]string{"IntfRef": "eth0"},
+	})
+	points := series[0].Points
+	if len(points) != 3 || points[0].Value != 200 || points[1].Value != 150 || points[2].Value != 250 {
+		t.Fatal("Bad stepped points", points)
+	}
+	if *points[1].Rate != 150.0/20 {
+		t.Error("Bad stepped rate", *points[1].Rate)
+	}
+}
+
+func TestHistoryExpiry(t *testing.T) {
+	hist := newStateHistory(2)
+	start := time.Unix(1000, 0)
+	hist.record(portFamilies(map[string]float64{"eth0": 1, "eth1": 1}), start, 10*time.Second)
+	for idx := 1; idx <= 3; idx++ {
+		hist.record(portFamilies(map[string]float64{"eth0": 1}), start.Add(time.Duration(idx)*10*time.Second), 10*time.Second)
+	}
+	if series, _ := hist.query(HistoryQuery{}); len(series) != 1 || series[0].Key["IntfRef"] != "eth0" {
+		t.Error("Removed object not expired", series)
+	}
+}
+
+func TestHistoryKeyFilter(t *testing.T) {
+	hist := newStateHistory(2)
+	hist.record(portFamilies(map[string]float64{"eth0": 1}), time.Unix(1000, 0), 10*time.Second)
+	if _, err := hist.query(HistoryQuery{KeyFilters: map[string]string{"Port": "eth0"}}); err == nil {
+		t.Error("Filter on a non key attribute accepted")
+	}
+}
+
+func TestHistoryTotalCap(t *testing.T) {
+	atomic.StoreInt64(&historySamples, MAX_TOTAL_HISTORY_SAMPLES-3)
+	defer atomic.StoreInt64(&historySamples, 0)
+	hist := newStateHistory(3)
+	start := time.Unix(1000, 0)
+	hist.record(portFamilies(map[string]float64{"eth0": 1, "eth1": 1}), start, 10*time.Second)
+	if !hist.record(portFamilies(map[string]float64{"eth0": 2, "eth1": 2, "eth2": 2}), start.Add(10*time.Second), 10*time.Second) {
+		t.Error("Cap not reported")
+	}
+	if hist.count != 3 || atomic.LoadInt64(&historySamples) != MAX_TOTAL_HISTORY_SAMPLES {
+		t.Fatal("Samples beyond the cap kept", hist.count)
+	}
+	if _, exist := hist.keys["eth2"]; exist {
+		t.Error("New object sampled at the cap")
+	}
+	hist.release()
+	if atomic.LoadInt64(&historySamples) != MAX_TOTAL_HISTORY_SAMPLES-3 {
+		t.Error("Samples not released", atomic.LoadInt64(&historySamples))
+	}
+}
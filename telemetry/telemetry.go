@@ -0,0 +1,217 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package telemetry
+
+import (
+	"config/metrics"
+	"config/objects"
+	modelObjs "models/objects"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"utils/logging"
+)
+
+//
+// The telemetry exporter polls daemon state objects of the types listed in
+// the Telemetry section of systemProfile.json and serves their numeric
+// attributes as Prometheus metrics, with the key attributes as labels.
+// Attributes flagged isCounter in the members metadata of the object are
+// counters, all others gauges. Types with History also keep that many
+// samples per object for the history API.
+//
+const (
+	DEFAULT_POLL_INTERVAL = 30
+	METRICS_PATH          = "/metrics/state"
+)
+
+type TelemetryObjectJson struct {
+	ObjectType string   `json:"ObjectType"`
+	Attributes []string `json:"Attributes"`
+	Interval   int      `json:"Interval"`
+	History    int      `json:"History"`
+}
+
+type TelemetryConfig struct {
+	Enable   bool                  `json:"Enable"`
+	Interval int                   `json:"Interval"`
+	Objects  []TelemetryObjectJson `json:"Objects"`
+}
+
+var (
+	telemetryPolls = metrics.NewCounterVec("confd_telemetry_polls_total",
+		"Polls of state objects for telemetry", "object")
+	telemetryPollErrors = metrics.NewCounterVec("confd_telemetry_poll_errors_total",
+		"Failed polls of state objects for telemetry", "object")
+	telemetryPollLatency = metrics.NewHistogramVec("confd_telemetry_poll_duration_seconds",
+		"Time to poll all objects of a state type", metrics.DefaultBuckets, "object")
+)
+
+type TelemetryMgr struct {
+	logger    *logging.Writer
+	objectMgr *objects.ObjectMgr
+	dbHdl     *objects.DbHandler
+	registry  *metrics.Registry
+	exporters []*stateExporter
+	stopCh    chan struct{}
+	wg        sync.WaitGroup
+}
+
+var gMutex sync.Mutex
+var gTelemetryMgr *TelemetryMgr
+
+//
+// Start exporting as configured by cfg, replacing the running exporter.
+// Members metadata of the objects is read from modelsDir. Returns nil when
+// telemetry is not enabled.
+//
+func InitializeTelemetryMgr(cfg TelemetryConfig, modelsDir string, logger *logging.Writer,
+	objectMgr *objects.ObjectMgr, dbHdl *objects.DbHandler) (*TelemetryMgr, error) {
+	var mgr *TelemetryMgr
+	if cfg.Enable {
+		mgr = new(TelemetryMgr)
+		mgr.logger = logger
+		mgr.objectMgr = objectMgr
+		mgr.dbHdl = dbHdl
+		mgr.registry = metrics.NewRegistry()
+		mgr.stopCh = make(chan struct{})
+		interval := cfg.Interval
+		if interval <= 0 {
+			interval = DEFAULT_POLL_INTERVAL
+		}
+		for _, objCfg := range cfg.Objects {
+			exporter, err := newStateExporter(objCfg, interval, modelsDir, logger)
+			if err != nil {
+				return nil, err
+			}
+			mgr.exporters = append(mgr.exporters, exporter)
+		}
+	}
+	gMutex.Lock()
+	oldMgr := gTelemetryMgr
+	if mgr != nil && oldMgr != nil {
+		mgr.keepHistory(oldMgr)
+	}
+	gTelemetryMgr = mgr
+	gMutex.Unlock()
+	if oldMgr != nil {
+		oldMgr.Stop()
+		oldMgr.releaseHistory(mgr)
+	}
+	if mgr != nil {
+		for _, exporter := range mgr.exporters {
+			mgr.wg.Add(1)
+			go mgr.run(exporter)
+		}
+		logger.Info("Exporting telemetry of", len(mgr.exporters), "state object types")
+	}
+	return mgr, nil
+}
+
+func (mgr *TelemetryMgr) Stop() {
+	if mgr == nil {
+		return
+	}
+	gMutex.Lock()
+	current := gTelemetryMgr == mgr
+	if current {
+		gTelemetryMgr = nil
+	}
+	gMutex.Unlock()
+	close(mgr.stopCh)
+	mgr.wg.Wait()
+	if current {
+		mgr.releaseHistory(nil)
+	}
+}
+
+func (mgr *TelemetryMgr) run(exporter *stateExporter) {
+	defer mgr.wg.Done()
+	ticker := time.NewTicker(exporter.interval)
+	defer ticker.Stop()
+	for {
+		mgr.poll(exporter)
+		select {
+		case <-mgr.stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+//
+// Replace the metrics of the exporter with those of the current state
+// objects. Metrics of objects which can not be read are removed rather than
+// served stale.
+//
+func (mgr *TelemetryMgr) poll(exporter *stateExporter) {
+	start := time.Now()
+	telemetryPolls.Inc(exporter.objectType)
+	objs, err := mgr.objectMgr.GetAllStateObjects(exporter.resource)
+	if err != nil {
+		telemetryPollErrors.Inc(exporter.objectType)
+		mgr.logger.Debug("Telemetry poll of", exporter.objectType, "failed", err)
+	}
+	families := exporter.convert(objs)
+	if err == nil && exporter.history != nil {
+		if exporter.history.record(families, start, exporter.interval) {
+			mgr.logger.Err("History of", exporter.objectType, "is incomplete, all histories hold",
+				MAX_TOTAL_HISTORY_SAMPLES, "samples")
+		}
+	}
+	written := make(map[string]bool, len(families))
+	for _, family := range families {
+		mgr.registry.SetSnapshot(family.name, family.help, family.metricType, family.labelNames, family.samples)
+		written[family.name] = true
+	}
+	for name, _ := range exporter.written {
+		if !written[name] {
+			mgr.registry.Unregister(name)
+		}
+	}
+	exporter.written = written
+	telemetryPollLatency.Observe(time.Since(start).Seconds(), exporter.objectType)
+}
+
+//
+// Handler for the scrape endpoint of the running exporter
+//
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gMutex.Lock()
+		mgr := gTelemetryMgr
+		gMutex.Unlock()
+		if mgr == nil {
+			http.Error(w, "Telemetry is not enabled", http.StatusNotFound)
+			return
+		}
+		mgr.registry.ServeHTTP(w, r)
+	})
+}
+
+func isStateObject(resource string) bool {
+	_, exist := modelObjs.ConfigObjectMap[resource]
+	return exist && strings.HasSuffix(resource, "state")
+}
@@ -0,0 +1,285 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package webhooks
+
+import (
+	"bytes"
+	"config/auth"
+	"config/clients"
+	"config/eventstream"
+	"config/metrics"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+//
+// Each webhook has a queue of notifications in the DB which a delivery
+// routine POSTs in order. A failed delivery is retried with exponential
+// backoff, MaxRetries times if it is set. The queue holds at most
+// MAX_QUEUE_LENGTH notifications, the oldest are dropped beyond that.
+//
+const (
+	QUEUE_KEY_PREFIX  = "WebhookQueue#"
+	DELIVERY_ID_KEY   = "WebhookDeliveryId"
+	MAX_QUEUE_LENGTH  = 10000
+	DELIVERY_TIMEOUT  = 10 * time.Second
+	MAX_RESPONSE_READ = 64 * 1024
+
+	SIGNATURE_HEADER    = "X-Confd-Signature"
+	DELIVERY_HEADER     = "X-Confd-Delivery"
+	NOTIFICATION_HEADER = "X-Confd-Notification"
+
+	NOTIFICATION_CONFIG_CHANGE = "ConfigChange"
+	NOTIFICATION_EVENT         = "Event"
+)
+
+type Notification struct {
+	Id         string             `json:"Id"`
+	Type       string             `json:"Type"`
+	Time       string             `json:"Time"`
+	Webhook    string             `json:"Webhook"`
+	Change     json.RawMessage    `json:"Change,omitempty"`
+	Event      *eventstream.Event `json:"Event,omitempty"`
+	objectType string
+}
+
+var (
+	deliveries = metrics.NewCounterVec("confd_webhook_deliveries_total",
+		"Webhook delivery attempts by result", "webhook", "result")
+	deliveryLatency = metrics.NewHistogramVec("confd_webhook_delivery_duration_seconds",
+		"Webhook delivery latency", metrics.DefaultBuckets, "webhook")
+)
+
+var httpClient = &http.Client{Timeout: DELIVERY_TIMEOUT}
+
+func encodeChange(change clients.ObjectChange) (json.RawMessage, error) {
+	data, err := json.Marshal(change)
+	if err != nil {
+		return nil, err
+	}
+	var attrs map[string]interface{}
+	if err = json.Unmarshal(data, &attrs); err != nil {
+		return nil, err
+	}
+	auth.ScrubSecrets(attrs["OldObj"])
+	auth.ScrubSecrets(attrs["NewObj"])
+	return json.Marshal(attrs)
+}
+
+// HMAC-SHA256 of body with the secret of the webhook, in hex
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func queueKey(name string) string {
+	return QUEUE_KEY_PREFIX + name
+}
+
+func (mgr *WebhookMgr) newDeliveryId() string {
+	if id, err := mgr.dbHdl.DoLocked("INCR", DELIVERY_ID_KEY); err == nil {
+		if seqNum, ok := id.(int64); ok {
+			return strconv.FormatInt(seqNum, 10)
+		}
+	}
+	return strconv.FormatInt(time.Now().UnixNano(), 10)
+}
+
+//
+// Append a notification to the queue of a webhook, dropping the oldest ones
+// beyond MAX_QUEUE_LENGTH. Returns the number dropped.
+//
+func (mgr *WebhookMgr) enqueue(name string, notification Notification) (int, error) {
+	notification.Id = mgr.newDeliveryId()
+	notification.Webhook = name
+	data, err := json.Marshal(notification)
+	if err != nil {
+		return 0, err
+	}
+	mgr.dbHdl.DBUtil.DbLock.Lock()
+	defer mgr.dbHdl.DBUtil.DbLock.Unlock()
+	length, err := mgr.dbHdl.Do("RPUSH", queueKey(name), data)
+	if err != nil {
+		return 0, err
+	}
+	dropped := 0
+	if count, ok := length.(int64); ok {
+		for ; count > MAX_QUEUE_LENGTH; count-- {
+			if _, err := mgr.dbHdl.Do("LPOP", queueKey(name)); err != nil {
+				break
+			}
+			dropped++
+		}
+	}
+	return dropped, nil
+}
+
+// Oldest queued notification and its Id
+func (mgr *WebhookMgr) queueHead(name string) ([]byte, string, bool) {
+	mgr.dbHdl.DBUtil.DbLock.Lock()
+	defer mgr.dbHdl.DBUtil.DbLock.Unlock()
+	return mgr.readQueueHead(name)
+}
+
+// queueHead for callers already holding DbLock
+func (mgr *WebhookMgr) readQueueHead(name string) ([]byte, string, bool) {
+	reply, err := mgr.dbHdl.Do("LRANGE", queueKey(name), 0, 0)
+	values, ok := reply.([]interface{})
+	if err != nil || !ok || len(values) == 0 {
+		return nil, "", false
+	}
+	data, ok := values[0].([]byte)
+	if !ok {
+		return nil, "", false
+	}
+	id, _ := notificationHeaders(data)
+	return data, id, true
+}
+
+func (mgr *WebhookMgr) queueLength(name string) int32 {
+	reply, _ := mgr.dbHdl.DoLocked("LLEN", queueKey(name))
+	length, _ := reply.(int64)
+	return int32(length)
+}
+
+//
+// Remove the notification with the given Id from the head of the queue.
+// It may already be gone, dropped by enqueue while it was being delivered.
+//
+func (mgr *WebhookMgr) dequeue(name string, id string) {
+	mgr.dbHdl.DBUtil.DbLock.Lock()
+	defer mgr.dbHdl.DBUtil.DbLock.Unlock()
+	if _, headId, ok := mgr.readQueueHead(name); ok && headId == id {
+		mgr.dbHdl.Do("LPOP", queueKey(name))
+	}
+}
+
+func (mgr *WebhookMgr) deleteQueue(name string) {
+	mgr.dbHdl.DoLocked("DEL", queueKey(name))
+}
+
+func notificationHeaders(body []byte) (id, notificationType string) {
+	var notification Notification
+	json.Unmarshal(body, &notification)
+	return notification.Id, notification.Type
+}
+
+// POST one notification, returning the HTTP status of the response
+func post(ctx context.Context, url string, secret, body []byte) (int, error) {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(ctx)
+	id, notificationType := notificationHeaders(body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "confd-webhook")
+	req.Header.Set(DELIVERY_HEADER, id)
+	req.Header.Set(NOTIFICATION_HEADER, notificationType)
+	if len(secret) > 0 {
+		req.Header.Set(SIGNATURE_HEADER, Sign(secret, body))
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, MAX_RESPONSE_READ))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, errors.New(fmt.Sprint("Endpoint returned ", resp.Status))
+	}
+	return resp.StatusCode, nil
+}
+
+//
+// Deliver the queue of a webhook until it is stopped. The queue is read
+// from the DB, so notifications queued before a restart are delivered too.
+//
+func (mgr *WebhookMgr) deliver(hook *webhook) {
+	defer hook.wg.Done()
+	backoff := hook.policy.NewBackoff()
+	attempts := 0
+	lastId := ""
+	for {
+		body, id, ok := mgr.queueHead(hook.name)
+		if !ok {
+			select {
+			case <-hook.stopCh:
+				return
+			case <-hook.kickCh:
+			}
+			continue
+		}
+		if id != lastId {
+			// Next notification, or the one being retried was dropped
+			backoff.Reset()
+			attempts = 0
+			lastId = id
+		}
+		start := time.Now()
+		status, err := post(hook.ctx, hook.url, hook.secret, body)
+		deliveryLatency.Observe(time.Since(start).Seconds(), hook.name)
+		if hook.ctx.Err() != nil {
+			// Stopped during the request, the notification stays queued
+			return
+		}
+		if err == nil {
+			deliveries.Inc(hook.name, "delivered")
+			mgr.dequeue(hook.name, id)
+			hook.delivered(status, start)
+			backoff.Reset()
+			attempts = 0
+			continue
+		}
+		deliveries.Inc(hook.name, "failed")
+		attempts++
+		if hook.maxRetries > 0 && attempts > hook.maxRetries {
+			mgr.logger.Err("Dropping notification to webhook", hook.name, "after", attempts, "attempts", err)
+			mgr.dequeue(hook.name, id)
+			hook.failed(status, err, time.Time{}, 1)
+			backoff.Reset()
+			attempts = 0
+			continue
+		}
+		interval := backoff.Next()
+		mgr.logger.Debug("Failed to notify webhook", hook.name, err, "retry in", interval)
+		hook.failed(status, err, time.Now().Add(interval), 0)
+		select {
+		case <-hook.stopCh:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,514 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package webhooks
+
+import (
+	"config/auth"
+	"config/clients"
+	"config/eventstream"
+	"config/objects"
+	"context"
+	"errors"
+	modelEvents "models/events"
+	modelObjs "models/objects"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"utils/logging"
+)
+
+//
+// Webhooks POST JSON notifications of config changes and events to HTTP
+// endpoints. They are configured as Webhook objects, whose Secret is kept
+// under its own DB key and replaced by auth.SECRET_MASK in the object. Each
+// webhook has a WebhookState object with its delivery status.
+//
+const (
+	SECRET_KEY_PREFIX = "WebhookSecret#"
+	MATCH_ALL         = "*"
+	INCOMING_SIZE     = 1024
+)
+
+type webhook struct {
+	name        string
+	url         string
+	secret      []byte
+	objectTypes map[string]bool
+	eventTypes  map[string]bool
+	severities  map[string]bool
+	maxRetries  int
+	policy      clients.ClientPolicyJson
+	kickCh      chan bool
+	stopCh      chan struct{}
+	ctx         context.Context
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+	mutex       sync.Mutex
+	state       modelObjs.WebhookState
+}
+
+type WebhookMgr struct {
+	logger    *logging.Writer
+	dbHdl     *objects.DbHandler
+	streamer  *eventstream.Streamer
+	mutex     sync.Mutex
+	hooks     map[string]*webhook
+	states    map[string]modelObjs.WebhookState
+	incoming  chan Notification
+	lastEvent uint64
+	stopCh    chan struct{}
+	wg        sync.WaitGroup
+}
+
+var gWebhookMgr *WebhookMgr
+
+func lowerSet(names []string) map[string]bool {
+	set := make(map[string]bool)
+	for _, name := range names {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			set[name] = true
+		}
+	}
+	return set
+}
+
+func matchSet(set map[string]bool, name string) bool {
+	return set[MATCH_ALL] || set[strings.ToLower(name)]
+}
+
+func validateWebhook(cfg modelObjs.Webhook) error {
+	if cfg.Name == "" {
+		return errors.New("Webhook needs a Name")
+	}
+	endpoint, err := url.Parse(cfg.URL)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return errors.New("Webhook " + cfg.Name + ": URL must be an http or https URL")
+	}
+	for objType, _ := range lowerSet(cfg.ObjectTypes) {
+		if _, exist := modelObjs.ConfigObjectMap[objType]; !exist && objType != MATCH_ALL {
+			return errors.New("Webhook " + cfg.Name + ": unknown object type " + objType)
+		}
+	}
+	for eventType, _ := range lowerSet(cfg.EventTypes) {
+		_, confd := objects.GetConfdEventType(eventType)
+		if _, exist := modelEvents.EventObjectMap[eventType]; !exist && !confd && eventType != MATCH_ALL {
+			return errors.New("Webhook " + cfg.Name + ": unknown event type " + eventType)
+		}
+	}
+	if cfg.MaxRetries < 0 || cfg.RetryInitialInterval < 0 || cfg.RetryMaxInterval < 0 {
+		return errors.New("Webhook " + cfg.Name + ": retry policy can not be negative")
+	}
+	return nil
+}
+
+func (mgr *WebhookMgr) newWebhook(cfg modelObjs.Webhook) *webhook {
+	policy := clients.DefaultClientPolicy()
+	if cfg.RetryInitialInterval > 0 {
+		policy.RetryInitialInterval = int(cfg.RetryInitialInterval)
+	}
+	if cfg.RetryMaxInterval > 0 {
+		policy.RetryMaxInterval = int(cfg.RetryMaxInterval)
+	}
+	if policy.RetryMaxInterval < policy.RetryInitialInterval {
+		policy.RetryMaxInterval = policy.RetryInitialInterval
+	}
+	hook := &webhook{
+		name:        cfg.Name,
+		url:         cfg.URL,
+		objectTypes: lowerSet(cfg.ObjectTypes),
+		eventTypes:  lowerSet(cfg.EventTypes),
+		severities:  lowerSet(cfg.Severities),
+		maxRetries:  int(cfg.MaxRetries),
+		policy:      policy,
+		kickCh:      make(chan bool, 1),
+		stopCh:      make(chan struct{}),
+	}
+	hook.ctx, hook.cancel = context.WithCancel(context.Background())
+	if secret, err := mgr.dbHdl.DoLocked("GET", SECRET_KEY_PREFIX+cfg.Name); err == nil {
+		hook.secret, _ = secret.([]byte)
+	}
+	// Delivery counts carry over configuration changes
+	hook.state = mgr.states[cfg.Name]
+	hook.state.Name = cfg.Name
+	hook.state.URL = cfg.URL
+	return hook
+}
+
+func (hook *webhook) kick() {
+	select {
+	case hook.kickCh <- true:
+	default:
+	}
+}
+
+func (hook *webhook) delivered(status int, at time.Time) {
+	hook.mutex.Lock()
+	hook.state.Delivered++
+	hook.state.LastStatusCode = int32(status)
+	hook.state.LastError = ""
+	hook.state.LastDelivery = at.Format(time.RFC3339)
+	hook.state.NextAttempt = ""
+	hook.mutex.Unlock()
+}
+
+func (hook *webhook) failed(status int, err error, nextAttempt time.Time, dropped int) {
+	hook.mutex.Lock()
+	hook.state.Failed++
+	hook.state.Dropped += uint32(dropped)
+	hook.state.LastStatusCode = int32(status)
+	hook.state.LastError = err.Error()
+	hook.state.NextAttempt = ""
+	if !nextAttempt.IsZero() {
+		hook.state.NextAttempt = nextAttempt.Format(time.RFC3339)
+	}
+	hook.mutex.Unlock()
+}
+
+func (hook *webhook) getState() modelObjs.WebhookState {
+	hook.mutex.Lock()
+	defer hook.mutex.Unlock()
+	return hook.state
+}
+
+func (hook *webhook) wantsEvent(event eventstream.Event) bool {
+	if !matchSet(hook.eventTypes, event.Type) {
+		return false
+	}
+	return len(hook.severities) == 0 || matchSet(hook.severities, event.Severity)
+}
+
+//
+// Start delivering to the stored webhooks, and register as the handler of
+// Webhook and WebhookState objects and as observer of config changes.
+// Events are read from streamer.
+//
+func InitializeWebhookMgr(logger *logging.Writer, objectMgr *objects.ObjectMgr, dbHdl *objects.DbHandler,
+	streamer *eventstream.Streamer) *WebhookMgr {
+	mgr := &WebhookMgr{
+		logger:   logger,
+		dbHdl:    dbHdl,
+		streamer: streamer,
+		hooks:    make(map[string]*webhook),
+		states:   make(map[string]modelObjs.WebhookState),
+		incoming: make(chan Notification, INCOMING_SIZE),
+		stopCh:   make(chan struct{}),
+	}
+	cfgs, err := dbHdl.GetAllObjFromDb(modelObjs.Webhook{})
+	if err != nil {
+		logger.Err("Failed to read webhooks", err)
+	}
+	for _, obj := range cfgs {
+		cfg := obj.(modelObjs.Webhook)
+		if err := validateWebhook(cfg); err != nil {
+			logger.Err("Skipping stored webhook", err)
+			continue
+		}
+		mgr.configure(cfg)
+	}
+	clients.RegisterLocalObjectHandler("Webhook", mgr)
+	clients.RegisterLocalObjectHandler("WebhookState", mgr)
+	objectMgr.AddChangeObserver(mgr.objectChanged)
+	mgr.wg.Add(1)
+	go mgr.dispatch()
+	gWebhookMgr = mgr
+	return mgr
+}
+
+// Stop delivering, queued notifications are kept in the DB
+func (mgr *WebhookMgr) Stop() {
+	if mgr == nil {
+		return
+	}
+	close(mgr.stopCh)
+	mgr.wg.Wait()
+	mgr.mutex.Lock()
+	for name, _ := range mgr.hooks {
+		mgr.stopHook(name)
+	}
+	mgr.mutex.Unlock()
+}
+
+// Must be called with mutex held
+func (mgr *WebhookMgr) stopHook(name string) {
+	hook, exist := mgr.hooks[name]
+	if !exist {
+		return
+	}
+	close(hook.stopCh)
+	hook.cancel()
+	hook.wg.Wait()
+	mgr.states[name] = hook.getState()
+	delete(mgr.hooks, name)
+}
+
+// Replace the running webhook of cfg. Must be called with mutex held.
+func (mgr *WebhookMgr) configure(cfg modelObjs.Webhook) {
+	mgr.stopHook(cfg.Name)
+	if !cfg.Enable {
+		return
+	}
+	hook := mgr.newWebhook(cfg)
+	mgr.hooks[cfg.Name] = hook
+	hook.wg.Add(1)
+	go mgr.deliver(hook)
+}
+
+func (mgr *WebhookMgr) objectChanged(change clients.ObjectChange) {
+	data, err := encodeChange(change)
+	if err != nil {
+		mgr.logger.Debug("Failed to encode change of", change.ObjectType, err)
+		return
+	}
+	notification := Notification{
+		Type:       NOTIFICATION_CONFIG_CHANGE,
+		Time:       time.Now().Format(time.RFC3339),
+		Change:     data,
+		objectType: change.ObjectType,
+	}
+	select {
+	case mgr.incoming <- notification:
+	default:
+		mgr.logger.Err("Webhook notifications backed up, dropping change of", change.ObjectType)
+	}
+}
+
+func (mgr *WebhookMgr) wantEvents() bool {
+	mgr.mutex.Lock()
+	defer mgr.mutex.Unlock()
+	for _, hook := range mgr.hooks {
+		if len(hook.eventTypes) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+//
+// Queue incoming notifications for the webhooks which want them. Events
+// are only read while some webhook wants them.
+//
+func (mgr *WebhookMgr) dispatch() {
+	defer mgr.wg.Done()
+	var sub *eventstream.Subscriber
+	var events <-chan eventstream.Event
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	defer func() {
+		if sub != nil {
+			mgr.streamer.Unsubscribe(sub)
+		}
+	}()
+	for {
+		select {
+		case <-mgr.stopCh:
+			return
+		case notification := <-mgr.incoming:
+			mgr.queueNotification(notification, nil)
+		case event, ok := <-events:
+			if !ok {
+				mgr.logger.Err("Webhook event stream closed", sub.Err())
+				sub, events = nil, nil
+				continue
+			}
+			mgr.lastEvent = event.Id
+			mgr.queueNotification(Notification{
+				Type:  NOTIFICATION_EVENT,
+				Time:  time.Now().Format(time.RFC3339),
+				Event: &event,
+			}, &event)
+		case <-ticker.C:
+			wantEvents := mgr.wantEvents()
+			if wantEvents && sub == nil && mgr.streamer != nil {
+				var backlog []eventstream.Event
+				var err error
+				sub, backlog, _, err = mgr.streamer.Subscribe(eventstream.Filter{}, mgr.lastEvent > 0, mgr.lastEvent)
+				if err != nil {
+					sub = nil
+					continue
+				}
+				events = sub.C
+				for idx := range backlog {
+					mgr.lastEvent = backlog[idx].Id
+					mgr.queueNotification(Notification{
+						Type:  NOTIFICATION_EVENT,
+						Time:  time.Now().Format(time.RFC3339),
+						Event: &backlog[idx],
+					}, &backlog[idx])
+				}
+			} else if !wantEvents && sub != nil {
+				mgr.streamer.Unsubscribe(sub)
+				sub, events = nil, nil
+			}
+		}
+	}
+}
+
+func (mgr *WebhookMgr) queueNotification(notification Notification, event *eventstream.Event) {
+	mgr.mutex.Lock()
+	hooks := make([]*webhook, 0, len(mgr.hooks))
+	for _, hook := range mgr.hooks {
+		if (event != nil && hook.wantsEvent(*event)) ||
+			(event == nil && matchSet(hook.objectTypes, notification.objectType)) {
+			hooks = append(hooks, hook)
+		}
+	}
+	mgr.mutex.Unlock()
+	for _, hook := range hooks {
+		dropped, err := mgr.enqueue(hook.name, notification)
+		if err != nil {
+			mgr.logger.Err("Failed to queue notification for webhook", hook.name, err)
+			continue
+		}
+		if dropped > 0 {
+			hook.mutex.Lock()
+			hook.state.Dropped += uint32(dropped)
+			hook.mutex.Unlock()
+		}
+		hook.kick()
+	}
+}
+
+//
+// Keep the secret of a webhook out of its object. An update which sends
+// back auth.SECRET_MASK keeps the secret, an empty Secret turns signing off.
+// A create with auth.SECRET_MASK, as by ApplyConfig or RestoreDatabase of a
+// saved config, keeps the stored secret of the webhook.
+//
+func (mgr *WebhookMgr) PrepareObject(oldObj, newObj modelObjs.ConfigObj) (modelObjs.ConfigObj, error) {
+	cfg, ok := newObj.(modelObjs.Webhook)
+	if !ok {
+		return nil, ErrReadOnly
+	}
+	if err := validateWebhook(cfg); err != nil {
+		return nil, err
+	}
+	switch cfg.Secret {
+	case auth.SECRET_MASK:
+		if oldObj == nil {
+			exist, err := mgr.dbHdl.DoLocked("EXISTS", SECRET_KEY_PREFIX+cfg.Name)
+			if err != nil {
+				return nil, err
+			}
+			if count, _ := exist.(int64); count == 0 {
+				return nil, errors.New("Webhook " + cfg.Name + ": Secret can not be " + auth.SECRET_MASK +
+					", there is no stored secret")
+			}
+		}
+	case "":
+		if _, err := mgr.dbHdl.DoLocked("DEL", SECRET_KEY_PREFIX+cfg.Name); err != nil {
+			return nil, err
+		}
+	default:
+		if _, err := mgr.dbHdl.DoLocked("SET", SECRET_KEY_PREFIX+cfg.Name, cfg.Secret); err != nil {
+			return nil, err
+		}
+		cfg.Secret = auth.SECRET_MASK
+	}
+	return cfg, nil
+}
+
+var ErrReadOnly = errors.New("WebhookState is read only")
+
+func (mgr *WebhookMgr) ApplyObject(op string, oldObj, newObj modelObjs.ConfigObj) error {
+	if _, ok := oldObj.(modelObjs.WebhookState); ok {
+		return ErrReadOnly
+	}
+	if _, ok := newObj.(modelObjs.WebhookState); ok {
+		return ErrReadOnly
+	}
+	mgr.mutex.Lock()
+	defer mgr.mutex.Unlock()
+	if op == clients.OBJECT_CHANGE_DELETE {
+		name := oldObj.(modelObjs.Webhook).Name
+		mgr.stopHook(name)
+		delete(mgr.states, name)
+		mgr.deleteQueue(name)
+		// The secret is kept for the webhook to be created again with the
+		// masked Secret, as by ResetConfig followed by RestoreDatabase
+		return nil
+	}
+	mgr.configure(newObj.(modelObjs.Webhook))
+	return nil
+}
+
+type webhookStates []modelObjs.WebhookState
+
+func (states webhookStates) Len() int {
+	return len(states)
+}
+
+func (states webhookStates) Less(i, j int) bool {
+	return states[i].Name < states[j].Name
+}
+
+func (states webhookStates) Swap(i, j int) {
+	states[i], states[j] = states[j], states[i]
+}
+
+// Delivery status of the enabled webhooks and those which were enabled
+func (mgr *WebhookMgr) GetStates() []modelObjs.WebhookState {
+	mgr.mutex.Lock()
+	states := make(webhookStates, 0, len(mgr.hooks)+len(mgr.states))
+	for name, state := range mgr.states {
+		if _, running := mgr.hooks[name]; !running {
+			states = append(states, state)
+		}
+	}
+	for _, hook := range mgr.hooks {
+		states = append(states, hook.getState())
+	}
+	mgr.mutex.Unlock()
+	for idx := range states {
+		states[idx].Pending = mgr.queueLength(states[idx].Name)
+	}
+	sort.Sort(states)
+	return states
+}
+
+func (mgr *WebhookMgr) GetObject(obj modelObjs.ConfigObj) (modelObjs.ConfigObj, error) {
+	query, ok := obj.(modelObjs.WebhookState)
+	if !ok {
+		return nil, errors.New("Only WebhookState can be read from the webhook manager")
+	}
+	for _, state := range mgr.GetStates() {
+		if state.Name == query.Name {
+			return state, nil
+		}
+	}
+	return nil, errors.New("No enabled webhook " + query.Name)
+}
+
+func (mgr *WebhookMgr) GetAllObjects(obj modelObjs.ConfigObj) ([]modelObjs.ConfigObj, error) {
+	if _, ok := obj.(modelObjs.WebhookState); !ok {
+		return nil, errors.New("Only WebhookState can be read from the webhook manager")
+	}
+	states := mgr.GetStates()
+	objs := make([]modelObjs.ConfigObj, len(states))
+	for idx, state := range states {
+		objs[idx] = state
+	}
+	return objs, nil
+}
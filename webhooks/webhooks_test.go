@@ -0,0 +1,247 @@
+//
+//Copyright [2016] [SnapRoute Inc]
+//
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	 Unless required by applicable law or agreed to in writing, software
+//	 distributed under the License is distributed on an "AS IS" BASIS,
+//	 WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	 See the License for the specific language governing permissions and
+//	 limitations under the License.
+//
+// _______  __       __________   ___      _______.____    __    ____  __  .___________.  ______  __    __
+// |   ____||  |     |   ____\  \ /  /     /       |\   \  /  \  /   / |  | |           | /      ||  |  |  |
+// |  |__   |  |     |  |__   \  V  /     |   (----` \   \/    \/   /  |  | `---|  |----`|  ,----'|  |__|  |
+// |   __|  |  |     |   __|   >   <       \   \      \            /   |  |     |  |     |  |     |   __   |
+// |  |     |  `----.|  |____ /  .  \  .----)   |      \    /\    /    |  |     |  |     |  `----.|  |  |  |
+// |__|     |_______||_______/__/ \__\ |_______/        \__/  \__/     |__|     |__|      \______||__|  |__|
+//
+
+package webhooks
+
+import (
+	"config/auth"
+	"config/clients"
+	"config/objects"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	modelObjs "models/objects"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"utils/logging"
+)
+
+var logger *logging.Writer
+
+func TestMain(m *testing.M) {
+	var err error
+	logger, err = logging.NewLogger("confd", "Webhooks", true)
+	if err != nil {
+		fmt.Println("Failed to start logger", err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+func newTestWebhookMgr() *WebhookMgr {
+	if _, exist := modelObjs.ConfigObjectMap["confdclient"]; !exist {
+		modelObjs.ConfigObjectMap["confdclient"] = modelObjs.ConfdClient{}
+	}
+	return &WebhookMgr{
+		logger:   logger,
+		dbHdl:    objects.NewMemoryDbHandler(logger),
+		hooks:    make(map[string]*webhook),
+		states:   make(map[string]modelObjs.WebhookState),
+		incoming: make(chan Notification, INCOMING_SIZE),
+		stopCh:   make(chan struct{}),
+	}
+}
+
+func TestValidateWebhook(t *testing.T) {
+	newTestWebhookMgr()
+	objects.RegisterConfdEventType("Alarm")
+	invalid := []modelObjs.Webhook{
+		{URL: "http://chatops:8000/hook"},
+		{Name: "a", URL: "ftp://chatops/hook"},
+		{Name: "a", URL: "http:///hook"},
+		{Name: "a", URL: "http://chatops/hook", ObjectTypes: []string{"NoSuchObject"}},
+		{Name: "a", URL: "http://chatops/hook", EventTypes: []string{"nosuchevents"}},
+		{Name: "a", URL: "http://chatops/hook", MaxRetries: -1},
+	}
+	for _, cfg := range invalid {
+		if validateWebhook(cfg) == nil {
+			t.Error("Accepted invalid webhook", cfg)
+		}
+	}
+	cfg := modelObjs.Webhook{Name: "a", URL: "https://chatops/hook", ObjectTypes: []string{"ConfdClient"},
+		EventTypes: []string{"*", "Alarm"}}
+	if err := validateWebhook(cfg); err != nil {
+		t.Error("Rejected valid webhook", err)
+	}
+}
+
+func TestEncodeChangeScrubsSecrets(t *testing.T) {
+	data, err := encodeChange(clients.ObjectChange{
+		Op:         clients.OBJECT_CHANGE_UPDATE,
+		ObjectType: "User",
+		OldObj:     modelObjs.User{UserName: "ops", Password: "old"},
+		NewObj:     modelObjs.User{UserName: "ops", Password: "new"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "old") || strings.Contains(string(data), "new") ||
+		!strings.Contains(string(data), `"UserName":"ops"`) {
+		t.Error("Secrets not scrubbed from change", string(data))
+	}
+}
+
+func TestPrepareObjectSecret(t *testing.T) {
+	mgr := newTestWebhookMgr()
+	cfg := modelObjs.Webhook{Name: "a", URL: "http://chatops/hook", Secret: "s3cret"}
+	obj, err := mgr.PrepareObject(nil, cfg)
+	if err != nil || obj.(modelObjs.Webhook).Secret != auth.SECRET_MASK {
+		t.Fatal("Secret not masked", obj, err)
+	}
+	if secret, _ := mgr.dbHdl.Do("GET", SECRET_KEY_PREFIX+"a"); string(secret.([]byte)) != "s3cret" {
+		t.Error("Secret not stored, got", secret)
+	}
+	if _, err := mgr.PrepareObject(obj, obj); err != nil {
+		t.Error("Update with masked secret failed", err)
+	}
+	if secret, _ := mgr.dbHdl.Do("GET", SECRET_KEY_PREFIX+"a"); string(secret.([]byte)) != "s3cret" {
+		t.Error("Masked update changed the secret, got", secret)
+	}
+	// As by RestoreDatabase, which deletes the webhook and creates it again
+	if err := mgr.ApplyObject(clients.OBJECT_CHANGE_DELETE, obj, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mgr.PrepareObject(nil, obj); err != nil {
+		t.Error("Create with masked secret of a stored secret failed", err)
+	}
+	other := obj.(modelObjs.Webhook)
+	other.Name = "b"
+	if _, err := mgr.PrepareObject(nil, other); err == nil {
+		t.Error("Create with masked secret accepted without a stored secret")
+	}
+}
+
+func TestDequeueById(t *testing.T) {
+	mgr := newTestWebhookMgr()
+	for idx := 0; idx < 2; idx++ {
+		if _, err := mgr.enqueue("a", Notification{Type: NOTIFICATION_EVENT}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, id, ok := mgr.queueHead("a")
+	if !ok {
+		t.Fatal("Queue empty")
+	}
+	// The head was dropped and replaced while being delivered
+	mgr.dequeue("a", id+"0")
+	if _, headId, _ := mgr.queueHead("a"); headId != id || mgr.queueLength("a") != 2 {
+		t.Error("Dequeued a notification which was not delivered")
+	}
+	mgr.dequeue("a", id)
+	if _, headId, _ := mgr.queueHead("a"); headId == id || mgr.queueLength("a") != 1 {
+		t.Error("Delivered notification not dequeued")
+	}
+}
+
+type testEndpoint struct {
+	mutex     sync.Mutex
+	failures  int
+	received  []Notification
+	signature string
+}
+
+func (endpoint *testEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	endpoint.mutex.Lock()
+	defer endpoint.mutex.Unlock()
+	if endpoint.failures > 0 {
+		endpoint.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	var notification Notification
+	json.Unmarshal(body, &notification)
+	endpoint.received = append(endpoint.received, notification)
+	endpoint.signature = r.Header.Get(SIGNATURE_HEADER)
+	if endpoint.signature != Sign([]byte("s3cret"), body) {
+		endpoint.signature = "invalid"
+	}
+}
+
+func (endpoint *testEndpoint) count() int {
+	endpoint.mutex.Lock()
+	defer endpoint.mutex.Unlock()
+	return len(endpoint.received)
+}
+
+func TestDeliveryWithRetry(t *testing.T) {
+	endpoint := &testEndpoint{failures: 2}
+	server := httptest.NewServer(endpoint)
+	defer server.Close()
+	mgr := newTestWebhookMgr()
+	cfg, err := mgr.PrepareObject(nil, modelObjs.Webhook{Name: "chatops", URL: server.URL, Enable: true,
+		Secret: "s3cret", ObjectTypes: []string{"ConfdClient"}, RetryInitialInterval: 10, RetryMaxInterval: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr.ApplyObject(clients.OBJECT_CHANGE_CREATE, nil, cfg)
+	defer mgr.Stop()
+
+	mgr.objectChanged(clients.ObjectChange{Op: clients.OBJECT_CHANGE_CREATE, ObjectType: "User",
+		NewObj: modelObjs.User{UserName: "ops"}})
+	mgr.objectChanged(clients.ObjectChange{Op: clients.OBJECT_CHANGE_CREATE, ObjectType: "ConfdClient",
+		NewObj: modelObjs.ConfdClient{Name: "bgpd"}})
+	for len(mgr.incoming) > 0 {
+		mgr.queueNotification(<-mgr.incoming, nil)
+	}
+	for start := time.Now(); endpoint.count() == 0 && time.Since(start) < 5*time.Second; {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if endpoint.count() != 1 || endpoint.received[0].Type != NOTIFICATION_CONFIG_CHANGE ||
+		!strings.Contains(string(endpoint.received[0].Change), "bgpd") {
+		t.Fatal("Expected the ConfdClient change, got", endpoint.received)
+	}
+	if endpoint.signature == "invalid" || endpoint.signature == "" {
+		t.Error("Notification not signed with the secret")
+	}
+	states := mgr.GetStates()
+	if len(states) != 1 || states[0].Delivered != 1 || states[0].Failed != 2 || states[0].Pending != 0 ||
+		states[0].LastStatusCode != http.StatusOK {
+		t.Error("Unexpected delivery state", states)
+	}
+}
+
+func TestDropAfterMaxRetries(t *testing.T) {
+	endpoint := &testEndpoint{failures: 100}
+	server := httptest.NewServer(endpoint)
+	defer server.Close()
+	mgr := newTestWebhookMgr()
+	mgr.ApplyObject(clients.OBJECT_CHANGE_CREATE, nil, modelObjs.Webhook{Name: "chatops", URL: server.URL,
+		Enable: true, ObjectTypes: []string{"*"}, MaxRetries: 1, RetryInitialInterval: 10})
+	defer mgr.Stop()
+	mgr.queueNotification(Notification{Type: NOTIFICATION_CONFIG_CHANGE, objectType: "User"}, nil)
+	var states []modelObjs.WebhookState
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		if states = mgr.GetStates(); states[0].Dropped == 1 {
+			break
+		}
+	}
+	if states[0].Dropped != 1 || states[0].Failed != 2 || states[0].Pending != 0 {
+		t.Error("Expected notification dropped after 2 attempts, got", states)
+	}
+}